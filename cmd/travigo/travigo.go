@@ -8,9 +8,11 @@ import (
 	"github.com/travigo/travigo/pkg/dataimporter"
 	"github.com/travigo/travigo/pkg/datalinker"
 	"github.com/travigo/travigo/pkg/dbwatch"
+	"github.com/travigo/travigo/pkg/dev"
 	"github.com/travigo/travigo/pkg/events"
 	"github.com/travigo/travigo/pkg/indexer"
 	"github.com/travigo/travigo/pkg/notify"
+	"github.com/travigo/travigo/pkg/pipeline"
 	"github.com/travigo/travigo/pkg/realtime"
 	stats "github.com/travigo/travigo/pkg/stats/cli"
 
@@ -52,6 +54,9 @@ func main() {
 			dbwatch.RegisterCLI(),
 			indexer.RegisterCLI(),
 			datalinker.RegisterCLI(),
+			pipeline.RegisterCLI(),
+			transforms.RegisterCLI(),
+			dev.RegisterCLI(),
 		},
 	}
 
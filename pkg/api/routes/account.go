@@ -2,6 +2,10 @@ package routes
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/mail"
+	"net/url"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,11 +17,34 @@ import (
 
 func AccountRouter(router fiber.Router) {
 	router.Post("/notificationtoken", postNotificationToken)
+	router.Get("/devices", listDevices)
+	router.Delete("/devices/:identifier", deleteDevice)
+	router.Post("/notificationemail", postNotificationEmail)
+	router.Post("/notificationwebhook", postNotificationWebhook)
+
+	router.Get("/subscriptions", listSubscriptions)
+	router.Post("/subscriptions", createSubscription)
+	router.Get("/subscriptions/:identifier", getSubscription)
+	router.Put("/subscriptions/:identifier", updateSubscription)
+	router.Delete("/subscriptions/:identifier", deleteSubscription)
+
+	router.Get("/tracking", listTrackingSubscriptions)
+	router.Post("/tracking", createTrackingSubscription)
+	router.Delete("/tracking/:identifier", deleteTrackingSubscription)
+
+	router.Get("/notifications", listNotificationHistory)
+	router.Get("/notificationpreferences", getNotificationPreferences)
+	router.Put("/notificationpreferences", putNotificationPreferences)
 }
 
 func postNotificationToken(c *fiber.Ctx) error {
 	var requestBody struct {
 		Token string
+
+		DeviceID   string
+		DeviceName string
+		Platform   string
+		AppVersion string
 	}
 	c.BodyParser(&requestBody)
 
@@ -37,22 +64,211 @@ func postNotificationToken(c *fiber.Ctx) error {
 		})
 	}
 
+	now := time.Now()
+
 	userPushNotificationTarget := ctdf.UserPushNotificationTarget{
 		UserID:                userID,
 		PushNotificationToken: requestBody.Token,
-		ModificationDateTime:  time.Now(),
+		ModificationDateTime:  now,
+		DeviceID:              requestBody.DeviceID,
+		DeviceName:            requestBody.DeviceName,
+		Platform:              requestBody.Platform,
+		AppVersion:            requestBody.AppVersion,
 	}
 
 	userPushNotificationTargetCollection := database.GetCollection("user_push_notification_target")
 
+	// A token only ever belongs to one user so remove it from anyone that previously used this device
+	_, err := userPushNotificationTargetCollection.DeleteMany(context.Background(), bson.M{
+		"pushnotificationtoken": requestBody.Token,
+		"userid":                bson.M{"$ne": userID},
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err,
+		})
+	}
+
+	// Devices that identify themselves replace their old token when it's refreshed
+	filter := bson.M{"userid": userID, "pushnotificationtoken": requestBody.Token}
+	if requestBody.DeviceID != "" {
+		filter = bson.M{"userid": userID, "deviceid": requestBody.DeviceID}
+	}
+	update := bson.M{
+		"$set":         userPushNotificationTarget,
+		"$setOnInsert": bson.M{"creationdatetime": now},
+	}
+	opts := options.Update().SetUpsert(true)
+	_, err = userPushNotificationTargetCollection.UpdateOne(context.Background(), filter, update, opts)
+
+	if err == nil {
+		return c.JSON(fiber.Map{
+			"success": true,
+		})
+	} else {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err,
+		})
+	}
+}
+
+func listDevices(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+
+	userPushNotificationTargetCollection := database.GetCollection("user_push_notification_target")
+	cursor, err := userPushNotificationTargetCollection.Find(context.Background(), bson.M{"userid": userID})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	devices := []ctdf.UserPushNotificationTarget{}
+	if err := cursor.All(context.Background(), &devices); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(devices)
+}
+
+// deleteDevice removes a device by its DeviceID or push token, eg. when logging out
+func deleteDevice(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+	identifier := c.Params("identifier")
+
+	userPushNotificationTargetCollection := database.GetCollection("user_push_notification_target")
+	result, err := userPushNotificationTargetCollection.DeleteMany(context.Background(), bson.M{
+		"userid": userID,
+		"$or": bson.A{
+			bson.M{"deviceid": identifier},
+			bson.M{"pushnotificationtoken": identifier},
+		},
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"error": "Device not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+func postNotificationEmail(c *fiber.Ctx) error {
+	var requestBody struct {
+		Email string
+	}
+	c.BodyParser(&requestBody)
+
+	userID := c.Locals("account_userid").(string)
+
+	if userID == "" {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": "No userid set",
+		})
+	}
+
+	// Only the address itself is stored, not a display name or surrounding whitespace
+	parsedEmail, err := mail.ParseAddress(requestBody.Email)
+	if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": "Invalid email address",
+		})
+	}
+
+	// Setting the address again clears any previous bounce so that the user can fix a broken address
+	userEmailNotificationTarget := ctdf.UserEmailNotificationTarget{
+		UserID:               userID,
+		EmailAddress:         parsedEmail.Address,
+		ModificationDateTime: time.Now(),
+	}
+
+	userEmailNotificationTargetCollection := database.GetCollection("user_email_notification_target")
+
+	filter := bson.M{"userid": userID}
+	update := bson.M{"$set": userEmailNotificationTarget}
+	opts := options.Update().SetUpsert(true)
+	_, err = userEmailNotificationTargetCollection.UpdateOne(context.Background(), filter, update, opts)
+
+	if err == nil {
+		return c.JSON(fiber.Map{
+			"success": true,
+		})
+	} else {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err,
+		})
+	}
+}
+
+func postNotificationWebhook(c *fiber.Ctx) error {
+	var requestBody struct {
+		URL string
+	}
+	c.BodyParser(&requestBody)
+
+	userID := c.Locals("account_userid").(string)
+
+	if userID == "" {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": "No userid set",
+		})
+	}
+
+	webhookURL, err := url.Parse(requestBody.URL)
+	if err != nil || webhookURL.Scheme != "https" || webhookURL.Host == "" {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": "Invalid webhook URL, must be https",
+		})
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err,
+		})
+	}
+
+	// Registering again generates a new secret and re-enables a previously disabled endpoint
+	userWebhookNotificationTarget := ctdf.UserWebhookNotificationTarget{
+		UserID:               userID,
+		URL:                  webhookURL.String(),
+		Secret:               hex.EncodeToString(secretBytes),
+		ModificationDateTime: time.Now(),
+	}
+
+	userWebhookNotificationTargetCollection := database.GetCollection("user_webhook_notification_target")
+
 	filter := bson.M{"userid": userID}
-	update := bson.M{"$set": userPushNotificationTarget}
+	update := bson.M{"$set": userWebhookNotificationTarget}
 	opts := options.Update().SetUpsert(true)
-	_, err := userPushNotificationTargetCollection.UpdateOne(context.Background(), filter, update, opts)
+	_, err = userWebhookNotificationTargetCollection.UpdateOne(context.Background(), filter, update, opts)
 
 	if err == nil {
 		return c.JSON(fiber.Map{
 			"success": true,
+			"secret":  userWebhookNotificationTarget.Secret,
 		})
 	} else {
 		c.SendStatus(fiber.StatusInternalServerError)
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func newAccountTestApp() *fiber.App {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("account_userid", c.Get("X-Test-User"))
+		return c.Next()
+	})
+	AccountRouter(app.Group("/account"))
+
+	return app
+}
+
+func TestNotificationDevices(t *testing.T) {
+	database.ConnectMemory()
+
+	app := newAccountTestApp()
+
+	for _, test := range []struct {
+		name    string
+		method  string
+		path    string
+		user    string
+		body    string
+		status  int
+		devices map[string][]string
+	}{
+		{
+			"register a device", "POST", "/account/notificationtoken", "user-a",
+			`{"Token": "token-1", "DeviceID": "phone"}`, fiber.StatusOK,
+			map[string][]string{"user-a": {"token-1"}},
+		},
+		{
+			"register a second device", "POST", "/account/notificationtoken", "user-a",
+			`{"Token": "token-2", "DeviceID": "tablet"}`, fiber.StatusOK,
+			map[string][]string{"user-a": {"token-1", "token-2"}},
+		},
+		{
+			"refreshed token replaces the device token", "POST", "/account/notificationtoken", "user-a",
+			`{"Token": "token-3", "DeviceID": "phone"}`, fiber.StatusOK,
+			map[string][]string{"user-a": {"token-2", "token-3"}},
+		},
+		{
+			"device without an id", "POST", "/account/notificationtoken", "user-a",
+			`{"Token": "token-4"}`, fiber.StatusOK,
+			map[string][]string{"user-a": {"token-2", "token-3", "token-4"}},
+		},
+		{
+			"token moves to a new user", "POST", "/account/notificationtoken", "user-b",
+			`{"Token": "token-2", "DeviceID": "tablet"}`, fiber.StatusOK,
+			map[string][]string{"user-a": {"token-3", "token-4"}, "user-b": {"token-2"}},
+		},
+		{
+			"delete by device id", "DELETE", "/account/devices/phone", "user-a",
+			"", fiber.StatusOK,
+			map[string][]string{"user-a": {"token-4"}, "user-b": {"token-2"}},
+		},
+		{
+			"delete by token", "DELETE", "/account/devices/token-4", "user-a",
+			"", fiber.StatusOK,
+			map[string][]string{"user-a": nil, "user-b": {"token-2"}},
+		},
+		{
+			"can't delete another users device", "DELETE", "/account/devices/tablet", "user-a",
+			"", fiber.StatusNotFound,
+			map[string][]string{"user-a": nil, "user-b": {"token-2"}},
+		},
+	} {
+		request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("X-Test-User", test.user)
+
+		response, err := app.Test(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != test.status {
+			t.Errorf("%s: expected status %d, got %d", test.name, test.status, response.StatusCode)
+		}
+
+		for user, expectedTokens := range test.devices {
+			request := httptest.NewRequest("GET", "/account/devices", nil)
+			request.Header.Set("X-Test-User", user)
+
+			response, err := app.Test(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var devices []ctdf.UserPushNotificationTarget
+			if err := json.NewDecoder(response.Body).Decode(&devices); err != nil {
+				t.Fatal(err)
+			}
+
+			var tokens []string
+			for _, device := range devices {
+				tokens = append(tokens, device.PushNotificationToken)
+			}
+			sort.Strings(tokens)
+
+			if strings.Join(tokens, ",") != strings.Join(expectedTokens, ",") {
+				t.Errorf("%s: expected %s to have tokens %v, got %v", test.name, user, expectedTokens, tokens)
+			}
+		}
+	}
+
+	var device ctdf.UserPushNotificationTarget
+	database.GetCollection("user_push_notification_target").FindOne(context.Background(), bson.M{"pushnotificationtoken": "token-2"}).Decode(&device)
+	if device.DeviceID != "tablet" || device.CreationDateTime.IsZero() {
+		t.Errorf("expected the device details to be stored, got %+v", device)
+	}
+}
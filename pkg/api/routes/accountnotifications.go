@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func listNotificationHistory(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	userNotificationHistoryCollection := database.GetCollection("user_notification_history")
+	opts := options.Find().SetSort(bson.D{{Key: "creationdatetime", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := userNotificationHistoryCollection.Find(context.Background(), bson.M{"userid": userID}, opts)
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	history := []ctdf.UserNotificationHistory{}
+	if err := cursor.All(context.Background(), &history); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(history)
+}
+
+func getNotificationPreferences(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+
+	preferences := ctdf.UserNotificationPreferences{
+		UserID: userID,
+	}
+
+	userNotificationPreferencesCollection := database.GetCollection("user_notification_preferences")
+	userNotificationPreferencesCollection.FindOne(context.Background(), bson.M{"userid": userID}).Decode(&preferences)
+
+	return c.JSON(preferences)
+}
+
+func putNotificationPreferences(c *fiber.Ctx) error {
+	var preferences ctdf.UserNotificationPreferences
+	if err := c.BodyParser(&preferences); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	preferences.UserID = c.Locals("account_userid").(string)
+	preferences.ModificationDateTime = time.Now()
+
+	if err := preferences.Validate(); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userNotificationPreferencesCollection := database.GetCollection("user_notification_preferences")
+
+	filter := bson.M{"userid": preferences.UserID}
+	update := bson.M{"$set": preferences}
+	opts := options.Update().SetUpsert(true)
+	_, err := userNotificationPreferencesCollection.UpdateOne(context.Background(), filter, update, opts)
+
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(preferences)
+}
@@ -0,0 +1,189 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type userEventSubscriptionRequest struct {
+	EventType        ctdf.EventType
+	NotificationType ctdf.NotificationType
+
+	Expression string
+
+	DedupWindowMinutes int
+}
+
+func listSubscriptions(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	cursor, err := userEventSubscriptionCollection.Find(context.Background(), bson.M{"userid": userID})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	subscriptions := []ctdf.UserEventSubscription{}
+	if err := cursor.All(context.Background(), &subscriptions); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(subscriptions)
+}
+
+func getSubscription(c *fiber.Ctx) error {
+	subscription, err := findUserSubscription(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"error": "Subscription not found",
+		})
+	}
+
+	return c.JSON(subscription)
+}
+
+func createSubscription(c *fiber.Ctx) error {
+	var requestBody userEventSubscriptionRequest
+	if err := c.BodyParser(&requestBody); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	now := time.Now()
+
+	subscription := ctdf.UserEventSubscription{
+		PrimaryIdentifier:    primitive.NewObjectID().Hex(),
+		UserID:               c.Locals("account_userid").(string),
+		CreationDateTime:     now,
+		ModificationDateTime: now,
+		EventType:            requestBody.EventType,
+		NotificationType:     requestBody.NotificationType,
+		Expression:           requestBody.Expression,
+		DedupWindowMinutes:   requestBody.DedupWindowMinutes,
+	}
+
+	if err := subscription.Validate(); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	if _, err := userEventSubscriptionCollection.InsertOne(context.Background(), subscription); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Status(fiber.StatusCreated)
+	return c.JSON(subscription)
+}
+
+func updateSubscription(c *fiber.Ctx) error {
+	subscription, err := findUserSubscription(c)
+	if err != nil {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"error": "Subscription not found",
+		})
+	}
+
+	var requestBody userEventSubscriptionRequest
+	if err := c.BodyParser(&requestBody); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	// Only overwrite the fields that have been provided
+	if requestBody.EventType != "" {
+		subscription.EventType = requestBody.EventType
+	}
+	if requestBody.NotificationType != "" {
+		subscription.NotificationType = requestBody.NotificationType
+	}
+	if requestBody.Expression != "" {
+		subscription.Expression = requestBody.Expression
+	}
+	if requestBody.DedupWindowMinutes != 0 {
+		subscription.DedupWindowMinutes = requestBody.DedupWindowMinutes
+	}
+	subscription.ModificationDateTime = time.Now()
+
+	if err := subscription.Validate(); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	_, err = userEventSubscriptionCollection.UpdateOne(context.Background(), bson.M{
+		"primaryidentifier": subscription.PrimaryIdentifier,
+		"userid":            subscription.UserID,
+	}, bson.M{"$set": subscription})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(subscription)
+}
+
+func deleteSubscription(c *fiber.Ctx) error {
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	result, err := userEventSubscriptionCollection.DeleteOne(context.Background(), bson.M{
+		"primaryidentifier": c.Params("identifier"),
+		"userid":            c.Locals("account_userid").(string),
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"error": "Subscription not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// findUserSubscription only returns subscriptions owned by the requesting user
+func findUserSubscription(c *fiber.Ctx) (*ctdf.UserEventSubscription, error) {
+	var subscription *ctdf.UserEventSubscription
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	err := userEventSubscriptionCollection.FindOne(context.Background(), bson.M{
+		"primaryidentifier": c.Params("identifier"),
+		"userid":            c.Locals("account_userid").(string),
+	}).Decode(&subscription)
+
+	return subscription, err
+}
@@ -0,0 +1,217 @@
+package routes
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/dataaggregator"
+	"github.com/travigo/travigo/pkg/dataaggregator/query"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// How long after the scheduled arrival at the final stop we keep tracking a journey to allow for delays
+const journeyTrackingExpiryBuffer = 3 * time.Hour
+
+// How long stop & service tracking lasts as there's no single journey to expire with
+const stopServiceTrackingDuration = 24 * time.Hour
+
+func listTrackingSubscriptions(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+
+	trackingSubscriptionCollection := database.GetCollection("user_journey_tracking_subscription")
+	cursor, err := trackingSubscriptionCollection.Find(context.Background(), bson.M{
+		"userid":         userID,
+		"expirydatetime": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	trackingSubscriptions := []ctdf.UserJourneyTrackingSubscription{}
+	if err := cursor.All(context.Background(), &trackingSubscriptions); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(trackingSubscriptions)
+}
+
+func createTrackingSubscription(c *fiber.Ctx) error {
+	var requestBody struct {
+		NotificationType ctdf.NotificationType
+
+		JourneyRef     string
+		JourneyRunDate string
+
+		StopRef    string
+		ServiceRef string
+	}
+	if err := c.BodyParser(&requestBody); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	now := time.Now()
+
+	trackingSubscription := ctdf.UserJourneyTrackingSubscription{
+		PrimaryIdentifier: primitive.NewObjectID().Hex(),
+		UserID:            c.Locals("account_userid").(string),
+		CreationDateTime:  now,
+		NotificationType:  requestBody.NotificationType,
+		JourneyRef:        requestBody.JourneyRef,
+		StopRef:           requestBody.StopRef,
+		ServiceRef:        requestBody.ServiceRef,
+	}
+
+	if requestBody.JourneyRunDate != "" {
+		journeyRunDate, err := time.Parse("2006-01-02", requestBody.JourneyRunDate)
+		if err != nil {
+			c.SendStatus(fiber.StatusBadRequest)
+			return c.JSON(fiber.Map{
+				"error": "JourneyRunDate must be in the format YYYY-MM-DD",
+			})
+		}
+		trackingSubscription.JourneyRunDate = journeyRunDate
+	}
+
+	if err := trackingSubscription.Validate(); err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if trackingSubscription.JourneyRef != "" {
+		journey, err := dataaggregator.Lookup[*ctdf.Journey](query.Journey{
+			PrimaryIdentifier: trackingSubscription.JourneyRef,
+		})
+		if err != nil {
+			c.SendStatus(fiber.StatusNotFound)
+			return c.JSON(fiber.Map{
+				"error": "Journey not found",
+			})
+		}
+
+		trackingSubscription.ExpiryDateTime = journeyTrackingExpiry(journey, trackingSubscription.JourneyRunDate)
+	} else {
+		trackingSubscription.ExpiryDateTime = now.Add(stopServiceTrackingDuration)
+	}
+
+	if trackingSubscription.ExpiryDateTime.Before(now) {
+		c.SendStatus(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"error": "Journey has already finished",
+		})
+	}
+
+	var eventSubscriptionOperations []mongo.WriteModel
+	for _, eventSubscription := range trackingSubscription.GenerateEventSubscriptions() {
+		if err := eventSubscription.Validate(); err != nil {
+			c.SendStatus(fiber.StatusInternalServerError)
+			return c.JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+
+		eventSubscriptionOperations = append(eventSubscriptionOperations, mongo.NewInsertOneModel().SetDocument(eventSubscription))
+	}
+
+	trackingSubscriptionCollection := database.GetCollection("user_journey_tracking_subscription")
+	if _, err := trackingSubscriptionCollection.InsertOne(context.Background(), trackingSubscription); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	if _, err := userEventSubscriptionCollection.BulkWrite(context.Background(), eventSubscriptionOperations); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	c.Status(fiber.StatusCreated)
+	return c.JSON(trackingSubscription)
+}
+
+func deleteTrackingSubscription(c *fiber.Ctx) error {
+	userID := c.Locals("account_userid").(string)
+	identifier := c.Params("identifier")
+
+	trackingSubscriptionCollection := database.GetCollection("user_journey_tracking_subscription")
+	result, err := trackingSubscriptionCollection.DeleteOne(context.Background(), bson.M{
+		"primaryidentifier": identifier,
+		"userid":            userID,
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if result.DeletedCount == 0 {
+		c.SendStatus(fiber.StatusNotFound)
+		return c.JSON(fiber.Map{
+			"error": "Tracking subscription not found",
+		})
+	}
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	_, err = userEventSubscriptionCollection.DeleteMany(context.Background(), bson.M{
+		"trackingsubscriptionref": identifier,
+		"userid":                  userID,
+	})
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
+
+// journeyTrackingExpiry works out when the journey is scheduled to arrive at its final stop on the run date
+func journeyTrackingExpiry(journey *ctdf.Journey, journeyRunDate time.Time) time.Time {
+	timezone, err := time.LoadLocation(journey.DepartureTimezone)
+	if err != nil {
+		timezone = time.UTC
+	}
+
+	runDate := time.Date(journeyRunDate.Year(), journeyRunDate.Month(), journeyRunDate.Day(), 0, 0, 0, 0, timezone)
+	endTime := journey.DepartureTime
+
+	if len(journey.Path) > 0 {
+		lastArrival := journey.Path[len(journey.Path)-1].DestinationArrivalTime
+
+		// Journeys running past midnight arrive at an earlier time of day than they depart
+		if timeOfDay(lastArrival) < timeOfDay(journey.DepartureTime) {
+			runDate = runDate.AddDate(0, 0, 1)
+		}
+
+		endTime = lastArrival
+	}
+
+	return runDate.Add(timeOfDay(endTime)).Add(journeyTrackingExpiryBuffer)
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
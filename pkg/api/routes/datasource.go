@@ -1,14 +1,24 @@
 package routes
 
 import (
+	"context"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/dataaggregator"
 	"github.com/travigo/travigo/pkg/dataaggregator/query"
+	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/importruns"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func DatasourcesRouter(router fiber.Router) {
 	router.Get("/dataset/:identifier", getDataset)
+	router.Get("/dataset/:identifier/changes", getDatasetTimetableChanges)
+	router.Get("/dataset/:identifier/runs", getDatasetImportRuns)
+	router.Get("/dataset/:identifier/status", getDatasetImportStatus)
 	router.Get("/provider/:identifier", getProvider)
 }
 
@@ -47,3 +57,74 @@ func getProvider(c *fiber.Ctx) error {
 		return c.JSON(datasource)
 	}
 }
+
+func getDatasetTimetableChanges(c *fiber.Ctx) error {
+	identifier := c.Params("identifier")
+
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	query := bson.M{"datasetid": identifier}
+	if serviceRef := c.Query("service"); serviceRef != "" {
+		query["services.serviceref"] = serviceRef
+	}
+
+	timetableChangesCollection := database.GetCollection("timetable_changes")
+	opts := options.Find().SetSort(bson.D{{Key: "creationdatetime", Value: -1}}).SetLimit(int64(limit))
+	cursor, err := timetableChangesCollection.Find(context.Background(), query, opts)
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	changes := []ctdf.TimetableChange{}
+	if err := cursor.All(context.Background(), &changes); err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(changes)
+}
+
+func getDatasetImportRuns(c *fiber.Ctx) error {
+	identifier := c.Params("identifier")
+
+	limit := c.QueryInt("limit", 20)
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	runs, err := importruns.GetRuns(identifier, ctdf.DatasetImportRunStatus(c.Query("status")), int64(limit))
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(runs)
+}
+
+func getDatasetImportStatus(c *fiber.Ctx) error {
+	identifier := c.Params("identifier")
+
+	var dataset *datasets.DataSet
+	dataset, err := dataaggregator.Lookup[*datasets.DataSet](query.DataSet{
+		DataSetID: identifier,
+	})
+
+	if err != nil {
+		c.SendStatus(404)
+		return c.JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	return c.JSON(importruns.GetStatus(dataset))
+}
@@ -129,7 +129,10 @@ func getOperatorServices(c *fiber.Ctx) error {
 		var services []*ctdf.Service
 
 		servicesCollection := database.GetCollection("services")
-		cursor, _ := servicesCollection.Find(context.Background(), bson.M{"operatorref": bson.M{"$in": operator.OtherIdentifiers}})
+		cursor, _ := servicesCollection.Find(context.Background(), bson.M{
+			"operatorref": bson.M{"$in": operator.OtherIdentifiers},
+			"duplicateof": bson.M{"$exists": false},
+		})
 
 		for cursor.Next(context.Background()) {
 			var service ctdf.Service
@@ -198,8 +198,8 @@ func getStopDepartures(c *fiber.Ctx) error {
 	}
 
 	currentTime := time.Now()
-	// Transforming the whole document is incredibly ineffecient
-	// Instead just transform the Operator & Service as those are the key values
+	// Import transforms are already stored with the records so only the presentation ones are applied here
+	// Transforming the whole document is incredibly ineffecient, instead just transform the Operator & Service
 	for _, item := range departureBoard {
 		item.Journey.GetOperator()
 		transforms.Transform(item.Journey.Operator, 1)
@@ -7,10 +7,10 @@ import (
 
 	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 )
 
-type RedisConsumer struct {
+type QueueConsumer struct {
 	QueueName string
 
 	NumberConsumers int
@@ -21,16 +21,16 @@ type RedisConsumer struct {
 	Consumer rmq.BatchConsumer
 }
 
-func (c *RedisConsumer) Setup() {
+func (c *QueueConsumer) Setup() {
 	c.startConsumers()
 	//c.startStatsServer()
 }
 
-func (c *RedisConsumer) startConsumers() {
+func (c *QueueConsumer) startConsumers() {
 	// Run the background consumers
 	log.Info().Str("queue", c.QueueName).Msg("Starting consumers")
 
-	queue, err := redis_client.QueueConnection.OpenQueue(c.QueueName)
+	queue, err := queue_client.QueueConnection.OpenQueue(c.QueueName)
 	if err != nil {
 		panic(err)
 	}
@@ -42,7 +42,7 @@ func (c *RedisConsumer) startConsumers() {
 		go c.startQueueConsumer(queue, i)
 	}
 }
-func (c *RedisConsumer) startQueueConsumer(queue rmq.Queue, id int) {
+func (c *QueueConsumer) startQueueConsumer(queue queue_client.Queue, id int) {
 	log.Info().Msgf("Starting %s consumer %d", c.QueueName, id)
 
 	if _, err := queue.AddBatchConsumer(fmt.Sprintf("%s-%d", c.QueueName, id), int64(c.BatchSize), c.Timeout, c.Consumer); err != nil {
@@ -50,9 +50,9 @@ func (c *RedisConsumer) startQueueConsumer(queue rmq.Queue, id int) {
 	}
 }
 
-func (c *RedisConsumer) startStatsServer() {
+func (c *QueueConsumer) startStatsServer() {
 	endpoint := fmt.Sprintf("/%s/stats", c.QueueName)
-	http.Handle(endpoint, NewStatsHandler(redis_client.QueueConnection))
+	http.Handle(endpoint, NewStatsHandler(queue_client.QueueConnection))
 	http.Handle("/health", NewHealthHandler())
 
 	log.Info().Msgf("Stats server listening on http://localhost:3333%s}", endpoint)
@@ -6,34 +6,30 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 )
 
 type StatsServerHandler struct {
-	redisConnection rmq.Connection
+	queueConnection queue_client.Connection
 }
 
-func NewStatsHandler(connection rmq.Connection) *StatsServerHandler {
-	return &StatsServerHandler{redisConnection: connection}
+func NewStatsHandler(connection queue_client.Connection) *StatsServerHandler {
+	return &StatsServerHandler{queueConnection: connection}
 }
 func (handler *StatsServerHandler) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
-	// get redis queue stats
-	layout := request.FormValue("layout")
 	refresh := request.FormValue("refresh")
 
-	queues, err := handler.redisConnection.GetOpenQueues()
+	stats, err := handler.queueConnection.Stats()
 	if err != nil {
-		panic(err)
-	}
+		writer.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(writer, err)
 
-	stats, err := handler.redisConnection.CollectStats(queues)
-	if err != nil {
-		panic(err)
+		return
 	}
 
-	fmt.Fprint(writer, stats.GetHtml(layout, refresh))
+	queue_client.WriteStatsHTML(writer, stats, refresh)
 }
 
 type HealthHandler struct {
@@ -51,7 +47,7 @@ func (handler *HealthHandler) ServeHTTP(writer http.ResponseWriter, _ *http.Requ
 		return
 	}
 
-	testMongo := database.Instance.Client.Ping(context.Background(), nil)
+	testMongo := database.Ping()
 	if testMongo != nil {
 		writer.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprint(writer, testMongo)
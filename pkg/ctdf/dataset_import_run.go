@@ -0,0 +1,41 @@
+package ctdf
+
+import "time"
+
+type DatasetImportRunStatus string
+
+const (
+	DatasetImportRunStatusRunning DatasetImportRunStatus = "Running"
+	DatasetImportRunStatusSuccess DatasetImportRunStatus = "Success"
+	DatasetImportRunStatusFailed  DatasetImportRunStatus = "Failed"
+)
+
+// DatasetImportRun is a record of a single import of a dataset
+type DatasetImportRun struct {
+	PrimaryIdentifier string `groups:"basic"`
+	Dataset           string `groups:"basic"`
+
+	// What started the import, eg. schedule, pipeline, realtime, manual or rollback
+	Trigger string `groups:"basic"`
+
+	StartDateTime   time.Time `groups:"basic"`
+	EndDateTime     time.Time `groups:"basic" bson:",omitempty"`
+	DurationSeconds float64   `groups:"basic"`
+
+	Status DatasetImportRunStatus `groups:"basic"`
+	Error  string                 `groups:"basic" bson:",omitempty"`
+
+	// Whether the import actually changed the dataset or was skipped as the source hasn't changed
+	Changed bool `groups:"basic"`
+
+	BytesDownloaded int64 `groups:"basic"`
+
+	// Records written to each live collection when the import was promoted
+	Collections map[string]DatasetImportRunRecordCounts `groups:"basic" bson:",omitempty"`
+}
+
+type DatasetImportRunRecordCounts struct {
+	Inserted int64 `groups:"basic"`
+	Updated  int64 `groups:"basic"`
+	Deleted  int64 `groups:"basic"`
+}
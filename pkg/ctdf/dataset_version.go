@@ -6,5 +6,9 @@ type DatasetVersion struct {
 	Dataset      string
 	Hash         string
 	ETag         string
+	Timestamp    string
 	LastModified time.Time
+
+	// The version that was live before this one, kept so the dataset can be rolled back
+	Previous *DatasetVersion `bson:",omitempty"`
 }
@@ -1,6 +1,7 @@
 package ctdf
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -10,6 +11,32 @@ type Event struct {
 	Body      interface{}
 }
 
+// ExpressionEnv is what subscription expressions are run against, the body is decoded into the type
+// for the event so expressions are run against the same fields they were compiled against
+func (e *Event) ExpressionEnv() (map[string]interface{}, error) {
+	body := NewEventBody(e.Type)
+
+	if e.Body != nil {
+		bodyBytes, err := json.Marshal(e.Body)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(bodyBytes, body); err != nil {
+			return nil, err
+		}
+	}
+
+	return eventExpressionEnv(e.Type, e.Timestamp, body), nil
+}
+
+func eventExpressionEnv(eventType EventType, timestamp time.Time, body interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"Type":      eventType,
+		"Timestamp": timestamp,
+		"Body":      body,
+	}
+}
+
 type EventType string
 
 const (
@@ -22,8 +49,99 @@ const (
 	EventTypeRealtimeJourneyCancelled           = "RealtimeJourneyCancelled"
 	EventTypeRealtimeJourneyLocationTextChanged = "RealtimeJourneyLocationTextChanged"
 	EventTypeRealtimeJourneyNextStopChanged     = "RealtimeJourneyNextStopChanged"
+	EventTypeRealtimeJourneyReinstated          = "RealtimeJourneyReinstated"
+	EventTypeRealtimeJourneyStopCancelled       = "RealtimeJourneyStopCancelled"
+	EventTypeRealtimeJourneyDelayed             = "RealtimeJourneyDelayed"
+	EventTypeRealtimeJourneyDelayReduced        = "RealtimeJourneyDelayReduced"
+	EventTypeRealtimeJourneyStarted             = "RealtimeJourneyStarted"
+	EventTypeRealtimeJourneyCompleted           = "RealtimeJourneyCompleted"
+
+	EventTypeTimetableChanged = "TimetableChanged"
+
+	// Notifications combining events of different types, never published as an event itself
+	EventTypeDigest = "Digest"
 )
 
+var EventTypes = []EventType{
+	EventTypeServiceAlertCreated,
+	EventTypeRealtimeJourneyCreated,
+	EventTypeRealtimeJourneyActivelyTracked,
+	EventTypeRealtimeJourneyPlatformSet,
+	EventTypeRealtimeJourneyPlatformChanged,
+	EventTypeRealtimeJourneyCancelled,
+	EventTypeRealtimeJourneyLocationTextChanged,
+	EventTypeRealtimeJourneyNextStopChanged,
+	EventTypeRealtimeJourneyReinstated,
+	EventTypeRealtimeJourneyStopCancelled,
+	EventTypeRealtimeJourneyDelayed,
+	EventTypeRealtimeJourneyDelayReduced,
+	EventTypeRealtimeJourneyStarted,
+	EventTypeRealtimeJourneyCompleted,
+	EventTypeTimetableChanged,
+}
+
+func IsValidEventType(eventType EventType) bool {
+	for _, validEventType := range EventTypes {
+		if eventType == validEventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NewEventBody returns a pointer to the body type published for the event type
+func NewEventBody(eventType EventType) interface{} {
+	switch eventType {
+	case EventTypeServiceAlertCreated:
+		return &ServiceAlert{}
+	case EventTypeRealtimeJourneyPlatformSet, EventTypeRealtimeJourneyPlatformChanged:
+		return &RealtimeJourneyPlatformEventBody{}
+	case EventTypeRealtimeJourneyNextStopChanged:
+		return &RealtimeJourneyNextStopEventBody{}
+	case EventTypeRealtimeJourneyStopCancelled:
+		return &RealtimeJourneyStopEventBody{}
+	case EventTypeRealtimeJourneyDelayed, EventTypeRealtimeJourneyDelayReduced:
+		return &RealtimeJourneyDelayEventBody{}
+	case EventTypeRealtimeJourneyStarted, EventTypeRealtimeJourneyCompleted:
+		return &RealtimeJourneyEventBody{}
+	case EventTypeTimetableChanged:
+		return &TimetableChange{}
+	default:
+		// Created, cancelled & reinstated events have the RealtimeJourney itself as the body
+		return &RealtimeJourney{}
+	}
+}
+
+type RealtimeJourneyEventBody struct {
+	RealtimeJourney *RealtimeJourney
+}
+
+type RealtimeJourneyStopEventBody struct {
+	RealtimeJourney *RealtimeJourney
+	Stop            string
+}
+
+type RealtimeJourneyPlatformEventBody struct {
+	RealtimeJourney *RealtimeJourney
+	Stop            string
+	OldPlatform     string
+	NewPlatform     string
+}
+
+type RealtimeJourneyNextStopEventBody struct {
+	RealtimeJourney *RealtimeJourney
+	OldNextStop     string
+	NextStop        string
+}
+
+type RealtimeJourneyDelayEventBody struct {
+	RealtimeJourney *RealtimeJourney
+	OldDelay        int
+	Delay           int
+	Threshold       int
+}
+
 type EventNotificationData struct {
 	Title   string
 	Message string
@@ -50,6 +50,10 @@ type Journey struct {
 
 	// Detailed journey information
 	DetailedRailInformation *JourneyDetailedRail `groups:"detailed" bson:",omitempty"`
+
+	// Primary identifier of the same journey from a higher priority dataset, set by the services linker.
+	// Duplicates are kept so realtime feeds referencing them can be identified but are left out of departures
+	DuplicateOf string `groups:"internal" bson:",omitempty"`
 }
 
 func (j *Journey) GetReferences() {
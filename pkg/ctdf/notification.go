@@ -3,14 +3,19 @@ package ctdf
 type Notification struct {
 	TargetUser string
 	Type       NotificationType
+	EventType  EventType
 
 	Title   string
 	Message string
+
+	// Event is the original event that triggered the notification, delivered as-is to webhooks
+	Event *Event
 }
 
 type NotificationType string
 
 const (
-	NotificationTypePush  NotificationType = "Push"
-	NotificationTypeEmail                  = "Email"
+	NotificationTypePush    NotificationType = "Push"
+	NotificationTypeEmail   NotificationType = "Email"
+	NotificationTypeWebhook NotificationType = "Webhook"
 )
@@ -0,0 +1,28 @@
+package ctdf
+
+import "time"
+
+type NotificationDelivery struct {
+	TargetUser string
+	Type       NotificationType
+	EventType  EventType
+
+	// Target is the address the notification was delivered to (eg. email address or webhook URL)
+	Target string
+
+	Attempts           int
+	ResponseStatusCode int
+
+	Status       NotificationDeliveryStatus
+	ErrorMessage string
+
+	CreationDateTime time.Time
+}
+
+type NotificationDeliveryStatus string
+
+const (
+	NotificationDeliveryStatusSent    NotificationDeliveryStatus = "Sent"
+	NotificationDeliveryStatusFailed  NotificationDeliveryStatus = "Failed"
+	NotificationDeliveryStatusBounced NotificationDeliveryStatus = "Bounced"
+)
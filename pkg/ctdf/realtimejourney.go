@@ -1,7 +1,13 @@
 package ctdf
 
 import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
 var RealtimeJourneyIDFormat = "realtime-%s:%s"
@@ -38,6 +44,10 @@ type RealtimeJourney struct {
 	Stops  map[string]*RealtimeJourneyStops `groups:"basic"` // Historic & future estimates
 	Offset time.Duration                    `groups:"internal"`
 
+	// DelayThreshold is the highest delay threshold the offset has reached, it only changes when the delay crosses
+	// a threshold so dbwatch watches it rather than every offset update
+	DelayThreshold int `groups:"internal"`
+
 	Reliability RealtimeJourneyReliabilityType `groups:"basic"`
 
 	VehicleRef string `groups:"internal"`
@@ -122,6 +132,97 @@ func (r *RealtimeJourney) IsActive() bool {
 	return !((timeFromlastPathItemArrival < 0) && (distanceEndStopLocation < 150))
 }
 
+var defaultRealtimeJourneyDelayThresholds = []int{5, 10, 30}
+
+// GetRealtimeJourneyDelayThresholds reads the delay thresholds in minutes from TRAVIGO_REALTIME_DELAY_THRESHOLDS (eg. "5,10,30")
+func GetRealtimeJourneyDelayThresholds() []int {
+	thresholdsString := os.Getenv("TRAVIGO_REALTIME_DELAY_THRESHOLDS")
+	if thresholdsString == "" {
+		return defaultRealtimeJourneyDelayThresholds
+	}
+
+	var thresholds []int
+	for _, thresholdString := range strings.Split(thresholdsString, ",") {
+		threshold, err := strconv.Atoi(strings.TrimSpace(thresholdString))
+		if err != nil || threshold <= 0 {
+			log.Error().Str("threshold", thresholdString).Msg("Invalid delay threshold")
+			continue
+		}
+
+		thresholds = append(thresholds, threshold)
+	}
+	sort.Ints(thresholds)
+
+	return thresholds
+}
+
+// GetDelayThreshold returns the highest of the sorted thresholds the delay has reached, or 0 if it hasn't reached any
+func GetDelayThreshold(delay time.Duration, thresholds []int) int {
+	delayMinutes := int(delay.Minutes())
+
+	reached := 0
+	for _, threshold := range thresholds {
+		if delayMinutes >= threshold {
+			reached = threshold
+		}
+	}
+
+	return reached
+}
+
+// CurrentDelay is how late the journey is running, either from the tracked vehicle offset or
+// the difference between the estimated & scheduled arrival at the next stop
+func (r *RealtimeJourney) CurrentDelay() time.Duration {
+	if r.Offset != 0 {
+		return r.Offset
+	}
+
+	if r.Journey == nil {
+		return 0
+	}
+
+	for _, path := range r.Journey.Path {
+		realtimeStop := r.Stops[path.DestinationStopRef]
+		if realtimeStop == nil || realtimeStop.TimeType == RealtimeJourneyStopTimeHistorical || realtimeStop.ArrivalTime.IsZero() {
+			continue
+		}
+
+		scheduled := path.DestinationArrivalTime
+		estimated := realtimeStop.ArrivalTime
+
+		// Scheduled & estimated stop times have no date so compare the time of day, allowing for crossing midnight
+		delay := time.Duration(estimated.Hour()-scheduled.Hour())*time.Hour +
+			time.Duration(estimated.Minute()-scheduled.Minute())*time.Minute +
+			time.Duration(estimated.Second()-scheduled.Second())*time.Second
+		if delay > 12*time.Hour {
+			delay -= 24 * time.Hour
+		} else if delay < -12*time.Hour {
+			delay += 24 * time.Hour
+		}
+
+		return delay
+	}
+
+	return 0
+}
+
+// IsCompleted is true once the final stop of the journey has been visited
+func (r *RealtimeJourney) IsCompleted() bool {
+	if r.Journey == nil || len(r.Journey.Path) == 0 {
+		return false
+	}
+
+	lastStopRef := r.Journey.Path[len(r.Journey.Path)-1].DestinationStopRef
+
+	if r.DepartedStopRef == lastStopRef {
+		return true
+	}
+
+	lastStop := r.Stops[lastStopRef]
+
+	return lastStop != nil && lastStop.TimeType == RealtimeJourneyStopTimeHistorical
+}
+
 type RealtimeJourneyStops struct {
 	StopRef string `groups:"basic"`
 	Stop    *Stop  `groups:"basic" bson:"-"`
@@ -26,6 +26,9 @@ type Service struct {
 	StopNameOverrides map[string]string `groups:"internal"`
 
 	TransportType TransportType `groups:"basic,search,search-llm,stop-llm,departures-llm"`
+
+	// Primary identifier of the same service from a higher priority dataset, set by the services linker
+	DuplicateOf string `groups:"internal" bson:",omitempty"`
 }
 
 type Route struct {
@@ -0,0 +1,36 @@
+package ctdf
+
+import "time"
+
+// TimetableChange is a summary of what changed in the journeys of a dataset between two imports
+type TimetableChange struct {
+	PrimaryIdentifier string `groups:"basic"`
+
+	DataSetID         string `groups:"basic"`
+	Timestamp         string `groups:"basic"`
+	PreviousTimestamp string `groups:"basic"`
+
+	CreationDateTime time.Time `groups:"basic"`
+
+	JourneysAdded   int `groups:"basic"`
+	JourneysRemoved int `groups:"basic"`
+	JourneysRetimed int `groups:"basic"`
+
+	Services []TimetableServiceChange `groups:"basic"`
+}
+
+// TimetableServiceChange is the change summary for a single service within a TimetableChange
+type TimetableServiceChange struct {
+	ServiceRef string `groups:"basic"`
+
+	JourneysAdded   []string `groups:"basic"`
+	JourneysRemoved []string `groups:"basic"`
+	JourneysRetimed []string `groups:"basic"`
+
+	StopsAdded   []string `groups:"basic"`
+	StopsRemoved []string `groups:"basic"`
+}
+
+func (c *TimetableChange) HasChanges() bool {
+	return len(c.Services) > 0
+}
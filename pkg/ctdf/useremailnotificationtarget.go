@@ -0,0 +1,15 @@
+package ctdf
+
+import "time"
+
+type UserEmailNotificationTarget struct {
+	UserID               string
+	ModificationDateTime time.Time
+	EmailAddress         string
+
+	// Bounced is set when the mail server permanently rejects the address, no more emails are sent until it is updated
+	Bounced            bool
+	BouncedDateTime    time.Time
+	FailedDeliveries   int
+	LastFailureMessage string
+}
@@ -1,10 +1,59 @@
 package ctdf
 
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
 type UserEventSubscription struct {
-	UserID string
+	PrimaryIdentifier string
+	UserID            string
+
+	CreationDateTime     time.Time
+	ModificationDateTime time.Time
+	ExpiryDateTime       time.Time `bson:",omitempty"`
+
+	// TrackingSubscriptionRef is set when this was generated by a UserJourneyTrackingSubscription
+	TrackingSubscriptionRef string `bson:",omitempty"`
 
 	EventType        EventType
 	NotificationType NotificationType
 
 	Expression string
+
+	// DedupWindowMinutes overrides the users dedup window for notifications from this subscription
+	DedupWindowMinutes int `bson:",omitempty"`
+}
+
+// CompileExpression compiles the subscription expression against the Event schema with the body type of
+// the subscription's event type, so that references to unknown fields or expressions that don't return a boolean are caught.
+// The program must be run against Event.ExpressionEnv
+func (s *UserEventSubscription) CompileExpression() (*vm.Program, error) {
+	return expr.Compile(s.Expression, expr.Env(eventExpressionEnv(s.EventType, time.Time{}, NewEventBody(s.EventType))), expr.AsBool())
+}
+
+func (s *UserEventSubscription) Validate() error {
+	if !IsValidEventType(s.EventType) {
+		return errors.New(fmt.Sprintf("Unknown event type %s", s.EventType))
+	}
+
+	switch s.NotificationType {
+	case NotificationTypePush, NotificationTypeEmail, NotificationTypeWebhook:
+	default:
+		return errors.New(fmt.Sprintf("Unknown notification type %s", s.NotificationType))
+	}
+
+	if s.Expression == "" {
+		return errors.New("Expression must be set")
+	}
+
+	if _, err := s.CompileExpression(); err != nil {
+		return errors.New(fmt.Sprintf("Invalid expression: %s", err))
+	}
+
+	return nil
 }
@@ -0,0 +1,109 @@
+package ctdf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UserJourneyTrackingSubscription is a high level "track this journey" subscription that
+// generates the underlying UserEventSubscriptions for every event a traveller cares about
+type UserJourneyTrackingSubscription struct {
+	PrimaryIdentifier string
+	UserID            string
+
+	CreationDateTime time.Time
+	ExpiryDateTime   time.Time
+
+	NotificationType NotificationType
+
+	// Track a single journey on a specific date
+	JourneyRef     string
+	JourneyRunDate time.Time
+
+	// Or track every journey of a service calling at a stop
+	StopRef    string
+	ServiceRef string
+}
+
+// TrackedJourneyEventTypes are the events a journey tracking subscription follows
+var TrackedJourneyEventTypes = []EventType{
+	EventTypeRealtimeJourneyCancelled,
+	EventTypeRealtimeJourneyPlatformSet,
+	EventTypeRealtimeJourneyPlatformChanged,
+	EventTypeRealtimeJourneyNextStopChanged,
+	EventTypeRealtimeJourneyReinstated,
+	EventTypeRealtimeJourneyStopCancelled,
+	EventTypeRealtimeJourneyDelayed,
+	EventTypeRealtimeJourneyDelayReduced,
+}
+
+func (s *UserJourneyTrackingSubscription) Validate() error {
+	switch s.NotificationType {
+	case NotificationTypePush, NotificationTypeEmail, NotificationTypeWebhook:
+	default:
+		return errors.New(fmt.Sprintf("Unknown notification type %s", s.NotificationType))
+	}
+
+	if s.JourneyRef != "" {
+		if s.JourneyRunDate.IsZero() {
+			return errors.New("JourneyRunDate must be set when tracking a journey")
+		}
+	} else if s.StopRef == "" || s.ServiceRef == "" {
+		return errors.New("Either JourneyRef or both StopRef and ServiceRef must be set")
+	}
+
+	return nil
+}
+
+// GenerateEventSubscriptions creates one UserEventSubscription per tracked event type with an expression
+// matching this journey or stop & service, they share the expiry of the tracking subscription
+func (s *UserJourneyTrackingSubscription) GenerateEventSubscriptions() []UserEventSubscription {
+	var eventSubscriptions []UserEventSubscription
+
+	for _, eventType := range TrackedJourneyEventTypes {
+		eventSubscriptions = append(eventSubscriptions, UserEventSubscription{
+			PrimaryIdentifier:       fmt.Sprintf("%s-%s", s.PrimaryIdentifier, strings.ToLower(string(eventType))),
+			UserID:                  s.UserID,
+			CreationDateTime:        s.CreationDateTime,
+			ModificationDateTime:    s.CreationDateTime,
+			ExpiryDateTime:          s.ExpiryDateTime,
+			TrackingSubscriptionRef: s.PrimaryIdentifier,
+			EventType:               eventType,
+			NotificationType:        s.NotificationType,
+			Expression:              s.generateExpression(eventType),
+		})
+	}
+
+	return eventSubscriptions
+}
+
+func (s *UserJourneyTrackingSubscription) generateExpression(eventType EventType) string {
+	// Cancellation & reinstatement events have the RealtimeJourney as the body, the others wrap it up with extra fields
+	realtimeJourneyPath := "Body.RealtimeJourney"
+	if eventType == EventTypeRealtimeJourneyCancelled || eventType == EventTypeRealtimeJourneyReinstated {
+		realtimeJourneyPath = "Body"
+	}
+
+	var conditions []string
+
+	if s.JourneyRef != "" {
+		conditions = append(conditions,
+			fmt.Sprintf("%s.Journey?.PrimaryIdentifier == %q", realtimeJourneyPath, s.JourneyRef),
+			fmt.Sprintf("%s.JourneyRunDate.Format(\"2006-01-02\") == %q", realtimeJourneyPath, s.JourneyRunDate.Format("2006-01-02")),
+		)
+	} else {
+		conditions = append(conditions,
+			fmt.Sprintf("%s.Journey?.ServiceRef == %q", realtimeJourneyPath, s.ServiceRef),
+			fmt.Sprintf("any(%s.Journey?.Path ?? [], {.OriginStopRef == %q || .DestinationStopRef == %q})", realtimeJourneyPath, s.StopRef, s.StopRef),
+		)
+
+		// Platform changes & stop cancellations are only interesting at the stop being tracked
+		if eventType == EventTypeRealtimeJourneyPlatformSet || eventType == EventTypeRealtimeJourneyPlatformChanged || eventType == EventTypeRealtimeJourneyStopCancelled {
+			conditions = append(conditions, fmt.Sprintf("Body.Stop == %q", s.StopRef))
+		}
+	}
+
+	return strings.Join(conditions, " && ")
+}
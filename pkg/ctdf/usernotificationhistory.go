@@ -0,0 +1,39 @@
+package ctdf
+
+import "time"
+
+type UserNotificationHistory struct {
+	UserID          string
+	SubscriptionRef string
+
+	EventType        EventType
+	NotificationType NotificationType
+
+	Title   string
+	Message string
+
+	Status UserNotificationHistoryStatus
+
+	// ReleaseDateTime is when a held notification will be sent
+	ReleaseDateTime time.Time `bson:",omitempty"`
+
+	CreationDateTime time.Time
+}
+
+type UserNotificationHistoryStatus string
+
+const (
+	UserNotificationHistoryStatusSent         UserNotificationHistoryStatus = "Sent"
+	UserNotificationHistoryStatusDeduplicated UserNotificationHistoryStatus = "Deduplicated"
+	UserNotificationHistoryStatusHeld         UserNotificationHistoryStatus = "Held"
+)
+
+// PendingNotification is a notification held back for quiet hours or a digest
+type PendingNotification struct {
+	UserID          string
+	SubscriptionRef string
+	Notification    Notification
+
+	ReleaseDateTime  time.Time
+	CreationDateTime time.Time
+}
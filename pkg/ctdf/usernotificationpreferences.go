@@ -0,0 +1,117 @@
+package ctdf
+
+import (
+	"time"
+)
+
+type UserNotificationPreferences struct {
+	UserID               string
+	ModificationDateTime time.Time
+
+	// Quiet hours are local times of day in the format 15:04, notifications during them are held until they end
+	QuietHoursEnabled bool
+	QuietHoursStart   string
+	QuietHoursEnd     string
+	Timezone          string
+
+	// Digests combine all the notifications within the interval into a single one
+	DigestEnabled         bool
+	DigestIntervalMinutes int
+
+	// DedupWindowMinutes overrides how long an identical notification is suppressed for
+	DedupWindowMinutes int
+}
+
+const DefaultNotificationDedupWindow = 15 * time.Minute
+const DefaultNotificationDigestInterval = 30 * time.Minute
+
+func (p *UserNotificationPreferences) DedupWindow() time.Duration {
+	if p == nil || p.DedupWindowMinutes <= 0 {
+		return DefaultNotificationDedupWindow
+	}
+
+	return time.Duration(p.DedupWindowMinutes) * time.Minute
+}
+
+func (p *UserNotificationPreferences) Validate() error {
+	if p.QuietHoursEnabled {
+		if _, err := time.Parse("15:04", p.QuietHoursStart); err != nil {
+			return err
+		}
+		if _, err := time.Parse("15:04", p.QuietHoursEnd); err != nil {
+			return err
+		}
+	}
+
+	if p.Timezone != "" {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// QuietHoursEndTime returns when the current quiet hours finish, or a zero time if we're not in quiet hours
+func (p *UserNotificationPreferences) QuietHoursEndTime(now time.Time) time.Time {
+	if p == nil || !p.QuietHoursEnabled {
+		return time.Time{}
+	}
+
+	timezone, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		timezone = time.UTC
+	}
+	localNow := now.In(timezone)
+
+	start, startErr := time.Parse("15:04", p.QuietHoursStart)
+	end, endErr := time.Parse("15:04", p.QuietHoursEnd)
+	if startErr != nil || endErr != nil {
+		return time.Time{}
+	}
+
+	midnight := time.Date(localNow.Year(), localNow.Month(), localNow.Day(), 0, 0, 0, 0, timezone)
+	startToday := midnight.Add(time.Duration(start.Hour())*time.Hour + time.Duration(start.Minute())*time.Minute)
+	endToday := midnight.Add(time.Duration(end.Hour())*time.Hour + time.Duration(end.Minute())*time.Minute)
+
+	if !startToday.After(endToday) {
+		// Quiet hours within a single day (eg. 13:00 - 14:00)
+		if !localNow.Before(startToday) && localNow.Before(endToday) {
+			return endToday
+		}
+	} else {
+		// Quiet hours crossing midnight (eg. 22:00 - 07:00)
+		if localNow.Before(endToday) {
+			return endToday
+		} else if !localNow.Before(startToday) {
+			return endToday.AddDate(0, 0, 1)
+		}
+	}
+
+	return time.Time{}
+}
+
+// HoldUntil returns when a notification created now should be released, a zero time means send immediately
+// The digest release time is shared by every notification in the same digest window
+func (p *UserNotificationPreferences) HoldUntil(now time.Time, pendingDigestRelease time.Time) time.Time {
+	var release time.Time
+
+	if p != nil && p.DigestEnabled {
+		if !pendingDigestRelease.IsZero() && pendingDigestRelease.After(now) {
+			release = pendingDigestRelease
+		} else {
+			interval := DefaultNotificationDigestInterval
+			if p.DigestIntervalMinutes > 0 {
+				interval = time.Duration(p.DigestIntervalMinutes) * time.Minute
+			}
+
+			release = now.Add(interval)
+		}
+	}
+
+	if quietHoursEnd := p.QuietHoursEndTime(now); quietHoursEnd.After(release) {
+		release = quietHoursEnd
+	}
+
+	return release
+}
@@ -2,8 +2,15 @@ package ctdf
 
 import "time"
 
+// UserPushNotificationTarget is a single device registered for push notifications, users can have many
 type UserPushNotificationTarget struct {
 	UserID                string
+	CreationDateTime      time.Time `bson:",omitempty"`
 	ModificationDateTime  time.Time
 	PushNotificationToken string
+
+	DeviceID   string
+	DeviceName string
+	Platform   string
+	AppVersion string
 }
@@ -0,0 +1,18 @@
+package ctdf
+
+import "time"
+
+type UserWebhookNotificationTarget struct {
+	UserID               string
+	ModificationDateTime time.Time
+
+	URL string
+	// Secret is used to HMAC sign each payload so the receiver can verify it came from us
+	Secret string
+
+	// Disabled is set once an endpoint has failed too many deliveries in a row
+	Disabled            bool
+	DisabledDateTime    time.Time
+	ConsecutiveFailures int
+	LastFailureMessage  string
+}
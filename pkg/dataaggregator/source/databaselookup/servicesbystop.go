@@ -34,6 +34,7 @@ func (s Source) ServicesByStopQuery(q query.ServicesByStop) ([]*ctdf.Service, er
 			bson.M{"path.originstopref": bson.M{"$in": allStopIDs}},
 			bson.M{"path.destinationstopref": bson.M{"$in": allStopIDs}},
 		},
+		"duplicateof": bson.M{"$exists": false},
 	}
 
 	serviceRefs, err := journeysCollection.Distinct(context.Background(), "serviceref", filter)
@@ -50,11 +51,24 @@ func (s Source) ServicesByStopQuery(q query.ServicesByStop) ([]*ctdf.Service, er
 		bson.E{Key: "stopnameoverrides", Value: 0},
 	})
 
+	foundServices := map[string]bool{}
 	for _, serviceRef := range serviceRefs {
 		var service *ctdf.Service
 		servicesCollection.FindOne(context.Background(), bson.M{"primaryidentifier": serviceRef}, serviceOpts).Decode(&service)
 
-		if service != nil {
+		// Journeys not matched to one from the higher priority dataset can still belong to a duplicate service
+		if service != nil && service.DuplicateOf != "" {
+			var preferredService *ctdf.Service
+			servicesCollection.FindOne(context.Background(), bson.M{"primaryidentifier": service.DuplicateOf}, serviceOpts).Decode(&preferredService)
+
+			if preferredService != nil {
+				service = preferredService
+			}
+		}
+
+		if service != nil && !foundServices[service.PrimaryIdentifier] {
+			foundServices[service.PrimaryIdentifier] = true
+
 			transforms.Transform(service, 1)
 			services = append(services, service)
 		}
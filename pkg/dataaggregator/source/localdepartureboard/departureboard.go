@@ -42,7 +42,11 @@ func (s Source) DepartureBoardQuery(q query.DepartureBoard) ([]*ctdf.DepartureBo
 	currentTime := time.Now()
 
 	baseCacheItemPath := fmt.Sprintf("cachedresults/departureboardjourneys/%s/%s", q.Stop.PrimaryIdentifier, filterHashString)
-	journeyQuery := bson.M{"path.originstopref": bson.M{"$in": allStopIDs}}
+	// Journeys duplicating one from a higher priority dataset would show twice
+	journeyQuery := bson.M{
+		"path.originstopref": bson.M{"$in": allStopIDs},
+		"duplicateof":        bson.M{"$exists": false},
+	}
 	if q.Filter != nil {
 		journeyQuery = bson.M{
 			"$and": bson.A{
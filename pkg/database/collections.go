@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"fmt"
 
 	"github.com/rs/zerolog/log"
 	"go.mongodb.org/mongo-driver/bson"
@@ -18,7 +19,7 @@ func createIndexes() {
 
 func createStopsIndexes() {
 	// Stops
-	stopsCollection := GetCollection("stops")
+	stopsCollection := getMongoCollection("stops")
 	stopsIndex := []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
@@ -41,7 +42,7 @@ func createStopsIndexes() {
 	}
 
 	// Stops raw
-	stopsRawCollection := GetCollection("stops_raw")
+	stopsRawCollection := getMongoCollection("stops_raw")
 	stopsRawIndex := []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
@@ -58,7 +59,7 @@ func createStopsIndexes() {
 	}
 
 	// Stops staging
-	stopsStagingCollection := GetCollection("stops_staging")
+	stopsStagingCollection := getMongoCollection("stops_staging")
 	stopsStagingIndex := []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
@@ -75,7 +76,7 @@ func createStopsIndexes() {
 	}
 
 	// Stop Groups
-	stopGroupsCollection := GetCollection("stop_groups")
+	stopGroupsCollection := getMongoCollection("stop_groups")
 	stopGroupsIndex := []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "identifier", Value: 1}},
@@ -91,7 +92,7 @@ func createStopsIndexes() {
 
 func createOperatorsIndexes() {
 	// Operators
-	operatorsCollection := GetCollection("operators")
+	operatorsCollection := getMongoCollection("operators")
 
 	operatorIndex := []mongo.IndexModel{
 		{
@@ -111,8 +112,25 @@ func createOperatorsIndexes() {
 		log.Error().Err(err).Msg("Creating Index")
 	}
 
+	// Operators raw
+	operatorsRawCollection := getMongoCollection("operators_raw")
+	operatorsRawIndex := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "otheridentifiers", Value: 1}},
+		},
+	}
+
+	opts = options.CreateIndexes()
+	_, err = operatorsRawCollection.Indexes().CreateMany(context.Background(), operatorsRawIndex, opts)
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
 	// OperatorGroups
-	operatorGroupsCollection := GetCollection("operator_groups")
+	operatorGroupsCollection := getMongoCollection("operator_groups")
 	operatorGroupsIndex := []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "identifier", Value: 1}},
@@ -128,7 +146,7 @@ func createOperatorsIndexes() {
 
 func createRealtimeIndexes() {
 	// RealtimeJourneys
-	realtimeJourneysCollection := GetCollection("realtime_journeys")
+	realtimeJourneysCollection := getMongoCollection("realtime_journeys")
 	_, err := realtimeJourneysCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
@@ -170,7 +188,7 @@ func createRealtimeIndexes() {
 
 func createJourneysIndexes() {
 	// Services
-	servicesCollection := GetCollection("services")
+	servicesCollection := getMongoCollection("services")
 	serviceNameOperatorRefIndexName := "ServiceNameOperatorRef"
 	_, err := servicesCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
@@ -179,6 +197,10 @@ func createJourneysIndexes() {
 		{
 			Keys: bson.D{{Key: "datasource.datasetid", Value: 1}},
 		},
+		{
+			Keys:    bson.D{{Key: "duplicateof", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
 		{
 			Options: &options.IndexOptions{
 				Name: &serviceNameOperatorRefIndexName,
@@ -194,7 +216,7 @@ func createJourneysIndexes() {
 	}
 
 	// Journeys
-	journeysCollection := GetCollection("journeys")
+	journeysCollection := getMongoCollection("journeys")
 
 	// journeyIdentificationServiceOriginStopsIndexName := "JourneyIdentificationServiceOriginStops"
 	// journeyIdentificationServiceDestinationStopsIndexName := "JourneyIdentificationServiceDestinationStops"
@@ -207,6 +229,9 @@ func createJourneysIndexes() {
 		{
 			Keys: bson.D{{Key: "serviceref", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "operatorref", Value: 1}},
+		},
 		{
 			Keys: bson.D{{Key: "path.originstopref", Value: 1}},
 		},
@@ -216,6 +241,10 @@ func createJourneysIndexes() {
 		{
 			Keys: bson.D{{Key: "datasource.datasetid", Value: 1}},
 		},
+		// Used by the vehicle tracker journey index to only load the days journeys
+		{
+			Keys: bson.D{{Key: "availability.match.type", Value: 1}, {Key: "availability.match.value", Value: 1}},
+		},
 		// {
 		// 	Options: &options.IndexOptions{
 		// 		Name: &journeyIdentificationServiceOriginStopsIndexName,
@@ -258,6 +287,10 @@ func createJourneysIndexes() {
 		{
 			Keys: bson.D{{Key: "otheridentifiers.GTFS-TripID", Value: 1}},
 		},
+		{
+			Keys:    bson.D{{Key: "duplicateof", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
 		{
 			Keys:    bson.D{{Key: "expiry", Value: 1}},
 			Options: options.Index().SetExpireAfterSeconds(1), // Expire after 1 second
@@ -268,7 +301,7 @@ func createJourneysIndexes() {
 	}
 
 	// Retry Records
-	retryRecordsCollection := GetCollection("retry_records")
+	retryRecordsCollection := getMongoCollection("retry_records")
 	_, err = retryRecordsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "creationdatetime", Value: 1}},
@@ -280,7 +313,7 @@ func createJourneysIndexes() {
 	}
 
 	// ServiceAlerts
-	serviceAlertsCollection := GetCollection("service_alerts")
+	serviceAlertsCollection := getMongoCollection("service_alerts")
 	_, err = serviceAlertsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
@@ -298,18 +331,58 @@ func createJourneysIndexes() {
 	}
 
 	// UserPushNotificationTarget
-	userPushNotificationTargetCollection := GetCollection("user_push_notification_target")
+	userPushNotificationTargetCollection := getMongoCollection("user_push_notification_target")
 	_, err = userPushNotificationTargetCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "userid", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "pushnotificationtoken", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// UserEmailNotificationTarget
+	userEmailNotificationTargetCollection := getMongoCollection("user_email_notification_target")
+	_, err = userEmailNotificationTargetCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// UserWebhookNotificationTarget
+	userWebhookNotificationTargetCollection := getMongoCollection("user_webhook_notification_target")
+	_, err = userWebhookNotificationTargetCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// NotificationDelivery
+	notificationDeliveriesCollection := getMongoCollection("notification_deliveries")
+	_, err = notificationDeliveriesCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "targetuser", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "creationdatetime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 3600), // Expire after 30 days
+		},
 	}, options.CreateIndexes())
 	if err != nil {
 		log.Error().Err(err).Msg("Creating Index")
 	}
 
 	// UserEventNotificationExpression
-	userEventSubscriptionCollection := GetCollection("user_event_subscription")
+	userEventSubscriptionCollection := getMongoCollection("user_event_subscription")
 	_, err = userEventSubscriptionCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys: bson.D{{Key: "userid", Value: 1}},
@@ -317,13 +390,146 @@ func createJourneysIndexes() {
 		{
 			Keys: bson.D{{Key: "eventtype", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "trackingsubscriptionref", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expirydatetime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // Expire at the expiry date time
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// UserJourneyTrackingSubscription
+	userJourneyTrackingSubscriptionCollection := getMongoCollection("user_journey_tracking_subscription")
+	_, err = userJourneyTrackingSubscriptionCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expirydatetime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0), // Expire at the expiry date time
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// UserNotificationPreferences
+	userNotificationPreferencesCollection := getMongoCollection("user_notification_preferences")
+	_, err = userNotificationPreferencesCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// UserNotificationHistory
+	userNotificationHistoryCollection := getMongoCollection("user_notification_history")
+	_, err = userNotificationHistoryCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}, {Key: "creationdatetime", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "creationdatetime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 3600), // Expire after 30 days
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// PendingNotification
+	pendingNotificationsCollection := getMongoCollection("pending_notifications")
+	_, err = pendingNotificationsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "releasedatetime", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "userid", Value: 1}, {Key: "notification.type", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// Dataset imports are staged in _import collections & the records the latest import changed are kept in _versions collections to roll back
+	for _, collectionName := range []string{"stops_raw", "stop_groups", "operators_raw", "operator_groups", "services", "journeys"} {
+		for _, suffix := range []string{"import", "versions"} {
+			stagedCollection := getMongoCollection(fmt.Sprintf("%s_%s", collectionName, suffix))
+			_, err = stagedCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+				{
+					Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
+				},
+				{
+					Keys: bson.D{{Key: "datasource.datasetid", Value: 1}},
+				},
+			}, options.CreateIndexes())
+			if err != nil {
+				log.Error().Err(err).Msg("Creating Index")
+			}
+		}
+	}
+
+	// DatasetImportRun
+	datasetImportRunsCollection := getMongoCollection("dataset_import_runs")
+	_, err = datasetImportRunsCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "primaryidentifier", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "dataset", Value: 1}, {Key: "startdatetime", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "dataset", Value: 1}, {Key: "status", Value: 1}, {Key: "startdatetime", Value: -1}},
+		},
+		{
+			Keys:    bson.D{{Key: "startdatetime", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(30 * 24 * 3600), // Expire after 30 days
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// TimetableChange
+	timetableChangesCollection := getMongoCollection("timetable_changes")
+	_, err = timetableChangesCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "datasetid", Value: 1}, {Key: "creationdatetime", Value: -1}},
+		},
+		{
+			Keys: bson.D{{Key: "services.serviceref", Value: 1}},
+		},
+	}, options.CreateIndexes())
+	if err != nil {
+		log.Error().Err(err).Msg("Creating Index")
+	}
+
+	// DBWatch resume tokens
+	dbwatchResumeTokensCollection := getMongoCollection("dbwatch_resume_tokens")
+	_, err = dbwatchResumeTokensCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "watch", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
 	}, options.CreateIndexes())
 	if err != nil {
 		log.Error().Err(err).Msg("Creating Index")
 	}
 
 	// UserPushNotificationTarget
-	tflTrackerCollection := GetCollection("tfl_tracker")
+	tflTrackerCollection := getMongoCollection("tfl_tracker")
 	_, err = tflTrackerCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
 		{
 			Keys:    bson.D{{Key: "creationdatetime", Value: 1}},
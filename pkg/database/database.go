@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -19,10 +20,23 @@ type MongoInstance struct {
 var Instance *MongoInstance
 var RealtimeJourneyInstance *MongoInstance
 
+var memoryInstance *memoryDatabase
+
+// Collections kept in memory whatever the backend is, see UseMemoryCollections
+var memoryOverrides = newMemoryDatabase()
+var memoryOverrideNames sync.Map
+
 const defaultConnectionString = "mongodb://localhost:27017/"
 const defaultDatabase = "travigo"
 
 func Connect() error {
+	env := util.GetEnvironmentVariables()
+
+	if env["TRAVIGO_DATABASE_BACKEND"] == "memory" {
+		ConnectMemory()
+		return nil
+	}
+
 	err := ConnectStandard()
 	if err != nil {
 		return err
@@ -78,6 +92,14 @@ func ConnectStandard() error {
 	return nil
 }
 
+// ConnectMemory switches all collections to the embedded in-memory storage
+func ConnectMemory() {
+	if memoryInstance == nil {
+		log.Info().Msg("Using in-memory database")
+		memoryInstance = newMemoryDatabase()
+	}
+}
+
 func ConnectRealtime() error {
 	env := util.GetEnvironmentVariables()
 
@@ -123,10 +145,38 @@ func GetInstance(collectionName string) *MongoInstance {
 	}
 }
 
-func GetCollection(collectionName string) *mongo.Collection {
+func GetCollection(collectionName string) Collection {
+	if _, overridden := memoryOverrideNames.Load(collectionName); overridden {
+		return memoryOverrides.Collection(collectionName)
+	}
+
+	if memoryInstance != nil {
+		return memoryInstance.Collection(collectionName)
+	}
+
+	return getMongoCollection(collectionName)
+}
+
+// UseMemoryCollections keeps the given collections in memory for the rest of the process so
+// anything written to them never reaches the real database
+func UseMemoryCollections(collectionNames ...string) {
+	for _, collectionName := range collectionNames {
+		memoryOverrideNames.Store(collectionName, true)
+	}
+}
+
+func getMongoCollection(collectionName string) *mongo.Collection {
 	return GetInstance(collectionName).Database.Collection(collectionName)
 }
 
+func Ping() error {
+	if memoryInstance != nil {
+		return nil
+	}
+
+	return Instance.Client.Ping(context.Background(), nil)
+}
+
 // Requires
 // use admin
 // db.runCommand( {
@@ -0,0 +1,498 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// memoryDatabase is an embedded storage backend so travigo can run without MongoDB for local development & tests.
+// It implements the subset of MongoDB query, update & aggregation behaviour that travigo uses.
+type memoryDatabase struct {
+	mutex       sync.Mutex
+	collections map[string]*memoryCollection
+}
+
+func newMemoryDatabase() *memoryDatabase {
+	return &memoryDatabase{
+		collections: map[string]*memoryCollection{},
+	}
+}
+
+func (d *memoryDatabase) Collection(name string) *memoryCollection {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	collection, exists := d.collections[name]
+	if !exists {
+		collection = &memoryCollection{name: name, database: d, index: newMemoryIndex(nil)}
+		d.collections[name] = collection
+	}
+
+	return collection
+}
+
+// memoryCollection stores normalised documents that are never modified in place, updates always swap in a new copy
+// so snapshots can be read without holding the lock
+type memoryCollection struct {
+	name     string
+	database *memoryDatabase
+
+	mutex     sync.RWMutex
+	documents []bson.M
+	index     *memoryIndex
+}
+
+var _ Collection = (*memoryCollection)(nil)
+
+var errChangeStreamsUnsupported = errors.New("Change streams are not supported by the in-memory database")
+
+func (c *memoryCollection) Name() string {
+	return c.name
+}
+
+// candidates returns a copy of the documents that could match the filter without holding the lock
+func (c *memoryCollection) candidates(filter bson.M) []bson.M {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	positions, indexed := c.index.candidates(filter)
+	if !indexed {
+		documents := make([]bson.M, len(c.documents))
+		copy(documents, c.documents)
+
+		return documents
+	}
+
+	documents := make([]bson.M, len(positions))
+	for i, position := range positions {
+		documents[i] = c.documents[position]
+	}
+
+	return documents
+}
+
+func (c *memoryCollection) snapshot() []bson.M {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	documents := make([]bson.M, len(c.documents))
+	copy(documents, c.documents)
+
+	return documents
+}
+
+func (c *memoryCollection) replaceAll(documents []bson.M) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.documents = make([]bson.M, len(documents))
+	copy(c.documents, documents)
+	c.index = newMemoryIndex(c.documents)
+}
+
+func (c *memoryCollection) query(filter interface{}, sortSpec interface{}, skip int64, limit int64) ([]bson.M, error) {
+	normalisedFilter, err := normaliseDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := filterDocuments(c.candidates(normalisedFilter), normalisedFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	if sortSpec != nil {
+		orderedSort, err := normaliseOrderedDocument(sortSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		sortDocuments(documents, orderedSort)
+	}
+
+	if skip > 0 {
+		if skip >= int64(len(documents)) {
+			return nil, nil
+		}
+		documents = documents[skip:]
+	}
+
+	if limit > 0 && limit < int64(len(documents)) {
+		documents = documents[:limit]
+	}
+
+	return documents, nil
+}
+
+func documentsCursor(documents []bson.M) (*mongo.Cursor, error) {
+	cursorDocuments := make([]interface{}, len(documents))
+	for i, document := range documents {
+		cursorDocuments[i] = document
+	}
+
+	return mongo.NewCursorFromDocuments(cursorDocuments, nil, nil)
+}
+
+// Projections are ignored as they only limit what gets decoded
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
+	findOneOptions := options.MergeFindOneOptions(opts...)
+
+	var skip int64
+	if findOneOptions.Skip != nil {
+		skip = *findOneOptions.Skip
+	}
+
+	documents, err := c.query(filter, findOneOptions.Sort, skip, 1)
+	if err != nil {
+		return mongo.NewSingleResultFromDocument(bson.M{}, err, nil)
+	}
+
+	if len(documents) == 0 {
+		return mongo.NewSingleResultFromDocument(bson.M{}, mongo.ErrNoDocuments, nil)
+	}
+
+	return mongo.NewSingleResultFromDocument(documents[0], nil, nil)
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
+	findOptions := options.MergeFindOptions(opts...)
+
+	var skip, limit int64
+	if findOptions.Skip != nil {
+		skip = *findOptions.Skip
+	}
+	if findOptions.Limit != nil {
+		limit = *findOptions.Limit
+	}
+
+	documents, err := c.query(filter, findOptions.Sort, skip, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return documentsCursor(documents)
+}
+
+func (c *memoryCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	countOptions := options.MergeCountOptions(opts...)
+
+	var skip, limit int64
+	if countOptions.Skip != nil {
+		skip = *countOptions.Skip
+	}
+	if countOptions.Limit != nil {
+		limit = *countOptions.Limit
+	}
+
+	documents, err := c.query(filter, nil, skip, limit)
+
+	return int64(len(documents)), err
+}
+
+func (c *memoryCollection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
+	documents, err := c.query(filter, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	values := bson.A{}
+	seen := map[interface{}]bool{}
+	for _, document := range documents {
+		for _, value := range expandArrays(lookupPath(document, splitPath(fieldName))) {
+			if _, isArray := value.(bson.A); isArray {
+				continue
+			}
+
+			if key, comparable := distinctKey(value); comparable {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			} else if containsValue(values, value) {
+				continue
+			}
+
+			values = append(values, value)
+		}
+	}
+
+	return values, nil
+}
+
+func (c *memoryCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	stages, err := normalisePipeline(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	documents, err := c.runPipeline(c.snapshot(), stages)
+	if err != nil {
+		return nil, err
+	}
+
+	return documentsCursor(documents)
+}
+
+func (c *memoryCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	normalisedDocument, err := normaliseDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return &mongo.InsertOneResult{InsertedID: c.insert(normalisedDocument)}, nil
+}
+
+// insert must be called with the write lock held
+func (c *memoryCollection) insert(document bson.M) interface{} {
+	if _, hasID := document["_id"]; !hasID {
+		document = setPath(document, []string{"_id"}, primitive.NewObjectID())
+	}
+
+	c.documents = append(c.documents, document)
+	c.index.add(document, len(c.documents)-1)
+
+	return document["_id"]
+}
+
+func (c *memoryCollection) UpdateOne(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.updateWithOptions(filter, update, false, options.MergeUpdateOptions(opts...))
+}
+
+func (c *memoryCollection) UpdateMany(ctx context.Context, filter interface{}, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	return c.updateWithOptions(filter, update, true, options.MergeUpdateOptions(opts...))
+}
+
+func (c *memoryCollection) updateWithOptions(filter interface{}, update interface{}, multi bool, updateOptions *options.UpdateOptions) (*mongo.UpdateResult, error) {
+	normalisedFilter, err := normaliseDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+	normalisedUpdate, err := normaliseDocument(update)
+	if err != nil {
+		return nil, err
+	}
+
+	upsert := updateOptions.Upsert != nil && *updateOptions.Upsert
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.update(normalisedFilter, normalisedUpdate, multi, upsert)
+}
+
+// update must be called with the write lock held, the update can either use operators or be a replacement document
+func (c *memoryCollection) update(filter bson.M, update bson.M, multi bool, upsert bool) (*mongo.UpdateResult, error) {
+	result := &mongo.UpdateResult{}
+	operators := isUpdateDocument(update)
+
+	positions, indexed := c.index.candidates(filter)
+	if !indexed {
+		positions = make([]int, len(c.documents))
+		for i := range c.documents {
+			positions[i] = i
+		}
+	}
+
+	for _, i := range positions {
+		document := c.documents[i]
+
+		matched, err := matchDocument(document, filter)
+		if err != nil {
+			return nil, err
+		}
+		if !matched {
+			continue
+		}
+
+		var updated bson.M
+		if operators {
+			updated, err = applyUpdate(document, update, false)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			updated = copyDocument(update)
+			updated["_id"] = document["_id"]
+		}
+
+		result.MatchedCount++
+		if !valuesEqual(document, updated) {
+			result.ModifiedCount++
+		}
+
+		c.index.remove(document, i)
+		c.documents[i] = updated
+		c.index.add(updated, i)
+
+		if !multi {
+			break
+		}
+	}
+
+	if result.MatchedCount == 0 && upsert {
+		var inserted bson.M
+		var err error
+
+		if operators {
+			inserted, err = applyUpdate(upsertBase(filter), update, true)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			inserted = copyDocument(update)
+			if id, hasID := upsertBase(filter)["_id"]; hasID {
+				inserted["_id"] = id
+			}
+		}
+
+		result.UpsertedCount = 1
+		result.UpsertedID = c.insert(inserted)
+	}
+
+	return result, nil
+}
+
+func (c *memoryCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.deleteMatching(filter, false)
+}
+
+func (c *memoryCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	return c.deleteMatching(filter, true)
+}
+
+func (c *memoryCollection) deleteMatching(filter interface{}, multi bool) (*mongo.DeleteResult, error) {
+	normalisedFilter, err := normaliseDocument(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	deletedCount, err := c.delete(normalisedFilter, multi)
+
+	return &mongo.DeleteResult{DeletedCount: deletedCount}, err
+}
+
+// delete must be called with the write lock held
+func (c *memoryCollection) delete(filter bson.M, multi bool) (int64, error) {
+	var deletedCount int64
+	remaining := make([]bson.M, 0, len(c.documents))
+
+	for _, document := range c.documents {
+		if deletedCount > 0 && !multi {
+			remaining = append(remaining, document)
+			continue
+		}
+
+		matched, err := matchDocument(document, filter)
+		if err != nil {
+			return 0, err
+		}
+
+		if matched {
+			deletedCount++
+		} else {
+			remaining = append(remaining, document)
+		}
+	}
+
+	c.documents = remaining
+	if deletedCount > 0 {
+		c.index = newMemoryIndex(c.documents)
+	}
+
+	return deletedCount, nil
+}
+
+func (c *memoryCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	result := &mongo.BulkWriteResult{
+		UpsertedIDs: map[int64]interface{}{},
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for i, model := range models {
+		var err error
+
+		switch m := model.(type) {
+		case *mongo.InsertOneModel:
+			var document bson.M
+			document, err = normaliseDocument(m.Document)
+			if err == nil {
+				c.insert(document)
+				result.InsertedCount++
+			}
+		case *mongo.UpdateOneModel:
+			err = c.bulkUpdate(result, int64(i), m.Filter, m.Update, false, m.Upsert)
+		case *mongo.UpdateManyModel:
+			err = c.bulkUpdate(result, int64(i), m.Filter, m.Update, true, m.Upsert)
+		case *mongo.ReplaceOneModel:
+			err = c.bulkUpdate(result, int64(i), m.Filter, m.Replacement, false, m.Upsert)
+		case *mongo.DeleteOneModel:
+			err = c.bulkDelete(result, m.Filter, false)
+		case *mongo.DeleteManyModel:
+			err = c.bulkDelete(result, m.Filter, true)
+		default:
+			err = errors.New("Unsupported write model")
+		}
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+func (c *memoryCollection) bulkUpdate(result *mongo.BulkWriteResult, index int64, filter interface{}, update interface{}, multi bool, upsert *bool) error {
+	normalisedFilter, err := normaliseDocument(filter)
+	if err != nil {
+		return err
+	}
+	normalisedUpdate, err := normaliseDocument(update)
+	if err != nil {
+		return err
+	}
+
+	updateResult, err := c.update(normalisedFilter, normalisedUpdate, multi, upsert != nil && *upsert)
+	if err != nil {
+		return err
+	}
+
+	result.MatchedCount += updateResult.MatchedCount
+	result.ModifiedCount += updateResult.ModifiedCount
+	result.UpsertedCount += updateResult.UpsertedCount
+	if updateResult.UpsertedID != nil {
+		result.UpsertedIDs[index] = updateResult.UpsertedID
+	}
+
+	return nil
+}
+
+func (c *memoryCollection) bulkDelete(result *mongo.BulkWriteResult, filter interface{}, multi bool) error {
+	normalisedFilter, err := normaliseDocument(filter)
+	if err != nil {
+		return err
+	}
+
+	deletedCount, err := c.delete(normalisedFilter, multi)
+	result.DeletedCount += deletedCount
+
+	return err
+}
+
+func (c *memoryCollection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, errChangeStreamsUnsupported
+}
@@ -0,0 +1,355 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func newTestCollection(t *testing.T, documents ...bson.M) *memoryCollection {
+	collection := newMemoryDatabase().Collection("test")
+
+	for _, document := range documents {
+		if _, err := collection.InsertOne(context.Background(), document); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return collection
+}
+
+func findIdentifiers(t *testing.T, collection *memoryCollection, filter interface{}) []string {
+	cursor, err := collection.Find(context.Background(), filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var documents []struct {
+		PrimaryIdentifier string
+	}
+	if err := cursor.All(context.Background(), &documents); err != nil {
+		t.Fatal(err)
+	}
+
+	identifiers := []string{}
+	for _, document := range documents {
+		identifiers = append(identifiers, document.PrimaryIdentifier)
+	}
+	sort.Strings(identifiers)
+
+	return identifiers
+}
+
+func findOne(t *testing.T, collection *memoryCollection, identifier string) bson.M {
+	var document bson.M
+	if err := collection.FindOne(context.Background(), bson.M{"primaryidentifier": identifier}).Decode(&document); err != nil {
+		t.Fatal(err)
+	}
+
+	return document
+}
+
+func equalIdentifiers(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestMemoryQueryOperators(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"primaryidentifier": "a", "count": 1, "name": "Alpha", "tags": bson.A{"x", "y"}, "datasource": bson.M{"datasetid": "one"},
+			"stops": bson.A{bson.M{"ref": "s1", "time": 10}, bson.M{"ref": "s2", "time": 20}}},
+		bson.M{"primaryidentifier": "b", "count": int64(5), "name": "Beta", "tags": bson.A{"y"}, "datasource": bson.M{"datasetid": "two"},
+			"stops": bson.A{bson.M{"ref": "s1", "time": 30}}},
+		bson.M{"primaryidentifier": "c", "count": 9.5, "name": "Gamma", "duplicateof": "a", "datasource": bson.M{"datasetid": "one"}},
+	)
+
+	for name, test := range map[string]struct {
+		filter   bson.M
+		expected []string
+	}{
+		"empty":            {bson.M{}, []string{"a", "b", "c"}},
+		"equality":         {bson.M{"name": "Beta"}, []string{"b"}},
+		"dotted path":      {bson.M{"datasource.datasetid": "one"}, []string{"a", "c"}},
+		"array contains":   {bson.M{"tags": "x"}, []string{"a"}},
+		"array of docs":    {bson.M{"stops.ref": "s1"}, []string{"a", "b"}},
+		"number types":     {bson.M{"count": int32(5)}, []string{"b"}},
+		"$eq":              {bson.M{"name": bson.M{"$eq": "Alpha"}}, []string{"a"}},
+		"$ne":              {bson.M{"name": bson.M{"$ne": "Alpha"}}, []string{"b", "c"}},
+		"$ne missing":      {bson.M{"duplicateof": bson.M{"$ne": "a"}}, []string{"a", "b"}},
+		"$gt":              {bson.M{"count": bson.M{"$gt": 1}}, []string{"b", "c"}},
+		"$gte":             {bson.M{"count": bson.M{"$gte": 5}}, []string{"b", "c"}},
+		"$lt":              {bson.M{"count": bson.M{"$lt": 5}}, []string{"a"}},
+		"$lte range":       {bson.M{"count": bson.M{"$gte": 1, "$lte": 5}}, []string{"a", "b"}},
+		"$in":              {bson.M{"primaryidentifier": bson.M{"$in": bson.A{"a", "c", "z"}}}, []string{"a", "c"}},
+		"$in array field":  {bson.M{"tags": bson.M{"$in": bson.A{"x"}}}, []string{"a"}},
+		"$nin":             {bson.M{"primaryidentifier": bson.M{"$nin": bson.A{"a"}}}, []string{"b", "c"}},
+		"$exists":          {bson.M{"duplicateof": bson.M{"$exists": true}}, []string{"c"}},
+		"$exists false":    {bson.M{"duplicateof": bson.M{"$exists": false}}, []string{"a", "b"}},
+		"$regex":           {bson.M{"name": bson.M{"$regex": "^.a"}}, []string{"c"}},
+		"$regex options":   {bson.M{"name": bson.M{"$regex": "^b", "$options": "i"}}, []string{"b"}},
+		"$size":            {bson.M{"tags": bson.M{"$size": 2}}, []string{"a"}},
+		"$not":             {bson.M{"count": bson.M{"$not": bson.M{"$gt": 1}}}, []string{"a"}},
+		"$elemMatch":       {bson.M{"stops": bson.M{"$elemMatch": bson.M{"ref": "s1", "time": bson.M{"$gt": 15}}}}, []string{"b"}},
+		"$or":              {bson.M{"$or": bson.A{bson.M{"name": "Alpha"}, bson.M{"count": bson.M{"$gt": 9}}}}, []string{"a", "c"}},
+		"$and":             {bson.M{"$and": bson.A{bson.M{"datasource.datasetid": "one"}, bson.M{"count": bson.M{"$lt": 5}}}}, []string{"a"}},
+		"$nor":             {bson.M{"$nor": bson.A{bson.M{"name": "Alpha"}, bson.M{"name": "Beta"}}}, []string{"c"}},
+		"indexed":          {bson.M{"primaryidentifier": "b"}, []string{"b"}},
+		"indexed filtered": {bson.M{"primaryidentifier": "b", "datasource.datasetid": "one"}, []string{}},
+	} {
+		identifiers := findIdentifiers(t, collection, test.filter)
+		if !equalIdentifiers(identifiers, test.expected) {
+			t.Errorf("%s: expected %v, got %v", name, test.expected, identifiers)
+		}
+	}
+
+	if _, err := collection.Find(context.Background(), bson.M{"$where": "true"}); err == nil {
+		t.Error("expected an unsupported operator to fail")
+	}
+}
+
+func TestMemoryFindOptions(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"primaryidentifier": "a", "order": 3},
+		bson.M{"primaryidentifier": "b", "order": 1},
+		bson.M{"primaryidentifier": "c", "order": 2},
+	)
+
+	cursor, err := collection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "order", Value: -1}}).SetSkip(1).SetLimit(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var documents []bson.M
+	cursor.All(context.Background(), &documents)
+
+	if len(documents) != 1 || documents[0]["primaryidentifier"] != "c" {
+		t.Errorf("expected the sort, skip & limit to give c, got %v", documents)
+	}
+
+	count, _ := collection.CountDocuments(context.Background(), bson.M{"order": bson.M{"$gt": 1}})
+	if count != 2 {
+		t.Errorf("expected a count of 2, got %d", count)
+	}
+}
+
+func TestMemoryUpdateOperators(t *testing.T) {
+	collection := newTestCollection(t, bson.M{
+		"primaryidentifier": "a",
+		"count":             int32(1),
+		"remove":            "me",
+		"tags":              bson.A{"x"},
+		"nested":            bson.M{"value": 1},
+	})
+
+	_, err := collection.UpdateOne(context.Background(), bson.M{"primaryidentifier": "a"}, bson.M{
+		"$set":         bson.M{"name": "Alpha", "nested.other": 2},
+		"$setOnInsert": bson.M{"created": true},
+		"$unset":       bson.M{"remove": ""},
+		"$inc":         bson.M{"count": 2, "missing": 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	document := findOne(t, collection, "a")
+	if document["name"] != "Alpha" {
+		t.Errorf("expected $set to set name, got %v", document["name"])
+	}
+	if nested := document["nested"].(bson.M); nested["value"] != int32(1) || nested["other"] != int32(2) {
+		t.Errorf("expected $set on a dotted path to keep the other fields, got %v", nested)
+	}
+	if _, exists := document["created"]; exists {
+		t.Error("expected $setOnInsert to be skipped when updating")
+	}
+	if _, exists := document["remove"]; exists {
+		t.Error("expected $unset to remove the field")
+	}
+	if document["count"] != int32(3) {
+		t.Errorf("expected $inc to keep the count an integer & give 3, got %#v", document["count"])
+	}
+	if document["missing"] != int32(1) {
+		t.Errorf("expected $inc on a missing field to start at 0, got %#v", document["missing"])
+	}
+
+	for _, update := range []bson.M{
+		{"$push": bson.M{"tags": "x"}},
+		{"$addToSet": bson.M{"tags": bson.M{"$each": bson.A{"x", "y"}}}},
+		{"$pull": bson.M{"tags": "x"}},
+	} {
+		if _, err := collection.UpdateOne(context.Background(), bson.M{"primaryidentifier": "a"}, update); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// [x] -> $push [x x] -> $addToSet [x x y] -> $pull [y]
+	tags := findOne(t, collection, "a")["tags"].(bson.A)
+	if len(tags) != 1 || tags[0] != "y" {
+		t.Errorf("expected the array operators to leave [y], got %v", tags)
+	}
+
+	if _, err := collection.UpdateOne(context.Background(), bson.M{"primaryidentifier": "a"}, bson.M{"$rename": bson.M{"a": "b"}}); err == nil {
+		t.Error("expected an unsupported update operator to fail")
+	}
+}
+
+func TestMemoryUpdateResults(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"primaryidentifier": "a", "group": 1},
+		bson.M{"primaryidentifier": "b", "group": 1},
+		bson.M{"primaryidentifier": "c", "group": 2},
+	)
+
+	result, _ := collection.UpdateMany(context.Background(), bson.M{"group": 1}, bson.M{"$set": bson.M{"seen": true}})
+	if result.MatchedCount != 2 || result.ModifiedCount != 2 {
+		t.Errorf("expected 2 matched & modified, got %d & %d", result.MatchedCount, result.ModifiedCount)
+	}
+
+	result, _ = collection.UpdateMany(context.Background(), bson.M{"group": 1}, bson.M{"$set": bson.M{"seen": true}})
+	if result.MatchedCount != 2 || result.ModifiedCount != 0 {
+		t.Errorf("expected an update that changes nothing to not modify, got %d & %d", result.MatchedCount, result.ModifiedCount)
+	}
+
+	result, _ = collection.UpdateOne(context.Background(), bson.M{"group": 1}, bson.M{"$set": bson.M{"first": true}})
+	if result.MatchedCount != 1 {
+		t.Errorf("expected UpdateOne to only match 1, got %d", result.MatchedCount)
+	}
+}
+
+func TestMemoryUpsert(t *testing.T) {
+	collection := newTestCollection(t)
+
+	result, err := collection.UpdateOne(context.Background(),
+		bson.M{"primaryidentifier": "a", "datasource.datasetid": "one", "count": bson.M{"$gt": 5}},
+		bson.M{"$set": bson.M{"name": "Alpha"}, "$setOnInsert": bson.M{"created": true}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UpsertedCount != 1 || result.UpsertedID == nil {
+		t.Errorf("expected an upsert, got %+v", result)
+	}
+
+	document := findOne(t, collection, "a")
+	if document["name"] != "Alpha" || document["created"] != true {
+		t.Errorf("expected the update & $setOnInsert to apply, got %v", document)
+	}
+	if document["datasource"].(bson.M)["datasetid"] != "one" {
+		t.Errorf("expected the upsert to start from the filter equality, got %v", document["datasource"])
+	}
+	if _, exists := document["count"]; exists {
+		t.Error("expected operator conditions in the filter not to be copied to the upsert")
+	}
+
+	// A replacement keeps the _id and drops the fields it doesn't have
+	_, err = collection.BulkWrite(context.Background(), []mongo.WriteModel{
+		mongo.NewReplaceOneModel().SetFilter(bson.M{"primaryidentifier": "a"}).SetReplacement(bson.M{"primaryidentifier": "a", "replaced": true}).SetUpsert(true),
+		mongo.NewReplaceOneModel().SetFilter(bson.M{"primaryidentifier": "b"}).SetReplacement(bson.M{"primaryidentifier": "b"}).SetUpsert(true),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced := findOne(t, collection, "a")
+	if replaced["_id"] != document["_id"] || replaced["replaced"] != true || replaced["name"] != nil {
+		t.Errorf("expected the replacement to keep the _id & drop the other fields, got %v", replaced)
+	}
+
+	if count, _ := collection.CountDocuments(context.Background(), bson.M{}); count != 2 {
+		t.Errorf("expected 2 documents after the upserts, got %d", count)
+	}
+}
+
+func TestMemoryIndexFollowsChanges(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"primaryidentifier": "a", "value": 1},
+		bson.M{"primaryidentifier": "b", "value": 2},
+		bson.M{"primaryidentifier": "c", "value": 3},
+	)
+
+	// Changing the identifier moves the document in the index
+	collection.UpdateOne(context.Background(), bson.M{"primaryidentifier": "a"}, bson.M{"$set": bson.M{"primaryidentifier": "d"}})
+	if identifiers := findIdentifiers(t, collection, bson.M{"primaryidentifier": "a"}); len(identifiers) != 0 {
+		t.Errorf("expected the old identifier to be gone, got %v", identifiers)
+	}
+	if identifiers := findIdentifiers(t, collection, bson.M{"primaryidentifier": "d"}); !equalIdentifiers(identifiers, []string{"d"}) {
+		t.Errorf("expected the new identifier to be found, got %v", identifiers)
+	}
+
+	// Deleting shifts the positions of the documents after it
+	collection.DeleteOne(context.Background(), bson.M{"primaryidentifier": "b"})
+	if document := findOne(t, collection, "c"); document["value"] != int32(3) {
+		t.Errorf("expected c to still be found after a delete, got %v", document)
+	}
+
+	// Documents with an array identifier can't be indexed so every document has to be checked
+	collection.InsertOne(context.Background(), bson.M{"primaryidentifier": bson.A{"e", "f"}})
+	if count, _ := collection.CountDocuments(context.Background(), bson.M{"primaryidentifier": "f"}); count != 1 {
+		t.Errorf("expected the array identifier to match, got %d", count)
+	}
+
+	collection.replaceAll([]bson.M{{"primaryidentifier": "g"}})
+	if identifiers := findIdentifiers(t, collection, bson.M{"primaryidentifier": "g"}); !equalIdentifiers(identifiers, []string{"g"}) {
+		t.Errorf("expected the index to be rebuilt after replacing the documents, got %v", identifiers)
+	}
+}
+
+func TestMemoryDistinct(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"operatorref": "one", "count": int32(1), "tags": bson.A{"x", "y"}},
+		bson.M{"operatorref": "two", "count": int64(1), "tags": bson.A{"y"}},
+		bson.M{"operatorref": "one", "count": 2.0, "location": bson.M{"type": "Point"}},
+		bson.M{"operatorref": "three", "location": bson.M{"type": "Point"}},
+	)
+
+	for field, expected := range map[string]int{
+		"operatorref": 3,
+		"count":       2,
+		"tags":        2,
+		"location":    1,
+		"missing":     0,
+	} {
+		values, err := collection.Distinct(context.Background(), field, bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(values) != expected {
+			t.Errorf("expected %d distinct %s, got %v", expected, field, values)
+		}
+	}
+
+	values, _ := collection.Distinct(context.Background(), "operatorref", bson.M{"count": bson.M{"$exists": true}})
+	if len(values) != 2 {
+		t.Errorf("expected the filter to apply to distinct, got %v", values)
+	}
+}
+
+func TestMemoryDelete(t *testing.T) {
+	collection := newTestCollection(t,
+		bson.M{"primaryidentifier": "a", "group": 1},
+		bson.M{"primaryidentifier": "b", "group": 1},
+		bson.M{"primaryidentifier": "c", "group": 2},
+	)
+
+	result, _ := collection.DeleteOne(context.Background(), bson.M{"group": 1})
+	if result.DeletedCount != 1 {
+		t.Errorf("expected DeleteOne to delete 1, got %d", result.DeletedCount)
+	}
+
+	result, _ = collection.DeleteMany(context.Background(), bson.M{"group": bson.M{"$lte": 2}})
+	if result.DeletedCount != 2 {
+		t.Errorf("expected DeleteMany to delete 2, got %d", result.DeletedCount)
+	}
+}
@@ -0,0 +1,482 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// runPipeline supports the aggregation stages & expressions used across travigo, anything else returns an error
+func (c *memoryCollection) runPipeline(documents []bson.M, stages []bson.D) ([]bson.M, error) {
+	for _, stage := range stages {
+		if len(stage) != 1 {
+			return nil, errors.New("Aggregation stages must have exactly one key")
+		}
+
+		name := stage[0].Key
+		argument := stage[0].Value
+
+		var err error
+
+		switch name {
+		case "$match":
+			filter, _ := normaliseValue(argument).(bson.M)
+			documents, err = filterDocuments(documents, filter)
+		case "$addFields", "$set":
+			fields, _ := normaliseValue(argument).(bson.M)
+			documents = addFieldsStage(documents, fields)
+		case "$project":
+			projection, _ := normaliseValue(argument).(bson.M)
+			documents = projectStage(documents, projection)
+		case "$unwind":
+			documents, err = unwindStage(documents, normaliseValue(argument))
+		case "$group":
+			group, _ := normaliseValue(argument).(bson.M)
+			documents, err = groupStage(documents, group)
+		case "$sort":
+			sortSpec, _ := argument.(bson.D)
+			sortDocuments(documents, sortSpec)
+		case "$limit":
+			limit, _ := toFloat(argument)
+			if int(limit) < len(documents) {
+				documents = documents[:int(limit)]
+			}
+		case "$skip":
+			skip, _ := toFloat(argument)
+			if int(skip) < len(documents) {
+				documents = documents[int(skip):]
+			} else {
+				documents = nil
+			}
+		case "$count":
+			documents = []bson.M{{fmt.Sprint(argument): int32(len(documents))}}
+		case "$lookup":
+			lookup, _ := normaliseValue(argument).(bson.M)
+			documents, err = c.lookupStage(documents, lookup)
+		case "$out":
+			c.database.Collection(fmt.Sprint(argument)).replaceAll(documents)
+			documents = nil
+		default:
+			return nil, errors.New(fmt.Sprintf("Unsupported aggregation stage %s", name))
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return documents, nil
+}
+
+func filterDocuments(documents []bson.M, filter bson.M) ([]bson.M, error) {
+	var filtered []bson.M
+
+	for _, document := range documents {
+		matched, err := matchDocument(document, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		if matched {
+			filtered = append(filtered, document)
+		}
+	}
+
+	return filtered, nil
+}
+
+func addFieldsStage(documents []bson.M, fields bson.M) []bson.M {
+	output := make([]bson.M, len(documents))
+
+	for i, document := range documents {
+		updated := document
+		for path, expression := range fields {
+			updated = setPath(updated, splitPath(path), evaluateExpression(document, expression))
+		}
+		output[i] = updated
+	}
+
+	return output
+}
+
+func projectStage(documents []bson.M, projection bson.M) []bson.M {
+	exclusion := true
+	for key, value := range projection {
+		if key != "_id" && (typeRank(value) != 2 && typeRank(value) != 8 || isTruthy(value)) {
+			exclusion = false
+		}
+	}
+
+	output := make([]bson.M, len(documents))
+
+	for i, document := range documents {
+		if exclusion {
+			projected := document
+			for path := range projection {
+				projected = unsetPath(projected, splitPath(path))
+			}
+			output[i] = projected
+			continue
+		}
+
+		projected := bson.M{}
+		if includeID, exists := projection["_id"]; !exists || isTruthy(includeID) {
+			if id, hasID := document["_id"]; hasID {
+				projected["_id"] = id
+			}
+		}
+
+		for path, value := range projection {
+			if path == "_id" {
+				if _, isExpression := value.(string); !isExpression {
+					continue
+				}
+			}
+
+			var fieldValue interface{}
+			if typeRank(value) == 2 || typeRank(value) == 8 {
+				if !isTruthy(value) {
+					continue
+				}
+
+				fieldValue = firstValue(document, path)
+				if fieldValue == nil {
+					continue
+				}
+			} else {
+				fieldValue = evaluateExpression(document, value)
+			}
+
+			projected = setPath(projected, splitPath(path), fieldValue)
+		}
+
+		output[i] = projected
+	}
+
+	return output
+}
+
+func unwindStage(documents []bson.M, argument interface{}) ([]bson.M, error) {
+	var path string
+	var preserveEmpty bool
+
+	switch v := argument.(type) {
+	case string:
+		path = v
+	case bson.M:
+		path, _ = v["path"].(string)
+		preserveEmpty = isTruthy(v["preserveNullAndEmptyArrays"])
+	}
+
+	if !strings.HasPrefix(path, "$") {
+		return nil, errors.New("$unwind path must start with $")
+	}
+	parts := splitPath(strings.TrimPrefix(path, "$"))
+
+	var output []bson.M
+
+	for _, document := range documents {
+		value := firstValue(document, strings.Join(parts, "."))
+
+		array, isArray := value.(bson.A)
+		if !isArray {
+			if value != nil {
+				output = append(output, document)
+			} else if preserveEmpty {
+				output = append(output, document)
+			}
+			continue
+		}
+
+		if len(array) == 0 && preserveEmpty {
+			output = append(output, unsetPath(document, parts))
+		}
+
+		for _, element := range array {
+			output = append(output, setPath(document, parts, element))
+		}
+	}
+
+	return output, nil
+}
+
+type groupAccumulator struct {
+	operator   string
+	expression interface{}
+}
+
+func groupStage(documents []bson.M, group bson.M) ([]bson.M, error) {
+	accumulators := map[string]groupAccumulator{}
+
+	for field, value := range group {
+		if field == "_id" {
+			continue
+		}
+
+		accumulator, isDocument := value.(bson.M)
+		if !isDocument || len(accumulator) != 1 {
+			return nil, errors.New(fmt.Sprintf("Invalid accumulator for %s", field))
+		}
+
+		for operator, expression := range accumulator {
+			switch operator {
+			case "$sum", "$avg", "$min", "$max", "$first", "$last", "$push", "$addToSet":
+				accumulators[field] = groupAccumulator{operator: operator, expression: expression}
+			default:
+				return nil, errors.New(fmt.Sprintf("Unsupported accumulator %s", operator))
+			}
+		}
+	}
+
+	var groupOrder []interface{}
+	groups := []bson.M{}
+	counts := []int{}
+
+	for _, document := range documents {
+		groupID := evaluateExpression(document, group["_id"])
+
+		groupIndex := -1
+		for i, existingID := range groupOrder {
+			if valuesEqual(existingID, groupID) {
+				groupIndex = i
+				break
+			}
+		}
+
+		if groupIndex == -1 {
+			groupOrder = append(groupOrder, groupID)
+			groups = append(groups, bson.M{"_id": groupID})
+			counts = append(counts, 0)
+			groupIndex = len(groups) - 1
+		}
+
+		groupDocument := groups[groupIndex]
+		counts[groupIndex]++
+
+		for field, accumulator := range accumulators {
+			value := evaluateExpression(document, accumulator.expression)
+
+			switch accumulator.operator {
+			case "$sum", "$avg":
+				current, _ := toFloat(groupDocument[field])
+				if number, isNumber := toFloat(value); isNumber {
+					groupDocument[field] = current + number
+				} else {
+					groupDocument[field] = current
+				}
+			case "$min", "$max":
+				if value == nil {
+					continue
+				}
+				current, exists := groupDocument[field]
+				comparison, _ := compareSortValues(value, current)
+				if !exists || (accumulator.operator == "$min" && comparison < 0) || (accumulator.operator == "$max" && comparison > 0) {
+					groupDocument[field] = value
+				}
+			case "$first":
+				if _, exists := groupDocument[field]; !exists {
+					groupDocument[field] = value
+				}
+			case "$last":
+				groupDocument[field] = value
+			case "$push", "$addToSet":
+				array, _ := groupDocument[field].(bson.A)
+				if accumulator.operator == "$push" || !containsValue(array, value) {
+					array = append(array, value)
+				}
+				groupDocument[field] = array
+			}
+		}
+	}
+
+	// Integer sums stay integers like they do in MongoDB
+	for i, groupDocument := range groups {
+		for field, accumulator := range accumulators {
+			switch accumulator.operator {
+			case "$sum":
+				total, _ := toFloat(groupDocument[field])
+				if total == float64(int64(total)) {
+					groupDocument[field] = numberLike(int32(0), int32(0), total)
+				}
+			case "$avg":
+				total, _ := toFloat(groupDocument[field])
+				groupDocument[field] = total / float64(counts[i])
+			}
+		}
+	}
+
+	return groups, nil
+}
+
+func (c *memoryCollection) lookupStage(documents []bson.M, lookup bson.M) ([]bson.M, error) {
+	from, _ := lookup["from"].(string)
+	localField, _ := lookup["localField"].(string)
+	foreignField, _ := lookup["foreignField"].(string)
+	as, _ := lookup["as"].(string)
+
+	if from == "" || localField == "" || foreignField == "" || as == "" {
+		return nil, errors.New("$lookup requires from, localField, foreignField and as")
+	}
+
+	foreignDocuments := c.database.Collection(from).snapshot()
+
+	output := make([]bson.M, len(documents))
+
+	for i, document := range documents {
+		localValues := expandArrays(lookupPath(document, splitPath(localField)))
+		if len(localValues) == 0 {
+			localValues = []interface{}{nil}
+		}
+
+		joined := bson.A{}
+		for _, foreignDocument := range foreignDocuments {
+			foreignValues := lookupPath(foreignDocument, splitPath(foreignField))
+
+			for _, localValue := range localValues {
+				if matchEquality(foreignValues, localValue) {
+					joined = append(joined, foreignDocument)
+					break
+				}
+			}
+		}
+
+		output[i] = setPath(document, splitPath(as), joined)
+	}
+
+	return output, nil
+}
+
+func sortDocuments(documents []bson.M, sortSpec bson.D) {
+	if len(sortSpec) == 0 {
+		return
+	}
+
+	sort.SliceStable(documents, func(i, j int) bool {
+		for _, sortField := range sortSpec {
+			direction, _ := toFloat(sortField.Value)
+
+			comparison, _ := compareSortValues(firstValue(documents[i], sortField.Key), firstValue(documents[j], sortField.Key))
+			if comparison == 0 {
+				continue
+			}
+
+			if direction < 0 {
+				return comparison > 0
+			}
+			return comparison < 0
+		}
+
+		return false
+	})
+}
+
+func evaluateExpression(document bson.M, expression interface{}) interface{} {
+	switch v := expression.(type) {
+	case string:
+		if v == "$$ROOT" || v == "$$CURRENT" {
+			return document
+		} else if strings.HasPrefix(v, "$$") {
+			return nil
+		} else if strings.HasPrefix(v, "$") {
+			return expressionPath(document, splitPath(strings.TrimPrefix(v, "$")))
+		}
+		return v
+	case bson.A:
+		values := bson.A{}
+		for _, element := range v {
+			values = append(values, evaluateExpression(document, element))
+		}
+		return values
+	case bson.M:
+		if len(v) == 1 {
+			for operator, argument := range v {
+				if strings.HasPrefix(operator, "$") {
+					return evaluateOperator(document, operator, argument)
+				}
+			}
+		}
+
+		values := bson.M{}
+		for key, element := range v {
+			values[key] = evaluateExpression(document, element)
+		}
+		return values
+	default:
+		return v
+	}
+}
+
+func evaluateOperator(document bson.M, operator string, argument interface{}) interface{} {
+	if operator == "$literal" {
+		return argument
+	}
+
+	evaluated := evaluateExpression(document, argument)
+	arguments, _ := evaluated.(bson.A)
+
+	switch operator {
+	case "$concat":
+		var builder strings.Builder
+		for _, part := range arguments {
+			partString, isString := part.(string)
+			if !isString {
+				return nil
+			}
+			builder.WriteString(partString)
+		}
+		return builder.String()
+	case "$toString":
+		return expressionToString(evaluated)
+	case "$toLower":
+		return strings.ToLower(expressionToString(evaluated))
+	case "$toUpper":
+		return strings.ToUpper(expressionToString(evaluated))
+	case "$arrayElemAt":
+		if len(arguments) != 2 {
+			return nil
+		}
+		array, _ := arguments[0].(bson.A)
+		index, _ := toFloat(arguments[1])
+		position := int(index)
+		if position < 0 {
+			position = len(array) + position
+		}
+		if position < 0 || position >= len(array) {
+			return nil
+		}
+		return array[position]
+	case "$size":
+		array, _ := evaluated.(bson.A)
+		return int32(len(array))
+	case "$ifNull":
+		for _, option := range arguments {
+			if option != nil {
+				return option
+			}
+		}
+		return nil
+	case "$eq":
+		return len(arguments) == 2 && valuesEqual(arguments[0], arguments[1])
+	}
+
+	return nil
+}
+
+func expressionToString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format("2006-01-02T15:04:05.000Z")
+	}
+
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Almost every lookup & upsert during an import is by primaryidentifier, so the memory collections keep the
+// positions of the documents for each one to avoid scanning the whole collection for every record
+const memoryIndexField = "primaryidentifier"
+
+// memoryIndex must only be used with the collection lock held
+type memoryIndex struct {
+	positions map[string][]int
+	// Documents where the field is set but isn't a string, eg. an array, so can't be found through the index
+	unindexed int
+}
+
+func newMemoryIndex(documents []bson.M) *memoryIndex {
+	index := &memoryIndex{
+		positions: map[string][]int{},
+	}
+
+	for position, document := range documents {
+		index.add(document, position)
+	}
+
+	return index
+}
+
+func (i *memoryIndex) add(document bson.M, position int) {
+	value, exists := document[memoryIndexField]
+	if !exists || value == nil {
+		return
+	}
+
+	key, isString := value.(string)
+	if !isString {
+		i.unindexed++
+		return
+	}
+
+	i.positions[key] = append(i.positions[key], position)
+}
+
+func (i *memoryIndex) remove(document bson.M, position int) {
+	value, exists := document[memoryIndexField]
+	if !exists || value == nil {
+		return
+	}
+
+	key, isString := value.(string)
+	if !isString {
+		i.unindexed--
+		return
+	}
+
+	positions := i.positions[key]
+	for j, indexedPosition := range positions {
+		if indexedPosition == position {
+			positions = append(positions[:j:j], positions[j+1:]...)
+			break
+		}
+	}
+
+	if len(positions) == 0 {
+		delete(i.positions, key)
+	} else {
+		i.positions[key] = positions
+	}
+}
+
+// candidates returns the positions of the only documents that could match the filter in insertion order,
+// or false when the index can't narrow it down and every document has to be checked
+func (i *memoryIndex) candidates(filter bson.M) ([]int, bool) {
+	if i.unindexed > 0 {
+		return nil, false
+	}
+
+	value, exists := filter[memoryIndexField]
+	if !exists {
+		return nil, false
+	}
+
+	key, isString := value.(string)
+	if !isString {
+		return nil, false
+	}
+
+	positions := make([]int, len(i.positions[key]))
+	copy(positions, i.positions[key])
+	sort.Ints(positions)
+
+	return positions, true
+}
+
+// distinctKey gives a comparable key for the values Distinct can de-duplicate with a map,
+// numbers share a key across their types as they do when compared
+func distinctKey(value interface{}) (interface{}, bool) {
+	if number, isNumber := toFloat(value); isNumber {
+		return number, true
+	}
+
+	switch value.(type) {
+	case string, bool, primitive.ObjectID, primitive.DateTime:
+		return value, true
+	}
+
+	return nil, false
+}
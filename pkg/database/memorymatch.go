@@ -0,0 +1,388 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matchDocument evaluates a normalised MongoDB query filter against a document
+func matchDocument(document bson.M, filter bson.M) (bool, error) {
+	for key, condition := range filter {
+		var matched bool
+		var err error
+
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(document, key, condition)
+		case "$comment":
+			matched = true
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, errors.New(fmt.Sprintf("Unsupported query operator %s", key))
+			}
+
+			matched, err = matchField(document, key, condition)
+		}
+
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func matchLogical(document bson.M, operator string, condition interface{}) (bool, error) {
+	clauses, isArray := condition.(bson.A)
+	if !isArray {
+		return false, errors.New(fmt.Sprintf("%s requires an array", operator))
+	}
+
+	for _, clause := range clauses {
+		clauseFilter, isDocument := clause.(bson.M)
+		if !isDocument {
+			return false, errors.New(fmt.Sprintf("%s entries must be documents", operator))
+		}
+
+		matched, err := matchDocument(document, clauseFilter)
+		if err != nil {
+			return false, err
+		}
+
+		switch operator {
+		case "$and":
+			if !matched {
+				return false, nil
+			}
+		case "$or":
+			if matched {
+				return true, nil
+			}
+		case "$nor":
+			if matched {
+				return false, nil
+			}
+		}
+	}
+
+	return operator != "$or", nil
+}
+
+func isOperatorDocument(value interface{}) bool {
+	document, isDocument := value.(bson.M)
+	if !isDocument || len(document) == 0 {
+		return false
+	}
+
+	for key := range document {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchField(document bson.M, path string, condition interface{}) (bool, error) {
+	values := lookupPath(document, splitPath(path))
+
+	if isOperatorDocument(condition) {
+		return matchOperators(values, condition.(bson.M))
+	}
+
+	return matchEquality(values, condition), nil
+}
+
+// expandArrays adds the elements of any array values as candidates, as a query on an array field matches its elements
+func expandArrays(values []interface{}) []interface{} {
+	var candidates []interface{}
+
+	for _, value := range values {
+		candidates = append(candidates, value)
+
+		if array, isArray := value.(bson.A); isArray {
+			candidates = append(candidates, array...)
+		}
+	}
+
+	return candidates
+}
+
+func matchEquality(values []interface{}, condition interface{}) bool {
+	if typeRank(condition) == 1 && len(values) == 0 {
+		return true
+	}
+
+	for _, candidate := range expandArrays(values) {
+		if regex, isRegex := condition.(primitive.Regex); isRegex {
+			if matchRegex(candidate, regex.Pattern, regex.Options) {
+				return true
+			}
+		} else if valuesEqual(candidate, condition) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchOperators(values []interface{}, operators bson.M) (bool, error) {
+	for operator, argument := range operators {
+		var matched bool
+
+		switch operator {
+		case "$eq":
+			matched = matchEquality(values, argument)
+		case "$ne":
+			matched = !matchEquality(values, argument)
+		case "$gt", "$gte", "$lt", "$lte":
+			matched = matchComparison(values, operator, argument)
+		case "$in", "$nin":
+			options, isArray := argument.(bson.A)
+			if !isArray {
+				return false, errors.New(fmt.Sprintf("%s requires an array", operator))
+			}
+
+			for _, option := range options {
+				if matchEquality(values, option) {
+					matched = true
+					break
+				}
+			}
+
+			if operator == "$nin" {
+				matched = !matched
+			}
+		case "$exists":
+			matched = (len(values) > 0) == isTruthy(argument)
+		case "$regex":
+			regexOptions, _ := operators["$options"].(string)
+			pattern := argument
+			if regex, isRegex := argument.(primitive.Regex); isRegex {
+				pattern = regex.Pattern
+				regexOptions += regex.Options
+			}
+
+			for _, candidate := range expandArrays(values) {
+				if matchRegex(candidate, fmt.Sprint(pattern), regexOptions) {
+					matched = true
+					break
+				}
+			}
+		case "$options":
+			matched = true
+		case "$size":
+			size, _ := toFloat(argument)
+			for _, value := range values {
+				if array, isArray := value.(bson.A); isArray && float64(len(array)) == size {
+					matched = true
+					break
+				}
+			}
+		case "$not":
+			notMatched, err := matchNot(values, argument)
+			if err != nil {
+				return false, err
+			}
+			matched = notMatched
+		case "$elemMatch":
+			elemMatched, err := matchElem(values, argument)
+			if err != nil {
+				return false, err
+			}
+			matched = elemMatched
+		case "$geoWithin":
+			withinMatched, err := matchGeoWithin(values, argument)
+			if err != nil {
+				return false, err
+			}
+			matched = withinMatched
+		default:
+			return false, errors.New(fmt.Sprintf("Unsupported query operator %s", operator))
+		}
+
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func matchComparison(values []interface{}, operator string, argument interface{}) bool {
+	for _, candidate := range expandArrays(values) {
+		comparison, comparable := compareValues(candidate, argument)
+		if !comparable {
+			continue
+		}
+
+		switch operator {
+		case "$gt":
+			if comparison > 0 {
+				return true
+			}
+		case "$gte":
+			if comparison >= 0 {
+				return true
+			}
+		case "$lt":
+			if comparison < 0 {
+				return true
+			}
+		case "$lte":
+			if comparison <= 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchNot(values []interface{}, argument interface{}) (bool, error) {
+	if regex, isRegex := argument.(primitive.Regex); isRegex {
+		return !matchEquality(values, regex), nil
+	}
+
+	operators, isDocument := argument.(bson.M)
+	if !isDocument {
+		return false, errors.New("$not requires an operator document or regex")
+	}
+
+	matched, err := matchOperators(values, operators)
+	return !matched, err
+}
+
+func matchElem(values []interface{}, argument interface{}) (bool, error) {
+	condition, isDocument := argument.(bson.M)
+	if !isDocument {
+		return false, errors.New("$elemMatch requires a document")
+	}
+
+	for _, value := range values {
+		array, isArray := value.(bson.A)
+		if !isArray {
+			continue
+		}
+
+		for _, element := range array {
+			var matched bool
+			var err error
+
+			if isOperatorDocument(condition) {
+				matched, err = matchOperators([]interface{}{element}, condition)
+			} else if elementDocument, isElementDocument := element.(bson.M); isElementDocument {
+				matched, err = matchDocument(elementDocument, condition)
+			}
+
+			if err != nil {
+				return false, err
+			}
+			if matched {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// matchGeoWithin only supports the legacy $box shape against [longitude, latitude] pairs
+func matchGeoWithin(values []interface{}, argument interface{}) (bool, error) {
+	shape, isDocument := argument.(bson.M)
+	if !isDocument || shape["$box"] == nil {
+		return false, errors.New("Only $geoWithin $box is supported")
+	}
+
+	box, _ := shape["$box"].(bson.A)
+	if len(box) != 2 {
+		return false, errors.New("$box requires 2 points")
+	}
+
+	bottomLeft, bottomLeftValid := coordinatePair(box[0])
+	topRight, topRightValid := coordinatePair(box[1])
+	if !bottomLeftValid || !topRightValid {
+		return false, errors.New("Invalid $box points")
+	}
+
+	for _, value := range values {
+		if geoJSON, isGeoJSON := value.(bson.M); isGeoJSON {
+			value = geoJSON["coordinates"]
+		}
+
+		point, isPoint := coordinatePair(value)
+		if !isPoint {
+			continue
+		}
+
+		if point[0] >= bottomLeft[0] && point[0] <= topRight[0] && point[1] >= bottomLeft[1] && point[1] <= topRight[1] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func coordinatePair(value interface{}) ([2]float64, bool) {
+	array, isArray := value.(bson.A)
+	if !isArray || len(array) != 2 {
+		return [2]float64{}, false
+	}
+
+	x, xValid := toFloat(array[0])
+	y, yValid := toFloat(array[1])
+
+	return [2]float64{x, y}, xValid && yValid
+}
+
+var regexCache = map[string]*regexp.Regexp{}
+var regexCacheMutex sync.Mutex
+
+func matchRegex(value interface{}, pattern string, options string) bool {
+	valueString, isString := value.(string)
+	if !isString {
+		return false
+	}
+
+	flags := ""
+	for _, option := range options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		}
+	}
+	if flags != "" {
+		pattern = fmt.Sprintf("(?%s)%s", flags, pattern)
+	}
+
+	regexCacheMutex.Lock()
+	regex, exists := regexCache[pattern]
+	if !exists {
+		regex, _ = regexp.Compile(pattern)
+		regexCache[pattern] = regex
+	}
+	regexCacheMutex.Unlock()
+
+	return regex != nil && regex.MatchString(valueString)
+}
+
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case nil, primitive.Null, primitive.Undefined:
+		return false
+	}
+
+	if number, isNumber := toFloat(value); isNumber {
+		return number != 0
+	}
+
+	return true
+}
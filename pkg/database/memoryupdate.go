@@ -0,0 +1,165 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// applyUpdate returns a new copy of the document with the update operators applied
+func applyUpdate(document bson.M, update bson.M, inserting bool) (bson.M, error) {
+	updated := document
+
+	for operator, argument := range update {
+		fields, isDocument := argument.(bson.M)
+		if !isDocument {
+			return nil, errors.New(fmt.Sprintf("%s requires a document", operator))
+		}
+
+		for path, value := range fields {
+			parts := splitPath(path)
+
+			switch operator {
+			case "$set":
+				updated = setPath(updated, parts, value)
+			case "$setOnInsert":
+				if inserting {
+					updated = setPath(updated, parts, value)
+				}
+			case "$unset":
+				updated = unsetPath(updated, parts)
+			case "$inc":
+				current := firstValue(updated, path)
+				currentNumber, _ := toFloat(current)
+				increment, isNumber := toFloat(value)
+				if !isNumber {
+					return nil, errors.New("$inc requires a number")
+				}
+
+				updated = setPath(updated, parts, numberLike(current, value, currentNumber+increment))
+			case "$push", "$addToSet":
+				current, _ := firstValue(updated, path).(bson.A)
+				array := make(bson.A, len(current))
+				copy(array, current)
+
+				var additions bson.A
+				if each, isEach := value.(bson.M); isEach && each["$each"] != nil {
+					additions, _ = each["$each"].(bson.A)
+				} else {
+					additions = bson.A{value}
+				}
+
+				for _, addition := range additions {
+					if operator == "$addToSet" && containsValue(array, addition) {
+						continue
+					}
+					array = append(array, addition)
+				}
+
+				updated = setPath(updated, parts, array)
+			case "$pull":
+				current, _ := firstValue(updated, path).(bson.A)
+				array := bson.A{}
+				for _, element := range current {
+					if !valuesEqual(element, value) {
+						array = append(array, element)
+					}
+				}
+
+				updated = setPath(updated, parts, array)
+			default:
+				return nil, errors.New(fmt.Sprintf("Unsupported update operator %s", operator))
+			}
+		}
+	}
+
+	return updated, nil
+}
+
+func isUpdateDocument(update bson.M) bool {
+	for key := range update {
+		return strings.HasPrefix(key, "$")
+	}
+
+	return false
+}
+
+// upsertBase builds the starting document for an upsert from the equality conditions in the filter
+func upsertBase(filter bson.M) bson.M {
+	document := bson.M{}
+
+	for key, condition := range filter {
+		if key == "$and" {
+			clauses, _ := condition.(bson.A)
+			for _, clause := range clauses {
+				if clauseFilter, isDocument := clause.(bson.M); isDocument {
+					for clauseKey, clauseValue := range upsertBase(clauseFilter) {
+						document = setPath(document, splitPath(clauseKey), clauseValue)
+					}
+				}
+			}
+			continue
+		}
+
+		if strings.HasPrefix(key, "$") {
+			continue
+		}
+
+		if operators, isOperators := condition.(bson.M); isOperators && isOperatorDocument(operators) {
+			if equal, hasEquality := operators["$eq"]; hasEquality {
+				document = setPath(document, splitPath(key), equal)
+			}
+			continue
+		}
+
+		if _, isRegex := condition.(primitive.Regex); isRegex {
+			continue
+		}
+
+		document = setPath(document, splitPath(key), condition)
+	}
+
+	return document
+}
+
+func firstValue(document bson.M, path string) interface{} {
+	values := lookupPath(document, splitPath(path))
+	if len(values) == 0 {
+		return nil
+	}
+
+	return values[0]
+}
+
+func containsValue(array bson.A, value interface{}) bool {
+	for _, element := range array {
+		if valuesEqual(element, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// numberLike keeps integer fields as integers after arithmetic
+func numberLike(current interface{}, change interface{}, result float64) interface{} {
+	_, currentIsFloat := current.(float64)
+	_, changeIsFloat := change.(float64)
+
+	if currentIsFloat || changeIsFloat {
+		return result
+	}
+
+	if result >= -2147483648 && result <= 2147483647 {
+		if _, currentIsLong := current.(int64); !currentIsLong {
+			if _, changeIsLong := change.(int64); !changeIsLong {
+				return int32(result)
+			}
+		}
+	}
+
+	return int64(result)
+}
@@ -0,0 +1,386 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// normaliseDocument round trips any document through BSON so that the in-memory database only has to deal with
+// bson.M, bson.A and the primitive BSON types regardless of whether it was given a struct, bson.D or bson.M
+func normaliseDocument(document interface{}) (bson.M, error) {
+	if document == nil {
+		return bson.M{}, nil
+	}
+
+	documentBytes, err := marshalDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded bson.D
+	if err := bson.Unmarshal(documentBytes, &decoded); err != nil {
+		return nil, err
+	}
+
+	return normaliseValue(decoded).(bson.M), nil
+}
+
+// normaliseOrderedDocument is the same as normaliseDocument but keeps the key order, needed for sort specifications
+func normaliseOrderedDocument(document interface{}) (bson.D, error) {
+	if document == nil {
+		return bson.D{}, nil
+	}
+
+	documentBytes, err := marshalDocument(document)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded bson.D
+	if err := bson.Unmarshal(documentBytes, &decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+// marshalDocument passes through documents that have already been marshalled to BSON by the caller
+func marshalDocument(document interface{}) ([]byte, error) {
+	switch v := document.(type) {
+	case []byte:
+		return v, nil
+	case bson.Raw:
+		return v, nil
+	}
+
+	return bson.Marshal(document)
+}
+
+// normalisePipeline converts any pipeline representation into a list of ordered stages
+func normalisePipeline(pipeline interface{}) ([]bson.D, error) {
+	documentBytes, err := bson.Marshal(bson.M{"pipeline": pipeline})
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Pipeline []bson.D `bson:"pipeline"`
+	}
+	if err := bson.Unmarshal(documentBytes, &decoded); err != nil {
+		return nil, err
+	}
+
+	return decoded.Pipeline, nil
+}
+
+func normaliseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.D:
+		document := bson.M{}
+		for _, element := range v {
+			document[element.Key] = normaliseValue(element.Value)
+		}
+		return document
+	case bson.M:
+		document := bson.M{}
+		for key, element := range v {
+			document[key] = normaliseValue(element)
+		}
+		return document
+	case bson.A:
+		array := bson.A{}
+		for _, element := range v {
+			array = append(array, normaliseValue(element))
+		}
+		return array
+	default:
+		return v
+	}
+}
+
+func copyDocument(document bson.M) bson.M {
+	documentCopy := make(bson.M, len(document))
+	for key, value := range document {
+		documentCopy[key] = value
+	}
+
+	return documentCopy
+}
+
+// lookupPath returns every value found at the dotted path, traversing into arrays the same way MongoDB queries do
+func lookupPath(value interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{value}
+	}
+
+	switch v := value.(type) {
+	case bson.M:
+		child, exists := v[parts[0]]
+		if !exists {
+			return nil
+		}
+
+		return lookupPath(child, parts[1:])
+	case bson.A:
+		var values []interface{}
+
+		if index, err := strconv.Atoi(parts[0]); err == nil {
+			if index >= 0 && index < len(v) {
+				values = append(values, lookupPath(v[index], parts[1:])...)
+			}
+		}
+
+		for _, element := range v {
+			if _, isDocument := element.(bson.M); isDocument {
+				values = append(values, lookupPath(element, parts)...)
+			}
+		}
+
+		return values
+	default:
+		return nil
+	}
+}
+
+// expressionPath resolves a field path in an aggregation expression where arrays of documents produce arrays of values
+func expressionPath(value interface{}, parts []string) interface{} {
+	if len(parts) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case bson.M:
+		return expressionPath(v[parts[0]], parts[1:])
+	case bson.A:
+		values := bson.A{}
+		for _, element := range v {
+			if _, isDocument := element.(bson.M); !isDocument {
+				continue
+			}
+
+			if resolved := expressionPath(element, parts); resolved != nil {
+				values = append(values, resolved)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// setPath returns a copy of the document with the value set at the dotted path, never modifying the original
+func setPath(document bson.M, parts []string, value interface{}) bson.M {
+	updated := copyDocument(document)
+
+	if len(parts) == 1 {
+		updated[parts[0]] = value
+		return updated
+	}
+
+	switch child := document[parts[0]].(type) {
+	case bson.M:
+		updated[parts[0]] = setPath(child, parts[1:], value)
+	case bson.A:
+		if index, err := strconv.Atoi(parts[1]); err == nil && index >= 0 {
+			array := make(bson.A, len(child))
+			copy(array, child)
+			for len(array) <= index {
+				array = append(array, nil)
+			}
+
+			if len(parts) == 2 {
+				array[index] = value
+			} else {
+				childDocument, _ := array[index].(bson.M)
+				if childDocument == nil {
+					childDocument = bson.M{}
+				}
+				array[index] = setPath(childDocument, parts[2:], value)
+			}
+
+			updated[parts[0]] = array
+		} else {
+			updated[parts[0]] = setPath(bson.M{}, parts[1:], value)
+		}
+	default:
+		updated[parts[0]] = setPath(bson.M{}, parts[1:], value)
+	}
+
+	return updated
+}
+
+func unsetPath(document bson.M, parts []string) bson.M {
+	if _, exists := document[parts[0]]; !exists {
+		return document
+	}
+
+	updated := copyDocument(document)
+
+	if len(parts) == 1 {
+		delete(updated, parts[0])
+		return updated
+	}
+
+	if child, isDocument := document[parts[0]].(bson.M); isDocument {
+		updated[parts[0]] = unsetPath(child, parts[1:])
+	}
+
+	return updated
+}
+
+func splitPath(path string) []string {
+	return strings.Split(path, ".")
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// typeRank follows the MongoDB BSON comparison order so that mixed type sorts behave the same
+func typeRank(value interface{}) int {
+	switch value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, int, float64, float32, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.M:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	default:
+		return 12
+	}
+}
+
+// compareValues orders two values, the boolean is false when the types can't be meaningfully compared
+func compareValues(a interface{}, b interface{}) (int, bool) {
+	if typeRank(a) != typeRank(b) {
+		return 0, false
+	}
+
+	switch av := a.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 0, true
+	case string:
+		return strings.Compare(av, b.(string)), true
+	case bool:
+		bv := b.(bool)
+		if av == bv {
+			return 0, true
+		} else if !av {
+			return -1, true
+		}
+		return 1, true
+	case primitive.DateTime:
+		return compareOrdered(int64(av), int64(b.(primitive.DateTime))), true
+	case primitive.ObjectID:
+		return strings.Compare(av.Hex(), b.(primitive.ObjectID).Hex()), true
+	case bson.A:
+		bv := b.(bson.A)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if comparison, _ := compareSortValues(av[i], bv[i]); comparison != 0 {
+				return comparison, true
+			}
+		}
+		return compareOrdered(len(av), len(bv)), true
+	}
+
+	if af, isNumber := toFloat(a); isNumber {
+		bf, _ := toFloat(b)
+		return compareOrdered(af, bf), true
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+// compareSortValues gives a total order across all types
+func compareSortValues(a interface{}, b interface{}) (int, bool) {
+	if rankComparison := compareOrdered(typeRank(a), typeRank(b)); rankComparison != 0 {
+		return rankComparison, true
+	}
+
+	return compareValues(a, b)
+}
+
+func compareOrdered[T int | int64 | float64](a T, b T) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func valuesEqual(a interface{}, b interface{}) bool {
+	if _, isNumber := toFloat(a); isNumber {
+		comparison, comparable := compareValues(a, b)
+		return comparable && comparison == 0
+	}
+
+	switch av := a.(type) {
+	case bson.M:
+		bv, isDocument := b.(bson.M)
+		if !isDocument || len(av) != len(bv) {
+			return false
+		}
+		for key, value := range av {
+			if !valuesEqual(value, bv[key]) {
+				return false
+			}
+		}
+		return true
+	case bson.A:
+		bv, isArray := b.(bson.A)
+		if !isArray || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if typeRank(a) == 1 && typeRank(b) == 1 {
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
@@ -1,6 +1,7 @@
 package dataimporter
 
 import (
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
@@ -8,8 +9,12 @@ import (
 
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
 	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/dataimporter/scheduler"
 
+	dataaggregator "github.com/travigo/travigo/pkg/dataaggregator/global"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 
@@ -41,6 +46,10 @@ func RegisterCLI() *cli.Command {
 						Name:  "force",
 						Usage: "Force the import of the dataset",
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Convert & validate the dataset and report what would change without writing anything, exits with an error if any problems are found",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					if err := database.Connect(); err != nil {
@@ -49,6 +58,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						log.Fatal().Err(err).Msg("Failed to connect to Redis")
 					}
+					if err := queue_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to queue")
+					}
 
 					datasetid := c.String("id")
 					forceImport := c.Bool("force")
@@ -70,6 +82,24 @@ func RegisterCLI() *cli.Command {
 						return err
 					}
 
+					if c.Bool("dry-run") {
+						report, err := manager.DryRunDataset(&dataset)
+						if err != nil {
+							return err
+						}
+
+						report.Write(os.Stdout)
+
+						if report.ValidationError != "" {
+							return errors.New("Dataset failed validation")
+						}
+						if report.HasProblems() {
+							return errors.New("Dry run found problems with the dataset")
+						}
+
+						return nil
+					}
+
 					for {
 						startTime := time.Now()
 
@@ -95,6 +125,104 @@ func RegisterCLI() *cli.Command {
 					return nil
 				},
 			},
+			{
+				Name:  "scheduler",
+				Usage: "Import every registered dataset on its schedule and link & index the results",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Value: 2,
+						Usage: "Number of static datasets that can be imported at the same time",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-indexer",
+						Usage: "Don't index stops into Elasticsearch after they have been linked",
+					},
+					&cli.StringSliceFlag{
+						Name:  "dataset",
+						Usage: "Only schedule these datasets (can be repeated)",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := database.Connect(); err != nil {
+						return err
+					}
+					if err := redis_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to Redis")
+					}
+					if err := queue_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to queue")
+					}
+
+					runIndexer := !c.Bool("skip-indexer")
+					if runIndexer {
+						if err := elastic_client.Connect(true); err != nil {
+							return err
+						}
+						dataaggregator.Setup()
+					}
+
+					scheduledDatasets := manager.GetRegisteredDataSets()
+					if onlyDatasets := c.StringSlice("dataset"); len(onlyDatasets) > 0 {
+						scheduledDatasets = []datasets.DataSet{}
+
+						for _, identifier := range onlyDatasets {
+							dataset, err := manager.GetDataset(identifier)
+							if err != nil {
+								return err
+							}
+
+							scheduledDatasets = append(scheduledDatasets, dataset)
+						}
+					}
+
+					datasetScheduler := scheduler.NewScheduler(scheduledDatasets, c.Int("concurrency"), runIndexer)
+					if err := datasetScheduler.Run(); err != nil {
+						return err
+					}
+
+					signals := make(chan os.Signal, 1)
+					signal.Notify(signals, syscall.SIGINT)
+					defer signal.Stop(signals)
+
+					<-signals // wait for signal
+					go func() {
+						<-signals // hard exit on second signal (in case shutdown gets stuck)
+						os.Exit(1)
+					}()
+
+					return nil
+				},
+			},
+			{
+				Name:  "rollback",
+				Usage: "Roll a dataset back to its previous version until it is next imported",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "id",
+						Usage:    "ID of the dataset",
+						Required: true,
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := database.Connect(); err != nil {
+						return err
+					}
+					if err := redis_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to Redis")
+					}
+					if err := queue_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to queue")
+					}
+
+					dataset, err := manager.GetDataset(c.String("id"))
+					if err != nil {
+						return err
+					}
+
+					return manager.RollbackDataset(&dataset)
+				},
+			},
 			{
 				Name:  "multi-realtime",
 				Usage: "Import mutliple realtime datasets",
@@ -106,6 +234,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						log.Fatal().Err(err).Msg("Failed to connect to Redis")
 					}
+					if err := queue_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to queue")
+					}
 
 					allDatasets := manager.GetRegisteredDataSets()
 
@@ -130,10 +261,9 @@ func RegisterCLI() *cli.Command {
 							for {
 								startTime := time.Now()
 
-								err := manager.ImportDataset(&dataset, false)
+								_, err := manager.ImportDatasetWithTrigger(&dataset, false, "realtime")
 
 								if err != nil {
-									// TODO report failure here
 									log.Error().Err(err).Str("id", dataset.Identifier).Msg("Failed to import dataset")
 									time.Sleep(1 * time.Minute)
 								}
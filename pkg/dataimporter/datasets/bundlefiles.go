@@ -0,0 +1,72 @@
+package datasets
+
+import "path"
+
+// BundleFiles picks which files from a bundle, directory or glob source are imported & what format they are
+type BundleFiles struct {
+	// Glob patterns matched against both the full path & the file name, when set only matching files are imported
+	Include []string
+	Exclude []string
+
+	// Files matching a pattern are imported as that format instead of the dataset format, the first match wins
+	Formats []BundleFileFormat
+}
+
+type BundleFileFormat struct {
+	Pattern string
+	Format  DataSetFormat
+}
+
+func matchesFilePattern(patterns []string, filePath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, filePath); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(filePath)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExcludesFile is true when the file or nested bundle matches one of the exclude patterns
+func (d *DataSet) ExcludesFile(filePath string) bool {
+	return matchesFilePattern(d.BundleFiles.Exclude, filePath)
+}
+
+// IncludesFile is true when the file should be imported
+func (d *DataSet) IncludesFile(filePath string) bool {
+	if d.ExcludesFile(filePath) {
+		return false
+	}
+
+	return len(d.BundleFiles.Include) == 0 || matchesFilePattern(d.BundleFiles.Include, filePath)
+}
+
+// FormatForFile returns the format the file should be imported as
+func (d *DataSet) FormatForFile(filePath string) DataSetFormat {
+	for _, fileFormat := range d.BundleFiles.Formats {
+		if matchesFilePattern([]string{fileFormat.Pattern}, filePath) {
+			return fileFormat.Format
+		}
+	}
+
+	return d.Format
+}
+
+// ImportsArchive is true when a zip inside a bundle is picked out by an include or format pattern,
+// it's then imported as a file (eg. a bundle of GTFS feeds) rather than being unpacked
+func (d *DataSet) ImportsArchive(filePath string) bool {
+	if matchesFilePattern(d.BundleFiles.Include, filePath) {
+		return true
+	}
+
+	for _, fileFormat := range d.BundleFiles.Formats {
+		if matchesFilePattern([]string{fileFormat.Pattern}, filePath) {
+			return true
+		}
+	}
+
+	return false
+}
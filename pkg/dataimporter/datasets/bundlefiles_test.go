@@ -0,0 +1,49 @@
+package datasets
+
+import (
+	"path"
+	"testing"
+)
+
+func TestBundleFiles(t *testing.T) {
+	dataset := &DataSet{
+		Format: DataSetFormatTransXChange,
+		BundleFiles: BundleFiles{
+			Include: []string{"*.xml", "gtfs/*"},
+			Exclude: []string{"*_old.xml"},
+			Formats: []BundleFileFormat{
+				{Pattern: "gtfs/*", Format: DataSetFormatGTFSSchedule},
+				{Pattern: "*.zip", Format: DataSetFormatCIF},
+			},
+		},
+	}
+
+	for _, test := range []struct {
+		filePath       string
+		included       bool
+		format         DataSetFormat
+		importsArchive bool
+	}{
+		{"bundle.zip/services/a.xml", true, DataSetFormatTransXChange, false},
+		{"bundle.zip/services/a_old.xml", false, DataSetFormatTransXChange, false},
+		{"readme.md", false, DataSetFormatTransXChange, false},
+		{"gtfs/feed.zip", true, DataSetFormatGTFSSchedule, true},
+		{"other/feed.zip", false, DataSetFormatCIF, true},
+		{"other/nested.tar", false, DataSetFormatTransXChange, false},
+		{"nested.zip", false, DataSetFormatCIF, true},
+	} {
+		if included := dataset.IncludesFile(test.filePath); included != test.included {
+			t.Errorf("expected %s included to be %t", test.filePath, test.included)
+		}
+		if format := dataset.FormatForFile(test.filePath); format != test.format {
+			t.Errorf("expected %s to be %s, got %s", test.filePath, test.format, format)
+		}
+		// Only nested zips are checked for whether they're unpacked
+		if path.Ext(test.filePath) != ".zip" {
+			continue
+		}
+		if importsArchive := dataset.ImportsArchive(test.filePath); importsArchive != test.importsArchive {
+			t.Errorf("expected %s imports archive to be %t", test.filePath, test.importsArchive)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package datasets
 
 import (
+	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/adjust/rmq/v5"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
 )
 
 type DataSet struct {
@@ -14,25 +15,50 @@ type DataSet struct {
 
 	Provider Provider
 
+	// URL, file, directory or glob pattern
 	Source               string
 	SourceAuthentication SourceAuthentication `json:"-"`
 
 	DatasetSize     string
 	RefreshInterval time.Duration
+	// Cron expression for when the scheduler imports the dataset, used instead of RefreshInterval
+	Schedule string
+	// How long without a successful import before the dataset is reported as stale
+	StaleAfter time.Duration
 
 	UnpackBundle      BundleFormat `json:"-"`
+	BundleFiles       BundleFiles  `json:"-"`
 	SupportedObjects  SupportedObjects
 	IgnoreObjects     IgnoreObjects
+	Filters           RecordFilters     `json:"-"`
 	ImportDestination ImportDestination `json:"-"`
 
 	CustomConfig map[string]string
 
 	LinkedDataset string
 
+	// Datasets with a higher priority are preferred when the services linker finds the same service or journey in more than one
+	Priority int
+
+	Validation ValidationThresholds `json:"-"`
+
 	DownloadHandler func(*http.Request) `json:"-"`
 
 	// Internal only
-	Queue *rmq.Queue `json:"-"`
+	Queue *vehicletracker.PartitionedRealtimeQueue `json:"-"`
+}
+
+// ValidationThresholds control when a staged import is considered broken and won't be promoted
+type ValidationThresholds struct {
+	// Fraction of records that can disappear since the previous version, defaults to 0.5
+	MaxRecordCountDrop float64
+	// Fraction of service & stop references that can be missing, defaults to 0.1
+	MaxMissingReferences float64
+}
+
+// ImportCollectionName is the collection records are staged in during an import before being promoted to the live collection
+func ImportCollectionName(collection string) string {
+	return fmt.Sprintf("%s_import", collection)
 }
 
 type SourceAuthentication struct {
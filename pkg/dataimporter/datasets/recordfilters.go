@@ -0,0 +1,53 @@
+package datasets
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// RecordFilters are expr-lang expressions evaluated against each imported record of the object type,
+// eg. `Location != nil && Location.Coordinates[0] > -8.2` on stops.
+// Journeys calling at a removed stop or belonging to a removed service are removed as well,
+// along with any services that are left without journeys
+type RecordFilters struct {
+	Operators      []RecordFilter
+	OperatorGroups []RecordFilter
+	Stops          []RecordFilter
+	StopGroups     []RecordFilter
+	Services       []RecordFilter
+	Journeys       []RecordFilter
+}
+
+// RecordFilter either keeps only the records matching Keep or drops the ones matching Drop
+type RecordFilter struct {
+	Keep string
+	Drop string
+}
+
+// Compile checks the expression against the record type it will be run on
+func (f *RecordFilter) Compile(record interface{}) (*vm.Program, error) {
+	if (f.Keep == "") == (f.Drop == "") {
+		return nil, errors.New("Record filter must have exactly one of keep or drop")
+	}
+
+	expression := f.Keep
+	if f.Drop != "" {
+		expression = f.Drop
+	}
+
+	program, err := expr.Compile(expression, expr.Env(record), expr.AsBool())
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Invalid record filter %s: %s", expression, err))
+	}
+
+	return program, nil
+}
+
+// IsEmpty is true when there are no filters for any object type
+func (f *RecordFilters) IsEmpty() bool {
+	return len(f.Operators) == 0 && len(f.OperatorGroups) == 0 && len(f.Stops) == 0 &&
+		len(f.StopGroups) == 0 && len(f.Services) == 0 && len(f.Journeys) == 0
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/transforms"
 	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -191,7 +192,7 @@ func (c *CommonInterfaceFormat) Import(dataset datasets.DataSet, datasource *ctd
 	log.Info().Msgf(" - %d Journeys", len(journeys))
 
 	// Journeys table
-	journeysCollection := database.GetCollection("journeys")
+	journeysCollection := database.GetCollection(datasets.ImportCollectionName("journeys"))
 
 	// Import journeys
 	log.Info().Msg("Importing CTDF Journeys into Mongo")
@@ -217,6 +218,8 @@ func (c *CommonInterfaceFormat) Import(dataset datasets.DataSet, datasource *ctd
 			journey.ModificationDateTime = time.Now()
 			journey.DataSource = datasource
 
+			transforms.TransformImport(journey, 1, dataset.Identifier)
+
 			insertModel := mongo.NewInsertOneModel()
 
 			bsonRep, _ := bson.Marshal(journey)
@@ -3,9 +3,9 @@ package formats
 import (
 	"io"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
 )
 
 type Format interface {
@@ -15,5 +15,5 @@ type Format interface {
 
 type RealtimeQueueFormat interface {
 	Format
-	SetupRealtimeQueue(rmq.Queue)
+	SetupRealtimeQueue(*vehicletracker.PartitionedRealtimeQueue)
 }
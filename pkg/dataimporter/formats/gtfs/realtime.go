@@ -3,7 +3,6 @@ package gtfs
 import (
 	"context"
 	"crypto/sha256"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -11,7 +10,6 @@ import (
 	"time"
 
 	"github.com/MobilityData/gtfs-realtime-bindings/golang/gtfs"
-	"github.com/adjust/rmq/v5"
 	"github.com/eko/gocache/lib/v4/cache"
 	"github.com/eko/gocache/lib/v4/store"
 	redisstore "github.com/eko/gocache/store/redis/v4"
@@ -21,18 +19,19 @@ import (
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
 	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
 	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"google.golang.org/protobuf/proto"
 )
 
 type Realtime struct {
 	reader io.Reader
-	queue  rmq.Queue
+	queue  *vehicletracker.PartitionedRealtimeQueue
 
 	redisCache *cache.Cache[string]
 }
 
-func (r *Realtime) SetupRealtimeQueue(queue rmq.Queue) {
+func (r *Realtime) SetupRealtimeQueue(queue *vehicletracker.PartitionedRealtimeQueue) {
 	r.queue = queue
 
 	redisStore := redisstore.NewRedis(redis_client.Client, store.WithExpiration(90*time.Minute))
@@ -78,7 +77,7 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			trip = vehiclePosition.GetTrip()
 			recordedAtTime = time.Unix(int64(*vehiclePosition.Timestamp), 0)
 
-			recordedAtDifference := time.Now().UTC().Sub(recordedAtTime)
+			recordedAtDifference := util.Now().UTC().Sub(recordedAtTime)
 
 			// Skip any records that haven't been updated in over 20 minutes
 			if recordedAtDifference.Minutes() > 20 {
@@ -86,7 +85,7 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			}
 
 		} else {
-			recordedAtTime = time.Now()
+			recordedAtTime = util.Now()
 		}
 		if tripUpdate != nil {
 			trip = tripUpdate.GetTrip()
@@ -177,8 +176,7 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 					RecordedAt: recordedAtTime,
 				}
 
-				updateEventJson, _ := json.Marshal(updateEvent)
-				r.queue.PublishBytes(updateEventJson)
+				r.queue.Publish(&updateEvent)
 
 				serviceAlertCount += 1
 			}
@@ -190,7 +188,7 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			var timeFrameDateTime time.Time
 
 			if trip.StartDate == nil {
-				timeFrameDateTime = time.Now()
+				timeFrameDateTime = util.Now()
 			} else {
 				timeFrameDateTime, err = time.Parse("20060102", *trip.StartDate)
 				if err != nil {
@@ -301,9 +299,7 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 				withTripUpdate += 1
 			}
 
-			locationEventJson, _ := json.Marshal(locationEvent)
-
-			r.queue.PublishBytes(locationEventJson)
+			r.queue.Publish(&locationEvent)
 
 		} else {
 			if entity.Vehicle != nil && entity.Vehicle.Vehicle != nil && entity.Vehicle.Vehicle.GetId() != "" {
@@ -325,19 +321,18 @@ func (r *Realtime) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 		Int("total", len(feed.Entity)).
 		Msg("Submitted vehicle updates")
 
-	checkQueueSize()
+	checkQueueSize(r.queue)
 
 	return nil
 }
 
-func checkQueueSize() {
-	stats, _ := redis_client.QueueConnection.CollectStats([]string{"realtime-queue"})
-	inQueue := stats.QueueStats["realtime-queue"].ReadyCount
+func checkQueueSize(queue *vehicletracker.PartitionedRealtimeQueue) {
+	inQueue := queue.ReadyCount()
 
 	if inQueue >= 40000 {
 		log.Info().Int64("queuesize", inQueue).Msg("Queue size too long, hanging back for a bit")
 		time.Sleep(time.Duration(30+rand.IntN(20)) * time.Minute)
 
-		checkQueueSize()
+		checkQueueSize(queue)
 	}
 }
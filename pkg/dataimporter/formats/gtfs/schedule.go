@@ -107,7 +107,7 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 	}
 
 	log.Info().Int("length", len(g.Agencies)).Msg("Starting Operators")
-	agenciesQueue := NewDatabaseBatchProcessingQueue("operators", 1*time.Second, 10*time.Second, 500)
+	agenciesQueue := NewDatabaseBatchProcessingQueue(datasets.ImportCollectionName("operators_raw"), 1*time.Second, 10*time.Second, 500)
 
 	if dataset.SupportedObjects.Operators {
 		agenciesQueue.Process()
@@ -118,6 +118,7 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 		operatorID := fmt.Sprintf("%s-operator-%s", dataset.Identifier, gtfsAgency.ID)
 		ctdfOperator := &ctdf.Operator{
 			PrimaryIdentifier:    operatorID,
+			OtherIdentifiers:     []string{operatorID},
 			CreationDateTime:     time.Now(),
 			ModificationDateTime: time.Now(),
 			DataSource:           datasource,
@@ -125,6 +126,13 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			Website:              gtfsAgency.URL,
 		}
 
+		// Lets the operators linker merge the agency with the Traveline NOC operator
+		if nocRef := agencyNOCMapping[gtfsAgency.ID]; nocRef != "" {
+			ctdfOperator.OtherIdentifiers = append(ctdfOperator.OtherIdentifiers, nocRef)
+		}
+
+		transforms.TransformImport(ctdfOperator, 1, dataset.Identifier)
+
 		if dataset.SupportedObjects.Operators {
 			// Insert
 			bsonRep, _ := bson.Marshal(bson.M{"$set": ctdfOperator})
@@ -142,7 +150,7 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 
 	// Stops
 	log.Info().Int("length", len(g.Stops)).Msg("Starting Stops")
-	stopsQueue := NewDatabaseBatchProcessingQueue("stops_raw", 1*time.Second, 10*time.Second, 500)
+	stopsQueue := NewDatabaseBatchProcessingQueue(datasets.ImportCollectionName("stops_raw"), 1*time.Second, 10*time.Second, 500)
 
 	if dataset.SupportedObjects.Stops {
 		stopsQueue.Process()
@@ -170,6 +178,8 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			Timezone: timezone,
 		}
 
+		transforms.TransformImport(ctdfStop, 2, dataset.Identifier)
+
 		if dataset.SupportedObjects.Stops {
 			// Insert
 			bsonRep, _ := bson.Marshal(bson.M{"$set": ctdfStop})
@@ -203,7 +213,7 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 
 	// Routes / Services
 	log.Info().Int("length", len(g.Routes)).Msg("Starting Services")
-	servicesQueue := NewDatabaseBatchProcessingQueue("services", 1*time.Second, 10*time.Second, 500)
+	servicesQueue := NewDatabaseBatchProcessingQueue(datasets.ImportCollectionName("services"), 1*time.Second, 10*time.Second, 500)
 
 	if dataset.SupportedObjects.Services {
 		servicesQueue.Process()
@@ -245,7 +255,8 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			TransportType:        convertTransportType(gtfsRoute.Type),
 		}
 
-		transforms.Transform(ctdfService, 1, "gb-dft-bods-gtfs-schedule")
+		// Journeys take their operator from the service so it has to be transformed first
+		transforms.TransformImport(ctdfService, 1, dataset.Identifier)
 
 		ctdfServices[gtfsRoute.ID] = ctdfService
 
@@ -268,7 +279,7 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 	// fullJourneyTracks := map[string][]ctdf.Location{}
 
 	// Journeys
-	journeysQueue := NewDatabaseBatchProcessingQueue("journeys", 1*time.Second, 1*time.Minute, 1000)
+	journeysQueue := NewDatabaseBatchProcessingQueue(datasets.ImportCollectionName("journeys"), 1*time.Second, 1*time.Minute, 1000)
 	if dataset.SupportedObjects.Journeys {
 		journeysQueue.Process()
 	}
@@ -450,8 +461,8 @@ func (g *Schedule) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceR
 			}
 		}
 
-		// TODO fix transforms here
-		// transforms.Transform(ctdfJourneys[tripID], 1, "gb-dft-bods-gtfs-schedule")
+		transforms.TransformImport(ctdfJourneys[tripID], 1, dataset.Identifier)
+
 		if util.ContainsString([]string{
 			"gb-noc-LDLR", "gb-noc-LULD", "gb-noc-TRAM", "gb-dft-bods-gtfs-schedule-operator-OPTEMP454",
 			"gb-noc-ABLO", "gb-dft-bods-gtfs-schedule-operator-OP12046", "gb-noc-ALNO", "gb-noc-ALSO", "gb-dft-bods-gtfs-schedule-operator-OPTEMP450", "gb-dft-bods-gtfs-schedule-operator-OP11684",
@@ -52,8 +52,8 @@ func (naptanDoc *NaPTAN) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 		return errors.New("This format requires stops & stopgroups to be enabled")
 	}
 
-	stopsCollection := database.GetCollection("stops_raw")
-	stopGroupsCollection := database.GetCollection("stop_groups")
+	stopsCollection := database.GetCollection(datasets.ImportCollectionName("stops_raw"))
+	stopGroupsCollection := database.GetCollection(datasets.ImportCollectionName("stop_groups"))
 
 	// StopAreas
 	log.Info().Msg("Converting & Importing CTDF StopGroups into Mongo")
@@ -93,7 +93,7 @@ func (naptanDoc *NaPTAN) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 					stationStopGroupsMutex.Unlock()
 				}
 
-				transforms.Transform(ctdfStopGroup, 3)
+				transforms.TransformImport(ctdfStopGroup, 3, dataset.Identifier)
 
 				bsonRep, _ := bson.Marshal(bson.M{"$set": ctdfStopGroup})
 				updateModel := mongo.NewUpdateOneModel()
@@ -182,7 +182,7 @@ func (naptanDoc *NaPTAN) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 					continue
 				}
 
-				transforms.Transform(ctdfStop, 3)
+				transforms.TransformImport(ctdfStop, 3, dataset.Identifier)
 
 				ctdfStop.DataSource = datasource
 
@@ -261,7 +261,7 @@ func (naptanDoc *NaPTAN) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 			}
 		}
 
-		transforms.Transform(stationStop, 2)
+		transforms.TransformImport(stationStop, 2, dataset.Identifier)
 
 		bsonRep, _ := bson.Marshal(bson.M{"$set": stationStop})
 		updateModel := mongo.NewUpdateOneModel()
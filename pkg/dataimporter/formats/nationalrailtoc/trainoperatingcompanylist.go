@@ -15,6 +15,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/transforms"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -90,8 +91,8 @@ func (t *TrainOperatingCompanyList) Import(dataset datasets.DataSet, datasource
 	log.Info().Msgf(" - %d Services", len(services))
 
 	// Tables
-	operatorsCollection := database.GetCollection("operators")
-	servicesCollection := database.GetCollection("services")
+	operatorsCollection := database.GetCollection(datasets.ImportCollectionName("operators_raw"))
+	servicesCollection := database.GetCollection(datasets.ImportCollectionName("services"))
 
 	// Import operators
 	log.Info().Msg("Importing CTDF Operators into Mongo")
@@ -122,6 +123,8 @@ func (t *TrainOperatingCompanyList) Import(dataset datasets.DataSet, datasource
 				operator.ModificationDateTime = time.Now()
 				operator.DataSource = datasource
 
+				transforms.TransformImport(operator, 1, dataset.Identifier)
+
 				bsonRep, _ := bson.Marshal(bson.M{"$set": operator})
 				updateModel := mongo.NewUpdateOneModel()
 				updateModel.SetFilter(bson.M{"primaryidentifier": operator.PrimaryIdentifier})
@@ -179,6 +182,8 @@ func (t *TrainOperatingCompanyList) Import(dataset datasets.DataSet, datasource
 				service.ModificationDateTime = time.Now()
 				service.DataSource = datasource
 
+				transforms.TransformImport(service, 1, dataset.Identifier)
+
 				bsonRep, _ := bson.Marshal(bson.M{"$set": service})
 				updateModel := mongo.NewUpdateOneModel()
 				updateModel.SetFilter(bson.M{"primaryidentifier": service.PrimaryIdentifier})
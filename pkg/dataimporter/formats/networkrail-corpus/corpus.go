@@ -37,7 +37,7 @@ func (c *Corpus) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceRef
 
 	now := time.Now()
 
-	stopsCollection := database.GetCollection("stops_raw")
+	stopsCollection := database.GetCollection(datasets.ImportCollectionName("stops_raw"))
 
 	var updateOperations []mongo.WriteModel
 
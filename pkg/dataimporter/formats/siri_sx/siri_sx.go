@@ -2,27 +2,26 @@ package siri_sx
 
 import (
 	"crypto/sha256"
-	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
 	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
+	"github.com/travigo/travigo/pkg/util"
 	"golang.org/x/net/html/charset"
 )
 
 type SiriSX struct {
 	reader io.Reader
-	queue  rmq.Queue
+	queue  *vehicletracker.PartitionedRealtimeQueue
 }
 
-func (s *SiriSX) SetupRealtimeQueue(queue rmq.Queue) {
+func (s *SiriSX) SetupRealtimeQueue(queue *vehicletracker.PartitionedRealtimeQueue) {
 	s.queue = queue
 }
 
@@ -77,10 +76,10 @@ func (s *SiriSX) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceRef
 	return nil
 }
 
-func SubmitToProcessQueue(queue rmq.Queue, situationElement *SituationElement, dataset datasets.DataSet, datasource *ctdf.DataSourceReference) bool {
+func SubmitToProcessQueue(queue *vehicletracker.PartitionedRealtimeQueue, situationElement *SituationElement, dataset datasets.DataSet, datasource *ctdf.DataSourceReference) bool {
 	datasource.OriginalFormat = "siri-sx"
 
-	currentTime := time.Now()
+	currentTime := util.Now()
 
 	validityPeriodStart, _ := time.Parse(time.RFC3339, situationElement.ValidityPeriod.StartTime)
 	validityPeriodEnd, err := time.Parse(time.RFC3339, situationElement.ValidityPeriod.EndTime)
@@ -145,8 +144,10 @@ func SubmitToProcessQueue(queue rmq.Queue, situationElement *SituationElement, d
 		RecordedAt: versionedAtTime,
 	}
 
-	updateEventJson, _ := json.Marshal(updateEvent)
-	queue.PublishBytes(updateEventJson)
+	if err := queue.Publish(&updateEvent); err != nil {
+		log.Error().Err(err).Msg("Failed to publish service alert update")
+		return false
+	}
 
 	return true
 }
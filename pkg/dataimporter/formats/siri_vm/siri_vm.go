@@ -1,7 +1,6 @@
 package siri_vm
 
 import (
-	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
@@ -9,18 +8,17 @@ import (
 	"math/rand/v2"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
 	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
 	"golang.org/x/net/html/charset"
 )
 
 type SiriVM struct {
 	reader io.Reader
-	queue  rmq.Queue
+	queue  *vehicletracker.PartitionedRealtimeQueue
 }
 
 type SiriVMVehicleIdentificationEvent struct {
@@ -34,10 +32,10 @@ type queueEmptyElasticEvent struct {
 	Duration  int
 }
 
-func SubmitToProcessQueue(queue rmq.Queue, vehicle *VehicleActivity, dataset datasets.DataSet, datasource *ctdf.DataSourceReference) bool {
+func SubmitToProcessQueue(queue *vehicletracker.PartitionedRealtimeQueue, vehicle *VehicleActivity, dataset datasets.DataSet, datasource *ctdf.DataSourceReference) bool {
 	datasource.OriginalFormat = "siri-vm"
 
-	currentTime := time.Now()
+	currentTime := util.Now()
 
 	recordedAtTime, err := time.Parse(ctdf.XSDDateTimeFormat, vehicle.RecordedAtTime)
 
@@ -149,14 +147,15 @@ func SubmitToProcessQueue(queue rmq.Queue, vehicle *VehicleActivity, dataset dat
 		}
 	}
 
-	locationEventJson, _ := json.Marshal(locationEvent)
-
-	queue.PublishBytes(locationEventJson)
+	if err := queue.Publish(&locationEvent); err != nil {
+		log.Error().Err(err).Msg("Failed to publish vehicle update")
+		return false
+	}
 
 	return true
 }
 
-func (s *SiriVM) SetupRealtimeQueue(queue rmq.Queue) {
+func (s *SiriVM) SetupRealtimeQueue(queue *vehicletracker.PartitionedRealtimeQueue) {
 	s.queue = queue
 }
 
@@ -209,19 +208,18 @@ func (s *SiriVM) Import(dataset datasets.DataSet, datasource *ctdf.DataSourceRef
 	log.Info().Int64("retrieved", retrievedRecords).Int64("submitted", submittedRecords).Msgf("Parsed latest Siri-VM response")
 
 	// Wait for queue to empty
-	checkQueueSize()
+	checkQueueSize(s.queue)
 
 	return nil
 }
 
-func checkQueueSize() {
-	stats, _ := redis_client.QueueConnection.CollectStats([]string{"realtime-queue"})
-	inQueue := stats.QueueStats["realtime-queue"].ReadyCount
+func checkQueueSize(queue *vehicletracker.PartitionedRealtimeQueue) {
+	inQueue := queue.ReadyCount()
 
 	if inQueue >= 40000 {
 		log.Info().Int64("queuesize", inQueue).Msg("Queue size too long, hanging back for a bit")
 		time.Sleep(time.Duration(30+rand.IntN(20)) * time.Minute)
 
-		checkQueueSize()
+		checkQueueSize(queue)
 	}
 }
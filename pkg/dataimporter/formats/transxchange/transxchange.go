@@ -18,6 +18,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/transforms"
 	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -70,8 +71,8 @@ func (doc *TransXChange) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 
 	dateTimeFormatWithTimezoneRegex, _ := regexp.Compile(DateTimeFormatWithTimezoneRegex)
 
-	servicesCollection := database.GetCollection("services")
-	journeysCollection := database.GetCollection("journeys")
+	servicesCollection := database.GetCollection(datasets.ImportCollectionName("services"))
+	journeysCollection := database.GetCollection(datasets.ImportCollectionName("journeys"))
 
 	// Map the local operator references to globally unique operator codes based on NOC
 	operatorLocalMapping := map[string]string{}
@@ -223,6 +224,8 @@ func (doc *TransXChange) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 				journeyPatternReferences[localServiceIdentifier][journeyPattern.ID] = journeyPattern
 			}
 
+			transforms.TransformImport(&ctdfService, 1, dataset.Identifier)
+
 			// Check if we want to add this service to the list of MongoDB operations
 			bsonRep, _ := bson.Marshal(ctdfService)
 
@@ -660,6 +663,8 @@ func (doc *TransXChange) Import(dataset datasets.DataSet, datasource *ctdf.DataS
 					log.Error().Msgf("Journey %s has a nil path", ctdfJourney.PrimaryIdentifier)
 				}
 
+				transforms.TransformImport(&ctdfJourney, 1, dataset.Identifier)
+
 				bsonRep, _ := bson.Marshal(ctdfJourney)
 
 				var existingCtdfJourney *ctdf.Journey
@@ -15,6 +15,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/transforms"
 	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -216,10 +217,10 @@ func (t *TravelineData) Import(dataset datasets.DataSet, datasource *ctdf.DataSo
 	log.Info().Msgf(" - %d OperatorGroups", len(operatorGroups))
 
 	// Operators table
-	operatorsCollection := database.GetCollection("operators")
+	operatorsCollection := database.GetCollection(datasets.ImportCollectionName("operators_raw"))
 
 	// OperatorGroups table
-	operatorGroupsCollection := database.GetCollection("operator_groups")
+	operatorGroupsCollection := database.GetCollection(datasets.ImportCollectionName("operator_groups"))
 
 	// Import operators
 	log.Info().Msg("Importing CTDF Operators into Mongo")
@@ -250,6 +251,8 @@ func (t *TravelineData) Import(dataset datasets.DataSet, datasource *ctdf.DataSo
 				operator.ModificationDateTime = time.Now()
 				operator.DataSource = datasource
 
+				transforms.TransformImport(operator, 1, dataset.Identifier)
+
 				bsonRep, _ := bson.Marshal(bson.M{"$set": operator})
 				updateModel := mongo.NewUpdateOneModel()
 				updateModel.SetFilter(bson.M{"primaryidentifier": operator.PrimaryIdentifier})
@@ -307,6 +310,8 @@ func (t *TravelineData) Import(dataset datasets.DataSet, datasource *ctdf.DataSo
 				operatorGroup.ModificationDateTime = time.Now()
 				operatorGroup.DataSource = datasource
 
+				transforms.TransformImport(operatorGroup, 1, dataset.Identifier)
+
 				bsonRep, _ := bson.Marshal(bson.M{"$set": operatorGroup})
 				updateModel := mongo.NewUpdateOneModel()
 				updateModel.SetFilter(bson.M{"identifier": operatorGroup.Identifier})
@@ -0,0 +1,132 @@
+package importruns
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+)
+
+var (
+	lastRunTimestampDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_run_timestamp_seconds",
+		"When the latest import of the dataset started",
+		[]string{"dataset", "trigger"}, nil,
+	)
+	lastRunFailedDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_run_failed",
+		"Whether the latest import of the dataset failed",
+		[]string{"dataset"}, nil,
+	)
+	lastRunDurationDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_run_duration_seconds",
+		"How long the latest import of the dataset took",
+		[]string{"dataset"}, nil,
+	)
+	lastRunBytesDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_run_downloaded_bytes",
+		"Size of the source downloaded by the latest import of the dataset",
+		[]string{"dataset"}, nil,
+	)
+	lastChangedRunRecordsDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_changed_run_records",
+		"Records written to each collection by the latest import that changed the dataset",
+		[]string{"dataset", "collection", "operation"}, nil,
+	)
+	lastSuccessTimestampDesc = prometheus.NewDesc(
+		"travigo_dataset_import_last_success_timestamp_seconds",
+		"When the latest successful import of the dataset finished",
+		[]string{"dataset"}, nil,
+	)
+	staleDesc = prometheus.NewDesc(
+		"travigo_dataset_import_stale",
+		"Whether the dataset hasn't successfully imported within its expected window",
+		[]string{"dataset"}, nil,
+	)
+)
+
+// Imports are at most every couple of minutes so there's no point querying every run on every scrape
+const defaultCollectorCacheDuration = time.Minute
+
+// Collector exposes the import status of every dataset as Prometheus metrics, they are read
+// from the recorded runs so imports in any process are included and cached for CacheDuration between scrapes
+type Collector struct {
+	Datasets      []datasets.DataSet
+	CacheDuration time.Duration
+
+	mutex    sync.Mutex
+	metrics  []prometheus.Metric
+	cachedAt time.Time
+}
+
+func NewCollector(allDatasets []datasets.DataSet) *Collector {
+	return &Collector{
+		Datasets:      allDatasets,
+		CacheDuration: defaultCollectorCacheDuration,
+	}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lastRunTimestampDesc
+	ch <- lastRunFailedDesc
+	ch <- lastRunDurationDesc
+	ch <- lastRunBytesDesc
+	ch <- lastChangedRunRecordsDesc
+	ch <- lastSuccessTimestampDesc
+	ch <- staleDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.metrics == nil || time.Since(c.cachedAt) >= c.CacheDuration {
+		c.metrics = c.collectMetrics()
+		c.cachedAt = time.Now()
+	}
+
+	for _, metric := range c.metrics {
+		ch <- metric
+	}
+}
+
+func (c *Collector) collectMetrics() []prometheus.Metric {
+	metrics := []prometheus.Metric{}
+
+	for _, dataset := range c.Datasets {
+		status := GetStatus(&dataset)
+
+		metrics = append(metrics, prometheus.MustNewConstMetric(staleDesc, prometheus.GaugeValue, boolToFloat(status.Stale), dataset.Identifier))
+
+		if status.LastRun != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(lastRunTimestampDesc, prometheus.GaugeValue, float64(status.LastRun.StartDateTime.Unix()), dataset.Identifier, status.LastRun.Trigger))
+			metrics = append(metrics, prometheus.MustNewConstMetric(lastRunFailedDesc, prometheus.GaugeValue, boolToFloat(status.LastRunFailed), dataset.Identifier))
+			metrics = append(metrics, prometheus.MustNewConstMetric(lastRunDurationDesc, prometheus.GaugeValue, status.LastRun.DurationSeconds, dataset.Identifier))
+			metrics = append(metrics, prometheus.MustNewConstMetric(lastRunBytesDesc, prometheus.GaugeValue, float64(status.LastRun.BytesDownloaded), dataset.Identifier))
+		}
+
+		if status.LastSuccessfulRun != nil {
+			metrics = append(metrics, prometheus.MustNewConstMetric(lastSuccessTimestampDesc, prometheus.GaugeValue, float64(status.LastSuccessfulRun.EndDateTime.Unix()), dataset.Identifier))
+		}
+
+		// Most runs don't change anything so look back for the last one that did
+		if lastChangedRun := getLatestChangedRun(dataset.Identifier); lastChangedRun != nil {
+			for collection, counts := range lastChangedRun.Collections {
+				metrics = append(metrics, prometheus.MustNewConstMetric(lastChangedRunRecordsDesc, prometheus.GaugeValue, float64(counts.Inserted), dataset.Identifier, collection, "inserted"))
+				metrics = append(metrics, prometheus.MustNewConstMetric(lastChangedRunRecordsDesc, prometheus.GaugeValue, float64(counts.Updated), dataset.Identifier, collection, "updated"))
+				metrics = append(metrics, prometheus.MustNewConstMetric(lastChangedRunRecordsDesc, prometheus.GaugeValue, float64(counts.Deleted), dataset.Identifier, collection, "deleted"))
+			}
+		}
+	}
+
+	return metrics
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+
+	return 0
+}
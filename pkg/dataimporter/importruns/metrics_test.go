@@ -0,0 +1,55 @@
+package importruns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func collectMetricCount(collector *Collector) int {
+	ch := make(chan prometheus.Metric, 100)
+	collector.Collect(ch)
+	close(ch)
+
+	return len(ch)
+}
+
+func TestCollectorCache(t *testing.T) {
+	database.ConnectMemory()
+
+	for _, test := range []struct {
+		name          string
+		cacheDuration time.Duration
+		metrics       int
+	}{
+		// Only the stale metric until the run is seen
+		{"cached", time.Hour, 1},
+		{"not cached", 0, 5},
+	} {
+		database.GetCollection(collectionName).DeleteMany(context.Background(), bson.M{})
+
+		collector := NewCollector([]datasets.DataSet{{Identifier: "test-dataset"}})
+		collector.CacheDuration = test.cacheDuration
+
+		if metrics := collectMetricCount(collector); metrics != 1 {
+			t.Errorf("%s: expected 1 metric before any runs, got %d", test.name, metrics)
+		}
+
+		database.GetCollection(collectionName).InsertOne(context.Background(), ctdf.DatasetImportRun{
+			PrimaryIdentifier: "run",
+			Dataset:           "test-dataset",
+			StartDateTime:     time.Now(),
+			Status:            ctdf.DatasetImportRunStatusRunning,
+		})
+
+		if metrics := collectMetricCount(collector); metrics != test.metrics {
+			t.Errorf("%s: expected %d metrics, got %d", test.name, test.metrics, metrics)
+		}
+	}
+}
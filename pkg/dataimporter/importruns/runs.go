@@ -0,0 +1,124 @@
+package importruns
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionName = "dataset_import_runs"
+
+// RunTimeout is how long a run can stay running before it's assumed the importer died part way through it
+const RunTimeout = 6 * time.Hour
+
+// Start records that an import of the dataset has begun
+func Start(datasetID string, trigger string) *ctdf.DatasetImportRun {
+	run := &ctdf.DatasetImportRun{
+		PrimaryIdentifier: primitive.NewObjectID().Hex(),
+		Dataset:           datasetID,
+		Trigger:           trigger,
+		StartDateTime:     time.Now(),
+		Status:            ctdf.DatasetImportRunStatusRunning,
+		Collections:       map[string]ctdf.DatasetImportRunRecordCounts{},
+	}
+
+	datasetImportRunsCollection := database.GetCollection(collectionName)
+	if _, err := datasetImportRunsCollection.InsertOne(context.Background(), run); err != nil {
+		log.Error().Err(err).Msg("Failed to record import run")
+	}
+
+	return run
+}
+
+// Finish records the outcome of the import
+func Finish(run *ctdf.DatasetImportRun, err error) {
+	run.EndDateTime = time.Now()
+	run.DurationSeconds = run.EndDateTime.Sub(run.StartDateTime).Seconds()
+	run.Status = ctdf.DatasetImportRunStatusSuccess
+	if err != nil {
+		run.Status = ctdf.DatasetImportRunStatusFailed
+		run.Error = err.Error()
+	}
+
+	datasetImportRunsCollection := database.GetCollection(collectionName)
+	_, updateErr := datasetImportRunsCollection.UpdateOne(context.Background(), bson.M{"primaryidentifier": run.PrimaryIdentifier}, bson.M{"$set": run})
+	if updateErr != nil {
+		log.Error().Err(updateErr).Msg("Failed to record import run")
+	}
+}
+
+// failTimedOutRuns marks the runs of the dataset that have been running for longer than RunTimeout as failed, otherwise
+// an importer that was killed mid import would leave its run running forever
+func failTimedOutRuns(datasetID string) {
+	now := time.Now()
+
+	datasetImportRunsCollection := database.GetCollection(collectionName)
+	_, err := datasetImportRunsCollection.UpdateMany(context.Background(), bson.M{
+		"dataset":       datasetID,
+		"status":        ctdf.DatasetImportRunStatusRunning,
+		"startdatetime": bson.M{"$lt": now.Add(-RunTimeout)},
+	}, bson.M{"$set": bson.M{
+		"status":      ctdf.DatasetImportRunStatusFailed,
+		"error":       "import timed out",
+		"enddatetime": now,
+	}})
+	if err != nil {
+		log.Error().Err(err).Str("dataset", datasetID).Msg("Failed to fail timed out import runs")
+	}
+}
+
+// GetRuns returns the most recent runs of the dataset, optionally only those with the given status
+func GetRuns(datasetID string, status ctdf.DatasetImportRunStatus, limit int64) ([]ctdf.DatasetImportRun, error) {
+	query := bson.M{"dataset": datasetID}
+	if status != "" {
+		query["status"] = status
+	}
+
+	datasetImportRunsCollection := database.GetCollection(collectionName)
+	opts := options.Find().SetSort(bson.D{{Key: "startdatetime", Value: -1}}).SetLimit(limit)
+	cursor, err := datasetImportRunsCollection.Find(context.Background(), query, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	runs := []ctdf.DatasetImportRun{}
+	if err := cursor.All(context.Background(), &runs); err != nil {
+		return nil, err
+	}
+
+	return runs, nil
+}
+
+func getLatestRun(datasetID string, status ctdf.DatasetImportRunStatus) *ctdf.DatasetImportRun {
+	runs, err := GetRuns(datasetID, status, 1)
+	if err != nil {
+		log.Error().Err(err).Str("dataset", datasetID).Msg("Failed to load import runs")
+		return nil
+	}
+
+	if len(runs) == 0 {
+		return nil
+	}
+
+	return &runs[0]
+}
+
+func getLatestChangedRun(datasetID string) *ctdf.DatasetImportRun {
+	var run *ctdf.DatasetImportRun
+
+	datasetImportRunsCollection := database.GetCollection(collectionName)
+	opts := options.FindOne().SetSort(bson.D{{Key: "startdatetime", Value: -1}})
+	datasetImportRunsCollection.FindOne(context.Background(), bson.M{
+		"dataset": datasetID,
+		"status":  ctdf.DatasetImportRunStatusSuccess,
+		"changed": true,
+	}, opts).Decode(&run)
+
+	return run
+}
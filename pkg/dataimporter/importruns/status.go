@@ -0,0 +1,64 @@
+package importruns
+
+import (
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+)
+
+// Static datasets are imported daily so 2 days allows for a single missed import
+const defaultStaticStaleAfter = 48 * time.Hour
+
+// Realtime datasets are stale once several refreshes in a row have been missed
+const realtimeStaleAfterRefreshes = 5
+
+type DatasetImportStatus struct {
+	Dataset string `groups:"basic"`
+
+	LastRun           *ctdf.DatasetImportRun `groups:"basic"`
+	LastSuccessfulRun *ctdf.DatasetImportRun `groups:"basic"`
+	StaleAfterSeconds float64                `groups:"basic"`
+	Stale             bool                   `groups:"basic"`
+	LastRunFailed     bool                   `groups:"basic"`
+}
+
+// StaleAfter is how long the dataset can go without a successful import before it is considered stale
+func StaleAfter(dataset *datasets.DataSet) time.Duration {
+	if dataset.StaleAfter > 0 {
+		return dataset.StaleAfter
+	}
+
+	if dataset.ImportDestination != datasets.ImportDestinationRealtimeQueue {
+		return defaultStaticStaleAfter
+	}
+
+	refreshInterval := dataset.RefreshInterval
+	if refreshInterval == 0 {
+		refreshInterval = 2 * time.Minute
+		if dataset.SupportedObjects.ServiceAlerts {
+			refreshInterval = 10 * time.Minute
+		}
+	}
+
+	return refreshInterval * realtimeStaleAfterRefreshes
+}
+
+// GetStatus looks at the recent import runs of the dataset, a dataset that has never successfully imported is stale
+func GetStatus(dataset *datasets.DataSet) DatasetImportStatus {
+	failTimedOutRuns(dataset.Identifier)
+
+	staleAfter := StaleAfter(dataset)
+
+	status := DatasetImportStatus{
+		Dataset:           dataset.Identifier,
+		LastRun:           getLatestRun(dataset.Identifier, ""),
+		LastSuccessfulRun: getLatestRun(dataset.Identifier, ctdf.DatasetImportRunStatusSuccess),
+		StaleAfterSeconds: staleAfter.Seconds(),
+	}
+
+	status.LastRunFailed = status.LastRun != nil && status.LastRun.Status == ctdf.DatasetImportRunStatusFailed
+	status.Stale = status.LastSuccessfulRun == nil || time.Since(status.LastSuccessfulRun.EndDateTime) > staleAfter
+
+	return status
+}
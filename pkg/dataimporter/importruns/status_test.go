@@ -0,0 +1,99 @@
+package importruns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestStaleAfter(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		dataset    datasets.DataSet
+		staleAfter time.Duration
+	}{
+		{"static", datasets.DataSet{}, 48 * time.Hour},
+		{"static with override", datasets.DataSet{StaleAfter: 8 * 24 * time.Hour}, 8 * 24 * time.Hour},
+		{"realtime", datasets.DataSet{ImportDestination: datasets.ImportDestinationRealtimeQueue}, 10 * time.Minute},
+		{"realtime service alerts", datasets.DataSet{ImportDestination: datasets.ImportDestinationRealtimeQueue, SupportedObjects: datasets.SupportedObjects{ServiceAlerts: true}}, 50 * time.Minute},
+		{"realtime with refresh interval", datasets.DataSet{ImportDestination: datasets.ImportDestinationRealtimeQueue, RefreshInterval: 30 * time.Second}, 150 * time.Second},
+		{"realtime with override", datasets.DataSet{ImportDestination: datasets.ImportDestinationRealtimeQueue, RefreshInterval: 30 * time.Second, StaleAfter: time.Hour}, time.Hour},
+	} {
+		if staleAfter := StaleAfter(&test.dataset); staleAfter != test.staleAfter {
+			t.Errorf("%s: expected %s, got %s", test.name, test.staleAfter, staleAfter)
+		}
+	}
+}
+
+func TestGetStatus(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range []struct {
+		name          string
+		runs          []ctdf.DatasetImportRun
+		stale         bool
+		lastRunFailed bool
+		lastRunStatus ctdf.DatasetImportRunStatus
+	}{
+		{"never imported", nil, true, false, ""},
+		{
+			"recent success",
+			[]ctdf.DatasetImportRun{{StartDateTime: now.Add(-time.Hour), EndDateTime: now.Add(-time.Hour), Status: ctdf.DatasetImportRunStatusSuccess}},
+			false, false, ctdf.DatasetImportRunStatusSuccess,
+		},
+		{
+			"old success",
+			[]ctdf.DatasetImportRun{{StartDateTime: now.Add(-72 * time.Hour), EndDateTime: now.Add(-72 * time.Hour), Status: ctdf.DatasetImportRunStatusSuccess}},
+			true, false, ctdf.DatasetImportRunStatusSuccess,
+		},
+		{
+			"failed after a success",
+			[]ctdf.DatasetImportRun{
+				{StartDateTime: now.Add(-2 * time.Hour), EndDateTime: now.Add(-2 * time.Hour), Status: ctdf.DatasetImportRunStatusSuccess},
+				{StartDateTime: now.Add(-time.Hour), EndDateTime: now.Add(-time.Hour), Status: ctdf.DatasetImportRunStatusFailed},
+			},
+			false, true, ctdf.DatasetImportRunStatusFailed,
+		},
+		{
+			"running",
+			[]ctdf.DatasetImportRun{{StartDateTime: now.Add(-time.Hour), Status: ctdf.DatasetImportRunStatusRunning}},
+			true, false, ctdf.DatasetImportRunStatusRunning,
+		},
+		{
+			"running past the timeout",
+			[]ctdf.DatasetImportRun{{StartDateTime: now.Add(-RunTimeout - time.Minute), Status: ctdf.DatasetImportRunStatusRunning}},
+			true, true, ctdf.DatasetImportRunStatusFailed,
+		},
+	} {
+		database.ConnectMemory()
+		database.GetCollection(collectionName).DeleteMany(context.Background(), bson.M{})
+
+		for i, run := range test.runs {
+			run.PrimaryIdentifier = string(rune('a' + i))
+			run.Dataset = "test-dataset"
+			database.GetCollection(collectionName).InsertOne(context.Background(), run)
+		}
+
+		status := GetStatus(&datasets.DataSet{Identifier: "test-dataset"})
+
+		if status.Stale != test.stale {
+			t.Errorf("%s: expected stale to be %t", test.name, test.stale)
+		}
+		if status.LastRunFailed != test.lastRunFailed {
+			t.Errorf("%s: expected last run failed to be %t", test.name, test.lastRunFailed)
+		}
+
+		var lastRunStatus ctdf.DatasetImportRunStatus
+		if status.LastRun != nil {
+			lastRunStatus = status.LastRun.Status
+		}
+		if lastRunStatus != test.lastRunStatus {
+			t.Errorf("%s: expected last run status %s, got %s", test.name, test.lastRunStatus, lastRunStatus)
+		}
+	}
+}
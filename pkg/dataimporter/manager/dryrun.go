@@ -0,0 +1,407 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// How many example identifiers are printed for each problem
+const dryRunExamples = 10
+
+// Journeys are expected to run at least once in the coming year
+const availabilityLookaheadDays = 366
+
+type DryRunReport struct {
+	Dataset string
+
+	Collections []DryRunCollectionReport
+
+	StopsMissingLocation []string
+
+	MissingServiceReferences []string
+	MissingStopReferences    []string
+	JourneysWithUnknownStops int64
+
+	NeverAvailableJourneys []string
+
+	// Identifiers that appear more than once in the import
+	DuplicateIdentifiers []string
+	// Identifiers already used by a record from a different dataset, both would be live with the same identifier
+	ConflictingIdentifiers []string
+
+	TimetableChange *ctdf.TimetableChange
+
+	// Set when the import would fail validation and not be promoted
+	ValidationError string
+}
+
+type DryRunCollectionReport struct {
+	Collection string
+	Staged     int
+	Live       int
+	Added      []string
+	Removed    []string
+}
+
+// DryRunDataset converts the dataset without writing anything to the database and reports what the import would do
+// The staged records are kept in memory and compared against what is currently live
+func DryRunDataset(dataset *datasets.DataSet) (*DryRunReport, error) {
+	if dataset.ImportDestination == datasets.ImportDestinationRealtimeQueue {
+		return nil, errors.New("Dry runs are only supported for datasets that are imported into the database")
+	}
+
+	for _, collectionName := range stagedCollections(dataset) {
+		database.UseMemoryCollections(datasets.ImportCollectionName(collectionName))
+	}
+	defer clearStagedRecords(dataset)
+
+	datasource := &ctdf.DataSourceReference{
+		OriginalFormat: string(dataset.Format),
+		ProviderName:   dataset.Provider.Name,
+		ProviderID:     dataset.DataSourceRef,
+		DatasetID:      dataset.Identifier,
+		Timestamp:      fmt.Sprintf("%d", time.Now().Unix()),
+	}
+
+	source, err := fetchSource(dataset, "")
+	if err != nil {
+		return nil, err
+	}
+	defer source.Cleanup()
+	if !source.Changed {
+		return nil, errors.New("Dataset source returned no content")
+	}
+
+	if err := stageSource(dataset, source, datasource); err != nil {
+		return nil, err
+	}
+	if err := filterStagedRecords(dataset); err != nil {
+		return nil, err
+	}
+
+	report := &DryRunReport{
+		Dataset: dataset.Identifier,
+	}
+
+	if err := validateStagedImport(dataset); err != nil {
+		report.ValidationError = err.Error()
+	}
+
+	for _, collectionName := range stagedCollections(dataset) {
+		collectionReport, duplicates, err := diffStagedCollection(dataset, collectionName)
+		if err != nil {
+			return nil, err
+		}
+		report.Collections = append(report.Collections, collectionReport)
+		report.DuplicateIdentifiers = append(report.DuplicateIdentifiers, duplicates...)
+
+		conflicts, err := findConflictingIdentifiers(dataset, collectionName)
+		if err != nil {
+			return nil, err
+		}
+		report.ConflictingIdentifiers = append(report.ConflictingIdentifiers, conflicts...)
+	}
+
+	if dataset.SupportedObjects.Stops {
+		stopsMissingLocation, err := findStopsMissingLocation(dataset)
+		if err != nil {
+			return nil, err
+		}
+		report.StopsMissingLocation = stopsMissingLocation
+	}
+
+	if dataset.SupportedObjects.Journeys {
+		if err := checkStagedJourneys(dataset, report); err != nil {
+			return nil, err
+		}
+
+		report.TimetableChange = detectTimetableChanges(datasource)
+	}
+
+	return report, nil
+}
+
+// diffStagedCollection compares the identifiers of the staged records against the live ones from the dataset
+func diffStagedCollection(dataset *datasets.DataSet, collectionName string) (DryRunCollectionReport, []string, error) {
+	collectionReport := DryRunCollectionReport{
+		Collection: collectionName,
+	}
+
+	stagedIdentifiers, duplicates, err := stagedIdentifiers(dataset, collectionName)
+	if err != nil {
+		return collectionReport, nil, err
+	}
+
+	liveIdentifierValues, err := database.GetCollection(collectionName).Distinct(context.Background(), "primaryidentifier", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return collectionReport, nil, err
+	}
+	liveIdentifiers := map[string]bool{}
+	for _, identifier := range liveIdentifierValues {
+		if identifierString, ok := identifier.(string); ok {
+			liveIdentifiers[identifierString] = true
+		}
+	}
+
+	collectionReport.Staged = len(stagedIdentifiers)
+	collectionReport.Live = len(liveIdentifiers)
+
+	for identifier := range stagedIdentifiers {
+		if !liveIdentifiers[identifier] {
+			collectionReport.Added = append(collectionReport.Added, identifier)
+		}
+	}
+	for identifier := range liveIdentifiers {
+		if !stagedIdentifiers[identifier] {
+			collectionReport.Removed = append(collectionReport.Removed, identifier)
+		}
+	}
+
+	sort.Strings(collectionReport.Added)
+	sort.Strings(collectionReport.Removed)
+
+	return collectionReport, duplicates, nil
+}
+
+func stagedIdentifiers(dataset *datasets.DataSet, collectionName string) (map[string]bool, []string, error) {
+	cursor, err := database.GetCollection(datasets.ImportCollectionName(collectionName)).Find(context.Background(), datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	identifiers := map[string]bool{}
+	var duplicates []string
+
+	for cursor.Next(context.Background()) {
+		var record struct {
+			PrimaryIdentifier string
+		}
+		if err := cursor.Decode(&record); err != nil {
+			return nil, nil, err
+		}
+
+		if identifiers[record.PrimaryIdentifier] {
+			duplicates = append(duplicates, record.PrimaryIdentifier)
+		}
+		identifiers[record.PrimaryIdentifier] = true
+	}
+
+	sort.Strings(duplicates)
+
+	return identifiers, duplicates, cursor.Err()
+}
+
+// findConflictingIdentifiers finds staged records whose identifier already belongs to a live record of another dataset
+func findConflictingIdentifiers(dataset *datasets.DataSet, collectionName string) ([]string, error) {
+	identifierValues, err := database.GetCollection(datasets.ImportCollectionName(collectionName)).Distinct(context.Background(), "primaryidentifier", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var conflicts []string
+	liveCollection := database.GetCollection(collectionName)
+
+	for i := 0; i < len(identifierValues); i += stagingBatchSize {
+		chunk := identifierValues[i:min(i+stagingBatchSize, len(identifierValues))]
+
+		found, err := liveCollection.Distinct(context.Background(), "primaryidentifier", bson.M{
+			"primaryidentifier":    bson.M{"$in": chunk},
+			"datasource.datasetid": bson.M{"$ne": dataset.Identifier},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, identifier := range found {
+			if identifierString, ok := identifier.(string); ok {
+				conflicts = append(conflicts, identifierString)
+			}
+		}
+	}
+
+	sort.Strings(conflicts)
+
+	return conflicts, nil
+}
+
+func findStopsMissingLocation(dataset *datasets.DataSet) ([]string, error) {
+	cursor, err := database.GetCollection(datasets.ImportCollectionName("stops_raw")).Find(context.Background(), datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []string
+	for cursor.Next(context.Background()) {
+		var stop struct {
+			PrimaryIdentifier string
+			Location          *ctdf.Location
+		}
+		if err := cursor.Decode(&stop); err != nil {
+			return nil, err
+		}
+
+		if stop.Location == nil || len(stop.Location.Coordinates) < 2 ||
+			(stop.Location.Coordinates[0] == 0 && stop.Location.Coordinates[1] == 0) {
+			missing = append(missing, stop.PrimaryIdentifier)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return missing, cursor.Err()
+}
+
+// checkStagedJourneys looks for journeys calling at unknown stops or services & ones that never run
+func checkStagedJourneys(dataset *datasets.DataSet, report *DryRunReport) error {
+	serviceRefs, serviceCollections, err := stagedServiceReferences(dataset)
+	if err != nil {
+		return err
+	}
+	report.MissingServiceReferences, _, err = findMissingReferences("services", serviceRefs, serviceCollections)
+	if err != nil {
+		return err
+	}
+
+	stopRefs, stopCollections, err := stagedStopReferences(dataset)
+	if err != nil {
+		return err
+	}
+	report.MissingStopReferences, _, err = findMissingReferences("stops", stopRefs, stopCollections)
+	if err != nil {
+		return err
+	}
+
+	stagedJourneys := database.GetCollection(datasets.ImportCollectionName("journeys"))
+
+	if len(report.MissingStopReferences) > 0 {
+		report.JourneysWithUnknownStops, err = stagedJourneys.CountDocuments(context.Background(), bson.M{
+			"datasource.datasetid": dataset.Identifier,
+			"$or": bson.A{
+				bson.M{"path.originstopref": bson.M{"$in": report.MissingStopReferences}},
+				bson.M{"path.destinationstopref": bson.M{"$in": report.MissingStopReferences}},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cursor, err := stagedJourneys.Find(context.Background(), datasetQuery(dataset.Identifier))
+	if err != nil {
+		return err
+	}
+
+	// Most journeys share a handful of availabilities so only check each one once
+	availabilityMatches := map[string]bool{}
+
+	for cursor.Next(context.Background()) {
+		var journey struct {
+			PrimaryIdentifier string
+			Availability      *ctdf.Availability
+		}
+		if err := cursor.Decode(&journey); err != nil {
+			return err
+		}
+
+		availabilityKey, _ := json.Marshal(journey.Availability)
+		matches, checked := availabilityMatches[string(availabilityKey)]
+		if !checked {
+			matches = availabilityEverMatches(journey.Availability)
+			availabilityMatches[string(availabilityKey)] = matches
+		}
+
+		if !matches {
+			report.NeverAvailableJourneys = append(report.NeverAvailableJourneys, journey.PrimaryIdentifier)
+		}
+	}
+
+	sort.Strings(report.NeverAvailableJourneys)
+
+	return cursor.Err()
+}
+
+func availabilityEverMatches(availability *ctdf.Availability) bool {
+	if availability == nil || len(availability.Match) == 0 {
+		return false
+	}
+
+	now := time.Now()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, now.Location())
+
+	for i := 0; i < availabilityLookaheadDays; i++ {
+		if availability.MatchDate(day.AddDate(0, 0, i)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasProblems is true when the import would be rejected or any of the checks found something
+func (r *DryRunReport) HasProblems() bool {
+	return r.ValidationError != "" ||
+		len(r.StopsMissingLocation) > 0 ||
+		len(r.MissingServiceReferences) > 0 ||
+		len(r.MissingStopReferences) > 0 ||
+		len(r.NeverAvailableJourneys) > 0 ||
+		len(r.DuplicateIdentifiers) > 0 ||
+		len(r.ConflictingIdentifiers) > 0
+}
+
+func (r *DryRunReport) Write(writer io.Writer) {
+	fmt.Fprintf(writer, "Dry run of %s\n\n", r.Dataset)
+
+	fmt.Fprintf(writer, "%-16s %10s %10s %10s %10s\n", "COLLECTION", "IMPORTED", "LIVE", "ADDED", "REMOVED")
+	for _, collection := range r.Collections {
+		fmt.Fprintf(writer, "%-16s %10d %10d %10d %10d\n", collection.Collection, collection.Staged, collection.Live, len(collection.Added), len(collection.Removed))
+	}
+	fmt.Fprintln(writer)
+
+	for _, collection := range r.Collections {
+		writeExamples(writer, fmt.Sprintf("%s added", collection.Collection), collection.Added)
+		writeExamples(writer, fmt.Sprintf("%s removed", collection.Collection), collection.Removed)
+	}
+
+	if r.TimetableChange != nil {
+		fmt.Fprintf(writer, "Timetable: %d journeys added, %d removed & %d retimed across %d services\n\n",
+			r.TimetableChange.JourneysAdded, r.TimetableChange.JourneysRemoved, r.TimetableChange.JourneysRetimed, len(r.TimetableChange.Services))
+	}
+
+	writeExamples(writer, "Stops missing a location", r.StopsMissingLocation)
+	writeExamples(writer, "Unknown services referenced by journeys", r.MissingServiceReferences)
+	writeExamples(writer, fmt.Sprintf("Unknown stops referenced by %d journeys", r.JourneysWithUnknownStops), r.MissingStopReferences)
+	writeExamples(writer, "Journeys whose availability never matches in the next year", r.NeverAvailableJourneys)
+	writeExamples(writer, "Duplicate identifiers", r.DuplicateIdentifiers)
+	writeExamples(writer, "Identifiers already used by another dataset", r.ConflictingIdentifiers)
+
+	if r.ValidationError != "" {
+		fmt.Fprintf(writer, "Import would be rejected: %s\n", r.ValidationError)
+	} else {
+		fmt.Fprintln(writer, "Import would pass validation")
+	}
+}
+
+func writeExamples(writer io.Writer, title string, identifiers []string) {
+	if len(identifiers) == 0 {
+		return
+	}
+
+	fmt.Fprintf(writer, "%s (%d)\n", title, len(identifiers))
+	for _, identifier := range identifiers[:min(dryRunExamples, len(identifiers))] {
+		fmt.Fprintf(writer, "  %s\n", identifier)
+	}
+	if len(identifiers) > dryRunExamples {
+		fmt.Fprintf(writer, "  ... and %d more\n", len(identifiers)-dryRunExamples)
+	}
+	fmt.Fprintln(writer)
+}
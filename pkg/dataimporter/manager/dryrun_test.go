@@ -0,0 +1,136 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestDryRunCollectionChecks(t *testing.T) {
+	database.ConnectMemory()
+
+	dataset := &datasets.DataSet{Identifier: "dryrun-dataset"}
+	datasource := &ctdf.DataSourceReference{DatasetID: dataset.Identifier}
+	otherDatasource := &ctdf.DataSourceReference{DatasetID: "dryrun-other-dataset"}
+
+	// Other tests look at everything staged so leave nothing behind
+	t.Cleanup(func() {
+		for _, collectionName := range []string{"services", datasets.ImportCollectionName("services"), datasets.ImportCollectionName("stops_raw")} {
+			database.GetCollection(collectionName).DeleteMany(context.Background(), bson.M{
+				"datasource.datasetid": bson.M{"$in": bson.A{datasource.DatasetID, otherDatasource.DatasetID}},
+			})
+		}
+	})
+
+	for _, service := range []ctdf.Service{
+		{PrimaryIdentifier: "kept", DataSource: datasource},
+		{PrimaryIdentifier: "removed", DataSource: datasource},
+		{PrimaryIdentifier: "conflict", DataSource: otherDatasource},
+	} {
+		database.GetCollection("services").InsertOne(context.Background(), service)
+	}
+	for _, service := range []ctdf.Service{
+		{PrimaryIdentifier: "kept", DataSource: datasource},
+		{PrimaryIdentifier: "added", DataSource: datasource},
+		{PrimaryIdentifier: "added", DataSource: datasource},
+		{PrimaryIdentifier: "conflict", DataSource: datasource},
+	} {
+		database.GetCollection(datasets.ImportCollectionName("services")).InsertOne(context.Background(), service)
+	}
+
+	collectionReport, duplicates, err := diffStagedCollection(dataset, "services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collectionReport.Staged != 3 || collectionReport.Live != 2 {
+		t.Errorf("expected 3 staged & 2 live services, got %d & %d", collectionReport.Staged, collectionReport.Live)
+	}
+	if fmt.Sprint(collectionReport.Added) != "[added conflict]" || fmt.Sprint(collectionReport.Removed) != "[removed]" {
+		t.Errorf("expected added [added conflict] & removed [removed], got %v & %v", collectionReport.Added, collectionReport.Removed)
+	}
+	if fmt.Sprint(duplicates) != "[added]" {
+		t.Errorf("expected duplicates [added], got %v", duplicates)
+	}
+
+	conflicts, err := findConflictingIdentifiers(dataset, "services")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(conflicts) != "[conflict]" {
+		t.Errorf("expected conflicts [conflict], got %v", conflicts)
+	}
+
+	for _, stop := range []ctdf.Stop{
+		{PrimaryIdentifier: "located", DataSource: datasource, Location: &ctdf.Location{Type: "Point", Coordinates: []float64{-0.1, 51.5}}},
+		{PrimaryIdentifier: "no-location", DataSource: datasource},
+		{PrimaryIdentifier: "null-island", DataSource: datasource, Location: &ctdf.Location{Type: "Point", Coordinates: []float64{0, 0}}},
+		{PrimaryIdentifier: "other-dataset", DataSource: otherDatasource},
+	} {
+		database.GetCollection(datasets.ImportCollectionName("stops_raw")).InsertOne(context.Background(), stop)
+	}
+
+	stopsMissingLocation, err := findStopsMissingLocation(dataset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(stopsMissingLocation) != "[no-location null-island]" {
+		t.Errorf("expected stops missing a location [no-location null-island], got %v", stopsMissingLocation)
+	}
+}
+
+func TestAvailabilityEverMatches(t *testing.T) {
+	now := time.Now()
+
+	for _, test := range []struct {
+		name         string
+		availability *ctdf.Availability
+		matches      bool
+	}{
+		{"none", nil, false},
+		{"no match rules", &ctdf.Availability{}, false},
+		{"every day", &ctdf.Availability{Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityMatchAll}}}, true},
+		{"weekly", &ctdf.Availability{Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDayOfWeek, Value: "Sunday"}}}, true},
+		{"next month", &ctdf.Availability{Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: now.AddDate(0, 1, 0).Format("2006-01-02")}}}, true},
+		{"last year", &ctdf.Availability{Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: now.AddDate(-1, 0, 0).Format("2006-01-02")}}}, false},
+		{"in two years", &ctdf.Availability{Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: now.AddDate(2, 0, 0).Format("2006-01-02")}}}, false},
+		{
+			"always excluded",
+			&ctdf.Availability{
+				Match:   []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDayOfWeek, Value: "Sunday"}},
+				Exclude: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityMatchAll}},
+			},
+			false,
+		},
+	} {
+		if matches := availabilityEverMatches(test.availability); matches != test.matches {
+			t.Errorf("%s: expected matches to be %t", test.name, test.matches)
+		}
+	}
+}
+
+func TestDryRunReportHasProblems(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		report   DryRunReport
+		problems bool
+	}{
+		{"clean", DryRunReport{Collections: []DryRunCollectionReport{{Collection: "stops", Added: []string{"a"}}}}, false},
+		{"validation error", DryRunReport{ValidationError: "too few records"}, true},
+		{"stops missing location", DryRunReport{StopsMissingLocation: []string{"a"}}, true},
+		{"missing services", DryRunReport{MissingServiceReferences: []string{"a"}}, true},
+		{"missing stops", DryRunReport{MissingStopReferences: []string{"a"}}, true},
+		{"never available journeys", DryRunReport{NeverAvailableJourneys: []string{"a"}}, true},
+		{"duplicates", DryRunReport{DuplicateIdentifiers: []string{"a"}}, true},
+		{"conflicts", DryRunReport{ConflictingIdentifiers: []string{"a"}}, true},
+	} {
+		if problems := test.report.HasProblems(); problems != test.problems {
+			t.Errorf("%s: expected has problems to be %t", test.name, test.problems)
+		}
+	}
+}
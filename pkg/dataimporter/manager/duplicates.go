@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/datalinker/servicelinks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// markStagedDuplicates marks the staged services & journeys that duplicate live ones from a higher priority
+// dataset before they are promoted, so the live records never lose their mark when a lower priority dataset is re-imported.
+// When the dataset being imported is the preferred one nothing is marked here, the services linker follow-on
+// updates the other datasets records afterwards
+func markStagedDuplicates(dataset *datasets.DataSet) error {
+	if !dataset.SupportedObjects.Services {
+		return nil
+	}
+
+	stagedServicesCollection := database.GetCollection(datasets.ImportCollectionName("services"))
+	liveServicesCollection := database.GetCollection("services")
+
+	cursor, err := stagedServicesCollection.Find(context.Background(), datasetQuery(dataset.Identifier), options.Find().SetProjection(servicelinks.ServiceProjection))
+	if err != nil {
+		return err
+	}
+	var services []*ctdf.Service
+	if err := cursor.All(context.Background(), &services); err != nil {
+		return err
+	}
+
+	operatorRefs, err := stagedServicesCollection.Distinct(context.Background(), "operatorref", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return err
+	}
+	if len(operatorRefs) == 0 {
+		return nil
+	}
+
+	// Other datasets may reference the same operator by any of its identifiers
+	operatorIdentifiers, err := servicelinks.LoadOperatorIdentifiers()
+	if err != nil {
+		return err
+	}
+	var stagedOperatorRefs []string
+	for _, operatorRef := range operatorRefs {
+		if operatorRef, ok := operatorRef.(string); ok {
+			stagedOperatorRefs = append(stagedOperatorRefs, operatorRef)
+		}
+	}
+
+	cursor, err = liveServicesCollection.Find(context.Background(), bson.M{
+		"operatorref":          bson.M{"$in": operatorIdentifiers.Expand(stagedOperatorRefs)},
+		"datasource.datasetid": bson.M{"$ne": dataset.Identifier},
+	}, options.Find().SetProjection(servicelinks.ServiceProjection))
+	if err != nil {
+		return err
+	}
+	var otherServices []*ctdf.Service
+	if err := cursor.All(context.Background(), &otherServices); err != nil {
+		return err
+	}
+	services = append(services, otherServices...)
+	operatorIdentifiers.ResolveServices(services)
+
+	serviceWriter := servicelinks.NewMarkWriter(stagedServicesCollection)
+	journeyWriter := servicelinks.NewMarkWriter(database.GetCollection(datasets.ImportCollectionName("journeys")))
+
+	for _, group := range servicelinks.Group(services, GetDatasetPriorities()) {
+		preferredDataset := group[0].DataSource.DatasetID
+		if preferredDataset == dataset.Identifier {
+			continue
+		}
+
+		var stagedServiceRefs []string
+		var preferredServiceRefs []string
+		for _, service := range group {
+			switch service.DataSource.DatasetID {
+			case dataset.Identifier:
+				stagedServiceRefs = append(stagedServiceRefs, service.PrimaryIdentifier)
+			case preferredDataset:
+				preferredServiceRefs = append(preferredServiceRefs, service.PrimaryIdentifier)
+			}
+		}
+		if len(stagedServiceRefs) == 0 {
+			continue
+		}
+
+		var journeys []*ctdf.Journey
+		if dataset.SupportedObjects.Journeys {
+			stagedJourneys, err := findLinkJourneys(datasets.ImportCollectionName("journeys"), bson.M{
+				"serviceref":           bson.M{"$in": stagedServiceRefs},
+				"datasource.datasetid": dataset.Identifier,
+			})
+			if err != nil {
+				return err
+			}
+			preferredJourneys, err := findLinkJourneys("journeys", bson.M{
+				"serviceref":           bson.M{"$in": preferredServiceRefs},
+				"datasource.datasetid": preferredDataset,
+			})
+			if err != nil {
+				return err
+			}
+
+			journeys = append(stagedJourneys, preferredJourneys...)
+			operatorIdentifiers.ResolveJourneys(journeys)
+		}
+
+		links := servicelinks.Link(group, journeys)
+
+		for _, serviceRef := range stagedServiceRefs {
+			if err := serviceWriter.Mark(serviceRef, "", links.Services[serviceRef]); err != nil {
+				return err
+			}
+		}
+		for _, journey := range journeys {
+			if journey.DataSource.DatasetID != dataset.Identifier {
+				continue
+			}
+
+			if err := journeyWriter.Mark(journey.PrimaryIdentifier, "", links.Journeys[journey.PrimaryIdentifier]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := serviceWriter.Flush(); err != nil {
+		return err
+	}
+	if err := journeyWriter.Flush(); err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("dataset", dataset.Identifier).
+		Int("services", serviceWriter.Updated).
+		Int("journeys", journeyWriter.Updated).
+		Msg("Marked staged duplicates")
+
+	return nil
+}
+
+func findLinkJourneys(collectionName string, query bson.M) ([]*ctdf.Journey, error) {
+	cursor, err := database.GetCollection(collectionName).Find(context.Background(), query, options.Find().SetProjection(servicelinks.JourneyProjection))
+	if err != nil {
+		return nil, err
+	}
+
+	var journeys []*ctdf.Journey
+	err = cursor.All(context.Background(), &journeys)
+
+	return journeys, err
+}
@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"context"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// filterStagedRecords runs the dataset record filters over the staged records and removes the
+// ones that shouldn't be imported, so they are never promoted to the live collections.
+// Journeys calling at a removed stop or belonging to a removed service are removed with them, see removeStagedReferences
+func filterStagedRecords(dataset *datasets.DataSet) error {
+	if dataset.Filters.IsEmpty() {
+		return nil
+	}
+
+	filters := dataset.Filters
+
+	if _, err := filterStagedCollection[ctdf.Operator](dataset, "operators_raw", filters.Operators); err != nil {
+		return err
+	}
+	if _, err := filterStagedCollection[ctdf.OperatorGroup](dataset, "operator_groups", filters.OperatorGroups); err != nil {
+		return err
+	}
+	removedStops, err := filterStagedCollection[ctdf.Stop](dataset, "stops_raw", filters.Stops)
+	if err != nil {
+		return err
+	}
+	if _, err := filterStagedCollection[ctdf.StopGroup](dataset, "stop_groups", filters.StopGroups); err != nil {
+		return err
+	}
+	removedServices, err := filterStagedCollection[ctdf.Service](dataset, "services", filters.Services)
+	if err != nil {
+		return err
+	}
+	if _, err := filterStagedCollection[ctdf.Journey](dataset, "journeys", filters.Journeys); err != nil {
+		return err
+	}
+
+	return removeStagedReferences(dataset, removedStops, removedServices)
+}
+
+// removeStagedReferences removes the staged journeys that call at a removed stop or belong to a removed service,
+// then the services left without any journeys because of it. Services that didn't have any journeys are kept
+func removeStagedReferences(dataset *datasets.DataSet, removedStops []string, removedServices []string) error {
+	if len(removedStops) == 0 && len(removedServices) == 0 {
+		return nil
+	}
+
+	journeysCollection := database.GetCollection(datasets.ImportCollectionName("journeys"))
+	servicesCollection := database.GetCollection(datasets.ImportCollectionName("services"))
+
+	var journeyQueries []bson.M
+	for i := 0; i < len(removedStops); i += stagingBatchSize {
+		chunk := removedStops[i:min(i+stagingBatchSize, len(removedStops))]
+
+		journeyQueries = append(journeyQueries, bson.M{"$or": bson.A{
+			bson.M{"path.originstopref": bson.M{"$in": chunk}},
+			bson.M{"path.destinationstopref": bson.M{"$in": chunk}},
+		}})
+	}
+	for i := 0; i < len(removedServices); i += stagingBatchSize {
+		chunk := removedServices[i:min(i+stagingBatchSize, len(removedServices))]
+
+		journeyQueries = append(journeyQueries, bson.M{"serviceref": bson.M{"$in": chunk}})
+	}
+
+	var removedJourneys int64
+	affectedServices := map[string]bool{}
+
+	for _, journeyQuery := range journeyQueries {
+		journeyQuery["datasource.datasetid"] = dataset.Identifier
+
+		serviceRefs, err := journeysCollection.Distinct(context.Background(), "serviceref", journeyQuery)
+		if err != nil {
+			return err
+		}
+		for _, serviceRef := range serviceRefs {
+			if serviceRef, ok := serviceRef.(string); ok {
+				affectedServices[serviceRef] = true
+			}
+		}
+
+		result, err := journeysCollection.DeleteMany(context.Background(), journeyQuery)
+		if err != nil {
+			return err
+		}
+		removedJourneys += result.DeletedCount
+	}
+
+	var emptiedServices []string
+	for serviceRef := range affectedServices {
+		count, err := journeysCollection.CountDocuments(context.Background(), bson.M{
+			"datasource.datasetid": dataset.Identifier,
+			"serviceref":           serviceRef,
+		}, options.Count().SetLimit(1))
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			emptiedServices = append(emptiedServices, serviceRef)
+		}
+	}
+
+	for i := 0; i < len(emptiedServices); i += stagingBatchSize {
+		chunk := emptiedServices[i:min(i+stagingBatchSize, len(emptiedServices))]
+
+		_, err := servicesCollection.DeleteMany(context.Background(), bson.M{
+			"datasource.datasetid": dataset.Identifier,
+			"primaryidentifier":    bson.M{"$in": chunk},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info().
+		Int64("journeys", removedJourneys).
+		Int("services", len(emptiedServices)).
+		Msg("Removed staged records referencing filtered records")
+
+	return nil
+}
+
+// filterStagedCollection removes the staged records of the collection the filters don't keep, returning their primary identifiers
+func filterStagedCollection[T any](dataset *datasets.DataSet, collectionName string, filters []datasets.RecordFilter) ([]string, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	var emptyRecord T
+	programs := make([]*vm.Program, len(filters))
+	for i, filter := range filters {
+		program, err := filter.Compile(emptyRecord)
+		if err != nil {
+			return nil, err
+		}
+		programs[i] = program
+	}
+
+	collection := database.GetCollection(datasets.ImportCollectionName(collectionName))
+
+	cursor, err := collection.Find(context.Background(), datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, err
+	}
+
+	var total int
+	var failedEvaluations int
+	var removeIDs []interface{}
+	var removedIdentifiers []string
+
+	for cursor.Next(context.Background()) {
+		total++
+
+		var record T
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		var recordID struct {
+			ID                interface{} `bson:"_id"`
+			PrimaryIdentifier string
+		}
+		if err := cursor.Decode(&recordID); err != nil {
+			return nil, err
+		}
+
+		if !keepRecord(record, filters, programs, &failedEvaluations) {
+			removeIDs = append(removeIDs, recordID.ID)
+			removedIdentifiers = append(removedIdentifiers, recordID.PrimaryIdentifier)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(removeIDs); i += stagingBatchSize {
+		chunk := removeIDs[i:min(i+stagingBatchSize, len(removeIDs))]
+
+		if _, err := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": chunk}}); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Info().
+		Str("collection", collectionName).
+		Int("total", total).
+		Int("removed", len(removeIDs)).
+		Int("failed", failedEvaluations).
+		Msg("Filtered staged records")
+
+	return removedIdentifiers, nil
+}
+
+// keepRecord checks the record against every filter, an expression that errors (eg. on a nil field) counts as not matching
+func keepRecord(record interface{}, filters []datasets.RecordFilter, programs []*vm.Program, failedEvaluations *int) bool {
+	for i, filter := range filters {
+		output, err := expr.Run(programs[i], record)
+		if err != nil {
+			*failedEvaluations++
+		}
+
+		matches := err == nil && output == true
+
+		if filter.Keep != "" && !matches {
+			return false
+		}
+		if filter.Drop != "" && matches {
+			return false
+		}
+	}
+
+	return true
+}
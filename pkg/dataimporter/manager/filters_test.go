@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func remainingStagedIdentifiers(t *testing.T, collectionName string) []string {
+	identifiers, err := database.GetCollection(datasets.ImportCollectionName(collectionName)).Distinct(context.Background(), "primaryidentifier", bson.M{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining []string
+	for _, identifier := range identifiers {
+		remaining = append(remaining, identifier.(string))
+	}
+	sort.Strings(remaining)
+
+	return remaining
+}
+
+func TestFilterStagedRecordsRemovesReferences(t *testing.T) {
+	database.ConnectMemory()
+
+	dataset := &datasets.DataSet{
+		Identifier: "test-dataset",
+		Filters: datasets.RecordFilters{
+			Stops:    []datasets.RecordFilter{{Drop: `PrimaryIdentifier == "stop-c"`}},
+			Services: []datasets.RecordFilter{{Drop: `PrimaryIdentifier == "service-3"`}},
+		},
+	}
+	dataSource := &ctdf.DataSourceReference{DatasetID: dataset.Identifier}
+
+	stops := database.GetCollection(datasets.ImportCollectionName("stops_raw"))
+	for _, stop := range []string{"stop-a", "stop-b", "stop-c"} {
+		stops.InsertOne(context.Background(), ctdf.Stop{PrimaryIdentifier: stop, DataSource: dataSource})
+	}
+
+	services := database.GetCollection(datasets.ImportCollectionName("services"))
+	for _, service := range []string{"service-1", "service-2", "service-3", "service-4"} {
+		services.InsertOne(context.Background(), ctdf.Service{PrimaryIdentifier: service, DataSource: dataSource})
+	}
+
+	journeys := database.GetCollection(datasets.ImportCollectionName("journeys"))
+	for _, journey := range []struct {
+		identifier  string
+		service     string
+		origin      string
+		destination string
+	}{
+		// service-1 keeps one of its journeys, all of service-2's call at the removed stop
+		{"journey-1a", "service-1", "stop-a", "stop-b"},
+		{"journey-1b", "service-1", "stop-b", "stop-c"},
+		{"journey-2a", "service-2", "stop-c", "stop-a"},
+		{"journey-3a", "service-3", "stop-a", "stop-b"},
+	} {
+		journeys.InsertOne(context.Background(), ctdf.Journey{
+			PrimaryIdentifier: journey.identifier,
+			ServiceRef:        journey.service,
+			DataSource:        dataSource,
+			Path: []*ctdf.JourneyPathItem{
+				{OriginStopRef: journey.origin, DestinationStopRef: journey.destination},
+			},
+		})
+	}
+
+	if err := filterStagedRecords(dataset); err != nil {
+		t.Fatal(err)
+	}
+
+	for collectionName, expected := range map[string][]string{
+		"stops_raw": {"stop-a", "stop-b"},
+		"journeys":  {"journey-1a"},
+		// service-4 never had any journeys so is left alone
+		"services": {"service-1", "service-4"},
+	} {
+		identifiers := remainingStagedIdentifiers(t, collectionName)
+		if len(identifiers) != len(expected) {
+			t.Errorf("expected %s to be %v, got %v", collectionName, expected, identifiers)
+			continue
+		}
+		for i := range expected {
+			if identifiers[i] != expected[i] {
+				t.Errorf("expected %s to be %v, got %v", collectionName, expected, identifiers)
+				break
+			}
+		}
+	}
+}
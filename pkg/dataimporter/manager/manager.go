@@ -1,11 +1,7 @@
 package manager
 
 import (
-	"archive/zip"
-	"compress/gzip"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -28,7 +24,8 @@ import (
 	"github.com/travigo/travigo/pkg/dataimporter/formats/siri_vm"
 	"github.com/travigo/travigo/pkg/dataimporter/formats/transxchange"
 	"github.com/travigo/travigo/pkg/dataimporter/formats/travelinenoc"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/dataimporter/importruns"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
 	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -65,10 +62,10 @@ func GetDataset(identifier string) (datasets.DataSet, error) {
 	return datasets.DataSet{}, errors.New("Dataset could not be found")
 }
 
-func createDatasetFormat(dataset *datasets.DataSet) (formats.Format, error) {
+func createDatasetFormat(dataset *datasets.DataSet, datasetFormat datasets.DataSetFormat) (formats.Format, error) {
 	var format formats.Format
 
-	switch dataset.Format {
+	switch datasetFormat {
 	case datasets.DataSetFormatTravelineNOC:
 		format = &travelinenoc.TravelineData{}
 	case datasets.DataSetFormatNaPTAN:
@@ -90,33 +87,55 @@ func createDatasetFormat(dataset *datasets.DataSet) (formats.Format, error) {
 	case datasets.DataSetFormatTransXChange:
 		format = &transxchange.TransXChange{}
 	default:
-		return nil, errors.New(fmt.Sprintf("Unrecognised format %s", dataset.Format))
+		return nil, errors.New(fmt.Sprintf("Unrecognised format %s", datasetFormat))
 	}
 
 	if dataset.ImportDestination == datasets.ImportDestinationRealtimeQueue {
 		if dataset.Queue == nil {
-			realtimeQueue, err := redis_client.QueueConnection.OpenQueue("realtime-queue")
+			realtimeQueue, err := vehicletracker.OpenPartitionedRealtimeQueue()
 			if err != nil {
 				log.Fatal().Err(err).Msg("Failed to start redis realtime-queue")
 			}
-			dataset.Queue = &realtimeQueue
+			dataset.Queue = realtimeQueue
 		}
 
 		var realtimeQueueFormat formats.RealtimeQueueFormat
 		realtimeQueueFormat = format.(formats.RealtimeQueueFormat)
 
-		realtimeQueueFormat.SetupRealtimeQueue(*dataset.Queue)
+		realtimeQueueFormat.SetupRealtimeQueue(dataset.Queue)
 	}
 
 	return format, nil
 }
 
 func ImportDataset(dataset *datasets.DataSet, forceImport bool) error {
+	_, err := ImportDatasetWithTrigger(dataset, forceImport, "manual")
+
+	return err
+}
+
+// ImportDatasetWithTrigger imports the dataset and records the run against what started it
+func ImportDatasetWithTrigger(dataset *datasets.DataSet, forceImport bool, trigger string) (*ctdf.DatasetImportRun, error) {
+	run := importruns.Start(dataset.Identifier, trigger)
+
+	err := importDataset(dataset, forceImport, run)
+
+	importruns.Finish(run, err)
+
+	return run, err
+}
+
+func importDataset(dataset *datasets.DataSet, forceImport bool, run *ctdf.DatasetImportRun) error {
 	datasetVersionCollection := database.GetCollection("dataset_versions")
 
 	var existingDatasetVersion *ctdf.DatasetVersion
 	datasetVersionCollection.FindOne(context.Background(), bson.M{"dataset": dataset.Identifier}).Decode(&existingDatasetVersion)
 
+	if existingDatasetVersion != nil && !forceImport && missingLiveRecords(dataset) {
+		log.Info().Str("dataset", dataset.Identifier).Msg("Dataset has no live records in a collection it owns, importing even if it hasn't changed")
+		forceImport = true
+	}
+
 	var existingEtag string
 	if existingDatasetVersion != nil && !forceImport {
 		log.Info().Interface("version", existingDatasetVersion).Msg("Existing dataset version found")
@@ -131,32 +150,23 @@ func ImportDataset(dataset *datasets.DataSet, forceImport bool) error {
 		Timestamp:      fmt.Sprintf("%d", time.Now().Unix()),
 	}
 
-	source := dataset.Source
-	var etag string
-
-	if isValidUrl(dataset.Source) {
-		var tempFile *os.File
-		var hasChanged bool
-		hasChanged, tempFile, etag = tempDownloadFile(dataset, existingEtag)
-
-		if !hasChanged {
-			log.Info().Str("dataset", dataset.Identifier).Msg("File ETag is not new, skipping processing")
-			return nil
-		}
-
-		source = tempFile.Name()
-		defer os.Remove(tempFile.Name())
+	source, err := fetchSource(dataset, existingEtag)
+	if err != nil {
+		return err
 	}
+	defer source.Cleanup()
+	run.BytesDownloaded = source.DownloadedBytes
 
-	// Calculate the hash of the file
-	f, err := os.Open(source)
-	defer f.Close()
+	if !source.Changed {
+		log.Info().Str("dataset", dataset.Identifier).Msg("File ETag is not new, skipping processing")
+		return nil
+	}
 
-	hash := sha256.New()
-	if _, err := io.Copy(hash, f); err != nil {
-		log.Error().Err(err).Msg("Calculating hash")
+	// Calculate the hash of the source
+	sourceFileHash, err := source.Hash()
+	if err != nil {
+		return err
 	}
-	sourceFileHash := hex.EncodeToString(hash.Sum(nil))
 
 	// Check if the file hasn't changed
 	if existingDatasetVersion != nil && existingDatasetVersion.Hash == sourceFileHash && !forceImport {
@@ -164,92 +174,51 @@ func ImportDataset(dataset *datasets.DataSet, forceImport bool) error {
 		return nil
 	}
 
-	// Parse the file
-	sourceFileReaders := []io.Reader{}
+	clearStagedRecords(dataset)
 
-	file, err := os.Open(source)
-	if err != nil {
+	if err := stageSource(dataset, source, datasource); err != nil {
 		return err
 	}
+	if err := filterStagedRecords(dataset); err != nil {
+		clearStagedRecords(dataset)
 
-	switch dataset.UnpackBundle {
-	case datasets.BundleFormatNone, "":
-		sourceFileReaders = append(sourceFileReaders, file)
-	case datasets.BundleFormatGZ:
-		gzipDecoder, err := gzip.NewReader(file)
-		if err != nil {
-			log.Fatal().Err(err).Msg("cannot decode gzip stream")
-		}
-		defer gzipDecoder.Close()
-
-		sourceFileReaders = append(sourceFileReaders, gzipDecoder)
-	case datasets.BundleFormatZIP:
-		archive, err := zip.OpenReader(source)
-		if err != nil {
-			return err
-		}
-		defer archive.Close()
-
-		for i, zipFile := range archive.File {
-			zipFileOpen, err := zipFile.Open()
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to open file")
-			}
-			defer zipFileOpen.Close()
-
-			sourceFileReaders = append(sourceFileReaders, zipFileOpen)
-
-			log.Debug().Int("index", i).Str("path", zipFile.Name).Msg("Storing zip file")
-		}
-	default:
-		return errors.New(fmt.Sprintf("Cannot handle bundle format %s", dataset.UnpackBundle))
+		return err
 	}
 
-	for i, sourceFileReader := range sourceFileReaders {
-		format, err := createDatasetFormat(dataset)
-		if err != nil {
+	// Records are staged & only made live once they have been validated
+	if dataset.ImportDestination != datasets.ImportDestinationRealtimeQueue {
+		if err := validateStagedImport(dataset); err != nil {
+			log.Error().Err(err).Str("dataset", dataset.Identifier).Msg("Staged import failed validation, keeping the current version")
+			clearStagedRecords(dataset)
+
 			return err
 		}
 
-		// Actually import it
-		err = format.ParseFile(sourceFileReader)
-		if err != nil {
+		if err := markStagedDuplicates(dataset); err != nil {
+			clearStagedRecords(dataset)
+
 			return err
 		}
 
-		log.Debug().Int("index", i).Msg("Opening zipped file")
-		err = format.Import(*dataset, datasource)
-		if err != nil {
+		if err := promoteStagedImport(dataset, datasource, run.Collections); err != nil {
 			return err
 		}
 	}
 
-	if dataset.SupportedObjects.Stops {
-		cleanupOldRecords("stops_raw", datasource)
-	}
-	if dataset.SupportedObjects.StopGroups {
-		cleanupOldRecords("stop_groups", datasource)
-	}
-	if dataset.SupportedObjects.Operators {
-		cleanupOldRecords("operators", datasource)
-	}
-	if dataset.SupportedObjects.OperatorGroups {
-		cleanupOldRecords("operator_groups", datasource)
-	}
-	if dataset.SupportedObjects.Services {
-		cleanupOldRecords("services", datasource)
-	}
-	if dataset.SupportedObjects.Journeys {
-		cleanupOldRecords("journeys", datasource)
-	}
+	run.Changed = true
 
 	// Update dataset version
 	if dataset.ImportDestination != datasets.ImportDestinationRealtimeQueue {
 		datasetVersion := ctdf.DatasetVersion{
 			Dataset:      dataset.Identifier,
 			Hash:         sourceFileHash,
-			ETag:         etag,
+			ETag:         source.ETag,
+			Timestamp:    datasource.Timestamp,
 			LastModified: time.Now(),
+			Previous:     existingDatasetVersion,
+		}
+		if datasetVersion.Previous != nil {
+			datasetVersion.Previous.Previous = nil
 		}
 
 		opts := options.Update().SetUpsert(true)
@@ -273,7 +242,20 @@ func isValidUrl(toTest string) bool {
 	return true
 }
 
-func tempDownloadFile(dataset *datasets.DataSet, etag string) (bool, *os.File, string) {
+func DownloadDataset(dataset *datasets.DataSet) (*os.File, error) {
+	if !isValidUrl(dataset.Source) {
+		return nil, errors.New(fmt.Sprintf("Dataset source %s is not a URL", dataset.Source))
+	}
+
+	hasChanged, tempFile, _, _ := tempDownloadFile(dataset, "")
+	if !hasChanged {
+		return nil, errors.New("Dataset source returned no content")
+	}
+
+	return tempFile, nil
+}
+
+func tempDownloadFile(dataset *datasets.DataSet, etag string) (bool, *os.File, string, int64) {
 	req, _ := http.NewRequest("GET", dataset.Source, nil)
 	req.Header.Set("user-agent", "curl/7.54.1") // TfL is protected by cloudflare and it gets angry when no user agent is set
 
@@ -333,7 +315,7 @@ func tempDownloadFile(dataset *datasets.DataSet, etag string) (bool, *os.File, s
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotModified {
-		return false, nil, ""
+		return false, nil, "", 0
 	}
 
 	tmpFile, err := os.CreateTemp(os.TempDir(), "travigo-data-importer-")
@@ -343,30 +325,7 @@ func tempDownloadFile(dataset *datasets.DataSet, etag string) (bool, *os.File, s
 
 	log.Debug().Str("path", tmpFile.Name()).Msg("Data file downloaded")
 
-	io.Copy(tmpFile, resp.Body)
+	downloadedBytes, _ := io.Copy(tmpFile, resp.Body)
 
-	return true, tmpFile, resp.Header.Get("Etag")
-}
-
-func cleanupOldRecords(collectionName string, datasource *ctdf.DataSourceReference) {
-	collection := database.GetCollection(collectionName)
-
-	query := bson.M{
-		"$and": bson.A{
-			bson.M{"datasource.originalformat": datasource.OriginalFormat},
-			bson.M{"datasource.datasetid": datasource.DatasetID},
-			bson.M{"datasource.timestamp": bson.M{
-				"$ne": datasource.Timestamp,
-			}},
-		},
-	}
-
-	result, _ := collection.DeleteMany(context.Background(), query)
-
-	if result != nil {
-		log.Info().
-			Str("collection", collectionName).
-			Int64("num", result.DeletedCount).
-			Msg("Cleaned up old records")
-	}
+	return true, tmpFile, resp.Header.Get("Etag"), downloadedBytes
 }
@@ -55,6 +55,17 @@ func GetRegisteredDataSources() []datasets.DataSource {
 	return registeredDatasources
 }
 
+// GetDatasetPriorities returns the priority of each registered dataset by identifier, higher is preferred
+func GetDatasetPriorities() map[string]int {
+	priorities := map[string]int{}
+
+	for _, dataset := range GetRegisteredDataSets() {
+		priorities[dataset.Identifier] = dataset.Priority
+	}
+
+	return priorities
+}
+
 func GetRegisteredDataSets() []datasets.DataSet {
 	var registeredDatasets []datasets.DataSet
 
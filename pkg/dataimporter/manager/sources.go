@@ -0,0 +1,300 @@
+package manager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+)
+
+// datasetSource is the set of local files that make up a dataset source
+type datasetSource struct {
+	Paths []string
+
+	ETag            string
+	DownloadedBytes int64
+
+	// False when the server says the file matches the existing ETag
+	Changed bool
+
+	temporary bool
+}
+
+// fetchSource downloads the dataset source to a temporary file when it's a URL,
+// otherwise the source is a local file, directory or glob pattern
+func fetchSource(dataset *datasets.DataSet, existingEtag string) (*datasetSource, error) {
+	if isValidUrl(dataset.Source) {
+		hasChanged, tempFile, etag, downloadedBytes := tempDownloadFile(dataset, existingEtag)
+
+		source := &datasetSource{
+			ETag:            etag,
+			DownloadedBytes: downloadedBytes,
+			Changed:         hasChanged,
+			temporary:       true,
+		}
+		if hasChanged {
+			source.Paths = []string{tempFile.Name()}
+		}
+
+		return source, nil
+	}
+
+	paths, err := resolveLocalSource(dataset.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	return &datasetSource{
+		Paths:   paths,
+		Changed: true,
+	}, nil
+}
+
+func resolveLocalSource(source string) ([]string, error) {
+	var paths []string
+
+	if strings.ContainsAny(source, "*?[") {
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, match := range matches {
+			if fileInfo, err := os.Stat(match); err == nil && !fileInfo.IsDir() {
+				paths = append(paths, match)
+			}
+		}
+	} else {
+		fileInfo, err := os.Stat(source)
+		if err != nil {
+			return nil, err
+		}
+
+		if !fileInfo.IsDir() {
+			return []string{source}, nil
+		}
+
+		err = filepath.WalkDir(source, func(filePath string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() {
+				paths = append(paths, filePath)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New(fmt.Sprintf("Source %s doesn't contain any files", source))
+	}
+
+	sort.Strings(paths)
+
+	return paths, nil
+}
+
+func (s *datasetSource) Cleanup() {
+	if !s.temporary {
+		return
+	}
+
+	for _, filePath := range s.Paths {
+		os.Remove(filePath)
+	}
+}
+
+// Hash of the source contents, a single file is hashed on its own so hashes match older imports
+func (s *datasetSource) Hash() (string, error) {
+	hash := sha256.New()
+
+	for _, filePath := range s.Paths {
+		if len(s.Paths) > 1 {
+			hash.Write([]byte(filePath))
+		}
+
+		file, err := os.Open(filePath)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// stageSource unpacks & parses the source files and converts them into CTDF records in the import collections
+func stageSource(dataset *datasets.DataSet, source *datasetSource, datasource *ctdf.DataSourceReference) error {
+	for _, filePath := range source.Paths {
+		err := forEachSourceFile(dataset, filePath, func(name string, reader io.Reader) error {
+			fileFormat := dataset.FormatForFile(name)
+
+			log.Debug().Str("file", name).Str("format", string(fileFormat)).Msg("Importing file")
+
+			format, err := createDatasetFormat(dataset, fileFormat)
+			if err != nil {
+				return err
+			}
+
+			// Actually import it
+			if err := format.ParseFile(reader); err != nil {
+				return errors.New(fmt.Sprintf("%s: %s", name, err))
+			}
+
+			return format.Import(*dataset, datasource)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachSourceFile unpacks the file according to the dataset bundle format and calls handler
+// for every file that should be imported, nested zip files are unpacked as well
+func forEachSourceFile(dataset *datasets.DataSet, filePath string, handler func(name string, reader io.Reader) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	name := filepath.Base(filePath)
+
+	switch dataset.UnpackBundle {
+	case datasets.BundleFormatNone, "":
+		if !dataset.IncludesFile(name) {
+			return nil
+		}
+
+		return handler(name, file)
+	case datasets.BundleFormatGZ:
+		gzipDecoder, err := gzip.NewReader(file)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Cannot decode gzip stream %s: %s", name, err))
+		}
+		defer gzipDecoder.Close()
+
+		name = strings.TrimSuffix(name, ".gz")
+		if !dataset.IncludesFile(name) {
+			return nil
+		}
+
+		return handler(name, gzipDecoder)
+	case datasets.BundleFormatZIP:
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		return forEachZipFile(dataset, name, file, fileInfo.Size(), handler)
+	case datasets.BundleFormatTarGZ:
+		gzipDecoder, err := gzip.NewReader(file)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Cannot decode gzip stream %s: %s", name, err))
+		}
+		defer gzipDecoder.Close()
+
+		return forEachTarFile(dataset, name, gzipDecoder, handler)
+	default:
+		return errors.New(fmt.Sprintf("Cannot handle bundle format %s", dataset.UnpackBundle))
+	}
+}
+
+func forEachZipFile(dataset *datasets.DataSet, archiveName string, reader io.ReaderAt, size int64, handler func(name string, reader io.Reader) error) error {
+	archive, err := zip.NewReader(reader, size)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Cannot open zip %s: %s", archiveName, err))
+	}
+
+	for _, zipFile := range archive.File {
+		if zipFile.FileInfo().IsDir() {
+			continue
+		}
+
+		err := func() error {
+			zipFileOpen, err := zipFile.Open()
+			if err != nil {
+				return err
+			}
+			defer zipFileOpen.Close()
+
+			return handleBundleEntry(dataset, path.Join(archiveName, zipFile.Name), zipFileOpen, handler)
+		}()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func forEachTarFile(dataset *datasets.DataSet, archiveName string, reader io.Reader, handler func(name string, reader io.Reader) error) error {
+	tarReader := tar.NewReader(reader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New(fmt.Sprintf("Cannot read tar %s: %s", archiveName, err))
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if err := handleBundleEntry(dataset, path.Join(archiveName, header.Name), tarReader, handler); err != nil {
+			return err
+		}
+	}
+}
+
+// handleBundleEntry passes a file from inside a bundle to the handler, or unpacks it if it's a nested zip
+func handleBundleEntry(dataset *datasets.DataSet, name string, reader io.Reader, handler func(name string, reader io.Reader) error) error {
+	if strings.EqualFold(path.Ext(name), ".zip") && !dataset.ImportsArchive(name) {
+		if dataset.ExcludesFile(name) {
+			return nil
+		}
+
+		// Zips need random access so nested ones are read into memory
+		nestedArchive, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+
+		return forEachZipFile(dataset, name, bytes.NewReader(nestedArchive), int64(len(nestedArchive)), handler)
+	}
+
+	if !dataset.IncludesFile(name) {
+		return nil
+	}
+
+	return handler(name, reader)
+}
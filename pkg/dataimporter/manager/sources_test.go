@@ -0,0 +1,203 @@
+package manager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+)
+
+func writeTestFile(t *testing.T, filePath string, contents []byte) {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filePath, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func buildTestZip(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	zipWriter := zip.NewWriter(&buffer)
+
+	for name, contents := range files {
+		fileWriter, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileWriter.Write(contents)
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func buildTestTarGZ(t *testing.T, files map[string][]byte) []byte {
+	var buffer bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for name, contents := range files {
+		tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		tarWriter.Write(contents)
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestResolveLocalSource(t *testing.T) {
+	directory := t.TempDir()
+
+	writeTestFile(t, filepath.Join(directory, "data", "b.xml"), nil)
+	writeTestFile(t, filepath.Join(directory, "data", "a.xml"), nil)
+	writeTestFile(t, filepath.Join(directory, "data", "nested", "c.xml"), nil)
+	writeTestFile(t, filepath.Join(directory, "data", "nested", "d.csv"), nil)
+	os.MkdirAll(filepath.Join(directory, "empty"), 0755)
+
+	for _, test := range []struct {
+		source string
+		paths  []string
+		valid  bool
+	}{
+		{"data/a.xml", []string{"data/a.xml"}, true},
+		{"data", []string{"data/a.xml", "data/b.xml", "data/nested/c.xml", "data/nested/d.csv"}, true},
+		{"data/*.xml", []string{"data/a.xml", "data/b.xml"}, true},
+		{"data/*/*.xml", []string{"data/nested/c.xml"}, true},
+		// Directories matched by a glob are skipped rather than walked
+		{"data/*", []string{"data/a.xml", "data/b.xml"}, true},
+		{"data/*.json", nil, false},
+		{"empty", nil, false},
+		{"missing", nil, false},
+	} {
+		paths, err := resolveLocalSource(filepath.Join(directory, test.source))
+
+		if !test.valid {
+			if err == nil {
+				t.Errorf("expected %s to fail, got %v", test.source, paths)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expected %s to resolve, got %s", test.source, err)
+			continue
+		}
+
+		var expected []string
+		for _, expectedPath := range test.paths {
+			expected = append(expected, filepath.Join(directory, expectedPath))
+		}
+		if fmt.Sprint(paths) != fmt.Sprint(expected) {
+			t.Errorf("expected %s to resolve to %v, got %v", test.source, expected, paths)
+		}
+	}
+}
+
+func TestForEachSourceFile(t *testing.T) {
+	directory := t.TempDir()
+
+	nestedZip := buildTestZip(t, map[string][]byte{
+		"inner/stops.txt": []byte("nested stops"),
+		"readme.md":       []byte("readme"),
+	})
+
+	for _, test := range []struct {
+		name         string
+		fileName     string
+		contents     []byte
+		unpackBundle datasets.BundleFormat
+		bundleFiles  datasets.BundleFiles
+		files        map[string]string
+	}{
+		{
+			"plain file", "stops.txt", []byte("stops"),
+			datasets.BundleFormatNone, datasets.BundleFiles{},
+			map[string]string{"stops.txt": "stops"},
+		},
+		{
+			"gz", "stops.txt.gz", func() []byte {
+				var buffer bytes.Buffer
+				gzipWriter := gzip.NewWriter(&buffer)
+				gzipWriter.Write([]byte("stops"))
+				gzipWriter.Close()
+				return buffer.Bytes()
+			}(),
+			datasets.BundleFormatGZ, datasets.BundleFiles{},
+			map[string]string{"stops.txt": "stops"},
+		},
+		{
+			"zip with nested zip", "bundle.zip", buildTestZip(t, map[string][]byte{"routes.txt": []byte("routes"), "feed.zip": nestedZip}),
+			datasets.BundleFormatZIP, datasets.BundleFiles{},
+			map[string]string{
+				"bundle.zip/routes.txt":               "routes",
+				"bundle.zip/feed.zip/inner/stops.txt": "nested stops",
+				"bundle.zip/feed.zip/readme.md":       "readme",
+			},
+		},
+		{
+			"tar.gz with nested zip", "bundle.tar.gz", buildTestTarGZ(t, map[string][]byte{"routes.txt": []byte("routes"), "feeds/feed.zip": nestedZip}),
+			datasets.BundleFormatTarGZ, datasets.BundleFiles{},
+			map[string]string{
+				"bundle.tar.gz/routes.txt":                     "routes",
+				"bundle.tar.gz/feeds/feed.zip/inner/stops.txt": "nested stops",
+				"bundle.tar.gz/feeds/feed.zip/readme.md":       "readme",
+			},
+		},
+		{
+			"nested zip files filtered", "bundle.zip", buildTestZip(t, map[string][]byte{"routes.txt": []byte("routes"), "feed.zip": nestedZip}),
+			datasets.BundleFormatZIP, datasets.BundleFiles{Include: []string{"*.txt"}},
+			map[string]string{
+				"bundle.zip/routes.txt":               "routes",
+				"bundle.zip/feed.zip/inner/stops.txt": "nested stops",
+			},
+		},
+		{
+			"excluded nested zip", "bundle.zip", buildTestZip(t, map[string][]byte{"routes.txt": []byte("routes"), "feed.zip": nestedZip}),
+			datasets.BundleFormatZIP, datasets.BundleFiles{Exclude: []string{"feed.zip"}},
+			map[string]string{"bundle.zip/routes.txt": "routes"},
+		},
+		{
+			// A zip picked out by a pattern is imported as a file rather than being unpacked
+			"included nested zip", "bundle.zip", buildTestZip(t, map[string][]byte{"routes.txt": []byte("routes"), "feed.zip": []byte("feed")}),
+			datasets.BundleFormatZIP, datasets.BundleFiles{Formats: []datasets.BundleFileFormat{{Pattern: "*.zip", Format: datasets.DataSetFormatGTFSSchedule}}},
+			map[string]string{
+				"bundle.zip/routes.txt": "routes",
+				"bundle.zip/feed.zip":   "feed",
+			},
+		},
+	} {
+		filePath := filepath.Join(directory, test.fileName)
+		writeTestFile(t, filePath, test.contents)
+
+		dataset := &datasets.DataSet{UnpackBundle: test.unpackBundle, BundleFiles: test.bundleFiles}
+
+		files := map[string]string{}
+		err := forEachSourceFile(dataset, filePath, func(name string, reader io.Reader) error {
+			contents, err := io.ReadAll(reader)
+			files[name] = string(contents)
+			return err
+		})
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if fmt.Sprint(files) != fmt.Sprint(test.files) {
+			t.Errorf("%s: expected files %v, got %v", test.name, test.files, files)
+		}
+	}
+}
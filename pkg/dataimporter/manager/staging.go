@@ -0,0 +1,694 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/importruns"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultMaxRecordCountDrop = 0.5
+const defaultMaxMissingReferences = 0.1
+
+const stagingBatchSize = 1000
+
+// stagedCollections are the live collections a dataset owns records in, in the order they get promoted
+func stagedCollections(dataset *datasets.DataSet) []string {
+	var collections []string
+
+	if dataset.SupportedObjects.Stops {
+		collections = append(collections, "stops_raw")
+	}
+	if dataset.SupportedObjects.StopGroups {
+		collections = append(collections, "stop_groups")
+	}
+	if dataset.SupportedObjects.Operators {
+		collections = append(collections, "operators_raw")
+	}
+	if dataset.SupportedObjects.OperatorGroups {
+		collections = append(collections, "operator_groups")
+	}
+	if dataset.SupportedObjects.Services {
+		collections = append(collections, "services")
+	}
+	if dataset.SupportedObjects.Journeys {
+		collections = append(collections, "journeys")
+	}
+
+	return collections
+}
+
+func versionsCollectionName(collection string) string {
+	return fmt.Sprintf("%s_versions", collection)
+}
+
+func datasetQuery(datasetID string) bson.M {
+	return bson.M{"datasource.datasetid": datasetID}
+}
+
+// missingLiveRecords checks if any collection the dataset owns has none of its records, eg. operators_raw
+// the first time after operators stopped being imported straight into the live collection
+func missingLiveRecords(dataset *datasets.DataSet) bool {
+	for _, collectionName := range stagedCollections(dataset) {
+		count, err := database.GetCollection(collectionName).CountDocuments(context.Background(), datasetQuery(dataset.Identifier), options.Count().SetLimit(1))
+		if err == nil && count == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clearStagedRecords removes anything left behind in the import collections by a previous failed import
+func clearStagedRecords(dataset *datasets.DataSet) {
+	for _, collectionName := range stagedCollections(dataset) {
+		collection := database.GetCollection(datasets.ImportCollectionName(collectionName))
+		collection.DeleteMany(context.Background(), datasetQuery(dataset.Identifier))
+	}
+}
+
+// validateStagedImport checks the staged records look sane compared to what is currently live
+func validateStagedImport(dataset *datasets.DataSet) error {
+	maxRecordCountDrop := dataset.Validation.MaxRecordCountDrop
+	if maxRecordCountDrop == 0 {
+		maxRecordCountDrop = defaultMaxRecordCountDrop
+	}
+	maxMissingReferences := dataset.Validation.MaxMissingReferences
+	if maxMissingReferences == 0 {
+		maxMissingReferences = defaultMaxMissingReferences
+	}
+
+	// Record counts
+	for _, collectionName := range stagedCollections(dataset) {
+		stagedCount, err := database.GetCollection(datasets.ImportCollectionName(collectionName)).CountDocuments(context.Background(), datasetQuery(dataset.Identifier))
+		if err != nil {
+			return err
+		}
+		liveCount, err := database.GetCollection(collectionName).CountDocuments(context.Background(), datasetQuery(dataset.Identifier))
+		if err != nil {
+			return err
+		}
+
+		log.Info().
+			Str("collection", collectionName).
+			Int64("staged", stagedCount).
+			Int64("live", liveCount).
+			Msg("Validating staged record count")
+
+		if liveCount > 0 && stagedCount == 0 {
+			return errors.New(fmt.Sprintf("Import contains no %s but %d are live", collectionName, liveCount))
+		}
+		if liveCount > 0 && float64(stagedCount) < float64(liveCount)*(1-maxRecordCountDrop) {
+			return errors.New(fmt.Sprintf("Import contains %d %s which is too few compared to the %d live", stagedCount, collectionName, liveCount))
+		}
+	}
+
+	// References from journeys to services & stops
+	if dataset.SupportedObjects.Journeys {
+		serviceRefs, serviceCollections, err := stagedServiceReferences(dataset)
+		if err != nil {
+			return err
+		}
+		if err := checkMissingReferences("services", serviceRefs, serviceCollections, maxMissingReferences); err != nil {
+			return err
+		}
+
+		stopRefs, stopCollections, err := stagedStopReferences(dataset)
+		if err != nil {
+			return err
+		}
+		if err := checkMissingReferences("stops", stopRefs, stopCollections, maxMissingReferences); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// stagedServiceReferences returns the services the staged journeys use & the collections they could be found in
+func stagedServiceReferences(dataset *datasets.DataSet) ([]interface{}, []string, error) {
+	stagedJourneys := database.GetCollection(datasets.ImportCollectionName("journeys"))
+
+	serviceRefs, err := stagedJourneys.Distinct(context.Background(), "serviceref", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serviceCollections := []string{"services"}
+	if dataset.SupportedObjects.Services {
+		serviceCollections = append(serviceCollections, datasets.ImportCollectionName("services"))
+	}
+
+	return serviceRefs, serviceCollections, nil
+}
+
+// stagedStopReferences returns the stops the staged journeys call at & the collections they could be found in
+func stagedStopReferences(dataset *datasets.DataSet) ([]interface{}, []string, error) {
+	stagedJourneys := database.GetCollection(datasets.ImportCollectionName("journeys"))
+
+	stopRefs, err := stagedJourneys.Distinct(context.Background(), "path.originstopref", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	destinationStopRefs, err := stagedJourneys.Distinct(context.Background(), "path.destinationstopref", datasetQuery(dataset.Identifier))
+	if err != nil {
+		return nil, nil, err
+	}
+	stopRefs = append(stopRefs, destinationStopRefs...)
+
+	stopCollections := []string{"stops_raw"}
+	if dataset.SupportedObjects.Stops {
+		stopCollections = append(stopCollections, datasets.ImportCollectionName("stops_raw"))
+	}
+
+	return stopRefs, stopCollections, nil
+}
+
+// checkMissingReferences fails when too many of the references can't be found in the given collections
+func checkMissingReferences(name string, references []interface{}, collectionNames []string, maxMissing float64) error {
+	missing, total, err := findMissingReferences(name, references, collectionNames)
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("references", name).
+		Int("total", total).
+		Int("missing", len(missing)).
+		Msg("Validating staged references")
+
+	if float64(len(missing)) > float64(total)*maxMissing {
+		return errors.New(fmt.Sprintf("Import references %d %s that don't exist out of %d", len(missing), name, total))
+	}
+
+	return nil
+}
+
+// findMissingReferences looks up each reference in the given collections by primary or other identifier
+// It is skipped when the collections are completely empty as the referenced dataset hasn't been imported yet
+func findMissingReferences(name string, references []interface{}, collectionNames []string) ([]string, int, error) {
+	referenceSet := map[string]bool{}
+	for _, reference := range references {
+		if referenceString, ok := reference.(string); ok && referenceString != "" {
+			referenceSet[referenceString] = false
+		}
+	}
+
+	if len(referenceSet) == 0 {
+		return nil, 0, nil
+	}
+
+	var anyRecords bool
+	for _, collectionName := range collectionNames {
+		count, _ := database.GetCollection(collectionName).CountDocuments(context.Background(), bson.M{}, options.Count().SetLimit(1))
+		if count > 0 {
+			anyRecords = true
+			break
+		}
+	}
+	if !anyRecords {
+		log.Warn().Str("references", name).Msg("No records to validate references against, skipping")
+		return nil, len(referenceSet), nil
+	}
+
+	var referenceList []string
+	for reference := range referenceSet {
+		referenceList = append(referenceList, reference)
+	}
+
+	for i := 0; i < len(referenceList); i += stagingBatchSize {
+		chunk := referenceList[i:min(i+stagingBatchSize, len(referenceList))]
+
+		for _, collectionName := range collectionNames {
+			collection := database.GetCollection(collectionName)
+
+			for _, field := range []string{"primaryidentifier", "otheridentifiers"} {
+				found, err := collection.Distinct(context.Background(), field, bson.M{field: bson.M{"$in": chunk}})
+				if err != nil {
+					return nil, 0, err
+				}
+
+				for _, foundReference := range found {
+					if foundString, ok := foundReference.(string); ok {
+						if _, exists := referenceSet[foundString]; exists {
+							referenceSet[foundString] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	var missing []string
+	for reference, found := range referenceSet {
+		if !found {
+			missing = append(missing, reference)
+		}
+	}
+	sort.Strings(missing)
+
+	return missing, len(referenceSet), nil
+}
+
+// promoteStagedImport swaps the live records of the dataset for the staged ones.
+// Collections are promoted one at a time in batches so that large datasets aren't limited by the size of a transaction.
+// The live records each batch changes or removes are kept in the versions collections first, so the previous
+// version can be rolled back to (including after a failed promotion) without keeping a full copy of it.
+// The number of records written to each live collection is added to recordCounts
+func promoteStagedImport(dataset *datasets.DataSet, datasource *ctdf.DataSourceReference, recordCounts map[string]ctdf.DatasetImportRunRecordCounts) error {
+	// The change has to be worked out while the previous version is still live, but is only recorded once the new one is
+	var timetableChange *ctdf.TimetableChange
+	if dataset.SupportedObjects.Journeys {
+		timetableChange = detectTimetableChanges(datasource)
+	}
+
+	for _, collectionName := range stagedCollections(dataset) {
+		counts, err := promoteStagedCollection(collectionName, datasource)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Failed to promote staged %s: %s", collectionName, err))
+		}
+
+		recordCounts[collectionName] = counts
+	}
+
+	clearStagedRecords(dataset)
+
+	if timetableChange != nil && timetableChange.HasChanges() {
+		recordTimetableChange(timetableChange)
+	}
+
+	return nil
+}
+
+// Marks a record in a versions collection as having been added by the latest import, so rolling back removes it
+const versionAddedField = "versionadded"
+
+// Fields that change on every import even when the record itself hasn't
+var volatileRecordFields = map[string]bool{
+	"_id":                  true,
+	"datasource":           true,
+	"creationdatetime":     true,
+	"modificationdatetime": true,
+}
+
+// identifierField is the field records in the collection are identified by
+func identifierField(collectionName string) string {
+	if collectionName == "operator_groups" {
+		return "identifier"
+	}
+
+	return "primaryidentifier"
+}
+
+func promoteStagedCollection(collectionName string, datasource *ctdf.DataSourceReference) (ctdf.DatasetImportRunRecordCounts, error) {
+	var counts ctdf.DatasetImportRunRecordCounts
+
+	query := datasetQuery(datasource.DatasetID)
+
+	// Only the changes made by the latest import are kept
+	versionsCollection := database.GetCollection(versionsCollectionName(collectionName))
+	if _, err := versionsCollection.DeleteMany(context.Background(), query); err != nil {
+		return counts, err
+	}
+
+	cursor, err := database.GetCollection(datasets.ImportCollectionName(collectionName)).Find(context.Background(), query)
+	if err != nil {
+		return counts, err
+	}
+	defer cursor.Close(context.Background())
+
+	var batch []bson.Raw
+	for cursor.Next(context.Background()) {
+		batch = append(batch, append(bson.Raw{}, cursor.Current...))
+
+		if len(batch) >= stagingBatchSize {
+			if err := promoteStagedBatch(collectionName, datasource, batch, &counts); err != nil {
+				return counts, err
+			}
+			batch = nil
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return counts, err
+	}
+	if err := promoteStagedBatch(collectionName, datasource, batch, &counts); err != nil {
+		return counts, err
+	}
+
+	counts.Deleted, err = cleanupOldRecords(collectionName, datasource)
+
+	return counts, err
+}
+
+// promoteStagedBatch replaces the live records of the dataset with the staged ones, after keeping the live
+// records that are about to change & markers for the ones being added in the versions collection
+func promoteStagedBatch(collectionName string, datasource *ctdf.DataSourceReference, batch []bson.Raw, counts *ctdf.DatasetImportRunRecordCounts) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	identifier := identifierField(collectionName)
+	liveCollection := database.GetCollection(collectionName)
+
+	var identifiers []string
+	for _, record := range batch {
+		identifiers = append(identifiers, record.Lookup(identifier).StringValue())
+	}
+
+	cursor, err := liveCollection.Find(context.Background(), bson.M{
+		"datasource.datasetid": datasource.DatasetID,
+		identifier:             bson.M{"$in": identifiers},
+	})
+	if err != nil {
+		return err
+	}
+	liveRecords := map[string]bson.Raw{}
+	for cursor.Next(context.Background()) {
+		liveRecords[cursor.Current.Lookup(identifier).StringValue()] = append(bson.Raw{}, cursor.Current...)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	var versionOperations []mongo.WriteModel
+	var liveOperations []mongo.WriteModel
+
+	for i, record := range batch {
+		liveRecord, exists := liveRecords[identifiers[i]]
+		if !exists {
+			versionOperations = append(versionOperations, mongo.NewInsertOneModel().SetDocument(bson.M{
+				identifier:        identifiers[i],
+				"datasource":      bson.M{"datasetid": datasource.DatasetID},
+				versionAddedField: true,
+			}))
+			counts.Inserted++
+		} else if !sameRecord(liveRecord, record) {
+			versionOperations = append(versionOperations, mongo.NewInsertOneModel().SetDocument(withoutID(liveRecord)))
+			counts.Updated++
+		}
+
+		// Replace rather than update so fields removed from the source don't linger on, the dataset is part
+		// of the filter so a record with the same identifier from another dataset is never overwritten
+		liveOperations = append(liveOperations, mongo.NewReplaceOneModel().
+			SetFilter(bson.M{identifier: identifiers[i], "datasource.datasetid": datasource.DatasetID}).
+			SetReplacement(withoutID(record)).
+			SetUpsert(true))
+	}
+
+	if len(versionOperations) > 0 {
+		if _, err := database.GetCollection(versionsCollectionName(collectionName)).BulkWrite(context.Background(), versionOperations, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+
+	_, err = liveCollection.BulkWrite(context.Background(), liveOperations, options.BulkWrite().SetOrdered(false))
+
+	return err
+}
+
+// cleanupOldRecords removes the live records of the dataset that weren't in the latest import,
+// keeping them in the versions collection so they can be rolled back to
+func cleanupOldRecords(collectionName string, datasource *ctdf.DataSourceReference) (int64, error) {
+	collection := database.GetCollection(collectionName)
+	versionsCollection := database.GetCollection(versionsCollectionName(collectionName))
+
+	query := bson.M{
+		"datasource.datasetid": datasource.DatasetID,
+		"datasource.timestamp": bson.M{"$ne": datasource.Timestamp},
+	}
+
+	cursor, err := collection.Find(context.Background(), query)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var deleted int64
+	var ids []interface{}
+	var versionOperations []mongo.WriteModel
+
+	deleteBatch := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+
+		if _, err := versionsCollection.BulkWrite(context.Background(), versionOperations, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+		result, err := collection.DeleteMany(context.Background(), bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+		deleted += result.DeletedCount
+
+		ids = nil
+		versionOperations = nil
+
+		return nil
+	}
+
+	for cursor.Next(context.Background()) {
+		ids = append(ids, cursor.Current.Lookup("_id"))
+		versionOperations = append(versionOperations, mongo.NewInsertOneModel().SetDocument(withoutID(cursor.Current)))
+
+		if len(ids) >= stagingBatchSize {
+			if err := deleteBatch(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return deleted, err
+	}
+	if err := deleteBatch(); err != nil {
+		return deleted, err
+	}
+
+	log.Info().
+		Str("collection", collectionName).
+		Int64("num", deleted).
+		Msg("Cleaned up old records")
+
+	return deleted, nil
+}
+
+// sameRecord compares two versions of a record ignoring the fields that change on every import.
+// Documents are compared as maps as field order isn't significant
+func sameRecord(a bson.Raw, b bson.Raw) bool {
+	var aDocument, bDocument bson.M
+	if bson.Unmarshal(a, &aDocument) != nil || bson.Unmarshal(b, &bDocument) != nil {
+		return false
+	}
+
+	for field := range volatileRecordFields {
+		delete(aDocument, field)
+		delete(bDocument, field)
+	}
+
+	return reflect.DeepEqual(aDocument, bDocument)
+}
+
+func withoutID(record bson.Raw) bson.D {
+	var document bson.D
+	bson.Unmarshal(record, &document)
+
+	var withoutID bson.D
+	for _, element := range document {
+		if element.Key != "_id" {
+			withoutID = append(withoutID, element)
+		}
+	}
+
+	return withoutID
+}
+
+// copyRecords inserts the matching records into another collection
+func copyRecords(from string, to string, query bson.M) error {
+	cursor, err := database.GetCollection(from).Find(context.Background(), query)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	toCollection := database.GetCollection(to)
+
+	var operations []mongo.WriteModel
+	writeOperations := func() error {
+		if len(operations) == 0 {
+			return nil
+		}
+
+		_, err := toCollection.BulkWrite(context.Background(), operations, options.BulkWrite().SetOrdered(false))
+		operations = nil
+
+		return err
+	}
+
+	for cursor.Next(context.Background()) {
+		operations = append(operations, mongo.NewInsertOneModel().SetDocument(withoutID(cursor.Current)))
+
+		if len(operations) >= stagingBatchSize {
+			if err := writeOperations(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	return writeOperations()
+}
+
+// RollbackDataset makes the previous version of a dataset live again, the current version becomes
+// the previous one so running it again rolls forward
+func RollbackDataset(dataset *datasets.DataSet) error {
+	run := importruns.Start(dataset.Identifier, "rollback")
+
+	err := rollbackDataset(dataset, run)
+
+	importruns.Finish(run, err)
+
+	return err
+}
+
+func rollbackDataset(dataset *datasets.DataSet, run *ctdf.DatasetImportRun) error {
+	datasetVersionCollection := database.GetCollection("dataset_versions")
+
+	var currentVersion *ctdf.DatasetVersion
+	datasetVersionCollection.FindOne(context.Background(), bson.M{"dataset": dataset.Identifier}).Decode(&currentVersion)
+
+	if currentVersion == nil || currentVersion.Previous == nil || currentVersion.Previous.Timestamp == "" {
+		return errors.New(fmt.Sprintf("Dataset %s has no previous version to roll back to", dataset.Identifier))
+	}
+	previousVersion := currentVersion.Previous
+
+	log.Info().
+		Str("dataset", dataset.Identifier).
+		Str("from", currentVersion.Timestamp).
+		Str("to", previousVersion.Timestamp).
+		Msg("Rolling back dataset")
+
+	// Stage the previous version as if it had just been imported
+	clearStagedRecords(dataset)
+
+	var originalFormat string
+	for _, collectionName := range stagedCollections(dataset) {
+		if err := stagePreviousVersion(dataset, collectionName, previousVersion.Timestamp); err != nil {
+			clearStagedRecords(dataset)
+			return err
+		}
+
+		if originalFormat == "" {
+			var record struct {
+				DataSource *ctdf.DataSourceReference
+			}
+			database.GetCollection(datasets.ImportCollectionName(collectionName)).FindOne(context.Background(), datasetQuery(dataset.Identifier)).Decode(&record)
+
+			if record.DataSource != nil {
+				originalFormat = record.DataSource.OriginalFormat
+			}
+		}
+	}
+
+	if originalFormat == "" {
+		clearStagedRecords(dataset)
+		return errors.New(fmt.Sprintf("No records kept for the previous version of %s", dataset.Identifier))
+	}
+
+	datasource := &ctdf.DataSourceReference{
+		OriginalFormat: originalFormat,
+		ProviderName:   dataset.Provider.Name,
+		ProviderID:     dataset.DataSourceRef,
+		DatasetID:      dataset.Identifier,
+		Timestamp:      previousVersion.Timestamp,
+	}
+
+	if err := promoteStagedImport(dataset, datasource, run.Collections); err != nil {
+		return err
+	}
+	run.Changed = true
+
+	currentVersion.Previous = nil
+	rolledBackVersion := ctdf.DatasetVersion{
+		Dataset:      dataset.Identifier,
+		Hash:         previousVersion.Hash,
+		ETag:         previousVersion.ETag,
+		Timestamp:    previousVersion.Timestamp,
+		LastModified: time.Now(),
+		Previous:     currentVersion,
+	}
+
+	_, err := datasetVersionCollection.UpdateOne(context.Background(), bson.M{"dataset": dataset.Identifier}, bson.M{"$set": rolledBackVersion})
+
+	return err
+}
+
+// stagePreviousVersion stages the live records of the dataset with the changes the latest import made undone
+func stagePreviousVersion(dataset *datasets.DataSet, collectionName string, timestamp string) error {
+	identifier := identifierField(collectionName)
+	stagedCollection := database.GetCollection(datasets.ImportCollectionName(collectionName))
+
+	if err := copyRecords(collectionName, datasets.ImportCollectionName(collectionName), datasetQuery(dataset.Identifier)); err != nil {
+		return err
+	}
+
+	cursor, err := database.GetCollection(versionsCollectionName(collectionName)).Find(context.Background(), datasetQuery(dataset.Identifier))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.Background())
+
+	var operations []mongo.WriteModel
+	writeOperations := func() error {
+		if len(operations) == 0 {
+			return nil
+		}
+
+		_, err := stagedCollection.BulkWrite(context.Background(), operations, options.BulkWrite().SetOrdered(false))
+		operations = nil
+
+		return err
+	}
+
+	for cursor.Next(context.Background()) {
+		filter := bson.M{
+			identifier:             cursor.Current.Lookup(identifier).StringValue(),
+			"datasource.datasetid": dataset.Identifier,
+		}
+
+		if added, ok := cursor.Current.Lookup(versionAddedField).BooleanOK(); ok && added {
+			operations = append(operations, mongo.NewDeleteManyModel().SetFilter(filter))
+		} else {
+			operations = append(operations, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(withoutID(cursor.Current)).SetUpsert(true))
+		}
+
+		if len(operations) >= stagingBatchSize {
+			if err := writeOperations(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if err := writeOperations(); err != nil {
+		return err
+	}
+
+	// Unchanged records were replaced with the latest import's versions so take them back to the previous timestamp too
+	_, err = stagedCollection.UpdateMany(context.Background(), datasetQuery(dataset.Identifier), bson.M{"$set": bson.M{"datasource.timestamp": timestamp}})
+
+	return err
+}
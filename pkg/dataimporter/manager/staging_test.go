@@ -0,0 +1,129 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// stageServices stages a version of the dataset with the given service names keyed by identifier
+func stageServices(t *testing.T, datasource *ctdf.DataSourceReference, services map[string]string) {
+	stagedCollection := database.GetCollection(datasets.ImportCollectionName("services"))
+
+	for identifier, name := range services {
+		_, err := stagedCollection.InsertOne(context.Background(), ctdf.Service{
+			PrimaryIdentifier: identifier,
+			ServiceName:       name,
+			DataSource:        datasource,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// liveServices returns the service names of the dataset keyed by identifier
+func liveServices(t *testing.T, datasetID string) map[string]string {
+	cursor, err := database.GetCollection("services").Find(context.Background(), datasetQuery(datasetID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var services []ctdf.Service
+	if err := cursor.All(context.Background(), &services); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]string{}
+	for _, service := range services {
+		names[service.PrimaryIdentifier] = service.ServiceName
+	}
+
+	return names
+}
+
+func checkServices(t *testing.T, description string, actual map[string]string, expected map[string]string) {
+	if len(actual) != len(expected) {
+		t.Errorf("%s: expected %v, got %v", description, expected, actual)
+		return
+	}
+	for identifier, name := range expected {
+		if actual[identifier] != name {
+			t.Errorf("%s: expected %v, got %v", description, expected, actual)
+			return
+		}
+	}
+}
+
+func TestPromoteAndRollbackStagedImport(t *testing.T) {
+	database.ConnectMemory()
+
+	dataset := &datasets.DataSet{
+		Identifier:       "test-dataset",
+		Format:           "test-format",
+		SupportedObjects: datasets.SupportedObjects{Services: true},
+	}
+	datasource := func(timestamp string) *ctdf.DataSourceReference {
+		return &ctdf.DataSourceReference{OriginalFormat: "test-format", DatasetID: dataset.Identifier, Timestamp: timestamp}
+	}
+
+	// A record from another dataset with the same identifier must never be overwritten
+	database.GetCollection("services").InsertOne(context.Background(), ctdf.Service{
+		PrimaryIdentifier: "service-b",
+		ServiceName:       "Other",
+		DataSource:        &ctdf.DataSourceReference{DatasetID: "other-dataset", Timestamp: "1"},
+	})
+
+	firstVersion := map[string]string{"service-a": "1", "service-b": "2", "service-c": "3"}
+	stageServices(t, datasource("100"), firstVersion)
+	if err := promoteStagedImport(dataset, datasource("100"), map[string]ctdf.DatasetImportRunRecordCounts{}); err != nil {
+		t.Fatal(err)
+	}
+	checkServices(t, "first import", liveServices(t, dataset.Identifier), firstVersion)
+
+	// service-a is unchanged, service-b changes, service-c is removed & service-d is added
+	secondVersion := map[string]string{"service-a": "1", "service-b": "2X", "service-d": "4"}
+	stageServices(t, datasource("200"), secondVersion)
+	recordCounts := map[string]ctdf.DatasetImportRunRecordCounts{}
+	if err := promoteStagedImport(dataset, datasource("200"), recordCounts); err != nil {
+		t.Fatal(err)
+	}
+	checkServices(t, "second import", liveServices(t, dataset.Identifier), secondVersion)
+	checkServices(t, "other dataset", liveServices(t, "other-dataset"), map[string]string{"service-b": "Other"})
+
+	if counts := recordCounts["services"]; counts.Inserted != 1 || counts.Updated != 1 || counts.Deleted != 1 {
+		t.Errorf("expected 1 inserted, updated & deleted, got %+v", counts)
+	}
+
+	// Only the changes are kept to roll back to
+	if count, _ := database.GetCollection("services_versions").CountDocuments(context.Background(), datasetQuery(dataset.Identifier)); count != 3 {
+		t.Errorf("expected 3 records kept for the previous version, got %d", count)
+	}
+
+	if count, _ := database.GetCollection(datasets.ImportCollectionName("services")).CountDocuments(context.Background(), bson.M{}); count != 0 {
+		t.Errorf("expected the staged records to be cleared, got %d", count)
+	}
+
+	database.GetCollection("dataset_versions").InsertOne(context.Background(), ctdf.DatasetVersion{
+		Dataset:   dataset.Identifier,
+		Timestamp: "200",
+		Previous:  &ctdf.DatasetVersion{Dataset: dataset.Identifier, Timestamp: "100"},
+	})
+
+	run := &ctdf.DatasetImportRun{Collections: map[string]ctdf.DatasetImportRunRecordCounts{}}
+	if err := rollbackDataset(dataset, run); err != nil {
+		t.Fatal(err)
+	}
+	checkServices(t, "rollback", liveServices(t, dataset.Identifier), firstVersion)
+	checkServices(t, "other dataset after rollback", liveServices(t, "other-dataset"), map[string]string{"service-b": "Other"})
+
+	run = &ctdf.DatasetImportRun{Collections: map[string]ctdf.DatasetImportRunRecordCounts{}}
+	if err := rollbackDataset(dataset, run); err != nil {
+		t.Fatal(err)
+	}
+	checkServices(t, "roll forward", liveServices(t, dataset.Identifier), secondVersion)
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type serviceJourneyVersions struct {
+	oldJourneys map[string]string
+	newJourneys map[string]string
+
+	oldStops map[string]bool
+	newStops map[string]bool
+}
+
+// detectTimetableChanges compares the staged journeys against the live ones from the previous import of the dataset
+// Must be run before the staged journeys are promoted
+func detectTimetableChanges(datasource *ctdf.DataSourceReference) *ctdf.TimetableChange {
+	opts := options.Find().SetProjection(bson.D{
+		bson.E{Key: "primaryidentifier", Value: 1},
+		bson.E{Key: "serviceref", Value: 1},
+		bson.E{Key: "destinationdisplay", Value: 1},
+		bson.E{Key: "direction", Value: 1},
+		bson.E{Key: "departuretime", Value: 1},
+		bson.E{Key: "path.originstopref", Value: 1},
+		bson.E{Key: "path.destinationstopref", Value: 1},
+		bson.E{Key: "path.originarrivaltime", Value: 1},
+		bson.E{Key: "path.origindeparturetime", Value: 1},
+		bson.E{Key: "path.destinationarrivaltime", Value: 1},
+		bson.E{Key: "datasource.timestamp", Value: 1},
+	})
+
+	change := &ctdf.TimetableChange{
+		PrimaryIdentifier: primitive.NewObjectID().Hex(),
+		DataSetID:         datasource.DatasetID,
+		Timestamp:         datasource.Timestamp,
+		CreationDateTime:  time.Now(),
+	}
+
+	services := map[string]*serviceJourneyVersions{}
+
+	// The previous version is what is currently live and the new version is what has been staged
+	for _, collectionName := range []string{"journeys", datasets.ImportCollectionName("journeys")} {
+		isNew := collectionName != "journeys"
+
+		cursor, err := database.GetCollection(collectionName).Find(context.Background(), bson.M{
+			"datasource.datasetid": datasource.DatasetID,
+		}, opts)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load journeys for timetable change detection")
+			return nil
+		}
+
+		for cursor.Next(context.Background()) {
+			var journey ctdf.Journey
+			if err := cursor.Decode(&journey); err != nil {
+				log.Error().Err(err).Msg("Failed to decode Journey")
+				continue
+			}
+
+			service := services[journey.ServiceRef]
+			if service == nil {
+				service = &serviceJourneyVersions{
+					oldJourneys: map[string]string{},
+					newJourneys: map[string]string{},
+					oldStops:    map[string]bool{},
+					newStops:    map[string]bool{},
+				}
+				services[journey.ServiceRef] = service
+			}
+
+			journeys := service.newJourneys
+			stops := service.newStops
+			if !isNew {
+				journeys = service.oldJourneys
+				stops = service.oldStops
+
+				change.PreviousTimestamp = journey.DataSource.Timestamp
+			}
+
+			journeys[journey.PrimaryIdentifier] = journey.GenerateFunctionalHash(false)
+			for _, pathItem := range journey.Path {
+				stops[pathItem.OriginStopRef] = true
+				stops[pathItem.DestinationStopRef] = true
+			}
+		}
+	}
+
+	// Nothing to compare against on the first import of a dataset
+	if change.PreviousTimestamp == "" {
+		return nil
+	}
+
+	for serviceRef, service := range services {
+		serviceChange := service.compare()
+
+		if len(serviceChange.JourneysAdded) == 0 && len(serviceChange.JourneysRemoved) == 0 && len(serviceChange.JourneysRetimed) == 0 &&
+			len(serviceChange.StopsAdded) == 0 && len(serviceChange.StopsRemoved) == 0 {
+			continue
+		}
+		serviceChange.ServiceRef = serviceRef
+
+		change.JourneysAdded += len(serviceChange.JourneysAdded)
+		change.JourneysRemoved += len(serviceChange.JourneysRemoved)
+		change.JourneysRetimed += len(serviceChange.JourneysRetimed)
+
+		change.Services = append(change.Services, serviceChange)
+	}
+
+	sort.Slice(change.Services, func(i, j int) bool {
+		return change.Services[i].ServiceRef < change.Services[j].ServiceRef
+	})
+
+	return change
+}
+
+// compare matches journeys by identifier first, a journey with a new identifier but an identical
+// functional hash to a removed one is treated as unchanged rather than an add & remove
+func (s *serviceJourneyVersions) compare() ctdf.TimetableServiceChange {
+	serviceChange := ctdf.TimetableServiceChange{}
+
+	unmatchedOldHashes := map[string][]string{}
+	for journeyID, oldHash := range s.oldJourneys {
+		newHash, exists := s.newJourneys[journeyID]
+
+		if !exists {
+			unmatchedOldHashes[oldHash] = append(unmatchedOldHashes[oldHash], journeyID)
+		} else if newHash != oldHash {
+			serviceChange.JourneysRetimed = append(serviceChange.JourneysRetimed, journeyID)
+		}
+	}
+
+	// Walk the new journeys in a fixed order so the same versions always produce the same change
+	newJourneyIDs := make([]string, 0, len(s.newJourneys))
+	for journeyID := range s.newJourneys {
+		newJourneyIDs = append(newJourneyIDs, journeyID)
+	}
+	sort.Strings(newJourneyIDs)
+
+	for _, journeyID := range newJourneyIDs {
+		if _, exists := s.oldJourneys[journeyID]; exists {
+			continue
+		}
+		newHash := s.newJourneys[journeyID]
+
+		if len(unmatchedOldHashes[newHash]) > 0 {
+			unmatchedOldHashes[newHash] = unmatchedOldHashes[newHash][1:]
+		} else {
+			serviceChange.JourneysAdded = append(serviceChange.JourneysAdded, journeyID)
+		}
+	}
+
+	for _, journeyIDs := range unmatchedOldHashes {
+		serviceChange.JourneysRemoved = append(serviceChange.JourneysRemoved, journeyIDs...)
+	}
+
+	for stop := range s.newStops {
+		if !s.oldStops[stop] {
+			serviceChange.StopsAdded = append(serviceChange.StopsAdded, stop)
+		}
+	}
+	for stop := range s.oldStops {
+		if !s.newStops[stop] {
+			serviceChange.StopsRemoved = append(serviceChange.StopsRemoved, stop)
+		}
+	}
+
+	sort.Strings(serviceChange.JourneysAdded)
+	sort.Strings(serviceChange.JourneysRemoved)
+	sort.Strings(serviceChange.JourneysRetimed)
+	sort.Strings(serviceChange.StopsAdded)
+	sort.Strings(serviceChange.StopsRemoved)
+
+	return serviceChange
+}
+
+// recordTimetableChange stores the change log entry and raises a TimetableChanged event
+func recordTimetableChange(change *ctdf.TimetableChange) {
+	log.Info().
+		Str("dataset", change.DataSetID).
+		Int("services", len(change.Services)).
+		Int("added", change.JourneysAdded).
+		Int("removed", change.JourneysRemoved).
+		Int("retimed", change.JourneysRetimed).
+		Msg("Timetable changed")
+
+	timetableChangesCollection := database.GetCollection("timetable_changes")
+	if _, err := timetableChangesCollection.InsertOne(context.Background(), change); err != nil {
+		log.Error().Err(err).Msg("Failed to store timetable change")
+	}
+
+	if queue_client.QueueConnection == nil {
+		return
+	}
+
+	eventQueue, err := queue_client.QueueConnection.OpenQueue("events-queue")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to open event queue")
+		return
+	}
+
+	eventBytes, _ := json.Marshal(ctdf.Event{
+		Type:      ctdf.EventTypeTimetableChanged,
+		Timestamp: time.Now(),
+		Body:      change,
+	})
+	eventQueue.PublishBytes(eventBytes)
+}
@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServiceJourneyVersionsCompare(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		versions serviceJourneyVersions
+		retimed  []string
+		added    []string
+		removed  []string
+		stops    [2][]string
+	}{
+		{
+			name: "unchanged",
+			versions: serviceJourneyVersions{
+				oldJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-2"},
+				newJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-2"},
+			},
+		},
+		{
+			name: "retimed",
+			versions: serviceJourneyVersions{
+				oldJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-2"},
+				newJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-3"},
+			},
+			retimed: []string{"journey-b"},
+		},
+		{
+			name: "added & removed",
+			versions: serviceJourneyVersions{
+				oldJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-2"},
+				newJourneys: map[string]string{"journey-a": "hash-1", "journey-c": "hash-3", "journey-d": "hash-4"},
+			},
+			added:   []string{"journey-c", "journey-d"},
+			removed: []string{"journey-b"},
+		},
+		{
+			name: "renamed journey with the same hash",
+			versions: serviceJourneyVersions{
+				oldJourneys: map[string]string{"journey-a": "hash-1", "journey-b": "hash-2"},
+				newJourneys: map[string]string{"journey-a": "hash-1", "journey-b2": "hash-2"},
+			},
+		},
+		{
+			name: "renamed journeys only match one old journey each",
+			versions: serviceJourneyVersions{
+				oldJourneys: map[string]string{"journey-a": "hash-1"},
+				newJourneys: map[string]string{"journey-b": "hash-1", "journey-c": "hash-1"},
+			},
+			added: []string{"journey-c"},
+		},
+		{
+			name: "stops added & removed",
+			versions: serviceJourneyVersions{
+				oldStops: map[string]bool{"stop-a": true, "stop-b": true},
+				newStops: map[string]bool{"stop-b": true, "stop-c": true},
+			},
+			stops: [2][]string{{"stop-c"}, {"stop-a"}},
+		},
+	} {
+		serviceChange := test.versions.compare()
+
+		for _, field := range []struct {
+			name     string
+			actual   []string
+			expected []string
+		}{
+			{"retimed", serviceChange.JourneysRetimed, test.retimed},
+			{"added", serviceChange.JourneysAdded, test.added},
+			{"removed", serviceChange.JourneysRemoved, test.removed},
+			{"stops added", serviceChange.StopsAdded, test.stops[0]},
+			{"stops removed", serviceChange.StopsRemoved, test.stops[1]},
+		} {
+			if len(field.actual) == 0 && len(field.expected) == 0 {
+				continue
+			}
+			if !reflect.DeepEqual(field.actual, field.expected) {
+				t.Errorf("%s: expected %s to be %v, got %v", test.name, field.name, field.expected, field.actual)
+			}
+		}
+	}
+}
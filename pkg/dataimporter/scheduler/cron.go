@@ -0,0 +1,143 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a standard 5 field cron expression (minute hour day-of-month month day-of-week)
+type cronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+
+	// When both day fields are restricted a time matching either of them is a match
+	dayOfMonthWildcard bool
+	dayOfWeekWildcard  bool
+}
+
+func parseCronSchedule(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("Cron expression %s must have 5 fields", expression))
+	}
+
+	schedule := &cronSchedule{
+		dayOfMonthWildcard: fields[2] == "*",
+		dayOfWeekWildcard:  fields[4] == "*",
+	}
+
+	var err error
+	if schedule.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+
+	// Sunday can be either 0 or 7
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+
+	return schedule, nil
+}
+
+// parseCronField handles *, single values, ranges (a-b), steps (*/n & a-b/n) and comma separated lists of them
+func parseCronField(field string, min int, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return nil, errors.New(fmt.Sprintf("Invalid cron step %s", part))
+			}
+		}
+
+		start, end := min, max
+		if rangePart != "*" {
+			startString, endString, isRange := strings.Cut(rangePart, "-")
+
+			var err error
+			start, err = strconv.Atoi(startString)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid cron value %s", part))
+			}
+
+			end = start
+			if isRange {
+				end, err = strconv.Atoi(endString)
+				if err != nil {
+					return nil, errors.New(fmt.Sprintf("Invalid cron range %s", part))
+				}
+			} else if hasStep {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return nil, errors.New(fmt.Sprintf("Cron value %s out of range %d-%d", part, min, max))
+		}
+
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+
+	return values, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dayOfMonthMatch := s.daysOfMonth[t.Day()]
+	dayOfWeekMatch := s.daysOfWeek[int(t.Weekday())]
+
+	if s.dayOfMonthWildcard || s.dayOfWeekWildcard {
+		return dayOfMonthMatch && dayOfWeekMatch
+	}
+
+	return dayOfMonthMatch || dayOfWeekMatch
+}
+
+// Next returns the first time after the given one that matches the schedule
+func (s *cronSchedule) Next(after time.Time) time.Time {
+	next := after.Truncate(time.Minute).Add(time.Minute)
+
+	// Every valid schedule matches at least once in a 4 year cycle
+	limit := next.AddDate(4, 0, 0)
+
+	for next.Before(limit) {
+		switch {
+		case !s.months[int(next.Month())]:
+			next = time.Date(next.Year(), next.Month()+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.dayMatches(next):
+			next = time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, next.Location())
+		case !s.hours[next.Hour()]:
+			next = next.Truncate(time.Hour).Add(time.Hour)
+		case !s.minutes[next.Minute()]:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronSchedule(t *testing.T) {
+	for _, test := range []struct {
+		expression string
+		valid      bool
+	}{
+		{"0 7 * * *", true},
+		{"*/15 0-6,22-23 1,15 */2 1-5", true},
+		{"0 7 * * 7", true},
+		{"0 7 * *", false},
+		{"60 7 * * *", false},
+		{"0 7 0 * *", false},
+		{"0 7 * * 8", false},
+		{"*/0 7 * * *", false},
+		{"0 7-5 * * *", false},
+		{"a 7 * * *", false},
+	} {
+		_, err := parseCronSchedule(test.expression)
+		if test.valid && err != nil {
+			t.Errorf("expected %s to be valid, got %s", test.expression, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("expected %s to be invalid", test.expression)
+		}
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// A Tuesday
+	after := time.Date(2024, 3, 5, 8, 30, 15, 0, time.UTC)
+
+	for _, test := range []struct {
+		expression string
+		next       time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 5, 8, 31, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2024, 3, 6, 7, 0, 0, 0, time.UTC)},
+		{"45 8 * * *", time.Date(2024, 3, 5, 8, 45, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 3, 5, 8, 40, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"0 9 * * 0", time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)},
+		// Day of month & day of week only both have to match when one is a wildcard
+		{"0 9 * * 5", time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 9 20 * *", time.Date(2024, 3, 20, 9, 0, 0, 0, time.UTC)},
+		// When both are restricted either of them matching is enough, the 20th or the next Friday
+		{"0 9 20 * 5", time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 9 6 * 5", time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC)},
+		{"0 9 31 2 *", time.Time{}},
+	} {
+		schedule, err := parseCronSchedule(test.expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if next := schedule.Next(after); !next.Equal(test.next) {
+			t.Errorf("expected %s to next run at %s, got %s", test.expression, test.next, next)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/redis_client"
+)
+
+// followOnPendingKey holds a counter per follow on step that's bumped every time an import needs it to run. It's kept
+// in Redis next to the dataset locks so a pending step isn't forgotten when the scheduler restarts
+const followOnPendingKey = "dataimporter/follow-on/pending"
+
+// Only clear the step if nothing has needed it again since it was read
+var clearFollowOnPendingScript = redis.NewScript(`
+if redis.call("hget", KEYS[1], ARGV[1]) == ARGV[2] then
+	return redis.call("hdel", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
+func markFollowOnPending(steps ...string) {
+	for _, step := range steps {
+		if err := redis_client.Client.HIncrBy(context.Background(), followOnPendingKey, step, 1).Err(); err != nil {
+			log.Error().Err(err).Str("step", step).Msg("Failed to mark follow on step as pending")
+		}
+	}
+}
+
+// getFollowOnPending returns the pending steps along with the counter to pass to clearFollowOnPending
+func getFollowOnPending() (map[string]string, error) {
+	return redis_client.Client.HGetAll(context.Background(), followOnPendingKey).Result()
+}
+
+func clearFollowOnPending(step string, counter string) {
+	if err := clearFollowOnPendingScript.Run(context.Background(), redis_client.Client, []string{followOnPendingKey}, step, counter).Err(); err != nil {
+		log.Error().Err(err).Str("step", step).Msg("Failed to clear pending follow on step")
+	}
+}
@@ -0,0 +1,64 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/redis_client"
+)
+
+func TestFollowOnSteps(t *testing.T) {
+	for _, test := range []struct {
+		supportedObjects datasets.SupportedObjects
+		steps            []string
+	}{
+		{datasets.SupportedObjects{Stops: true}, []string{"stops"}},
+		{datasets.SupportedObjects{Operators: true}, []string{"operators"}},
+		{datasets.SupportedObjects{Services: true, Journeys: true}, []string{"operators", "services"}},
+		{datasets.SupportedObjects{Stops: true, Journeys: true}, []string{"stops", "operators", "services"}},
+		{datasets.SupportedObjects{}, nil},
+	} {
+		steps := followOnSteps(&datasets.DataSet{SupportedObjects: test.supportedObjects})
+
+		if fmt.Sprint(steps) != fmt.Sprint(test.steps) {
+			t.Errorf("expected %+v to need %v, got %v", test.supportedObjects, test.steps, steps)
+		}
+	}
+}
+
+func TestFollowOnPending(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	t.Setenv("TRAVIGO_REDIS_ADDRESS", redisServer.Addr())
+	if err := redis_client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	markFollowOnPending("stops", "operators")
+
+	pending, err := getFollowOnPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("expected 2 pending steps, got %v", pending)
+	}
+
+	// Another import needs the operators linker again while it's running
+	markFollowOnPending("operators")
+
+	clearFollowOnPending("stops", pending["stops"])
+	clearFollowOnPending("operators", pending["operators"])
+
+	pending, err = getFollowOnPending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, isPending := pending["stops"]; isPending {
+		t.Error("expected the stops step to be cleared")
+	}
+	if _, isPending := pending["operators"]; !isPending {
+		t.Error("expected the operators step to still be pending")
+	}
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const datasetLockTTL = 5 * time.Minute
+
+// Only release or extend the lock if we still own it
+var releaseLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+var extendLockScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// datasetLock stops the same dataset being imported by more than one scheduler at a time
+type datasetLock struct {
+	key   string
+	token string
+
+	stop chan struct{}
+}
+
+func datasetLockKey(datasetID string) string {
+	return fmt.Sprintf("dataimporter/lock/%s", datasetID)
+}
+
+func acquireDatasetLock(datasetID string) (*datasetLock, bool) {
+	lock := &datasetLock{
+		key:   datasetLockKey(datasetID),
+		token: primitive.NewObjectID().Hex(),
+		stop:  make(chan struct{}),
+	}
+
+	acquired, err := redis_client.Client.SetNX(context.Background(), lock.key, lock.token, datasetLockTTL).Result()
+	if err != nil {
+		log.Error().Err(err).Str("dataset", datasetID).Msg("Failed to acquire dataset lock")
+		return nil, false
+	}
+	if !acquired {
+		return nil, false
+	}
+
+	// Keep extending the lock for as long as the import runs
+	go func() {
+		ticker := time.NewTicker(datasetLockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-lock.stop:
+				return
+			case <-ticker.C:
+				extendLockScript.Run(context.Background(), redis_client.Client, []string{lock.key}, lock.token, datasetLockTTL.Milliseconds())
+			}
+		}
+	}()
+
+	return lock, true
+}
+
+func (l *datasetLock) Release() {
+	close(l.stop)
+	releaseLockScript.Run(context.Background(), redis_client.Client, []string{l.key}, l.token)
+}
+
+func isDatasetLocked(datasetID string) bool {
+	exists, _ := redis_client.Client.Exists(context.Background(), datasetLockKey(datasetID)).Result()
+
+	return exists > 0
+}
@@ -0,0 +1,311 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/importruns"
+	"github.com/travigo/travigo/pkg/dataimporter/insertrecords"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/datalinker"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/indexer"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Static datasets without a schedule are imported daily like the old batch import
+const defaultStaticSchedule = "0 7 * * *"
+
+const linkedDatasetPollInterval = 30 * time.Second
+const followOnPollInterval = 30 * time.Second
+const staleCheckInterval = 5 * time.Minute
+
+// Run history & locks for the follow on steps use these identifiers in place of a dataset
+const followOnIdentifierFormat = "travigo-follow-on-%s"
+
+// Linkers run after static imports, in this order
+var followOnLinkers = []string{"operators", "services", "stops"}
+
+// Scheduler imports every dataset on its schedule and runs the linkers & indexer once static imports have changed data
+type Scheduler struct {
+	Datasets    []datasets.DataSet
+	Concurrency int
+	RunIndexer  bool
+
+	staticSlots   chan struct{}
+	runningStatic atomic.Int32
+}
+
+func NewScheduler(allDatasets []datasets.DataSet, concurrency int, runIndexer bool) *Scheduler {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Scheduler{
+		Datasets:    allDatasets,
+		Concurrency: concurrency,
+		RunIndexer:  runIndexer,
+		staticSlots: make(chan struct{}, concurrency),
+	}
+}
+
+func (s *Scheduler) Run() error {
+	// Check every schedule up front so a typo doesn't only show up when the dataset is due
+	for _, dataset := range s.Datasets {
+		if _, _, err := getDatasetSchedule(&dataset); err != nil {
+			return errors.New(fmt.Sprintf("Dataset %s: %s", dataset.Identifier, err))
+		}
+	}
+
+	for _, dataset := range s.Datasets {
+		go s.scheduleDataset(dataset)
+	}
+
+	go s.runFollowOnSteps()
+	go s.reportStaleDatasets()
+
+	return nil
+}
+
+// getDatasetSchedule returns either the cron schedule or the fixed interval the dataset should be imported on
+func getDatasetSchedule(dataset *datasets.DataSet) (*cronSchedule, time.Duration, error) {
+	if dataset.Schedule != "" {
+		schedule, err := parseCronSchedule(dataset.Schedule)
+		return schedule, 0, err
+	}
+
+	if dataset.RefreshInterval.Seconds() > 0 {
+		return nil, dataset.RefreshInterval, nil
+	}
+
+	if dataset.ImportDestination == datasets.ImportDestinationRealtimeQueue {
+		if dataset.SupportedObjects.ServiceAlerts {
+			return nil, 10 * time.Minute, nil
+		}
+
+		return nil, 2 * time.Minute, nil
+	}
+
+	schedule, err := parseCronSchedule(defaultStaticSchedule)
+	return schedule, 0, err
+}
+
+func isStaticDataset(dataset *datasets.DataSet) bool {
+	return dataset.ImportDestination != datasets.ImportDestinationRealtimeQueue
+}
+
+func (s *Scheduler) scheduleDataset(dataset datasets.DataSet) {
+	schedule, interval, _ := getDatasetSchedule(&dataset)
+
+	// Realtime datasets & static ones that have never been imported start straight away
+	nextRun := time.Now()
+	if isStaticDataset(&dataset) && getDatasetVersion(dataset.Identifier) != nil {
+		if schedule != nil {
+			nextRun = schedule.Next(time.Now())
+		} else {
+			nextRun = time.Now().Add(interval)
+		}
+	}
+
+	log.Info().
+		Str("dataset", dataset.Identifier).
+		Str("schedule", dataset.Schedule).
+		Str("interval", interval.String()).
+		Time("next", nextRun).
+		Msg("Scheduled dataset")
+
+	for {
+		time.Sleep(time.Until(nextRun))
+
+		startTime := time.Now()
+		s.runDataset(&dataset)
+
+		if schedule != nil {
+			nextRun = schedule.Next(time.Now())
+		} else {
+			nextRun = startTime.Add(interval)
+		}
+	}
+}
+
+func (s *Scheduler) runDataset(dataset *datasets.DataSet) {
+	s.waitForLinkedDataset(dataset)
+
+	static := isStaticDataset(dataset)
+	if static {
+		s.staticSlots <- struct{}{}
+		defer func() { <-s.staticSlots }()
+
+		s.runningStatic.Add(1)
+		defer s.runningStatic.Add(-1)
+	}
+
+	lock, acquired := acquireDatasetLock(dataset.Identifier)
+	if !acquired {
+		log.Info().Str("dataset", dataset.Identifier).Msg("Dataset is already being imported, skipping this run")
+		return
+	}
+	defer lock.Release()
+
+	run, err := manager.ImportDatasetWithTrigger(dataset, false, "schedule")
+	if err != nil {
+		log.Error().Err(err).Str("dataset", dataset.Identifier).Msg("Failed to import dataset")
+		return
+	}
+
+	log.Info().
+		Str("dataset", dataset.Identifier).
+		Bool("changed", run.Changed).
+		Str("duration", time.Since(run.StartDateTime).String()).
+		Msg("Imported dataset")
+
+	if static && run.Changed {
+		markFollowOnPending(followOnSteps(dataset)...)
+	}
+}
+
+// followOnSteps returns the linkers that have to run after the dataset has changed
+func followOnSteps(dataset *datasets.DataSet) []string {
+	var steps []string
+
+	if dataset.SupportedObjects.Stops {
+		steps = append(steps, "stops")
+	}
+	// Services & journeys are imported referencing the operators before they were merged
+	if dataset.SupportedObjects.Operators || dataset.SupportedObjects.Services || dataset.SupportedObjects.Journeys {
+		steps = append(steps, "operators")
+	}
+	if dataset.SupportedObjects.Services || dataset.SupportedObjects.Journeys {
+		steps = append(steps, "services")
+	}
+
+	return steps
+}
+
+// waitForLinkedDataset holds the import until the dataset it depends on has been imported & isn't mid import
+func (s *Scheduler) waitForLinkedDataset(dataset *datasets.DataSet) {
+	if dataset.LinkedDataset == "" {
+		return
+	}
+
+	var logged bool
+	for getDatasetVersion(dataset.LinkedDataset) == nil || isDatasetLocked(dataset.LinkedDataset) {
+		if !logged {
+			log.Info().
+				Str("dataset", dataset.Identifier).
+				Str("linked", dataset.LinkedDataset).
+				Msg("Waiting for linked dataset")
+			logged = true
+		}
+
+		time.Sleep(linkedDatasetPollInterval)
+	}
+}
+
+// runFollowOnSteps links the records & indexes stops once all the static imports that changed them have finished
+func (s *Scheduler) runFollowOnSteps() {
+	for {
+		time.Sleep(followOnPollInterval)
+
+		if s.runningStatic.Load() > 0 {
+			continue
+		}
+
+		pending, err := getFollowOnPending()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get pending follow on steps")
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		insertrecords.Insert()
+
+		// Steps stay pending until they succeed so they're tried again on the next poll, even after a restart
+		for _, linkerType := range followOnLinkers {
+			counter, isPending := pending[linkerType]
+			if isPending && s.runFollowOnLinker(linkerType) {
+				clearFollowOnPending(linkerType, counter)
+			}
+		}
+	}
+}
+
+// runFollowOnLinker returns whether the linker ran successfully
+func (s *Scheduler) runFollowOnLinker(linkerType string) bool {
+	identifier := fmt.Sprintf(followOnIdentifierFormat, linkerType)
+
+	lock, acquired := acquireDatasetLock(identifier)
+	if !acquired {
+		log.Info().Str("type", linkerType).Msg("Linking is already running elsewhere, skipping")
+		return false
+	}
+	defer lock.Release()
+
+	linker, err := datalinker.NewLinker(linkerType)
+	if err != nil {
+		log.Error().Err(err).Str("type", linkerType).Msg("Failed to create linker")
+		return false
+	}
+
+	run := importruns.Start(identifier, "follow-on")
+	run.Changed = true
+
+	log.Info().Str("type", linkerType).Msg("Running linker")
+	if err := linker.Run(); err != nil {
+		log.Error().Err(err).Str("type", linkerType).Msg("Failed to link")
+		importruns.Finish(run, err)
+
+		return false
+	}
+
+	if linkerType == "stops" && s.RunIndexer {
+		log.Info().Msg("Running stops indexer")
+		indexer.IndexStops()
+		elastic_client.WaitUntilQueueEmpty()
+	}
+
+	importruns.Finish(run, nil)
+
+	return true
+}
+
+// reportStaleDatasets warns about datasets that haven't successfully imported within their expected window
+func (s *Scheduler) reportStaleDatasets() {
+	for {
+		time.Sleep(staleCheckInterval)
+
+		for _, dataset := range s.Datasets {
+			status := importruns.GetStatus(&dataset)
+			if !status.Stale {
+				continue
+			}
+
+			event := log.Warn().
+				Str("dataset", dataset.Identifier).
+				Str("staleafter", importruns.StaleAfter(&dataset).String()).
+				Bool("lastrunfailed", status.LastRunFailed)
+			if status.LastSuccessfulRun != nil {
+				event = event.Time("lastsuccess", status.LastSuccessfulRun.EndDateTime)
+			}
+			event.Msg("Dataset is stale")
+		}
+	}
+}
+
+func getDatasetVersion(datasetID string) *ctdf.DatasetVersion {
+	var datasetVersion *ctdf.DatasetVersion
+
+	datasetVersionCollection := database.GetCollection("dataset_versions")
+	datasetVersionCollection.FindOne(context.Background(), bson.M{"dataset": datasetID}).Decode(&datasetVersion)
+
+	return datasetVersion
+}
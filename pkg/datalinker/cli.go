@@ -1,8 +1,6 @@
 package datalinker
 
 import (
-	"errors"
-
 	"github.com/travigo/travigo/pkg/dataimporter/insertrecords"
 
 	"github.com/travigo/travigo/pkg/database"
@@ -28,6 +26,10 @@ func RegisterCLI() *cli.Command {
 						Usage:    "Type of the dataset",
 						Required: true,
 					},
+					&cli.BoolFlag{
+						Name:  "match-names",
+						Usage: "Also merge operators with the same name in a region",
+					},
 				},
 				Action: func(c *cli.Context) error {
 					if err := database.Connect(); err != nil {
@@ -38,19 +40,17 @@ func RegisterCLI() *cli.Command {
 					}
 					insertrecords.Insert()
 
-					dataType := c.String("type")
-
-					var linker Linker
-
-					if dataType == "stops" {
-						linker = NewStopsLinker()
-					} else {
-						return errors.New("Unknown type")
+					linker, err := NewLinker(c.String("type"))
+					if err != nil {
+						return err
 					}
 
-					linker.Run()
+					if operatorsLinker, isOperatorsLinker := linker.(OperatorsLinker); isOperatorsLinker {
+						operatorsLinker.MatchNames = c.Bool("match-names")
+						linker = operatorsLinker
+					}
 
-					return nil
+					return linker.Run()
 				},
 			},
 		},
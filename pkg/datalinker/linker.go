@@ -1,6 +1,24 @@
 package datalinker
 
+import (
+	"errors"
+	"fmt"
+)
+
 type Linker interface {
 	GetBaseCollectionName() string
-	Run()
+	Run() error
+}
+
+func NewLinker(dataType string) (Linker, error) {
+	switch dataType {
+	case "stops":
+		return NewStopsLinker(), nil
+	case "operators":
+		return NewOperatorsLinker(), nil
+	case "services":
+		return NewServicesLinker(), nil
+	default:
+		return nil, errors.New(fmt.Sprintf("Unknown type %s", dataType))
+	}
 }
@@ -0,0 +1,345 @@
+package datalinker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var operatorNameSeparatorRegex = regexp.MustCompile("[^a-z0-9]+")
+
+// Words that don't help tell operators apart when matching by name
+var operatorNameIgnoredWords = []string{"the", "ltd", "limited", "plc", "co", "company"}
+
+// OperatorsLinker merges the operators from different datasets that are the same operator. Services & journeys keep
+// the operatorref their own dataset gave them as anything rewritten would be undone by their next import, so lookups
+// resolve merged operators through OtherIdentifiers instead
+type OperatorsLinker struct {
+	// Also merge operators with the same name that share a region
+	MatchNames bool
+
+	// Datasets that import operators, any without records in the raw collection are seeded from the live one
+	Datasets []string
+}
+
+func NewOperatorsLinker() OperatorsLinker {
+	var operatorDatasets []string
+
+	for _, dataset := range manager.GetRegisteredDataSets() {
+		if dataset.SupportedObjects.Operators {
+			operatorDatasets = append(operatorDatasets, dataset.Identifier)
+		}
+	}
+
+	return OperatorsLinker{
+		Datasets: operatorDatasets,
+	}
+}
+
+func (l OperatorsLinker) GetBaseCollectionName() string {
+	return "operators"
+}
+
+func (l OperatorsLinker) Run() error {
+	liveCollectionName := l.GetBaseCollectionName()
+	rawCollectionName := fmt.Sprintf("%s_raw", liveCollectionName)
+	stagingCollectionName := fmt.Sprintf("%s_staging", liveCollectionName)
+
+	rawCollection := database.GetCollection(rawCollectionName)
+	stagingCollection := database.GetCollection(stagingCollectionName)
+
+	if err := l.seedRawCollection(liveCollectionName, rawCollectionName); err != nil {
+		return err
+	}
+
+	rawCount, err := rawCollection.CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		return err
+	}
+	if rawCount == 0 {
+		log.Info().Msg("No operators to link")
+		return nil
+	}
+
+	if err := copyCollection(rawCollectionName, stagingCollectionName); err != nil {
+		return err
+	}
+
+	cursor, err := rawCollection.Find(context.Background(), bson.M{})
+	if err != nil {
+		return err
+	}
+
+	var operators []*ctdf.Operator
+	if err := cursor.All(context.Background(), &operators); err != nil {
+		return err
+	}
+
+	var operations []mongo.WriteModel
+
+	mergeGroups := l.getMergeGroups(operators)
+
+	for _, mergeGroup := range mergeGroups {
+		newRecord := mergeOperators(mergeGroup)
+
+		// Now delete all the records that are being merged
+		var mergedIdentifiers []string
+		for _, operator := range mergeGroup {
+			mergedIdentifiers = append(mergedIdentifiers, operator.PrimaryIdentifier)
+		}
+		mergedIdentifiers = util.RemoveDuplicateStrings(mergedIdentifiers, []string{})
+
+		for _, identifier := range mergedIdentifiers {
+			deleteModel := mongo.NewDeleteManyModel()
+			deleteModel.SetFilter(bson.M{"primaryidentifier": identifier})
+			operations = append(operations, deleteModel)
+		}
+
+		// insert new
+		insertModel := mongo.NewInsertOneModel()
+		bsonRep, _ := bson.Marshal(newRecord)
+		insertModel.SetDocument(bsonRep)
+		operations = append(operations, insertModel)
+
+		log.Debug().Str("operator", newRecord.PrimaryIdentifier).Strs("merged", mergedIdentifiers).Msg("Merging operators")
+	}
+
+	if len(operations) > 0 {
+		_, err := stagingCollection.BulkWrite(context.Background(), operations, &options.BulkWriteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Delete any remaining manual merge entries from staging
+	_, err = stagingCollection.DeleteMany(context.Background(), bson.M{"primaryidentifier": bson.M{"$regex": "^travigo-internalmerge-"}})
+	if err != nil {
+		return err
+	}
+
+	// Copy staging to live
+	if err := copyCollection(stagingCollectionName, liveCollectionName); err != nil {
+		return err
+	}
+	// Delete staging as it's not needed now
+	if err := emptyCollection(stagingCollectionName); err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("operators", len(operators)).
+		Int("merged", len(mergeGroups)).
+		Msg("Linked operators")
+
+	return nil
+}
+
+// seedRawCollection copies the live operators of any dataset that has nothing in the raw collection yet. Operators used
+// to be imported straight into the live collection and datasets that haven't changed since aren't imported again, so
+// without this linking would drop them when staging replaces the live collection
+func (l OperatorsLinker) seedRawCollection(liveCollectionName string, rawCollectionName string) error {
+	liveCollection := database.GetCollection(liveCollectionName)
+	rawCollection := database.GetCollection(rawCollectionName)
+
+	for _, datasetID := range l.Datasets {
+		query := bson.M{"datasource.datasetid": datasetID}
+
+		rawCount, err := rawCollection.CountDocuments(context.Background(), query)
+		if err != nil {
+			return err
+		}
+		if rawCount > 0 {
+			continue
+		}
+
+		cursor, err := liveCollection.Find(context.Background(), query)
+		if err != nil {
+			return err
+		}
+
+		var operations []mongo.WriteModel
+		for cursor.Next(context.Background()) {
+			var operator bson.M
+			if err := cursor.Decode(&operator); err != nil {
+				return err
+			}
+			delete(operator, "_id")
+
+			operations = append(operations, mongo.NewInsertOneModel().SetDocument(operator))
+		}
+		if err := cursor.Err(); err != nil {
+			return err
+		}
+
+		if len(operations) == 0 {
+			continue
+		}
+
+		if _, err := rawCollection.BulkWrite(context.Background(), operations, &options.BulkWriteOptions{}); err != nil {
+			return err
+		}
+
+		log.Info().Str("dataset", datasetID).Int("operators", len(operations)).Msg("Seeded raw operators from the live collection")
+	}
+
+	return nil
+}
+
+// getMergeGroups finds the sets of operators that share any identifier, and the same name in a region when MatchNames is set
+func (l OperatorsLinker) getMergeGroups(operators []*ctdf.Operator) [][]*ctdf.Operator {
+	parents := make([]int, len(operators))
+	for i := range parents {
+		parents[i] = i
+	}
+	find := func(i int) int {
+		for parents[i] != i {
+			parents[i] = parents[parents[i]]
+			i = parents[i]
+		}
+		return i
+	}
+	union := func(owners map[string]int, key string, i int) {
+		if owner, exists := owners[key]; exists {
+			parents[find(i)] = find(owner)
+		} else {
+			owners[key] = i
+		}
+	}
+
+	identifierOwners := map[string]int{}
+	nameOwners := map[string]int{}
+
+	for i, operator := range operators {
+		for _, identifier := range append([]string{operator.PrimaryIdentifier}, operator.OtherIdentifiers...) {
+			if identifier != "" {
+				union(identifierOwners, identifier, i)
+			}
+		}
+
+		if l.MatchNames {
+			name := normaliseOperatorName(operator.PrimaryName)
+			if name == "" {
+				continue
+			}
+
+			for _, region := range operator.Regions {
+				union(nameOwners, fmt.Sprintf("%s/%s", region, name), i)
+			}
+		}
+	}
+
+	groupedOperators := map[int][]*ctdf.Operator{}
+	for i, operator := range operators {
+		root := find(i)
+		groupedOperators[root] = append(groupedOperators[root], operator)
+	}
+
+	var mergeGroups [][]*ctdf.Operator
+	for _, group := range groupedOperators {
+		if len(group) > 1 {
+			mergeGroups = append(mergeGroups, group)
+		}
+	}
+
+	return mergeGroups
+}
+
+func normaliseOperatorName(name string) string {
+	var words []string
+
+	for _, word := range strings.Fields(operatorNameSeparatorRegex.ReplaceAllString(strings.ToLower(name), " ")) {
+		if !util.ContainsString(operatorNameIgnoredWords, word) {
+			words = append(words, word)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+// operatorSourcePreference ranks which record a merged operator is based on, Traveline NOC records have
+// the most detail then the National Rail TOC ones and then anything else like GTFS agencies
+func operatorSourcePreference(operator *ctdf.Operator) int {
+	switch {
+	case strings.HasPrefix(operator.PrimaryIdentifier, fmt.Sprintf(ctdf.OperatorNOCIDFormat, "")):
+		return 0
+	case strings.HasPrefix(operator.PrimaryIdentifier, fmt.Sprintf(ctdf.OperatorTOCFormat, "")):
+		return 1
+	case strings.HasPrefix(operator.PrimaryIdentifier, "travigo-internalmerge-"):
+		return 3
+	default:
+		return 2
+	}
+}
+
+// mergeOperators combines the group into a copy of the preferred record, filling in anything it's missing from the others
+func mergeOperators(mergeGroup []*ctdf.Operator) *ctdf.Operator {
+	sort.SliceStable(mergeGroup, func(i, j int) bool {
+		iPreference := operatorSourcePreference(mergeGroup[i])
+		jPreference := operatorSourcePreference(mergeGroup[j])
+
+		if iPreference != jPreference {
+			return iPreference < jPreference
+		}
+
+		return mergeGroup[i].CreationDateTime.Before(mergeGroup[j].CreationDateTime)
+	})
+
+	newRecord := *mergeGroup[0]
+	newRecord.SocialMedia = map[string]string{}
+
+	var identifiers []string
+	var names []string
+	var regions []string
+
+	for _, operator := range mergeGroup {
+		identifiers = append(identifiers, operator.PrimaryIdentifier)
+		identifiers = append(identifiers, operator.OtherIdentifiers...)
+
+		names = append(names, operator.PrimaryName)
+		names = append(names, operator.OtherNames...)
+
+		regions = append(regions, operator.Regions...)
+
+		for _, field := range []struct {
+			Value *string
+			Other string
+		}{
+			{&newRecord.PrimaryName, operator.PrimaryName},
+			{&newRecord.OperatorGroupRef, operator.OperatorGroupRef},
+			{&newRecord.TransportType, operator.TransportType},
+			{&newRecord.Licence, operator.Licence},
+			{&newRecord.Website, operator.Website},
+			{&newRecord.Email, operator.Email},
+			{&newRecord.Address, operator.Address},
+			{&newRecord.PhoneNumber, operator.PhoneNumber},
+		} {
+			if *field.Value == "" {
+				*field.Value = field.Other
+			}
+		}
+
+		for key, value := range operator.SocialMedia {
+			if _, exists := newRecord.SocialMedia[key]; !exists {
+				newRecord.SocialMedia[key] = value
+			}
+		}
+	}
+
+	newRecord.OtherIdentifiers = util.RemoveDuplicateStrings(identifiers, []string{})
+	sort.Strings(newRecord.OtherIdentifiers)
+	newRecord.OtherNames = util.RemoveDuplicateStrings(names, []string{})
+	newRecord.Regions = util.RemoveDuplicateStrings(regions, []string{})
+
+	return &newRecord
+}
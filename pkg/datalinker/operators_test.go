@@ -0,0 +1,98 @@
+package datalinker
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestGetMergeGroups(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		matchNames bool
+		operators  []*ctdf.Operator
+		expected   [][]string
+	}{
+		{
+			name: "shared identifier",
+			operators: []*ctdf.Operator{
+				{PrimaryIdentifier: "gb-noc-TEST", OtherIdentifiers: []string{"gb-noc-TEST", "gb-nocid-1"}},
+				{PrimaryIdentifier: "gb-gtfs-agency-1", OtherIdentifiers: []string{"gb-nocid-1"}},
+				{PrimaryIdentifier: "gb-noc-OTHER"},
+			},
+			expected: [][]string{{"gb-gtfs-agency-1", "gb-noc-TEST"}},
+		},
+		{
+			name: "transitively shared identifiers",
+			operators: []*ctdf.Operator{
+				{PrimaryIdentifier: "a", OtherIdentifiers: []string{"x"}},
+				{PrimaryIdentifier: "b", OtherIdentifiers: []string{"y"}},
+				{PrimaryIdentifier: "c", OtherIdentifiers: []string{"x", "y"}},
+				{PrimaryIdentifier: "d", OtherIdentifiers: []string{"z"}},
+				{PrimaryIdentifier: "e", OtherIdentifiers: []string{"d"}},
+			},
+			expected: [][]string{{"a", "b", "c"}, {"d", "e"}},
+		},
+		{
+			name: "same name without matching names",
+			operators: []*ctdf.Operator{
+				{PrimaryIdentifier: "a", PrimaryName: "Test Buses Ltd", Regions: []string{"gb-region-NW"}},
+				{PrimaryIdentifier: "b", PrimaryName: "Test Buses", Regions: []string{"gb-region-NW"}},
+			},
+		},
+		{
+			name:       "same name in a shared region",
+			matchNames: true,
+			operators: []*ctdf.Operator{
+				{PrimaryIdentifier: "a", PrimaryName: "Test Buses Ltd", Regions: []string{"gb-region-NW"}},
+				{PrimaryIdentifier: "b", PrimaryName: "The Test Buses", Regions: []string{"gb-region-NW", "gb-region-Y"}},
+				{PrimaryIdentifier: "c", PrimaryName: "Test Buses", Regions: []string{"gb-region-SW"}},
+				{PrimaryIdentifier: "d", PrimaryName: "Ltd", Regions: []string{"gb-region-NW"}},
+				{PrimaryIdentifier: "e", PrimaryName: "Limited", Regions: []string{"gb-region-NW"}},
+			},
+			expected: [][]string{{"a", "b"}},
+		},
+	} {
+		linker := OperatorsLinker{MatchNames: test.matchNames}
+
+		var groups []string
+		for _, group := range linker.getMergeGroups(test.operators) {
+			var identifiers []string
+			for _, operator := range group {
+				identifiers = append(identifiers, operator.PrimaryIdentifier)
+			}
+			sort.Strings(identifiers)
+
+			groups = append(groups, fmt.Sprint(identifiers))
+		}
+		sort.Strings(groups)
+
+		var expected []string
+		for _, group := range test.expected {
+			expected = append(expected, fmt.Sprint(group))
+		}
+
+		if fmt.Sprint(groups) != fmt.Sprint(expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, groups)
+		}
+	}
+}
+
+func TestMergeOperators(t *testing.T) {
+	merged := mergeOperators([]*ctdf.Operator{
+		{PrimaryIdentifier: "gb-gtfs-agency-1", PrimaryName: "Test Agency", OtherIdentifiers: []string{"gb-noc-TEST"}, Website: "https://agency.example"},
+		{PrimaryIdentifier: "gb-nocid-1", PrimaryName: "Test Buses", OtherIdentifiers: []string{"gb-noc-TEST"}, Regions: []string{"gb-region-NW"}},
+	})
+
+	if merged.PrimaryIdentifier != "gb-nocid-1" || merged.PrimaryName != "Test Buses" {
+		t.Errorf("expected the NOC record to be preferred, got %s %s", merged.PrimaryIdentifier, merged.PrimaryName)
+	}
+	if merged.Website != "https://agency.example" {
+		t.Errorf("expected the missing website to be filled in, got %s", merged.Website)
+	}
+	if fmt.Sprint(merged.OtherIdentifiers) != fmt.Sprint([]string{"gb-gtfs-agency-1", "gb-noc-TEST", "gb-nocid-1"}) {
+		t.Errorf("expected every identifier to be kept, got %v", merged.OtherIdentifiers)
+	}
+}
@@ -0,0 +1,88 @@
+package servicelinks
+
+import (
+	"context"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OperatorIdentifiers maps every identifier of an operator to its primary identifier. Records keep referencing
+// whichever identifier their dataset uses, so operators merged by the operators linker are resolved here instead
+type OperatorIdentifiers map[string]string
+
+func LoadOperatorIdentifiers() (OperatorIdentifiers, error) {
+	cursor, err := database.GetCollection("operators").Find(context.Background(), bson.M{}, options.Find().SetProjection(bson.D{
+		bson.E{Key: "primaryidentifier", Value: 1},
+		bson.E{Key: "otheridentifiers", Value: 1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	var operators []*ctdf.Operator
+	if err := cursor.All(context.Background(), &operators); err != nil {
+		return nil, err
+	}
+
+	return NewOperatorIdentifiers(operators), nil
+}
+
+func NewOperatorIdentifiers(operators []*ctdf.Operator) OperatorIdentifiers {
+	operatorIdentifiers := OperatorIdentifiers{}
+
+	for _, operator := range operators {
+		for _, identifier := range operator.OtherIdentifiers {
+			operatorIdentifiers[identifier] = operator.PrimaryIdentifier
+		}
+	}
+	// Primary identifiers take precedence over an other identifier shared with a different operator
+	for _, operator := range operators {
+		operatorIdentifiers[operator.PrimaryIdentifier] = operator.PrimaryIdentifier
+	}
+
+	return operatorIdentifiers
+}
+
+// Resolve returns the primary identifier of the operator, or the reference itself for an unknown operator
+func (o OperatorIdentifiers) Resolve(operatorRef string) string {
+	if primaryIdentifier, exists := o[operatorRef]; exists {
+		return primaryIdentifier
+	}
+
+	return operatorRef
+}
+
+// Expand returns every identifier of the referenced operators for querying records by operatorref
+func (o OperatorIdentifiers) Expand(operatorRefs []string) []string {
+	primaryIdentifiers := map[string]bool{}
+	for _, operatorRef := range operatorRefs {
+		primaryIdentifiers[o.Resolve(operatorRef)] = true
+	}
+
+	expanded := append([]string{}, operatorRefs...)
+	for identifier, primaryIdentifier := range o {
+		if primaryIdentifiers[primaryIdentifier] {
+			expanded = append(expanded, identifier)
+		}
+	}
+
+	return expanded
+}
+
+// ResolveServices points the services in memory at the primary identifier of their operator so that Group
+// treats references to any identifier of the same operator alike
+func (o OperatorIdentifiers) ResolveServices(services []*ctdf.Service) {
+	for _, service := range services {
+		service.OperatorRef = o.Resolve(service.OperatorRef)
+	}
+}
+
+// ResolveJourneys does the same as ResolveServices for JourneyMatchHash
+func (o OperatorIdentifiers) ResolveJourneys(journeys []*ctdf.Journey) {
+	for _, journey := range journeys {
+		journey.OperatorRef = o.Resolve(journey.OperatorRef)
+	}
+}
@@ -0,0 +1,67 @@
+package servicelinks
+
+import (
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestOperatorIdentifiers(t *testing.T) {
+	operatorIdentifiers := NewOperatorIdentifiers([]*ctdf.Operator{
+		{PrimaryIdentifier: "gb-noc-TEST", OtherIdentifiers: []string{"gb-noc-TEST", "gb-nocid-1", "gb-gtfs-agency-1"}},
+		{PrimaryIdentifier: "gb-noc-OTHER", OtherIdentifiers: []string{"gb-noc-OTHER"}},
+	})
+
+	for operatorRef, expected := range map[string]string{
+		"gb-noc-TEST":      "gb-noc-TEST",
+		"gb-gtfs-agency-1": "gb-noc-TEST",
+		"gb-noc-OTHER":     "gb-noc-OTHER",
+		"gb-noc-UNKNOWN":   "gb-noc-UNKNOWN",
+	} {
+		if resolved := operatorIdentifiers.Resolve(operatorRef); resolved != expected {
+			t.Errorf("expected %s to resolve to %s, got %s", operatorRef, expected, resolved)
+		}
+	}
+
+	expanded := operatorIdentifiers.Expand([]string{"gb-gtfs-agency-1"})
+	expanded = removeDuplicates(expanded)
+	if fmt.Sprint(expanded) != fmt.Sprint([]string{"gb-gtfs-agency-1", "gb-noc-TEST", "gb-nocid-1"}) {
+		t.Errorf("expected every identifier of the operator, got %v", expanded)
+	}
+}
+
+func TestGroupResolvedOperators(t *testing.T) {
+	operatorIdentifiers := NewOperatorIdentifiers([]*ctdf.Operator{
+		{PrimaryIdentifier: "gb-noc-TEST", OtherIdentifiers: []string{"gb-noc-TEST", "gb-gtfs-agency-1"}},
+	})
+
+	txcService := testService("txc-1", "gb-txc", "X1")
+	gtfsService := testService("gtfs-1", "gb-gtfs", "X1")
+	gtfsService.OperatorRef = "gb-gtfs-agency-1"
+	services := []*ctdf.Service{txcService, gtfsService}
+
+	if groups := Group(services, map[string]int{}); len(groups) != 0 {
+		t.Fatalf("expected services referencing different identifiers not to group before resolving, got %d", len(groups))
+	}
+
+	operatorIdentifiers.ResolveServices(services)
+	if groups := Group(services, map[string]int{}); len(groups) != 1 {
+		t.Fatalf("expected services of the merged operator to group, got %d", len(groups))
+	}
+}
+
+func removeDuplicates(values []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+
+	return unique
+}
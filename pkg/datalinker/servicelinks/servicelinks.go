@@ -0,0 +1,279 @@
+package servicelinks
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const matchTimeFormat = "15:04:05"
+
+const markBatchSize = 1000
+
+// ServiceMatchThreshold is the share of a services journeys that have to match the preferred service's journeys
+// for it to be treated as a duplicate
+const ServiceMatchThreshold = 0.8
+
+// ServiceProjection loads just what's needed to group services
+var ServiceProjection = bson.D{
+	bson.E{Key: "primaryidentifier", Value: 1},
+	bson.E{Key: "servicename", Value: 1},
+	bson.E{Key: "operatorref", Value: 1},
+	bson.E{Key: "transporttype", Value: 1},
+	bson.E{Key: "datasource.datasetid", Value: 1},
+	bson.E{Key: "duplicateof", Value: 1},
+}
+
+// JourneyProjection loads just what's needed to match journeys
+var JourneyProjection = bson.D{
+	bson.E{Key: "primaryidentifier", Value: 1},
+	bson.E{Key: "serviceref", Value: 1},
+	bson.E{Key: "operatorref", Value: 1},
+	bson.E{Key: "datasource.datasetid", Value: 1},
+	bson.E{Key: "departuretime", Value: 1},
+	bson.E{Key: "availability", Value: 1},
+	bson.E{Key: "path.originstopref", Value: 1},
+	bson.E{Key: "path.originarrivaltime", Value: 1},
+	bson.E{Key: "path.origindeparturetime", Value: 1},
+	bson.E{Key: "path.destinationstopref", Value: 1},
+	bson.E{Key: "path.destinationarrivaltime", Value: 1},
+	bson.E{Key: "duplicateof", Value: 1},
+}
+
+// Links maps the primary identifiers of duplicate records to the record from the preferred dataset they duplicate
+type Links struct {
+	Services map[string]string
+	Journeys map[string]string
+}
+
+// GroupKey is what services have to share to be treated as the same service
+func GroupKey(service *ctdf.Service) string {
+	serviceName := strings.ToLower(strings.TrimSpace(service.ServiceName))
+	if service.DataSource == nil || service.DataSource.DatasetID == "" || service.OperatorRef == "" || serviceName == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s/%s/%s", service.OperatorRef, service.TransportType, serviceName)
+}
+
+// Group finds the services from more than one dataset with the same operator, transport type & name.
+// Each group is sorted by dataset priority (higher first) so the preferred service is first
+func Group(services []*ctdf.Service, datasetPriorities map[string]int) [][]*ctdf.Service {
+	groupedServices := map[string][]*ctdf.Service{}
+	var groupKeys []string
+
+	for _, service := range services {
+		key := GroupKey(service)
+		if key == "" {
+			continue
+		}
+
+		if _, exists := groupedServices[key]; !exists {
+			groupKeys = append(groupKeys, key)
+		}
+		groupedServices[key] = append(groupedServices[key], service)
+	}
+	sort.Strings(groupKeys)
+
+	var groups [][]*ctdf.Service
+	for _, key := range groupKeys {
+		group := groupedServices[key]
+
+		datasetIDs := map[string]bool{}
+		for _, service := range group {
+			datasetIDs[service.DataSource.DatasetID] = true
+		}
+		if len(datasetIDs) < 2 {
+			continue
+		}
+
+		sort.SliceStable(group, func(i, j int) bool {
+			iDataset := group[i].DataSource.DatasetID
+			jDataset := group[j].DataSource.DatasetID
+
+			if datasetPriorities[iDataset] != datasetPriorities[jDataset] {
+				return datasetPriorities[iDataset] > datasetPriorities[jDataset]
+			}
+			if iDataset != jDataset {
+				return iDataset < jDataset
+			}
+
+			return group[i].PrimaryIdentifier < group[j].PrimaryIdentifier
+		})
+
+		groups = append(groups, group)
+	}
+
+	return groups
+}
+
+// Link works out which services & journeys of a group from Group duplicate the ones from the preferred dataset.
+// Journeys only duplicate a preferred journey with the same operator, times, stops & operating days. Each preferred
+// journey is matched by at most one journey from each of the other datasets so journeys that run twice at the same
+// time don't all get linked to one of them. A service from the other datasets only duplicates the first service when
+// at least ServiceMatchThreshold of its journeys matched, sharing a name isn't enough on its own
+func Link(group []*ctdf.Service, journeys []*ctdf.Journey) Links {
+	links := Links{
+		Services: map[string]string{},
+		Journeys: map[string]string{},
+	}
+
+	if len(group) == 0 {
+		return links
+	}
+
+	preferredService := group[0]
+	preferredDataset := preferredService.DataSource.DatasetID
+
+	journeys = append([]*ctdf.Journey{}, journeys...)
+	sort.SliceStable(journeys, func(i, j int) bool {
+		return journeys[i].PrimaryIdentifier < journeys[j].PrimaryIdentifier
+	})
+
+	preferredJourneys := map[string][]*ctdf.Journey{}
+	for _, journey := range journeys {
+		if journey.DataSource != nil && journey.DataSource.DatasetID == preferredDataset {
+			hash := JourneyMatchHash(journey)
+			preferredJourneys[hash] = append(preferredJourneys[hash], journey)
+		}
+	}
+
+	// How many of the preferred journeys with a hash each dataset has used up
+	matchedCounts := map[string]int{}
+
+	serviceJourneys := map[string]int{}
+	serviceMatchedJourneys := map[string]int{}
+
+	for _, journey := range journeys {
+		if journey.DataSource == nil || journey.DataSource.DatasetID == preferredDataset {
+			continue
+		}
+
+		serviceJourneys[journey.ServiceRef]++
+
+		hash := JourneyMatchHash(journey)
+		candidates := preferredJourneys[hash]
+
+		countKey := fmt.Sprintf("%s/%s", journey.DataSource.DatasetID, hash)
+		if matchedCounts[countKey] >= len(candidates) {
+			continue
+		}
+
+		links.Journeys[journey.PrimaryIdentifier] = candidates[matchedCounts[countKey]].PrimaryIdentifier
+		matchedCounts[countKey]++
+		serviceMatchedJourneys[journey.ServiceRef]++
+	}
+
+	for _, service := range group {
+		if service.DataSource.DatasetID == preferredDataset {
+			continue
+		}
+
+		journeyCount := serviceJourneys[service.PrimaryIdentifier]
+		if journeyCount > 0 && float64(serviceMatchedJourneys[service.PrimaryIdentifier]) >= ServiceMatchThreshold*float64(journeyCount) {
+			links.Services[service.PrimaryIdentifier] = preferredService.PrimaryIdentifier
+		}
+	}
+
+	return links
+}
+
+// JourneyMatchHash is like GenerateFunctionalHash but leaves out everything that's specific to a dataset
+// (service, direction, destination display & rule descriptions) so the same trip matches across datasets
+func JourneyMatchHash(journey *ctdf.Journey) string {
+	hash := sha256.New()
+
+	hash.Write([]byte(journey.OperatorRef))
+	hash.Write([]byte(journey.DepartureTime.Format(matchTimeFormat)))
+
+	if journey.Availability != nil {
+		for _, rules := range [][]ctdf.AvailabilityRule{
+			journey.Availability.Match,
+			journey.Availability.MatchSecondary,
+			journey.Availability.Exclude,
+			journey.Availability.Condition,
+		} {
+			var ruleValues []string
+			for _, rule := range rules {
+				ruleValues = append(ruleValues, fmt.Sprintf("%s=%s", rule.Type, rule.Value))
+			}
+			sort.Strings(ruleValues)
+
+			hash.Write([]byte(strings.Join(ruleValues, ",")))
+			hash.Write([]byte{0})
+		}
+	}
+
+	for _, pathItem := range journey.Path {
+		hash.Write([]byte(pathItem.OriginStopRef))
+		hash.Write([]byte(pathItem.OriginArrivalTime.Format(matchTimeFormat)))
+		hash.Write([]byte(pathItem.OriginDepartureTime.Format(matchTimeFormat)))
+		hash.Write([]byte(pathItem.DestinationStopRef))
+		hash.Write([]byte(pathItem.DestinationArrivalTime.Format(matchTimeFormat)))
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// MarkModel sets which record the record is a duplicate of, or clears it when duplicateOf is empty
+func MarkModel(identifier string, duplicateOf string) mongo.WriteModel {
+	update := bson.M{"$set": bson.M{"duplicateof": duplicateOf}}
+	if duplicateOf == "" {
+		update = bson.M{"$unset": bson.M{"duplicateof": ""}}
+	}
+
+	updateModel := mongo.NewUpdateManyModel()
+	updateModel.SetFilter(bson.M{"primaryidentifier": identifier})
+	updateModel.SetUpdate(update)
+
+	return updateModel
+}
+
+// MarkWriter batches up changes to the duplicateof field of records in a collection
+type MarkWriter struct {
+	collection database.Collection
+	operations []mongo.WriteModel
+
+	Updated int
+}
+
+func NewMarkWriter(collection database.Collection) *MarkWriter {
+	return &MarkWriter{
+		collection: collection,
+	}
+}
+
+// Mark queues an update when the record isn't already marked as a duplicate of duplicateOf
+func (w *MarkWriter) Mark(identifier string, current string, duplicateOf string) error {
+	if current == duplicateOf {
+		return nil
+	}
+
+	w.operations = append(w.operations, MarkModel(identifier, duplicateOf))
+	w.Updated++
+
+	if len(w.operations) >= markBatchSize {
+		return w.Flush()
+	}
+
+	return nil
+}
+
+func (w *MarkWriter) Flush() error {
+	if len(w.operations) == 0 {
+		return nil
+	}
+
+	_, err := w.collection.BulkWrite(context.Background(), w.operations, &options.BulkWriteOptions{})
+	w.operations = []mongo.WriteModel{}
+
+	return err
+}
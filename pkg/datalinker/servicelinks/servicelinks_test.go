@@ -0,0 +1,221 @@
+package servicelinks
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func testService(identifier string, datasetID string, name string) *ctdf.Service {
+	return &ctdf.Service{
+		PrimaryIdentifier: identifier,
+		ServiceName:       name,
+		OperatorRef:       "gb-noc-TEST",
+		TransportType:     ctdf.TransportTypeBus,
+		DataSource:        &ctdf.DataSourceReference{DatasetID: datasetID},
+	}
+}
+
+func testJourney(identifier string, datasetID string, serviceRef string, departure time.Time, days ...string) *ctdf.Journey {
+	journey := &ctdf.Journey{
+		PrimaryIdentifier: identifier,
+		ServiceRef:        serviceRef,
+		OperatorRef:       "gb-noc-TEST",
+		DataSource:        &ctdf.DataSourceReference{DatasetID: datasetID},
+		DepartureTime:     departure,
+		Availability:      &ctdf.Availability{},
+		Path: []*ctdf.JourneyPathItem{
+			{
+				OriginStopRef:          "gb-atco-1",
+				OriginDepartureTime:    departure,
+				DestinationStopRef:     "gb-atco-2",
+				DestinationArrivalTime: departure.Add(10 * time.Minute),
+			},
+		},
+	}
+
+	for _, day := range days {
+		journey.Availability.Match = append(journey.Availability.Match, ctdf.AvailabilityRule{Type: ctdf.AvailabilityDayOfWeek, Value: day})
+	}
+
+	return journey
+}
+
+func TestGroup(t *testing.T) {
+	services := []*ctdf.Service{
+		testService("gtfs-1", "gb-gtfs", "X1"),
+		testService("txc-1", "gb-txc", " x1"),
+		testService("gtfs-2", "gb-gtfs", "X2"),
+		testService("gtfs-3", "gb-gtfs", "X2"),
+		testService("other-1", "gb-other", "X1"),
+	}
+
+	groups := Group(services, map[string]int{"gb-txc": 1})
+
+	if len(groups) != 1 {
+		t.Fatalf("expected 1 group, got %d", len(groups))
+	}
+
+	var identifiers []string
+	for _, service := range groups[0] {
+		identifiers = append(identifiers, service.PrimaryIdentifier)
+	}
+
+	expected := []string{"txc-1", "gtfs-1", "other-1"}
+	if len(identifiers) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, identifiers)
+	}
+	for i := range expected {
+		if identifiers[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, identifiers)
+		}
+	}
+}
+
+func TestGroupSkipsIncompleteServices(t *testing.T) {
+	noOperator := testService("gtfs-1", "gb-gtfs", "X1")
+	noOperator.OperatorRef = ""
+	noDataSource := testService("txc-1", "gb-txc", "X1")
+	noDataSource.DataSource = nil
+
+	groups := Group([]*ctdf.Service{noOperator, noDataSource, testService("other-1", "gb-other", "X1")}, map[string]int{})
+
+	if len(groups) != 0 {
+		t.Fatalf("expected no groups, got %d", len(groups))
+	}
+}
+
+func TestJourneyMatchHash(t *testing.T) {
+	departure := time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	txcJourney := testJourney("txc-j1", "gb-txc", "txc-1", departure, "Monday", "Tuesday")
+	txcJourney.Direction = "inbound"
+	txcJourney.DestinationDisplay = "Town Centre"
+
+	// Same trip with times on a different date, rules in another order & dataset specific fields
+	gtfsJourney := testJourney("gtfs-j1", "gb-gtfs", "gtfs-1", time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC), "Tuesday", "Monday")
+	gtfsJourney.Direction = "0"
+	gtfsJourney.Availability.Match[0].Description = "Weekdays"
+
+	if JourneyMatchHash(txcJourney) != JourneyMatchHash(gtfsJourney) {
+		t.Error("expected the same trip from two datasets to match")
+	}
+
+	saturdayJourney := testJourney("gtfs-j2", "gb-gtfs", "gtfs-1", departure, "Saturday")
+	if JourneyMatchHash(txcJourney) == JourneyMatchHash(saturdayJourney) {
+		t.Error("expected journeys on different days not to match")
+	}
+
+	laterJourney := testJourney("gtfs-j3", "gb-gtfs", "gtfs-1", departure.Add(time.Minute), "Monday", "Tuesday")
+	if JourneyMatchHash(txcJourney) == JourneyMatchHash(laterJourney) {
+		t.Error("expected journeys at different times not to match")
+	}
+
+	excludedJourney := testJourney("gtfs-j4", "gb-gtfs", "gtfs-1", departure, "Monday", "Tuesday")
+	excludedJourney.Availability.Exclude = []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: "2024-12-25"}}
+	if JourneyMatchHash(txcJourney) == JourneyMatchHash(excludedJourney) {
+		t.Error("expected journeys with different exclusions not to match")
+	}
+}
+
+func TestLink(t *testing.T) {
+	departure := time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	group := []*ctdf.Service{
+		testService("txc-1", "gb-txc", "X1"),
+		testService("gtfs-1", "gb-gtfs", "X1"),
+		testService("other-1", "gb-other", "X1"),
+	}
+	journeys := []*ctdf.Journey{
+		testJourney("txc-weekday", "gb-txc", "txc-1", departure, "Monday"),
+		testJourney("gtfs-weekday", "gb-gtfs", "gtfs-1", departure, "Monday"),
+		testJourney("other-saturday", "gb-other", "other-1", departure, "Saturday"),
+	}
+
+	links := Link(group, journeys)
+
+	if links.Services["gtfs-1"] != "txc-1" {
+		t.Errorf("expected gtfs-1 to duplicate txc-1, got %q", links.Services["gtfs-1"])
+	}
+	if _, exists := links.Services["txc-1"]; exists {
+		t.Error("expected the preferred service not to be a duplicate")
+	}
+	if _, exists := links.Services["other-1"]; exists {
+		t.Error("expected a service with the same name but none of the same journeys not to be a duplicate")
+	}
+	if links.Journeys["gtfs-weekday"] != "txc-weekday" {
+		t.Errorf("expected gtfs-weekday to duplicate txc-weekday, got %q", links.Journeys["gtfs-weekday"])
+	}
+	if _, exists := links.Journeys["other-saturday"]; exists {
+		t.Error("expected the Saturday journey not to be a duplicate of the weekday one")
+	}
+}
+
+func TestLinkServiceMatchThreshold(t *testing.T) {
+	departure := time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		name      string
+		matched   int
+		unmatched int
+		duplicate bool
+	}{
+		{"all journeys matched", 5, 0, true},
+		{"most journeys matched", 4, 1, true},
+		{"some journeys matched", 3, 2, false},
+		{"no journeys matched", 0, 5, false},
+		{"no journeys", 0, 0, false},
+	} {
+		group := []*ctdf.Service{
+			testService("txc-1", "gb-txc", "X1"),
+			testService("gtfs-1", "gb-gtfs", "X1"),
+		}
+
+		var journeys []*ctdf.Journey
+		for i := 0; i < test.matched+test.unmatched; i++ {
+			journeyDeparture := departure.Add(time.Duration(i) * time.Hour)
+			journeys = append(journeys, testJourney(fmt.Sprintf("gtfs-%d", i), "gb-gtfs", "gtfs-1", journeyDeparture, "Monday"))
+
+			if i < test.matched {
+				journeys = append(journeys, testJourney(fmt.Sprintf("txc-%d", i), "gb-txc", "txc-1", journeyDeparture, "Monday"))
+			}
+		}
+
+		links := Link(group, journeys)
+
+		if _, duplicate := links.Services["gtfs-1"]; duplicate != test.duplicate {
+			t.Errorf("%s: expected gtfs-1 duplicate to be %t, got %t", test.name, test.duplicate, duplicate)
+		}
+		if len(links.Journeys) != test.matched {
+			t.Errorf("%s: expected %d journeys to be linked, got %d", test.name, test.matched, len(links.Journeys))
+		}
+	}
+}
+
+func TestLinkMatchesIdenticalJourneysOnce(t *testing.T) {
+	departure := time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+
+	group := []*ctdf.Service{
+		testService("txc-1", "gb-txc", "X1"),
+		testService("gtfs-1", "gb-gtfs", "X1"),
+	}
+	// Two vehicles run the same trip at the same time
+	journeys := []*ctdf.Journey{
+		testJourney("txc-a", "gb-txc", "txc-1", departure, "Monday"),
+		testJourney("txc-b", "gb-txc", "txc-1", departure, "Monday"),
+		testJourney("gtfs-a", "gb-gtfs", "gtfs-1", departure, "Monday"),
+		testJourney("gtfs-b", "gb-gtfs", "gtfs-1", departure, "Monday"),
+		testJourney("gtfs-c", "gb-gtfs", "gtfs-1", departure, "Monday"),
+	}
+
+	links := Link(group, journeys)
+
+	if links.Journeys["gtfs-a"] != "txc-a" || links.Journeys["gtfs-b"] != "txc-b" {
+		t.Errorf("expected each preferred journey to be matched once, got %v", links.Journeys)
+	}
+	if _, exists := links.Journeys["gtfs-c"]; exists {
+		t.Error("expected the extra journey not to be a duplicate")
+	}
+}
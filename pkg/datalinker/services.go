@@ -0,0 +1,154 @@
+package datalinker
+
+import (
+	"context"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/datalinker/servicelinks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ServicesLinker links the same service & journeys imported from more than one dataset, eg. a bus route in both
+// the BODS TransXChange & GTFS datasets. Records from lower priority datasets are marked as a duplicate of the one
+// from the highest priority dataset rather than removed, so imports still see their own records & realtime feeds
+// referencing them can still be identified. Imports mark their staged records the same way so the marks survive
+// promotion, this catches up on anything the other way round eg. when the preferred dataset changes
+type ServicesLinker struct {
+	// Priority of each dataset by identifier, higher is preferred
+	DatasetPriorities map[string]int
+}
+
+func NewServicesLinker() ServicesLinker {
+	return ServicesLinker{
+		DatasetPriorities: manager.GetDatasetPriorities(),
+	}
+}
+
+func (l ServicesLinker) GetBaseCollectionName() string {
+	return "services"
+}
+
+func (l ServicesLinker) Run() error {
+	servicesCollection := database.GetCollection("services")
+	journeysCollection := database.GetCollection("journeys")
+
+	cursor, err := servicesCollection.Find(context.Background(), bson.M{}, options.Find().SetProjection(servicelinks.ServiceProjection))
+	if err != nil {
+		return err
+	}
+
+	var services []*ctdf.Service
+	if err := cursor.All(context.Background(), &services); err != nil {
+		return err
+	}
+
+	operatorIdentifiers, err := servicelinks.LoadOperatorIdentifiers()
+	if err != nil {
+		return err
+	}
+	operatorIdentifiers.ResolveServices(services)
+
+	serviceWriter := servicelinks.NewMarkWriter(servicesCollection)
+	journeyWriter := servicelinks.NewMarkWriter(journeysCollection)
+
+	serviceLinks := map[string]string{}
+	journeyLinks := map[string]string{}
+	groupedJourneys := map[string]bool{}
+
+	groups := servicelinks.Group(services, l.DatasetPriorities)
+
+	for _, group := range groups {
+		var serviceIdentifiers []string
+		for _, service := range group {
+			serviceIdentifiers = append(serviceIdentifiers, service.PrimaryIdentifier)
+		}
+
+		journeyCursor, err := journeysCollection.Find(context.Background(), bson.M{
+			"serviceref": bson.M{"$in": serviceIdentifiers},
+		}, options.Find().SetProjection(servicelinks.JourneyProjection))
+		if err != nil {
+			return err
+		}
+
+		var journeys []*ctdf.Journey
+		if err := journeyCursor.All(context.Background(), &journeys); err != nil {
+			return err
+		}
+		operatorIdentifiers.ResolveJourneys(journeys)
+
+		links := servicelinks.Link(group, journeys)
+
+		for identifier, duplicateOf := range links.Services {
+			serviceLinks[identifier] = duplicateOf
+		}
+		for identifier, duplicateOf := range links.Journeys {
+			journeyLinks[identifier] = duplicateOf
+		}
+
+		for _, journey := range journeys {
+			groupedJourneys[journey.PrimaryIdentifier] = true
+
+			if err := journeyWriter.Mark(journey.PrimaryIdentifier, journey.DuplicateOf, links.Journeys[journey.PrimaryIdentifier]); err != nil {
+				return err
+			}
+		}
+
+		log.Debug().
+			Str("service", group[0].PrimaryIdentifier).
+			Int("services", len(links.Services)).
+			Int("journeys", len(links.Journeys)).
+			Msg("Linked duplicate services")
+	}
+
+	for _, service := range services {
+		if err := serviceWriter.Mark(service.PrimaryIdentifier, service.DuplicateOf, serviceLinks[service.PrimaryIdentifier]); err != nil {
+			return err
+		}
+	}
+
+	// Journeys that were marked before but aren't part of any group now
+	markedCursor, err := journeysCollection.Find(context.Background(), bson.M{"duplicateof": bson.M{"$exists": true}}, options.Find().SetProjection(bson.D{
+		bson.E{Key: "primaryidentifier", Value: 1},
+		bson.E{Key: "duplicateof", Value: 1},
+	}))
+	if err != nil {
+		return err
+	}
+	for markedCursor.Next(context.Background()) {
+		var journey ctdf.Journey
+		if err := markedCursor.Decode(&journey); err != nil {
+			return err
+		}
+
+		if !groupedJourneys[journey.PrimaryIdentifier] {
+			if err := journeyWriter.Mark(journey.PrimaryIdentifier, journey.DuplicateOf, ""); err != nil {
+				return err
+			}
+		}
+	}
+	if err := markedCursor.Err(); err != nil {
+		return err
+	}
+
+	if err := serviceWriter.Flush(); err != nil {
+		return err
+	}
+	if err := journeyWriter.Flush(); err != nil {
+		return err
+	}
+
+	log.Info().
+		Int("services", len(services)).
+		Int("groups", len(groups)).
+		Int("duplicateservices", len(serviceLinks)).
+		Int("duplicatejourneys", len(journeyLinks)).
+		Int("updatedservices", serviceWriter.Updated).
+		Int("updatedjourneys", journeyWriter.Updated).
+		Msg("Linked services")
+
+	return nil
+}
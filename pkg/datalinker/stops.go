@@ -11,6 +11,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/transforms"
 	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -28,7 +29,7 @@ func (l StopsLinker) GetBaseCollectionName() string {
 	return "stops"
 }
 
-func (l StopsLinker) Run() {
+func (l StopsLinker) Run() error {
 	liveCollectionName := l.GetBaseCollectionName()
 	rawCollectionName := fmt.Sprintf("%s_raw", liveCollectionName)
 	stagingCollectionName := fmt.Sprintf("%s_staging", liveCollectionName)
@@ -36,7 +37,9 @@ func (l StopsLinker) Run() {
 	rawCollection := database.GetCollection(rawCollectionName)
 	stagingCollection := database.GetCollection(stagingCollectionName)
 
-	copyCollection(rawCollectionName, stagingCollectionName)
+	if err := copyCollection(rawCollectionName, stagingCollectionName); err != nil {
+		return err
+	}
 
 	// A location based aggregation
 	// 	bson.A{
@@ -125,7 +128,7 @@ func (l StopsLinker) Run() {
 
 	cursor, err := rawCollection.Aggregate(context.Background(), aggregation)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	var operations []mongo.WriteModel
@@ -220,6 +223,8 @@ func (l StopsLinker) Run() {
 
 		newRecord.OtherIdentifiers = append(mergeGroupFiltered, newRecord.PrimaryIdentifier)
 
+		transforms.TransformImport(&newRecord, 3)
+
 		// insert new
 		insertModel := mongo.NewInsertOneModel()
 		bsonRep, _ := bson.Marshal(newRecord)
@@ -233,15 +238,20 @@ func (l StopsLinker) Run() {
 	if len(operations) > 0 {
 		_, err := stagingCollection.BulkWrite(context.Background(), operations, &options.BulkWriteOptions{})
 		if err != nil {
-			log.Fatal().Err(err).Msg("Failed to bulk write")
+			return err
 		}
 	}
 
 	// Delete any remaining manual merge entries from staging
-	stagingCollection.DeleteMany(context.Background(), bson.M{"primaryidentifier": bson.M{"$regex": "^travigo-internalmerge-"}})
+	_, err = stagingCollection.DeleteMany(context.Background(), bson.M{"primaryidentifier": bson.M{"$regex": "^travigo-internalmerge-"}})
+	if err != nil {
+		return err
+	}
 
 	// Copy staging to live
-	copyCollection(stagingCollectionName, liveCollectionName)
+	if err := copyCollection(stagingCollectionName, liveCollectionName); err != nil {
+		return err
+	}
 	// Delete staging as it's not needed now
-	emptyCollection(stagingCollectionName)
+	return emptyCollection(stagingCollectionName)
 }
@@ -9,7 +9,7 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func copyCollection(source string, destination string) {
+func copyCollection(source string, destination string) error {
 	log.Info().Str("src", source).Str("dst", destination).Msg("Copying collection")
 	sourceCollection := database.GetCollection(source)
 
@@ -18,12 +18,19 @@ func copyCollection(source string, destination string) {
 		bson.D{{Key: "$out", Value: destination}},
 	}
 
-	sourceCollection.Aggregate(context.Background(), aggregation)
+	cursor, err := sourceCollection.Aggregate(context.Background(), aggregation)
+	if err != nil {
+		return err
+	}
+
+	return cursor.Close(context.Background())
 }
 
-func emptyCollection(collectionName string) {
+func emptyCollection(collectionName string) error {
 	log.Info().Str("collection", collectionName).Msg("Emptying collection")
 	collection := database.GetCollection(collectionName)
 
-	collection.DeleteMany(context.Background(), bson.M{})
+	_, err := collection.DeleteMany(context.Background(), bson.M{})
+
+	return err
 }
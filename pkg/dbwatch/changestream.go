@@ -0,0 +1,309 @@
+package dbwatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const changeStreamWorkers = 8
+const resumeTokenSaveInterval = 1 * time.Second
+const changeStreamRetryMaxBackoff = 1 * time.Minute
+const changeStreamHandlerAttempts = 3
+
+// Error codes from MongoDB for when the stored resume token can no longer be used
+var unresumableErrorCodes = []int{
+	260, // InvalidResumeToken
+	280, // ChangeStreamFatalError
+	286, // ChangeStreamHistoryLost
+}
+
+type changeStreamResumeToken struct {
+	Watch                string
+	ResumeToken          bson.Raw
+	Invalidated          bool
+	ModificationDateTime time.Time
+}
+
+// ChangeStreamWatcher runs a change stream that resumes from the last processed position after a restart,
+// reopens itself after errors or invalidation and processes the changes to a single document in order
+type ChangeStreamWatcher struct {
+	Name       string
+	Collection string
+	Pipeline   mongo.Pipeline
+	Options    *options.ChangeStreamOptions
+
+	// Handler processes a single change, when it keeps failing the stream is restarted from the last change
+	// that was fully processed so the change is tried again rather than skipped
+	Handler func(change bson.Raw) error
+
+	mutex          sync.Mutex
+	nextSequence   uint64
+	commitSequence uint64
+	completed      map[uint64]bson.Raw
+	lastSaved      time.Time
+	pendingToken   bson.Raw
+}
+
+func (w *ChangeStreamWatcher) Run() {
+	backoff := 1 * time.Second
+
+	for {
+		err := w.watch()
+
+		if err == nil {
+			backoff = 1 * time.Second
+			continue
+		}
+
+		var commandError mongo.CommandError
+		if errors.As(err, &commandError) && isUnresumableError(commandError) {
+			log.Error().Err(err).Str("watch", w.Name).Msg("Resume token can no longer be used, starting from now")
+			w.clearResumeToken()
+		} else {
+			log.Error().Err(err).Str("watch", w.Name).Dur("backoff", backoff).Msg("Change stream failed, reconnecting")
+		}
+
+		time.Sleep(backoff)
+		backoff = min(backoff*2, changeStreamRetryMaxBackoff)
+	}
+}
+
+// watch runs a single change stream until it ends, only returning once every change has been processed
+func (w *ChangeStreamWatcher) watch() error {
+	opts := options.MergeChangeStreamOptions(w.Options)
+
+	storedToken := w.loadResumeToken()
+	if storedToken != nil {
+		if storedToken.Invalidated {
+			opts.SetStartAfter(storedToken.ResumeToken)
+		} else {
+			opts.SetResumeAfter(storedToken.ResumeToken)
+		}
+		log.Info().Str("watch", w.Name).Msg("Resuming change stream from stored position")
+	}
+
+	collection := database.GetCollection(w.Collection)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := collection.Watch(ctx, w.Pipeline, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+
+	log.Info().Str("watch", w.Name).Msg("Change stream started")
+
+	w.completed = map[uint64]bson.Raw{}
+	w.nextSequence = 0
+	w.commitSequence = 0
+
+	var workerChannels []chan changeStreamItem
+	var workerGroup sync.WaitGroup
+
+	var handlerErr error
+	var handlerErrOnce sync.Once
+
+	for i := 0; i < changeStreamWorkers; i++ {
+		workerChannel := make(chan changeStreamItem, 100)
+		workerChannels = append(workerChannels, workerChannel)
+
+		workerGroup.Add(1)
+		go func() {
+			defer workerGroup.Done()
+
+			for item := range workerChannel {
+				// Once a change has failed nothing after it is committed so the rest are left for the restart
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := w.handle(item.change); err != nil {
+					handlerErrOnce.Do(func() {
+						handlerErr = err
+						cancel()
+					})
+					continue
+				}
+
+				w.markCompleted(item.sequence, item.resumeToken)
+			}
+		}()
+	}
+
+	var invalidateToken bson.Raw
+
+	for stream.Next(ctx) {
+		change := make(bson.Raw, len(stream.Current))
+		copy(change, stream.Current)
+
+		operationType, _ := change.Lookup("operationType").StringValueOK()
+		if operationType == "invalidate" {
+			invalidateToken = stream.ResumeToken()
+			break
+		}
+
+		// Changes to the same document always go to the same worker so they are processed in order
+		documentKey := change.Lookup("documentKey")
+		hash := fnv.New32a()
+		hash.Write(documentKey.Value)
+
+		select {
+		case workerChannels[hash.Sum32()%changeStreamWorkers] <- changeStreamItem{
+			sequence:    w.nextSequence,
+			change:      change,
+			resumeToken: stream.ResumeToken(),
+		}:
+		case <-ctx.Done():
+		}
+		w.nextSequence++
+	}
+
+	for _, workerChannel := range workerChannels {
+		close(workerChannel)
+	}
+	workerGroup.Wait()
+
+	if handlerErr != nil {
+		w.flushResumeToken()
+
+		return errors.New(fmt.Sprintf("failed to handle change: %s", handlerErr))
+	}
+
+	// Once invalidated the stream can only be restarted after the invalidate event
+	if invalidateToken != nil {
+		w.pendingToken = nil
+		w.saveResumeToken(invalidateToken, true)
+
+		log.Warn().Str("watch", w.Name).Msg("Change stream invalidated, restarting")
+		return nil
+	}
+
+	w.flushResumeToken()
+
+	if stream.Err() != nil {
+		return stream.Err()
+	}
+
+	return errors.New("change stream closed")
+}
+
+// handle runs the handler for a change, retrying a few times before giving up
+func (w *ChangeStreamWatcher) handle(change bson.Raw) error {
+	backoff := 1 * time.Second
+
+	var err error
+	for attempt := 1; attempt <= changeStreamHandlerAttempts; attempt++ {
+		err = w.Handler(change)
+		if err == nil {
+			return nil
+		}
+
+		if attempt < changeStreamHandlerAttempts {
+			log.Warn().Err(err).Str("watch", w.Name).Int("attempt", attempt).Msg("Failed to handle change, retrying")
+
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return err
+}
+
+type changeStreamItem struct {
+	sequence    uint64
+	change      bson.Raw
+	resumeToken bson.Raw
+}
+
+// markCompleted records a processed change and saves the resume token of the furthest point where
+// every earlier change has also been processed, so nothing is skipped if we restart
+func (w *ChangeStreamWatcher) markCompleted(sequence uint64, resumeToken bson.Raw) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.completed[sequence] = resumeToken
+
+	var commitToken bson.Raw
+	for {
+		token, exists := w.completed[w.commitSequence]
+		if !exists {
+			break
+		}
+
+		commitToken = token
+		delete(w.completed, w.commitSequence)
+		w.commitSequence++
+	}
+
+	if commitToken != nil && time.Since(w.lastSaved) >= resumeTokenSaveInterval {
+		w.saveResumeToken(commitToken, false)
+		w.lastSaved = time.Now()
+		w.pendingToken = nil
+	} else if commitToken != nil {
+		w.pendingToken = commitToken
+	}
+}
+
+func (w *ChangeStreamWatcher) flushResumeToken() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.pendingToken != nil {
+		w.saveResumeToken(w.pendingToken, false)
+		w.pendingToken = nil
+	}
+}
+
+func (w *ChangeStreamWatcher) loadResumeToken() *changeStreamResumeToken {
+	var resumeToken *changeStreamResumeToken
+
+	collection := database.GetCollection("dbwatch_resume_tokens")
+	collection.FindOne(context.Background(), bson.M{"watch": w.Name}).Decode(&resumeToken)
+
+	if resumeToken == nil || len(resumeToken.ResumeToken) == 0 {
+		return nil
+	}
+
+	return resumeToken
+}
+
+func (w *ChangeStreamWatcher) saveResumeToken(token bson.Raw, invalidated bool) {
+	collection := database.GetCollection("dbwatch_resume_tokens")
+	_, err := collection.UpdateOne(context.Background(), bson.M{"watch": w.Name}, bson.M{
+		"$set": changeStreamResumeToken{
+			Watch:                w.Name,
+			ResumeToken:          token,
+			Invalidated:          invalidated,
+			ModificationDateTime: time.Now(),
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		log.Error().Err(err).Str("watch", w.Name).Msg("Failed to save resume token")
+	}
+}
+
+func (w *ChangeStreamWatcher) clearResumeToken() {
+	collection := database.GetCollection("dbwatch_resume_tokens")
+	collection.DeleteOne(context.Background(), bson.M{"watch": w.Name})
+}
+
+func isUnresumableError(commandError mongo.CommandError) bool {
+	for _, code := range unresumableErrorCodes {
+		if int(commandError.Code) == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 )
@@ -26,6 +27,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
 					log.Info().Msg("Starting dbwatch server")
 
@@ -0,0 +1,160 @@
+package dbwatch
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+// detectEvents compares the journey before & after a change and returns the events that should be raised
+// For inserts the before journey is empty
+func (w *RealtimeJourneysWatch) detectEvents(before *ctdf.RealtimeJourney, after *ctdf.RealtimeJourney, inserted bool) []ctdf.Event {
+	var events []ctdf.Event
+	now := time.Now()
+
+	newEvent := func(eventType ctdf.EventType, body interface{}) {
+		events = append(events, ctdf.Event{
+			Type:      eventType,
+			Timestamp: now,
+			Body:      body,
+		})
+	}
+
+	// Detect newly cancelled journeys, nothing else matters once its cancelled
+	if after.Cancelled && !before.Cancelled {
+		log.Info().Str("id", after.PrimaryIdentifier).Msg("RealtimeJourney has been cancelled")
+		newEvent(ctdf.EventTypeRealtimeJourneyCancelled, after)
+
+		return events
+	}
+
+	if !after.Cancelled && before.Cancelled {
+		log.Info().Str("id", after.PrimaryIdentifier).Msg("RealtimeJourney has been reinstated")
+		newEvent(ctdf.EventTypeRealtimeJourneyReinstated, after)
+	}
+
+	if after.DepartedStopRef != "" && before.DepartedStopRef == "" {
+		log.Debug().Str("id", after.PrimaryIdentifier).Msg("RealtimeJourney has started")
+		newEvent(ctdf.EventTypeRealtimeJourneyStarted, &ctdf.RealtimeJourneyEventBody{
+			RealtimeJourney: after,
+		})
+	}
+
+	if after.IsCompleted() && !before.IsCompleted() {
+		log.Debug().Str("id", after.PrimaryIdentifier).Msg("RealtimeJourney has completed")
+		newEvent(ctdf.EventTypeRealtimeJourneyCompleted, &ctdf.RealtimeJourneyEventBody{
+			RealtimeJourney: after,
+		})
+
+		return events
+	}
+
+	// Detect the journey moving on to its next stop
+	if !inserted && after.NextStopRef != "" && after.NextStopRef != before.NextStopRef {
+		log.Debug().
+			Str("id", after.PrimaryIdentifier).
+			Str("nextstop", after.NextStopRef).
+			Msg("RealtimeJourney next stop changed")
+
+		newEvent(ctdf.EventTypeRealtimeJourneyNextStopChanged, &ctdf.RealtimeJourneyNextStopEventBody{
+			RealtimeJourney: after,
+			OldNextStop:     before.NextStopRef,
+			NextStop:        after.NextStopRef,
+		})
+	}
+
+	// Detect the delay crossing any of the thresholds
+	oldDelay := int(before.CurrentDelay().Minutes())
+	newDelay := int(after.CurrentDelay().Minutes())
+
+	var crossedUp, crossedDown bool
+	var crossedThreshold int
+	for _, threshold := range w.DelayThresholds {
+		if oldDelay < threshold && newDelay >= threshold {
+			crossedUp = true
+			crossedThreshold = threshold
+		} else if oldDelay >= threshold && newDelay < threshold {
+			crossedDown = true
+		} else if newDelay >= threshold {
+			crossedThreshold = threshold
+		}
+	}
+
+	if crossedUp {
+		log.Info().Str("id", after.PrimaryIdentifier).Int("delay", newDelay).Msg("RealtimeJourney delay increased")
+
+		newEvent(ctdf.EventTypeRealtimeJourneyDelayed, &ctdf.RealtimeJourneyDelayEventBody{
+			RealtimeJourney: after,
+			OldDelay:        oldDelay,
+			Delay:           newDelay,
+			Threshold:       crossedThreshold,
+		})
+	} else if crossedDown {
+		log.Info().Str("id", after.PrimaryIdentifier).Int("delay", newDelay).Msg("RealtimeJourney delay reduced")
+
+		newEvent(ctdf.EventTypeRealtimeJourneyDelayReduced, &ctdf.RealtimeJourneyDelayEventBody{
+			RealtimeJourney: after,
+			OldDelay:        oldDelay,
+			Delay:           newDelay,
+			Threshold:       crossedThreshold,
+		})
+	}
+
+	// Checks for stop level changes
+	for id, journeyStop := range after.Stops {
+		// This shouldnt happen as why would a historical stop change
+		if journeyStop.TimeType == ctdf.RealtimeJourneyStopTimeHistorical {
+			continue
+		}
+
+		oldJourneyStop := before.Stops[id]
+
+		if journeyStop.Cancelled && (oldJourneyStop == nil || !oldJourneyStop.Cancelled) {
+			log.Info().
+				Str("id", after.PrimaryIdentifier).
+				Str("stop", id).
+				Msg("RealtimeJourney stop cancelled")
+
+			newEvent(ctdf.EventTypeRealtimeJourneyStopCancelled, &ctdf.RealtimeJourneyStopEventBody{
+				RealtimeJourney: after,
+				Stop:            id,
+			})
+		}
+
+		if oldJourneyStop == nil {
+			continue
+		}
+
+		newPlatform := journeyStop.Platform
+		oldPlatform := oldJourneyStop.Platform
+
+		if oldPlatform == "" && newPlatform != oldPlatform {
+			log.Info().
+				Str("id", after.PrimaryIdentifier).
+				Str("platform", newPlatform).
+				Msg("RealtimeJourney stop platform set")
+
+			newEvent(ctdf.EventTypeRealtimeJourneyPlatformSet, &ctdf.RealtimeJourneyPlatformEventBody{
+				RealtimeJourney: after,
+				Stop:            id,
+				NewPlatform:     newPlatform,
+			})
+		} else if oldPlatform != "" && newPlatform != oldPlatform {
+			log.Info().
+				Str("id", after.PrimaryIdentifier).
+				Str("oldplatform", oldPlatform).
+				Str("newplatform", newPlatform).
+				Msg("RealtimeJourney stop platform changed")
+
+			newEvent(ctdf.EventTypeRealtimeJourneyPlatformChanged, &ctdf.RealtimeJourneyPlatformEventBody{
+				RealtimeJourney: after,
+				Stop:            id,
+				OldPlatform:     oldPlatform,
+				NewPlatform:     newPlatform,
+			})
+		}
+	}
+
+	return events
+}
@@ -0,0 +1,124 @@
+package dbwatch
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestGetDelayThreshold(t *testing.T) {
+	thresholds := []int{5, 10, 30}
+
+	for _, test := range []struct {
+		delay     time.Duration
+		threshold int
+	}{
+		{0, 0},
+		{4*time.Minute + 59*time.Second, 0},
+		{5 * time.Minute, 5},
+		{9 * time.Minute, 5},
+		{10 * time.Minute, 10},
+		{45 * time.Minute, 30},
+		{-10 * time.Minute, 0},
+	} {
+		if threshold := ctdf.GetDelayThreshold(test.delay, thresholds); threshold != test.threshold {
+			t.Errorf("expected a delay of %s to reach %d, got %d", test.delay, test.threshold, threshold)
+		}
+	}
+}
+
+func TestDetectDelayEvents(t *testing.T) {
+	watch := &RealtimeJourneysWatch{DelayThresholds: []int{5, 10, 30}}
+
+	for _, test := range []struct {
+		oldDelay  time.Duration
+		newDelay  time.Duration
+		eventType ctdf.EventType
+		threshold int
+	}{
+		{0, 3 * time.Minute, "", 0},
+		{3 * time.Minute, 6 * time.Minute, ctdf.EventTypeRealtimeJourneyDelayed, 5},
+		{6 * time.Minute, 8 * time.Minute, "", 0},
+		{6 * time.Minute, 35 * time.Minute, ctdf.EventTypeRealtimeJourneyDelayed, 30},
+		{12 * time.Minute, 7 * time.Minute, ctdf.EventTypeRealtimeJourneyDelayReduced, 5},
+		{12 * time.Minute, 0, ctdf.EventTypeRealtimeJourneyDelayReduced, 0},
+	} {
+		journey := &ctdf.Journey{
+			Path: []*ctdf.JourneyPathItem{{OriginStopRef: "test-stop-a", DestinationStopRef: "test-stop-b"}},
+		}
+		before := &ctdf.RealtimeJourney{PrimaryIdentifier: "test", Journey: journey, Offset: test.oldDelay}
+		after := &ctdf.RealtimeJourney{PrimaryIdentifier: "test", Journey: journey, Offset: test.newDelay}
+
+		events := watch.detectEvents(before, after, false)
+
+		if test.eventType == "" {
+			if len(events) != 0 {
+				t.Errorf("expected no events from %s to %s, got %v", test.oldDelay, test.newDelay, events)
+			}
+			continue
+		}
+
+		if len(events) != 1 || events[0].Type != test.eventType {
+			t.Errorf("expected a %s event from %s to %s, got %v", test.eventType, test.oldDelay, test.newDelay, events)
+			continue
+		}
+		if body := events[0].Body.(*ctdf.RealtimeJourneyDelayEventBody); body.Threshold != test.threshold {
+			t.Errorf("expected the %s event from %s to %s to be for %d minutes, got %d", test.eventType, test.oldDelay, test.newDelay, test.threshold, body.Threshold)
+		}
+	}
+}
+
+type recordingQueue struct {
+	queue_client.Queue
+
+	fail    bool
+	batches [][][]byte
+}
+
+func (q *recordingQueue) PublishBytes(payload ...[]byte) error {
+	if q.fail {
+		return errors.New("publish failed")
+	}
+
+	q.batches = append(q.batches, payload)
+
+	return nil
+}
+
+func TestHandleChangePublishesEventsTogether(t *testing.T) {
+	journey := &ctdf.Journey{
+		Path: []*ctdf.JourneyPathItem{{OriginStopRef: "test-stop-a", DestinationStopRef: "test-stop-b"}},
+	}
+	before := ctdf.RealtimeJourney{PrimaryIdentifier: "test", Journey: journey, NextStopRef: "test-stop-a"}
+	after := ctdf.RealtimeJourney{PrimaryIdentifier: "test", Journey: journey, NextStopRef: "test-stop-b", DepartedStopRef: "test-stop-a", Offset: 12 * time.Minute}
+
+	change, err := bson.Marshal(bson.M{
+		"operationType":            "update",
+		"fullDocument":             after,
+		"fullDocumentBeforeChange": before,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue := &recordingQueue{fail: true}
+	watch := &RealtimeJourneysWatch{EventQueue: queue, DelayThresholds: []int{5, 10, 30}}
+
+	if err := watch.handleChange(change); err == nil {
+		t.Fatal("expected the failed publish to be retried")
+	}
+
+	queue.fail = false
+	if err := watch.handleChange(change); err != nil {
+		t.Fatal(err)
+	}
+
+	// Started, next stop changed & delayed
+	if len(queue.batches) != 1 || len(queue.batches[0]) != 3 {
+		t.Errorf("expected the 3 events of the change to be published in one batch, got %d batches", len(queue.batches))
+	}
+}
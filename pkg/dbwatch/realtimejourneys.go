@@ -1,22 +1,21 @@
 package dbwatch
 
 import (
-	"context"
 	"encoding/json"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
-	"github.com/travigo/travigo/pkg/database"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type RealtimeJourneysWatch struct {
-	EventQueue rmq.Queue
+	EventQueue queue_client.Queue
+
+	DelayThresholds []int
 }
 
 type realtimeJourneyUpdate struct {
@@ -29,34 +28,53 @@ type realtimeJourneyUpdate struct {
 }
 
 func NewRealtimeJourneysWatch() *RealtimeJourneysWatch {
-	eventQueue, err := redis_client.QueueConnection.OpenQueue("events-queue")
+	eventQueue, err := queue_client.QueueConnection.OpenQueue("events-queue")
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start event queue")
 	}
 
 	return &RealtimeJourneysWatch{
-		EventQueue: eventQueue,
+		EventQueue:      eventQueue,
+		DelayThresholds: ctdf.GetRealtimeJourneyDelayThresholds(),
 	}
 }
 
 func (w *RealtimeJourneysWatch) Run() {
 	log.Info().Msg("Starting dbwatch on collection realtime_journeys")
-	collection := database.GetCollection("realtime_journeys")
 	matchPipeline := bson.D{
 		{
 			Key: "$match", Value: bson.D{
 				{
 					Key: "$and", Value: bson.A{
-						bson.D{{Key: "operationType", Value: "update"}}, //ignore inserts for now
+						bson.D{{Key: "operationType", Value: bson.D{{Key: "$in", Value: bson.A{"insert", "update"}}}}},
 						bson.D{
 							{
 								Key: "$or", Value: bson.A{
+									bson.D{{Key: "operationType", Value: "insert"}},
 									bson.D{
 										{
 											Key:   "updateDescription.updatedFields.cancelled",
 											Value: bson.D{{Key: "$exists", Value: true}},
 										},
 									},
+									bson.D{
+										{
+											Key:   "updateDescription.updatedFields.nextstopref",
+											Value: bson.D{{Key: "$exists", Value: true}},
+										},
+									},
+									bson.D{
+										{
+											Key:   "updateDescription.updatedFields.departedstopref",
+											Value: bson.D{{Key: "$exists", Value: true}},
+										},
+									},
+									bson.D{
+										{
+											Key:   "updateDescription.updatedFields.delaythreshold",
+											Value: bson.D{{Key: "$exists", Value: true}},
+										},
+									},
 									// This is prob a bit hacky but it does work so who really cares?
 									bson.D{
 										{
@@ -90,107 +108,61 @@ func (w *RealtimeJourneysWatch) Run() {
 			},
 		},
 	}
-	opts := options.ChangeStream().SetFullDocumentBeforeChange(options.WhenAvailable).SetFullDocument(options.WhenAvailable)
-	stream, err := collection.Watch(context.Background(), mongo.Pipeline{matchPipeline, projectPipeline}, opts)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Failed to watch collection")
+	watcher := &ChangeStreamWatcher{
+		Name:       "realtime_journeys",
+		Collection: "realtime_journeys",
+		Pipeline:   mongo.Pipeline{matchPipeline, projectPipeline},
+		Options:    options.ChangeStream().SetFullDocumentBeforeChange(options.WhenAvailable).SetFullDocument(options.WhenAvailable),
+		Handler:    w.handleChange,
 	}
 
-	defer stream.Close(context.Background())
+	watcher.Run()
+}
 
-	for stream.Next(context.Background()) {
-		var data realtimeJourneyUpdate
+func (w *RealtimeJourneysWatch) handleChange(change bson.Raw) error {
+	var data realtimeJourneyUpdate
+	if err := bson.Unmarshal(change, &data); err != nil {
+		// Retrying won't help a change that can't be decoded
+		log.Error().Err(err).Msg("Failed to decode event")
+		return nil
+	}
 
-		if err := stream.Decode(&data); err != nil {
-			log.Error().Err(err).Msg("Failed to decode event")
+	var events []ctdf.Event
+
+	if data.OperationType == "insert" {
+		log.Info().Str("id", data.FullDocument.PrimaryIdentifier).Msg("New RealtimeJourney inserted")
+
+		events = append(events, ctdf.Event{
+			Type:      ctdf.EventTypeRealtimeJourneyCreated,
+			Timestamp: time.Now(),
+			Body:      data.FullDocument,
+		})
+		events = append(events, w.detectEvents(&ctdf.RealtimeJourney{}, &data.FullDocument, true)...)
+	} else if data.OperationType == "update" {
+		// Without both versions of the document we can't tell what has changed
+		if data.FullDocument.PrimaryIdentifier == "" || data.FullDocumentBeforeChange.PrimaryIdentifier == "" {
+			return nil
+		}
+
+		events = w.detectEvents(&data.FullDocumentBeforeChange, &data.FullDocument, false)
+	}
+
+	var eventsBytes [][]byte
+	for _, event := range events {
+		eventBytes, err := json.Marshal(event)
+		if err != nil {
+			log.Error().Err(err).Str("type", string(event.Type)).Msg("Failed to encode event")
 			continue
 		}
 
-		go func(data *realtimeJourneyUpdate) {
-			if data.OperationType == "insert" {
-				log.Info().Str("id", data.FullDocument.PrimaryIdentifier).Msg("New RealtimeJourney inserted")
-
-				eventBytes, _ := json.Marshal(ctdf.Event{
-					Type:      ctdf.EventTypeRealtimeJourneyCreated,
-					Timestamp: time.Now(),
-					Body:      data.FullDocument,
-				})
-				w.EventQueue.PublishBytes(eventBytes)
-			} else if data.OperationType == "update" {
-				if data.FullDocument.PrimaryIdentifier == "" {
-					return
-				}
-
-				// Detect newly cancelled journeys
-				if data.UpdateDescription.UpdatedFields.Cancelled == true && !data.FullDocumentBeforeChange.Cancelled {
-					log.Info().Str("id", data.FullDocument.PrimaryIdentifier).Msg("RealtimeJourney has been cancelled")
-
-					eventBytes, _ := json.Marshal(ctdf.Event{
-						Type:      ctdf.EventTypeRealtimeJourneyCancelled,
-						Timestamp: time.Now(),
-						Body:      data.FullDocument,
-					})
-					w.EventQueue.PublishBytes(eventBytes)
-
-					return
-				}
-
-				// Checks for set or changed platforms
-				for id, journeyStop := range data.FullDocument.Stops {
-					// This shouldnt happen as why would a historical stop change platforms
-					if journeyStop.TimeType == ctdf.RealtimeJourneyStopTimeHistorical {
-						continue
-					}
-
-					newPlatform := journeyStop.Platform
-
-					oldJourneyPlatform := data.FullDocumentBeforeChange.Stops[id]
-					if oldJourneyPlatform == nil {
-						continue
-					}
-					oldPlatform := oldJourneyPlatform.Platform
-
-					if oldPlatform == "" && newPlatform != oldPlatform {
-						log.Info().
-							Str("id", data.FullDocument.PrimaryIdentifier).
-							Str("platform", newPlatform).
-							Msg("RealtimeJourney stop platform set")
-
-						eventBytes, _ := json.Marshal(ctdf.Event{
-							Type:      ctdf.EventTypeRealtimeJourneyPlatformSet,
-							Timestamp: time.Now(),
-							Body: map[string]interface{}{
-								"RealtimeJourney": data.FullDocument,
-								"Stop":            id,
-								"NewPlatform":     newPlatform,
-							},
-						})
-						w.EventQueue.PublishBytes(eventBytes)
-					} else if oldPlatform != "" && newPlatform != oldPlatform {
-						log.Info().
-							Str("id", data.FullDocument.PrimaryIdentifier).
-							Str("oldplatform", oldPlatform).
-							Str("newplatform", newPlatform).
-							Msg("RealtimeJourney stop platform changed")
-
-						eventBytes, _ := json.Marshal(ctdf.Event{
-							Type:      ctdf.EventTypeRealtimeJourneyPlatformChanged,
-							Timestamp: time.Now(),
-							Body: map[string]interface{}{
-								"RealtimeJourney": data.FullDocument,
-								"Stop":            id,
-								"OldPlatform":     oldPlatform,
-								"NewPlatform":     newPlatform,
-							},
-						})
-						w.EventQueue.PublishBytes(eventBytes)
-					}
-				}
-			}
-		}(&data)
+		eventsBytes = append(eventsBytes, eventBytes)
 	}
 
-	log.Error().Err(stream.Err()).Msg("realtime journey watch fell over")
+	if len(eventsBytes) == 0 {
+		return nil
+	}
 
-	w.Run() // this is a hack and a half
+	// All the events of a change are published together so a retried change doesn't republish the ones that were
+	// already sent before a failure
+	return w.EventQueue.PublishBytes(eventsBytes...)
 }
@@ -1,25 +1,22 @@
 package dbwatch
 
 import (
-	"context"
 	"encoding/json"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
-	"github.com/travigo/travigo/pkg/database"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ServiceAlertsWatch struct {
-	EventQueue rmq.Queue
+	EventQueue queue_client.Queue
 }
 
 func NewServiceAlertsWatch() *ServiceAlertsWatch {
-	eventQueue, err := redis_client.QueueConnection.OpenQueue("events-queue")
+	eventQueue, err := queue_client.QueueConnection.OpenQueue("events-queue")
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start event queue")
 	}
@@ -31,7 +28,6 @@ func NewServiceAlertsWatch() *ServiceAlertsWatch {
 
 func (w *ServiceAlertsWatch) Run() {
 	log.Info().Msg("Starting dbwatch on collection service_alerts")
-	collection := database.GetCollection("service_alerts")
 	matchPipeline := bson.D{
 		{
 			Key: "$match", Value: bson.D{
@@ -39,34 +35,42 @@ func (w *ServiceAlertsWatch) Run() {
 			},
 		},
 	}
-	stream, err := collection.Watch(context.Background(), mongo.Pipeline{matchPipeline})
-	if err != nil {
-		panic(err)
+	watcher := &ChangeStreamWatcher{
+		Name:       "service_alerts",
+		Collection: "service_alerts",
+		Pipeline:   mongo.Pipeline{matchPipeline},
+		Handler:    w.handleChange,
 	}
 
-	defer stream.Close(context.Background())
+	watcher.Run()
+}
 
-	for stream.Next(context.Background()) {
-		var data struct {
-			OperationType string             `bson:"operationType"`
-			FullDocument  *ctdf.ServiceAlert `bson:"fullDocument"`
-		}
-		if err := stream.Decode(&data); err != nil {
-			log.Error().Err(err).Msg("Failed to decode event")
-			continue
-		}
+func (w *ServiceAlertsWatch) handleChange(change bson.Raw) error {
+	var data struct {
+		OperationType string             `bson:"operationType"`
+		FullDocument  *ctdf.ServiceAlert `bson:"fullDocument"`
+	}
+	if err := bson.Unmarshal(change, &data); err != nil {
+		// Retrying won't help a change that can't be decoded
+		log.Error().Err(err).Msg("Failed to decode event")
+		return nil
+	}
 
-		if data.OperationType != "insert" {
-			continue
-		}
+	if data.OperationType != "insert" || data.FullDocument == nil {
+		return nil
+	}
 
-		log.Info().Str("id", data.FullDocument.PrimaryIdentifier).Msg("New ServiceAlert inserted")
+	log.Info().Str("id", data.FullDocument.PrimaryIdentifier).Msg("New ServiceAlert inserted")
 
-		eventBytes, _ := json.Marshal(ctdf.Event{
-			Type:      ctdf.EventTypeServiceAlertCreated,
-			Timestamp: time.Now(),
-			Body:      data.FullDocument,
-		})
-		w.EventQueue.PublishBytes(eventBytes)
+	eventBytes, err := json.Marshal(ctdf.Event{
+		Type:      ctdf.EventTypeServiceAlertCreated,
+		Timestamp: time.Now(),
+		Body:      data.FullDocument,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode event")
+		return nil
 	}
+
+	return w.EventQueue.PublishBytes(eventBytes)
 }
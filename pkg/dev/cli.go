@@ -0,0 +1,144 @@
+package dev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/api"
+	"github.com/travigo/travigo/pkg/consumer"
+	dataaggregator "github.com/travigo/travigo/pkg/dataaggregator/global"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/insertrecords"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/datalinker"
+	"github.com/travigo/travigo/pkg/events"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/urfave/cli/v2"
+)
+
+func RegisterCLI() *cli.Command {
+	return &cli.Command{
+		Name:  "dev",
+		Usage: "Run the importer, vehicle tracker, events and web api in a single process with in-memory storage",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "listen",
+				Value: ":8080",
+				Usage: "listen target for the web server",
+			},
+			&cli.StringSliceFlag{
+				Name:  "dataset",
+				Usage: "Dataset to import on startup as <id> or <id>=<local file> to use a fixture (can be repeated)",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			// Embedded Redis for the caches that expect it
+			redisServer, err := miniredis.Run()
+			if err != nil {
+				return err
+			}
+			defer redisServer.Close()
+
+			os.Setenv("TRAVIGO_REDIS_ADDRESS", redisServer.Addr())
+			os.Setenv("TRAVIGO_REDIS_PASSWORD", "")
+			os.Setenv("TRAVIGO_DATABASE_BACKEND", "memory")
+			os.Setenv("TRAVIGO_QUEUE_BACKEND", string(queue_client.BackendMemory))
+
+			if err := database.Connect(); err != nil {
+				return err
+			}
+			if err := redis_client.Connect(); err != nil {
+				return err
+			}
+			if err := queue_client.Connect(); err != nil {
+				return err
+			}
+
+			insertrecords.Insert()
+
+			dataaggregator.Setup()
+
+			if err := importDatasets(c.StringSlice("dataset")); err != nil {
+				return err
+			}
+
+			vehicletracker.StartConsumers()
+
+			eventsBatchConsumer := events.NewEventsBatchConsumer()
+			go eventsBatchConsumer.StartReleasingPendingNotifications()
+
+			eventsConsumer := consumer.QueueConsumer{
+				QueueName:       "events-queue",
+				NumberConsumers: 1,
+				BatchSize:       20,
+				Timeout:         2 * time.Second,
+				Consumer:        eventsBatchConsumer,
+			}
+			eventsConsumer.Setup()
+
+			log.Info().Str("listen", c.String("listen")).Msg("Travigo dev environment ready")
+
+			return api.SetupServer(c.String("listen"))
+		},
+	}
+}
+
+// importDatasets imports the static datasets before linking them and leaves realtime datasets refreshing in the background
+func importDatasets(datasetArguments []string) error {
+	var importedStatic bool
+
+	for _, datasetArgument := range datasetArguments {
+		identifier, source, _ := strings.Cut(datasetArgument, "=")
+
+		dataset, err := manager.GetDataset(identifier)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Dataset %s: %s", identifier, err))
+		}
+
+		if source != "" {
+			dataset.Source = source
+		}
+
+		if dataset.ImportDestination == datasets.ImportDestinationRealtimeQueue {
+			go refreshRealtimeDataset(dataset)
+			continue
+		}
+
+		if err := manager.ImportDataset(&dataset, true); err != nil {
+			return err
+		}
+
+		importedStatic = true
+	}
+
+	if importedStatic {
+		if err := datalinker.NewStopsLinker().Run(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func refreshRealtimeDataset(dataset datasets.DataSet) {
+	refreshInterval := dataset.RefreshInterval
+	if refreshInterval.Seconds() <= 0 {
+		refreshInterval = 30 * time.Second
+	}
+
+	for {
+		if err := manager.ImportDataset(&dataset, true); err != nil {
+			log.Error().Err(err).Str("dataset", dataset.Identifier).Msg("Failed to import realtime dataset")
+		}
+
+		time.Sleep(refreshInterval)
+	}
+}
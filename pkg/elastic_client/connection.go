@@ -59,10 +59,7 @@ func Connect(required bool) error {
 
 	Client = es
 
-	bulkIndexer, err = esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
-		Client:        es,               // The Elasticsearch client
-		FlushInterval: 15 * time.Second, // The periodic flush interval
-	})
+	bulkIndexer, err = newBulkIndexer()
 	if err != nil {
 		return err
 	}
@@ -72,6 +69,13 @@ func Connect(required bool) error {
 	return nil
 }
 
+func newBulkIndexer() (esutil.BulkIndexer, error) {
+	return esutil.NewBulkIndexer(esutil.BulkIndexerConfig{
+		Client:        Client,           // The Elasticsearch client
+		FlushInterval: 15 * time.Second, // The periodic flush interval
+	})
+}
+
 func IndexRequest(indexName string, document io.ReadSeeker) {
 	if Client == nil {
 		return
@@ -94,6 +98,18 @@ func IndexRequest(indexName string, document io.ReadSeeker) {
 	)
 }
 
+// WaitUntilQueueEmpty flushes everything queued so far, a fresh bulk indexer is
+// started afterwards so long running processes can keep indexing
 func WaitUntilQueueEmpty() {
+	if Client == nil {
+		return
+	}
+
 	bulkIndexer.Close(context.Background())
+
+	var err error
+	bulkIndexer, err = newBulkIndexer()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to restart bulk indexer")
+	}
 }
@@ -12,6 +12,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	dataaggregator "github.com/travigo/travigo/pkg/dataaggregator/global"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 )
@@ -31,17 +32,23 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
 					dataaggregator.Setup()
 
-					redisConsumer := consumer.RedisConsumer{
+					eventsBatchConsumer := NewEventsBatchConsumer()
+					go eventsBatchConsumer.StartReleasingPendingNotifications()
+
+					queueConsumer := consumer.QueueConsumer{
 						QueueName:       "events-queue",
 						NumberConsumers: 5,
 						BatchSize:       20,
 						Timeout:         2 * time.Second,
-						Consumer:        NewEventsBatchConsumer(),
+						Consumer:        eventsBatchConsumer,
 					}
-					redisConsumer.Setup()
+					queueConsumer.Setup()
 
 					signals := make(chan os.Signal, 1)
 					signal.Notify(signals, syscall.SIGINT)
@@ -53,7 +60,7 @@ func RegisterCLI() *cli.Command {
 						os.Exit(1)
 					}()
 
-					<-redis_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+					<-queue_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
 
 					return nil
 				},
@@ -65,6 +72,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
 					serviceAlert := ctdf.ServiceAlert{
 						PrimaryIdentifier: "GB:SERVICEALERT:TEST",
@@ -77,7 +87,7 @@ func RegisterCLI() *cli.Command {
 						MatchedIdentifiers: []string{"gb-noc-TFLO:1-NTN-_-y05-590847:1-NTN-_-y05-590847"},
 					}
 
-					eventsQueue, err := redis_client.QueueConnection.OpenQueue("events-queue")
+					eventsQueue, err := queue_client.QueueConnection.OpenQueue("events-queue")
 					if err != nil {
 						log.Fatal().Err(err).Msg("Failed to start event queue")
 					}
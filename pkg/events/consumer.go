@@ -4,23 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/expr-lang/expr"
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"go.mongodb.org/mongo-driver/bson"
 
 	"github.com/adjust/rmq/v5"
 )
 
 type EventsBatchConsumer struct {
-	NotifyQueue rmq.Queue
+	NotifyQueue queue_client.Queue
 }
 
 func NewEventsBatchConsumer() *EventsBatchConsumer {
-	notifyQueue, err := redis_client.QueueConnection.OpenQueue("notify-queue")
+	notifyQueue, err := queue_client.QueueConnection.OpenQueue("notify-queue")
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start notify queue")
 	}
@@ -43,9 +44,24 @@ func (c *EventsBatchConsumer) Consume(batch rmq.Deliveries) {
 
 		log.Info().Str("type", fmt.Sprintf("%s", event.Type)).Msg("Received event")
 
+		if event.Type == ctdf.EventTypeRealtimeJourneyCompleted {
+			expireJourneyTracking(&event)
+		}
+
+		expressionEnv, err := event.ExpressionEnv()
+		if err != nil {
+			log.Error().Err(err).Str("type", string(event.Type)).Msg("Failed to decode event body")
+			continue
+		}
+
 		userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
 		cursor, _ := userEventSubscriptionCollection.Find(context.Background(), bson.M{
 			"eventtype": event.Type,
+			// The TTL index only runs periodically so skip anything that has expired but not been removed yet
+			"$or": bson.A{
+				bson.M{"expirydatetime": bson.M{"$exists": false}},
+				bson.M{"expirydatetime": bson.M{"$gt": time.Now()}},
+			},
 		})
 
 		for cursor.Next(context.Background()) {
@@ -56,31 +72,35 @@ func (c *EventsBatchConsumer) Consume(batch rmq.Deliveries) {
 				continue
 			}
 
-			program, err := expr.Compile(userEventSubscription.Expression, expr.AsBool(), expr.AllowUndefinedVariables())
+			program, err := userEventSubscription.CompileExpression()
 			if err != nil {
+				log.Error().Err(err).Str("subscription", userEventSubscription.PrimaryIdentifier).Msg("Failed to compile UserEventSubscription expression")
 				continue
 			}
 
-			output, err := expr.Run(program, event)
+			output, err := expr.Run(program, expressionEnv)
 			if err != nil {
 				continue
 			}
 
 			// If expression matches to true then send the notification
 			if output == true {
-				notificationData := GetNotificationData(&event)
+				notificationData, err := GetNotificationData(&event)
+				if err != nil {
+					log.Error().Err(err).Str("subscription", userEventSubscription.PrimaryIdentifier).Msg("Failed to build notification")
+					continue
+				}
 
 				notification := ctdf.Notification{
 					TargetUser: userEventSubscription.UserID,
 					Type:       userEventSubscription.NotificationType,
+					EventType:  event.Type,
 					Title:      notificationData.Title,
 					Message:    notificationData.Message,
+					Event:      &event,
 				}
 
-				notificationBytes, _ := json.Marshal(notification)
-				c.NotifyQueue.PublishBytes(notificationBytes)
-
-				log.Info().Str("user", userEventSubscription.UserID).Msg("Sending notification")
+				c.dispatchNotification(&userEventSubscription, notification)
 			}
 		}
 	}
@@ -0,0 +1,96 @@
+package events
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+// roundTripEvent publishes & receives an event the same way as the events queue
+func roundTripEvent(t *testing.T, eventType ctdf.EventType, body interface{}) ctdf.Event {
+	eventBytes, err := json.Marshal(ctdf.Event{Type: eventType, Timestamp: time.Now(), Body: body})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event ctdf.Event
+	if err := json.Unmarshal(eventBytes, &event); err != nil {
+		t.Fatal(err)
+	}
+
+	return event
+}
+
+func TestTrackingExpressionsMatchEvents(t *testing.T) {
+	runDate := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	realtimeJourney := &ctdf.RealtimeJourney{
+		PrimaryIdentifier: "test-realtime-journey",
+		JourneyRunDate:    runDate,
+		Journey: &ctdf.Journey{
+			PrimaryIdentifier: "test-journey",
+			ServiceRef:        "test-service",
+			Path: []*ctdf.JourneyPathItem{
+				{OriginStopRef: "test-stop-a", DestinationStopRef: "test-stop-b"},
+			},
+		},
+	}
+
+	bodies := map[ctdf.EventType]interface{}{
+		ctdf.EventTypeRealtimeJourneyCancelled:       realtimeJourney,
+		ctdf.EventTypeRealtimeJourneyReinstated:      realtimeJourney,
+		ctdf.EventTypeRealtimeJourneyPlatformSet:     &ctdf.RealtimeJourneyPlatformEventBody{RealtimeJourney: realtimeJourney, Stop: "test-stop-a", NewPlatform: "1"},
+		ctdf.EventTypeRealtimeJourneyPlatformChanged: &ctdf.RealtimeJourneyPlatformEventBody{RealtimeJourney: realtimeJourney, Stop: "test-stop-a", OldPlatform: "1", NewPlatform: "2"},
+		ctdf.EventTypeRealtimeJourneyNextStopChanged: &ctdf.RealtimeJourneyNextStopEventBody{RealtimeJourney: realtimeJourney, NextStop: "test-stop-b"},
+		ctdf.EventTypeRealtimeJourneyStopCancelled:   &ctdf.RealtimeJourneyStopEventBody{RealtimeJourney: realtimeJourney, Stop: "test-stop-a"},
+		ctdf.EventTypeRealtimeJourneyDelayed:         &ctdf.RealtimeJourneyDelayEventBody{RealtimeJourney: realtimeJourney, Delay: 12, Threshold: 10},
+		ctdf.EventTypeRealtimeJourneyDelayReduced:    &ctdf.RealtimeJourneyDelayEventBody{RealtimeJourney: realtimeJourney, OldDelay: 12, Delay: 2},
+	}
+
+	for _, trackingSubscription := range []ctdf.UserJourneyTrackingSubscription{
+		{PrimaryIdentifier: "journey", JourneyRef: "test-journey", JourneyRunDate: runDate},
+		{PrimaryIdentifier: "stop", StopRef: "test-stop-a", ServiceRef: "test-service"},
+	} {
+		for _, subscription := range trackingSubscription.GenerateEventSubscriptions() {
+			program, err := subscription.CompileExpression()
+			if err != nil {
+				t.Fatalf("expected %s to compile, got %s", subscription.Expression, err)
+			}
+
+			event := roundTripEvent(t, subscription.EventType, bodies[subscription.EventType])
+			expressionEnv, err := event.ExpressionEnv()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := expr.Run(program, expressionEnv)
+			if err != nil || output != true {
+				t.Errorf("expected %s to match the %s event, got %v %v", subscription.Expression, subscription.EventType, output, err)
+			}
+		}
+	}
+}
+
+func TestSubscriptionExpressionsAreCheckedAgainstEventBody(t *testing.T) {
+	for _, test := range []struct {
+		subscription ctdf.UserEventSubscription
+		valid        bool
+	}{
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeRealtimeJourneyDelayed, Expression: `Body.Delay >= 10`}, true},
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeServiceAlertCreated, Expression: `Body.AlertType == "Closure"`}, true},
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeTimetableChanged, Expression: `Body.DataSetID == "test-dataset"`}, true},
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeRealtimeJourneyDelayed, Expression: `Body.NextStop == "test-stop"`}, false},
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeRealtimeJourneyDelayed, Expression: `Body.Delay == "10"`}, false},
+		{ctdf.UserEventSubscription{EventType: ctdf.EventTypeServiceAlertCreated, Expression: `Body.RealtimeJourney != nil`}, false},
+	} {
+		_, err := test.subscription.CompileExpression()
+		if test.valid && err != nil {
+			t.Errorf("expected %s on %s to compile, got %s", test.subscription.Expression, test.subscription.EventType, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("expected %s on %s to fail to compile", test.subscription.Expression, test.subscription.EventType)
+		}
+	}
+}
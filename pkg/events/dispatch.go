@@ -0,0 +1,157 @@
+package events
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// dispatchNotification applies deduplication, quiet hours & digests before sending a notification
+func (c *EventsBatchConsumer) dispatchNotification(subscription *ctdf.UserEventSubscription, notification ctdf.Notification) {
+	now := time.Now()
+
+	preferences := getUserNotificationPreferences(subscription.UserID)
+
+	history := ctdf.UserNotificationHistory{
+		UserID:           subscription.UserID,
+		SubscriptionRef:  subscription.PrimaryIdentifier,
+		EventType:        notification.EventType,
+		NotificationType: notification.Type,
+		Title:            notification.Title,
+		Message:          notification.Message,
+		Status:           ctdf.UserNotificationHistoryStatusSent,
+		CreationDateTime: now,
+	}
+
+	dedupWindow := preferences.DedupWindow()
+	if subscription.DedupWindowMinutes > 0 {
+		dedupWindow = time.Duration(subscription.DedupWindowMinutes) * time.Minute
+	}
+
+	dedupKey := notificationDedupKey(subscription, notification)
+
+	if isDuplicateNotification(dedupKey, dedupWindow) {
+		log.Debug().Str("user", subscription.UserID).Msg("Suppressing duplicate notification")
+
+		history.Status = ctdf.UserNotificationHistoryStatusDeduplicated
+		recordNotificationHistory(history)
+		return
+	}
+
+	// Webhooks are for machines so are always sent straight away
+	if notification.Type != ctdf.NotificationTypeWebhook {
+		releaseDateTime := preferences.HoldUntil(now, getPendingDigestRelease(subscription.UserID, notification.Type))
+
+		if !releaseDateTime.IsZero() {
+			pendingNotificationCollection := database.GetCollection("pending_notifications")
+			_, err := pendingNotificationCollection.InsertOne(context.Background(), ctdf.PendingNotification{
+				UserID:           subscription.UserID,
+				SubscriptionRef:  subscription.PrimaryIdentifier,
+				Notification:     notification,
+				ReleaseDateTime:  releaseDateTime,
+				CreationDateTime: now,
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to hold notification")
+			} else {
+				log.Info().Str("user", subscription.UserID).Time("release", releaseDateTime).Msg("Holding notification")
+
+				history.Status = ctdf.UserNotificationHistoryStatusHeld
+				history.ReleaseDateTime = releaseDateTime
+				recordNotificationHistory(history)
+				return
+			}
+		}
+	}
+
+	notificationBytes, _ := json.Marshal(notification)
+	if err := c.NotifyQueue.PublishBytes(notificationBytes); err != nil {
+		log.Error().Err(err).Str("user", subscription.UserID).Msg("Failed to publish notification")
+
+		// Nothing was sent so the next matching event shouldn't be treated as a duplicate of this one
+		releaseNotificationDedup(dedupKey)
+		return
+	}
+
+	recordNotificationHistory(history)
+
+	log.Info().Str("user", subscription.UserID).Msg("Sending notification")
+}
+
+// notificationDedupKey identifies notifications about the same thing for a user & subscription,
+// the title & message aren't used as they change with details like the current delay
+func notificationDedupKey(subscription *ctdf.UserEventSubscription, notification ctdf.Notification) string {
+	subscriptionRef := subscription.PrimaryIdentifier
+	if subscriptionRef == "" {
+		subscriptionRef = subscription.Expression
+	}
+
+	var subject string
+	if notification.Event != nil {
+		subject = GetEventSubject(notification.Event)
+	}
+
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%s|%s|%s", subscription.UserID, subscriptionRef, notification.Type, notification.EventType, subject)))
+
+	return fmt.Sprintf("notificationdedup/%s", hex.EncodeToString(hash[:]))
+}
+
+// isDuplicateNotification uses a Redis key per dedup key that lives for the dedup window
+func isDuplicateNotification(key string, window time.Duration) bool {
+	isNew, err := redis_client.Client.SetNX(context.Background(), key, 1, window).Result()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check notification dedup")
+		return false
+	}
+
+	return !isNew
+}
+
+func releaseNotificationDedup(key string) {
+	if err := redis_client.Client.Del(context.Background(), key).Err(); err != nil {
+		log.Error().Err(err).Msg("Failed to release notification dedup")
+	}
+}
+
+func getUserNotificationPreferences(userID string) *ctdf.UserNotificationPreferences {
+	var preferences *ctdf.UserNotificationPreferences
+
+	userNotificationPreferencesCollection := database.GetCollection("user_notification_preferences")
+	userNotificationPreferencesCollection.FindOne(context.Background(), bson.M{"userid": userID}).Decode(&preferences)
+
+	return preferences
+}
+
+// getPendingDigestRelease finds the release time of a digest already being built up for the user
+func getPendingDigestRelease(userID string, notificationType ctdf.NotificationType) time.Time {
+	var pendingNotification *ctdf.PendingNotification
+
+	pendingNotificationCollection := database.GetCollection("pending_notifications")
+	pendingNotificationCollection.FindOne(context.Background(), bson.M{
+		"userid":            userID,
+		"notification.type": notificationType,
+	}, options.FindOne().SetSort(bson.D{{Key: "releasedatetime", Value: -1}})).Decode(&pendingNotification)
+
+	if pendingNotification == nil {
+		return time.Time{}
+	}
+
+	return pendingNotification.ReleaseDateTime
+}
+
+func recordNotificationHistory(history ctdf.UserNotificationHistory) {
+	userNotificationHistoryCollection := database.GetCollection("user_notification_history")
+	if _, err := userNotificationHistoryCollection.InsertOne(context.Background(), history); err != nil {
+		log.Error().Err(err).Msg("Failed to record notification history")
+	}
+}
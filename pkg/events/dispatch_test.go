@@ -0,0 +1,82 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestNotificationDedupKey(t *testing.T) {
+	subscription := &ctdf.UserEventSubscription{UserID: "test-user", PrimaryIdentifier: "test-subscription"}
+
+	delayed := func(realtimeJourney string, delay int) ctdf.Notification {
+		return ctdf.Notification{
+			Type:      ctdf.NotificationTypePush,
+			EventType: ctdf.EventTypeRealtimeJourneyDelayed,
+			Message:   "The journey is now running late",
+			Event: &ctdf.Event{
+				Type: ctdf.EventTypeRealtimeJourneyDelayed,
+				Body: map[string]interface{}{
+					"RealtimeJourney": map[string]interface{}{"PrimaryIdentifier": realtimeJourney},
+					"Delay":           float64(delay),
+				},
+			},
+		}
+	}
+
+	first := notificationDedupKey(subscription, delayed("journey-a", 5))
+
+	repeated := delayed("journey-a", 10)
+	repeated.Message = "The journey is now running later"
+	if notificationDedupKey(subscription, repeated) != first {
+		t.Error("expected a notification for the same event type & journey to share a dedup key")
+	}
+
+	if notificationDedupKey(subscription, delayed("journey-b", 5)) == first {
+		t.Error("expected a notification for a different journey to have a different dedup key")
+	}
+
+	reduced := delayed("journey-a", 5)
+	reduced.EventType = ctdf.EventTypeRealtimeJourneyDelayReduced
+	reduced.Event.Type = ctdf.EventTypeRealtimeJourneyDelayReduced
+	if notificationDedupKey(subscription, reduced) == first {
+		t.Error("expected a notification for a different event type to have a different dedup key")
+	}
+}
+
+func TestGetEventSubject(t *testing.T) {
+	for _, test := range []struct {
+		event   ctdf.Event
+		subject string
+	}{
+		{ctdf.Event{Type: ctdf.EventTypeServiceAlertCreated, Body: map[string]interface{}{"PrimaryIdentifier": "alert"}}, "alert"},
+		{ctdf.Event{Type: ctdf.EventTypeRealtimeJourneyCancelled, Body: map[string]interface{}{"PrimaryIdentifier": "journey"}}, "journey"},
+		{ctdf.Event{Type: ctdf.EventTypeTimetableChanged, Body: map[string]interface{}{"DataSetID": "dataset"}}, "dataset"},
+		{ctdf.Event{Type: ctdf.EventTypeRealtimeJourneyPlatformChanged, Body: map[string]interface{}{
+			"RealtimeJourney": map[string]interface{}{"PrimaryIdentifier": "journey"},
+			"Stop":            "stop",
+		}}, "journey/stop"},
+		{ctdf.Event{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: map[string]interface{}{
+			"RealtimeJourney": map[string]interface{}{"PrimaryIdentifier": "journey"},
+			"NextStop":        "stop",
+		}}, "journey/stop"},
+		{ctdf.Event{Type: ctdf.EventTypeRealtimeJourneyStarted, Body: "not a map"}, ""},
+	} {
+		if subject := GetEventSubject(&test.event); subject != test.subject {
+			t.Errorf("expected %s subject to be %s, got %s", test.event.Type, test.subject, subject)
+		}
+	}
+}
+
+func TestCombineNotificationsKeepsEventType(t *testing.T) {
+	cancelled := ctdf.Notification{TargetUser: "test-user", Type: ctdf.NotificationTypeEmail, EventType: ctdf.EventTypeRealtimeJourneyCancelled}
+	delayed := ctdf.Notification{TargetUser: "test-user", Type: ctdf.NotificationTypeEmail, EventType: ctdf.EventTypeRealtimeJourneyDelayed}
+
+	if combined := combineNotifications([]ctdf.Notification{cancelled, cancelled}); combined.EventType != ctdf.EventTypeRealtimeJourneyCancelled {
+		t.Errorf("expected the shared event type, got %s", combined.EventType)
+	}
+
+	if combined := combineNotifications([]ctdf.Notification{cancelled, delayed}); combined.EventType != ctdf.EventTypeDigest {
+		t.Errorf("expected a digest event type for mixed event types, got %s", combined.EventType)
+	}
+}
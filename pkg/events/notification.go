@@ -1,6 +1,7 @@
 package events
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -10,32 +11,58 @@ import (
 	"github.com/travigo/travigo/pkg/dataaggregator/query"
 )
 
-func GetNotificationData(e *ctdf.Event) ctdf.EventNotificationData {
+// GetNotificationData builds the title & message for an event, events with a body missing the fields
+// needed for their type return an error rather than being sent with a broken message
+func GetNotificationData(e *ctdf.Event) (ctdf.EventNotificationData, error) {
 	eventNotificationData := ctdf.EventNotificationData{}
 
-	eventBody := e.Body.(map[string]interface{})
+	eventBody, ok := e.Body.(map[string]interface{})
+	if !ok {
+		return eventNotificationData, errors.New(fmt.Sprintf("%s event body is %T not an object", e.Type, e.Body))
+	}
 
 	switch e.Type {
 	case ctdf.EventTypeServiceAlertCreated:
-		eventNotificationData.Title = eventBody["AlertType"].(string)
-		eventNotificationData.Message = eventBody["Text"].(string)
+		alertType, err := bodyString(e, eventBody, "AlertType")
+		if err != nil {
+			return eventNotificationData, err
+		}
+		text, err := bodyString(e, eventBody, "Text")
+		if err != nil {
+			return eventNotificationData, err
+		}
+
+		eventNotificationData.Title = alertType
+		eventNotificationData.Message = text
 
-		title := eventBody["Title"].(string)
-		if title != "" {
+		if title, _ := eventBody["Title"].(string); title != "" {
 			eventNotificationData.Title = title
 		}
 	case ctdf.EventTypeRealtimeJourneyCancelled:
 		eventNotificationData.Title = "Journey cancelled"
 
-		journey := eventBody["Journey"].(map[string]interface{})
+		journey, err := bodyObject(e, eventBody, "Journey")
+		if err != nil {
+			return eventNotificationData, err
+		}
 
-		departureTime, _ := time.Parse(time.RFC3339, journey["DepartureTime"].(string))
+		departureTimeString, _ := journey["DepartureTime"].(string)
+		departureTime, _ := time.Parse(time.RFC3339, departureTimeString)
 		departureTimeText := departureTime.Format("15:04")
 
-		journeyRunDate, _ := time.Parse(time.RFC3339, eventBody["JourneyRunDate"].(string))
+		journeyRunDateString, _ := eventBody["JourneyRunDate"].(string)
+		journeyRunDate, _ := time.Parse(time.RFC3339, journeyRunDateString)
 		journeyRunDateText := journeyRunDate.Format("02/01")
 
-		origin := journey["Path"].([]interface{})[0].(map[string]interface{})["OriginStopRef"].(string)
+		var origin string
+		if path, _ := journey["Path"].([]interface{}); len(path) > 0 {
+			if firstPathItem, ok := path[0].(map[string]interface{}); ok {
+				origin, _ = firstPathItem["OriginStopRef"].(string)
+			}
+		}
+		if origin == "" {
+			return eventNotificationData, errors.New(fmt.Sprintf("%s event journey has no origin", e.Type))
+		}
 
 		destination := journey["DestinationDisplay"]
 		eventNotificationData.Message = fmt.Sprintf("The %s %s to %s from %s has been cancelled.", journeyRunDateText, departureTimeText, destination, origin)
@@ -47,25 +74,20 @@ func GetNotificationData(e *ctdf.Event) ctdf.EventNotificationData {
 	case ctdf.EventTypeRealtimeJourneyPlatformSet, ctdf.EventTypeRealtimeJourneyPlatformChanged:
 		eventNotificationData.Title = "Platform Update"
 
-		realtimeJourney := eventBody["RealtimeJourney"].(map[string]interface{})
-		journey := realtimeJourney["Journey"].(map[string]interface{})
-		originStopID := eventBody["Stop"].(string)
-
-		var stop *ctdf.Stop
-		stop, err := dataaggregator.Lookup[*ctdf.Stop](query.Stop{
-			Identifier: originStopID,
-		})
+		journey, err := realtimeJourneyJourney(e, eventBody)
 		if err != nil {
-			log.Error().Err(err).Str("stop", originStopID).Msg("Failed to lookup stop")
+			return eventNotificationData, err
+		}
+		originStopID, err := bodyString(e, eventBody, "Stop")
+		if err != nil {
+			return eventNotificationData, err
 		}
 
-		departureTime, _ := time.Parse(time.RFC3339, journey["DepartureTime"].(string))
+		departureTimeString, _ := journey["DepartureTime"].(string)
+		departureTime, _ := time.Parse(time.RFC3339, departureTimeString)
 		departureTimeText := departureTime.Format("15:04")
 		destination := journey["DestinationDisplay"]
-		originStop := originStopID
-		if stop != nil {
-			originStop = stop.PrimaryName
-		}
+		originStop := lookupStopName(originStopID)
 		platform := eventBody["NewPlatform"]
 
 		if e.Type == ctdf.EventTypeRealtimeJourneyPlatformSet {
@@ -74,7 +96,184 @@ func GetNotificationData(e *ctdf.Event) ctdf.EventNotificationData {
 			oldPlatform := eventBody["OldPlatform"]
 			eventNotificationData.Message = fmt.Sprintf("The %s service to %s from %s will now be departing from platform %s instead of %s", departureTimeText, destination, originStop, platform, oldPlatform)
 		}
+	case ctdf.EventTypeRealtimeJourneyNextStopChanged:
+		eventNotificationData.Title = "Journey Update"
+
+		journey, err := realtimeJourneyJourney(e, eventBody)
+		if err != nil {
+			return eventNotificationData, err
+		}
+		nextStopID, err := bodyString(e, eventBody, "NextStop")
+		if err != nil {
+			return eventNotificationData, err
+		}
+
+		nextStop := lookupStopName(nextStopID)
+
+		departureTimeString, _ := journey["DepartureTime"].(string)
+		departureTime, _ := time.Parse(time.RFC3339, departureTimeString)
+		departureTimeText := departureTime.Format("15:04")
+		destination := journey["DestinationDisplay"]
+
+		eventNotificationData.Message = fmt.Sprintf("The %s service to %s is now approaching %s", departureTimeText, destination, nextStop)
+	case ctdf.EventTypeRealtimeJourneyReinstated:
+		eventNotificationData.Title = "Journey reinstated"
+		eventNotificationData.Message = fmt.Sprintf("The %s has been reinstated and will now run as planned", describeRealtimeJourney(eventBody))
+	case ctdf.EventTypeRealtimeJourneyStopCancelled:
+		eventNotificationData.Title = "Stop cancelled"
+
+		realtimeJourney, err := bodyObject(e, eventBody, "RealtimeJourney")
+		if err != nil {
+			return eventNotificationData, err
+		}
+		stopID, err := bodyString(e, eventBody, "Stop")
+		if err != nil {
+			return eventNotificationData, err
+		}
+
+		eventNotificationData.Message = fmt.Sprintf("The %s will no longer call at %s", describeRealtimeJourney(realtimeJourney), lookupStopName(stopID))
+	case ctdf.EventTypeRealtimeJourneyDelayed, ctdf.EventTypeRealtimeJourneyDelayReduced:
+		eventNotificationData.Title = "Journey delayed"
+
+		realtimeJourney, err := bodyObject(e, eventBody, "RealtimeJourney")
+		if err != nil {
+			return eventNotificationData, err
+		}
+		delay, err := bodyInt(e, eventBody, "Delay")
+		if err != nil {
+			return eventNotificationData, err
+		}
+		threshold, err := bodyInt(e, eventBody, "Threshold")
+		if err != nil {
+			return eventNotificationData, err
+		}
+
+		if e.Type == ctdf.EventTypeRealtimeJourneyDelayReduced && threshold == 0 {
+			eventNotificationData.Title = "Journey back on time"
+			eventNotificationData.Message = fmt.Sprintf("The %s is now running on time", describeRealtimeJourney(realtimeJourney))
+		} else {
+			eventNotificationData.Message = fmt.Sprintf("The %s is now running %d minutes late", describeRealtimeJourney(realtimeJourney), delay)
+		}
+	case ctdf.EventTypeRealtimeJourneyStarted, ctdf.EventTypeRealtimeJourneyCompleted:
+		realtimeJourney, err := bodyObject(e, eventBody, "RealtimeJourney")
+		if err != nil {
+			return eventNotificationData, err
+		}
+
+		if e.Type == ctdf.EventTypeRealtimeJourneyStarted {
+			eventNotificationData.Title = "Journey started"
+			eventNotificationData.Message = fmt.Sprintf("The %s has departed", describeRealtimeJourney(realtimeJourney))
+		} else {
+			eventNotificationData.Title = "Journey completed"
+			eventNotificationData.Message = fmt.Sprintf("The %s has arrived at its destination", describeRealtimeJourney(realtimeJourney))
+		}
+	case ctdf.EventTypeTimetableChanged:
+		eventNotificationData.Title = "Timetable changed"
+
+		var counts []int
+		for _, key := range []string{"JourneysAdded", "JourneysRemoved", "JourneysRetimed"} {
+			count, err := bodyInt(e, eventBody, key)
+			if err != nil {
+				return eventNotificationData, err
+			}
+			counts = append(counts, count)
+		}
+
+		services, _ := eventBody["Services"].([]interface{})
+		eventNotificationData.Message = fmt.Sprintf(
+			"%d services have changed in %s: %d journeys added, %d removed and %d retimed",
+			len(services), eventBody["DataSetID"], counts[0], counts[1], counts[2],
+		)
+	}
+
+	return eventNotificationData, nil
+}
+
+func bodyString(e *ctdf.Event, eventBody map[string]interface{}, key string) (string, error) {
+	value, ok := eventBody[key].(string)
+	if !ok {
+		return "", errors.New(fmt.Sprintf("%s event is missing %s", e.Type, key))
+	}
+
+	return value, nil
+}
+
+func bodyObject(e *ctdf.Event, eventBody map[string]interface{}, key string) (map[string]interface{}, error) {
+	value, ok := eventBody[key].(map[string]interface{})
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("%s event is missing %s", e.Type, key))
+	}
+
+	return value, nil
+}
+
+// bodyInt reads a number, which will have been decoded from JSON as a float64
+func bodyInt(e *ctdf.Event, eventBody map[string]interface{}, key string) (int, error) {
+	value, ok := eventBody[key].(float64)
+	if !ok {
+		return 0, errors.New(fmt.Sprintf("%s event is missing %s", e.Type, key))
+	}
+
+	return int(value), nil
+}
+
+// realtimeJourneyJourney finds the scheduled journey of the realtime journey an event is about
+func realtimeJourneyJourney(e *ctdf.Event, eventBody map[string]interface{}) (map[string]interface{}, error) {
+	realtimeJourney, err := bodyObject(e, eventBody, "RealtimeJourney")
+	if err != nil {
+		return nil, err
+	}
+
+	return bodyObject(e, realtimeJourney, "Journey")
+}
+
+// GetEventSubject identifies the record an event is about eg. the realtime journey & stop for a platform change,
+// so notifications for repeated events about the same thing can be deduplicated
+func GetEventSubject(e *ctdf.Event) string {
+	eventBody, _ := e.Body.(map[string]interface{})
+
+	switch e.Type {
+	case ctdf.EventTypeServiceAlertCreated, ctdf.EventTypeRealtimeJourneyCancelled, ctdf.EventTypeRealtimeJourneyReinstated:
+		subject, _ := eventBody["PrimaryIdentifier"].(string)
+		return subject
+	case ctdf.EventTypeTimetableChanged:
+		subject, _ := eventBody["DataSetID"].(string)
+		return subject
+	}
+
+	realtimeJourney, _ := eventBody["RealtimeJourney"].(map[string]interface{})
+	subject, _ := realtimeJourney["PrimaryIdentifier"].(string)
+
+	for _, stopKey := range []string{"Stop", "NextStop"} {
+		if stop, _ := eventBody[stopKey].(string); stop != "" {
+			subject = fmt.Sprintf("%s/%s", subject, stop)
+		}
+	}
+
+	return subject
+}
+
+// describeRealtimeJourney gives the "15:04 service to Destination" description used in notifications
+func describeRealtimeJourney(realtimeJourney map[string]interface{}) string {
+	journey, _ := realtimeJourney["Journey"].(map[string]interface{})
+	if journey == nil {
+		return "service"
+	}
+
+	departureTimeString, _ := journey["DepartureTime"].(string)
+	departureTime, _ := time.Parse(time.RFC3339, departureTimeString)
+
+	return fmt.Sprintf("%s service to %s", departureTime.Format("15:04"), journey["DestinationDisplay"])
+}
+
+func lookupStopName(stopID string) string {
+	stop, err := dataaggregator.Lookup[*ctdf.Stop](query.Stop{
+		Identifier: stopID,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("stop", stopID).Msg("Failed to lookup stop")
+		return stopID
 	}
 
-	return eventNotificationData
+	return stop.PrimaryName
 }
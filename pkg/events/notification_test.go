@@ -0,0 +1,49 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestGetNotificationDataRejectsMalformedBodies(t *testing.T) {
+	realtimeJourney := map[string]interface{}{
+		"Journey": map[string]interface{}{"DepartureTime": "2024-03-05T08:15:00Z", "DestinationDisplay": "Leeds"},
+	}
+
+	for _, event := range []ctdf.Event{
+		{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: "not an object"},
+		{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: map[string]interface{}{"NextStop": "test-stop"}},
+		{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: map[string]interface{}{"RealtimeJourney": map[string]interface{}{}, "NextStop": "test-stop"}},
+		{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: map[string]interface{}{"RealtimeJourney": realtimeJourney}},
+		{Type: ctdf.EventTypeRealtimeJourneyNextStopChanged, Body: map[string]interface{}{"RealtimeJourney": realtimeJourney, "NextStop": 5}},
+		{Type: ctdf.EventTypeRealtimeJourneyCancelled, Body: map[string]interface{}{"Journey": map[string]interface{}{"Path": []interface{}{}}}},
+		{Type: ctdf.EventTypeRealtimeJourneyDelayed, Body: map[string]interface{}{"RealtimeJourney": realtimeJourney, "Delay": "5"}},
+		{Type: ctdf.EventTypeServiceAlertCreated, Body: map[string]interface{}{"Text": "Closed"}},
+		{Type: ctdf.EventTypeTimetableChanged, Body: map[string]interface{}{"DataSetID": "test-dataset"}},
+	} {
+		if _, err := GetNotificationData(&event); err == nil {
+			t.Errorf("expected %s event with body %v to fail", event.Type, event.Body)
+		}
+	}
+}
+
+func TestGetNotificationData(t *testing.T) {
+	notificationData, err := GetNotificationData(&ctdf.Event{
+		Type: ctdf.EventTypeRealtimeJourneyDelayed,
+		Body: map[string]interface{}{
+			"RealtimeJourney": map[string]interface{}{
+				"Journey": map[string]interface{}{"DepartureTime": "2024-03-05T08:15:00Z", "DestinationDisplay": "Leeds"},
+			},
+			"Delay":     float64(12),
+			"Threshold": float64(10),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if notificationData.Message != "The 08:15 service to Leeds is now running 12 minutes late" {
+		t.Errorf("unexpected message %s", notificationData.Message)
+	}
+}
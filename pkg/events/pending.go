@@ -0,0 +1,130 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type pendingNotificationRecord struct {
+	ID                       primitive.ObjectID `bson:"_id"`
+	ctdf.PendingNotification `bson:",inline"`
+}
+
+// StartReleasingPendingNotifications periodically sends notifications held back for quiet hours or digests
+func (c *EventsBatchConsumer) StartReleasingPendingNotifications() {
+	for {
+		c.releasePendingNotifications()
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+func (c *EventsBatchConsumer) releasePendingNotifications() {
+	pendingNotificationCollection := database.GetCollection("pending_notifications")
+
+	cursor, err := pendingNotificationCollection.Find(context.Background(), bson.M{
+		"releasedatetime": bson.M{"$lte": time.Now()},
+	}, options.Find().SetSort(bson.D{{Key: "creationdatetime", Value: 1}}))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to find pending notifications")
+		return
+	}
+
+	var pendingNotifications []pendingNotificationRecord
+	if err := cursor.All(context.Background(), &pendingNotifications); err != nil {
+		log.Error().Err(err).Msg("Failed to decode pending notifications")
+		return
+	}
+
+	var groupOrder []string
+	groups := map[string][]pendingNotificationRecord{}
+
+	for _, pendingNotification := range pendingNotifications {
+		// Claim the notification by deleting it so that multiple events servers don't send it twice
+		result, err := pendingNotificationCollection.DeleteOne(context.Background(), bson.M{"_id": pendingNotification.ID})
+		if err != nil || result.DeletedCount == 0 {
+			continue
+		}
+
+		groupKey := fmt.Sprintf("%s/%s", pendingNotification.UserID, pendingNotification.Notification.Type)
+		if _, exists := groups[groupKey]; !exists {
+			groupOrder = append(groupOrder, groupKey)
+		}
+		groups[groupKey] = append(groups[groupKey], pendingNotification)
+	}
+
+	for _, groupKey := range groupOrder {
+		var notifications []ctdf.Notification
+		for _, pendingNotification := range groups[groupKey] {
+			notifications = append(notifications, pendingNotification.Notification)
+		}
+
+		notification := combineNotifications(notifications)
+
+		notificationBytes, _ := json.Marshal(notification)
+		if err := c.NotifyQueue.PublishBytes(notificationBytes); err != nil {
+			log.Error().Err(err).Str("user", notification.TargetUser).Msg("Failed to publish held notifications")
+
+			// Put them back so they're tried again on the next release
+			for _, pendingNotification := range groups[groupKey] {
+				if _, err := pendingNotificationCollection.InsertOne(context.Background(), pendingNotification); err != nil {
+					log.Error().Err(err).Msg("Failed to hold notification")
+				}
+			}
+			continue
+		}
+
+		now := time.Now()
+		for _, pendingNotification := range groups[groupKey] {
+			recordNotificationHistory(ctdf.UserNotificationHistory{
+				UserID:           pendingNotification.UserID,
+				SubscriptionRef:  pendingNotification.SubscriptionRef,
+				EventType:        pendingNotification.Notification.EventType,
+				NotificationType: pendingNotification.Notification.Type,
+				Title:            pendingNotification.Notification.Title,
+				Message:          pendingNotification.Notification.Message,
+				Status:           ctdf.UserNotificationHistoryStatusSent,
+				CreationDateTime: now,
+			})
+		}
+
+		log.Info().Str("user", notification.TargetUser).Int("count", len(groups[groupKey])).Msg("Released held notifications")
+	}
+}
+
+// combineNotifications merges a set of held notifications into a single digest notification,
+// it keeps their event type if they all share one so the matching email template is still used
+func combineNotifications(notifications []ctdf.Notification) ctdf.Notification {
+	if len(notifications) == 1 {
+		return notifications[0]
+	}
+
+	eventType := notifications[0].EventType
+
+	var lines []string
+	for _, notification := range notifications {
+		lines = append(lines, fmt.Sprintf("%s: %s", notification.Title, notification.Message))
+
+		if notification.EventType != eventType {
+			eventType = ctdf.EventTypeDigest
+		}
+	}
+
+	return ctdf.Notification{
+		TargetUser: notifications[0].TargetUser,
+		Type:       notifications[0].Type,
+		EventType:  eventType,
+		Title:      fmt.Sprintf("%d travel updates", len(notifications)),
+		Message:    strings.Join(lines, "\n"),
+	}
+}
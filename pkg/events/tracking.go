@@ -0,0 +1,65 @@
+package events
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// expireJourneyTracking removes the journey tracking subscriptions following a journey once it has completed
+func expireJourneyTracking(event *ctdf.Event) {
+	eventBody, _ := event.Body.(map[string]interface{})
+	realtimeJourney, _ := eventBody["RealtimeJourney"].(map[string]interface{})
+	journey, _ := realtimeJourney["Journey"].(map[string]interface{})
+	if journey == nil {
+		return
+	}
+
+	journeyRef, _ := journey["PrimaryIdentifier"].(string)
+	journeyRunDateString, _ := realtimeJourney["JourneyRunDate"].(string)
+	journeyRunDate, err := time.Parse(time.RFC3339, journeyRunDateString)
+	if journeyRef == "" || err != nil {
+		return
+	}
+
+	runDate := time.Date(journeyRunDate.Year(), journeyRunDate.Month(), journeyRunDate.Day(), 0, 0, 0, 0, time.UTC)
+
+	trackingSubscriptionCollection := database.GetCollection("user_journey_tracking_subscription")
+	cursor, err := trackingSubscriptionCollection.Find(context.Background(), bson.M{
+		"journeyref":     journeyRef,
+		"journeyrundate": bson.M{"$gte": runDate, "$lt": runDate.AddDate(0, 0, 1)},
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to find journey tracking subscriptions")
+		return
+	}
+
+	var trackingSubscriptions []ctdf.UserJourneyTrackingSubscription
+	if err := cursor.All(context.Background(), &trackingSubscriptions); err != nil {
+		log.Error().Err(err).Msg("Failed to decode journey tracking subscriptions")
+		return
+	}
+
+	if len(trackingSubscriptions) == 0 {
+		return
+	}
+
+	var trackingSubscriptionRefs bson.A
+	for _, trackingSubscription := range trackingSubscriptions {
+		trackingSubscriptionRefs = append(trackingSubscriptionRefs, trackingSubscription.PrimaryIdentifier)
+	}
+
+	userEventSubscriptionCollection := database.GetCollection("user_event_subscription")
+	userEventSubscriptionCollection.DeleteMany(context.Background(), bson.M{
+		"trackingsubscriptionref": bson.M{"$in": trackingSubscriptionRefs},
+	})
+	trackingSubscriptionCollection.DeleteMany(context.Background(), bson.M{
+		"primaryidentifier": bson.M{"$in": trackingSubscriptionRefs},
+	})
+
+	log.Info().Str("journey", journeyRef).Int("subscriptions", len(trackingSubscriptions)).Msg("Expired journey tracking subscriptions")
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/travigo/travigo/pkg/consumer"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 )
@@ -30,6 +31,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
 					pushManager := &PushManager{}
 					err := pushManager.Setup()
@@ -37,14 +41,26 @@ func RegisterCLI() *cli.Command {
 						return err
 					}
 
-					redisConsumer := consumer.RedisConsumer{
+					emailManager := &EmailManager{}
+					err = emailManager.Setup()
+					if err != nil {
+						return err
+					}
+
+					webhookManager := &WebhookManager{}
+					err = webhookManager.Setup()
+					if err != nil {
+						return err
+					}
+
+					queueConsumer := consumer.QueueConsumer{
 						QueueName:       "notify-queue",
 						NumberConsumers: 5,
 						BatchSize:       20,
 						Timeout:         1 * time.Second,
-						Consumer:        NewNotifyBatchConsumer(pushManager),
+						Consumer:        NewNotifyBatchConsumer(pushManager, emailManager, webhookManager),
 					}
-					redisConsumer.Setup()
+					queueConsumer.Setup()
 
 					signals := make(chan os.Signal, 1)
 					signal.Notify(signals, syscall.SIGINT)
@@ -56,7 +72,7 @@ func RegisterCLI() *cli.Command {
 						os.Exit(1)
 					}()
 
-					<-redis_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+					<-queue_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
 
 					return nil
 				},
@@ -65,19 +81,34 @@ func RegisterCLI() *cli.Command {
 			{
 				Name:  "test-notification",
 				Usage: "generate a test notification",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "user",
+						Value: "auth0|651c491ffcd735ea268f65fb",
+						Usage: "user to send the notification to",
+					},
+					&cli.StringFlag{
+						Name:  "type",
+						Value: string(ctdf.NotificationTypePush),
+						Usage: "notification type to send (Push, Email or Webhook)",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
-					notifyQueue, err := redis_client.QueueConnection.OpenQueue("notify-queue")
+					notifyQueue, err := queue_client.QueueConnection.OpenQueue("notify-queue")
 					if err != nil {
 						log.Fatal().Err(err).Msg("Failed to start notify queue")
 					}
 
 					notification := ctdf.Notification{
-						TargetUser: "auth0|651c491ffcd735ea268f65fb",
-						Type:       ctdf.NotificationTypePush,
+						TargetUser: c.String("user"),
+						Type:       ctdf.NotificationType(c.String("type")),
 						Title:      "Line Suspended",
 						Message:    "Northern Line has been suspended due to a fault on the line",
 					}
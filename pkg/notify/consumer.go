@@ -3,6 +3,7 @@ package notify
 import (
 	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
@@ -10,41 +11,79 @@ import (
 	"github.com/adjust/rmq/v5"
 )
 
+// Number of notifications from a batch sent at the same time
+const notifyWorkers = 10
+
 type NotifyBatchConsumer struct {
-	PushManager *PushManager
+	PushManager    *PushManager
+	EmailManager   *EmailManager
+	WebhookManager *WebhookManager
 }
 
-func NewNotifyBatchConsumer(pushManager *PushManager) *NotifyBatchConsumer {
+func NewNotifyBatchConsumer(pushManager *PushManager, emailManager *EmailManager, webhookManager *WebhookManager) *NotifyBatchConsumer {
 	return &NotifyBatchConsumer{
-		PushManager: pushManager,
+		PushManager:    pushManager,
+		EmailManager:   emailManager,
+		WebhookManager: webhookManager,
 	}
 }
 
+// Consume sends the batch of notifications using a bounded pool of workers as webhooks can spend a while retrying.
+// Each delivery is only acked once its notification has been sent or the failure has been recorded, so anything
+// still in flight when the consumer stops is returned to the queue
 func (c *NotifyBatchConsumer) Consume(batch rmq.Deliveries) {
-	payloads := batch.Payloads()
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, notifyWorkers)
 
-	for _, payload := range payloads {
+	for _, delivery := range batch {
 		var notification ctdf.Notification
-		err := json.Unmarshal([]byte(payload), &notification)
+		if err := json.Unmarshal([]byte(delivery.Payload()), &notification); err != nil {
+			log.Error().Err(err).Msg("Failed to decode notification")
 
-		if err != nil {
+			if err := delivery.Reject(); err != nil {
+				log.Error().Err(err).Msg("Failed to reject notification")
+			}
 			continue
 		}
 
-		switch notification.Type {
-		case ctdf.NotificationTypePush:
-			err = c.PushManager.SendPush(notification)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to send Push Notification")
+		wg.Add(1)
+		workers <- struct{}{}
+
+		go func(delivery rmq.Delivery, notification ctdf.Notification) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			c.send(notification)
+
+			if err := delivery.Ack(); err != nil {
+				log.Error().Err(err).Msg("Failed to ack notification")
 			}
-		default:
-			log.Error().Str("type", fmt.Sprintf("%s", notification.Type)).Msg("Unknown notification type")
-		}
+		}(delivery, notification)
 	}
 
-	if ackErrors := batch.Ack(); len(ackErrors) > 0 {
-		for _, err := range ackErrors {
-			log.Fatal().Err(err).Msg("Failed to consume from queue")
+	wg.Wait()
+}
+
+func (c *NotifyBatchConsumer) send(notification ctdf.Notification) {
+	var err error
+
+	switch notification.Type {
+	case ctdf.NotificationTypePush:
+		err = c.PushManager.SendPush(notification)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to send Push Notification")
+		}
+	case ctdf.NotificationTypeEmail:
+		err = c.EmailManager.SendEmail(notification)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to send Email Notification")
+		}
+	case ctdf.NotificationTypeWebhook:
+		err = c.WebhookManager.SendWebhook(notification)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to send Webhook Notification")
 		}
+	default:
+		log.Error().Str("type", fmt.Sprintf("%s", notification.Type)).Msg("Unknown notification type")
 	}
 }
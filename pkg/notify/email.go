@@ -0,0 +1,302 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"embed"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+//go:embed templates/email
+var emailTemplates embed.FS
+
+type EmailManager struct {
+	Address  string
+	Username string
+	Password string
+	From     string
+
+	HTMLTemplates *htmltemplate.Template
+	TextTemplates *texttemplate.Template
+}
+
+type emailTemplateData struct {
+	Title     string
+	Message   string
+	EventType ctdf.EventType
+}
+
+func (m *EmailManager) Setup() error {
+	m.Address = os.Getenv("TRAVIGO_SMTP_ADDRESS")
+	m.Username = os.Getenv("TRAVIGO_SMTP_USERNAME")
+	m.Password = os.Getenv("TRAVIGO_SMTP_PASSWORD")
+	m.From = os.Getenv("TRAVIGO_SMTP_FROM")
+
+	if m.From == "" {
+		m.From = "notifications@travigo.app"
+	}
+
+	if m.Address == "" {
+		log.Warn().Msg("TRAVIGO_SMTP_ADDRESS not set, email notifications will not be sent")
+	}
+
+	var err error
+	m.HTMLTemplates, err = htmltemplate.ParseFS(emailTemplates, "templates/email/*.html")
+	if err != nil {
+		return err
+	}
+
+	m.TextTemplates, err = texttemplate.ParseFS(emailTemplates, "templates/email/*.txt")
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *EmailManager) SendEmail(notification ctdf.Notification) error {
+	if m.Address == "" {
+		return errors.New("email notifications are not configured")
+	}
+
+	userEmailNotificationTargetCollection := database.GetCollection("user_email_notification_target")
+	var userEmailNotificationTarget *ctdf.UserEmailNotificationTarget
+
+	userEmailNotificationTargetCollection.FindOne(context.Background(), bson.M{
+		"userid": notification.TargetUser,
+	}).Decode(&userEmailNotificationTarget)
+
+	if userEmailNotificationTarget == nil || userEmailNotificationTarget.EmailAddress == "" {
+		return errors.New("failed to find user email address")
+	}
+
+	if userEmailNotificationTarget.Bounced {
+		return errors.New("user email address has previously bounced")
+	}
+
+	message, err := m.buildMessage(notification, userEmailNotificationTarget.EmailAddress)
+	if err != nil {
+		return err
+	}
+
+	err = m.sendMail(userEmailNotificationTarget.EmailAddress, message)
+
+	m.recordDelivery(notification, userEmailNotificationTarget, err)
+
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("target", notification.TargetUser).Msg("Sent Email Notification")
+
+	return nil
+}
+
+// recipientRejectedError is returned when the mail server refuses the recipient address
+type recipientRejectedError struct {
+	err error
+}
+
+func (e *recipientRejectedError) Error() string {
+	return fmt.Sprintf("recipient rejected: %s", e.err)
+}
+
+func (e *recipientRejectedError) Unwrap() error {
+	return e.err
+}
+
+// sendMail works the same as smtp.SendMail but keeps track of which step failed so a rejected recipient
+// can be told apart from the server refusing the sender or the message
+func (m *EmailManager) sendMail(to string, message []byte) error {
+	host, _, _ := net.SplitHostPort(m.Address)
+
+	client, err := smtp.Dial(m.Address)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if m.Username != "" {
+		if ok, _ := client.Extension("AUTH"); ok {
+			if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := client.Mail(m.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return &recipientRejectedError{err: err}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(message); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// isBounce checks if the mail server permanently refused the recipient because the mailbox doesn't exist (550),
+// isn't local (551) or the address isn't allowed (553). Other failures may be temporary or down to the sender
+func isBounce(sendErr error) (int, bool) {
+	var recipientError *recipientRejectedError
+	var smtpError *textproto.Error
+
+	if !errors.As(sendErr, &recipientError) || !errors.As(sendErr, &smtpError) {
+		return 0, false
+	}
+
+	switch smtpError.Code {
+	case 550, 551, 553:
+		return smtpError.Code, true
+	default:
+		return smtpError.Code, false
+	}
+}
+
+// recordDelivery keeps a log of every email sent and tracks failures against the target
+// The mail server refusing the recipient is treated as a bounce and stops any further emails
+func (m *EmailManager) recordDelivery(notification ctdf.Notification, target *ctdf.UserEmailNotificationTarget, sendErr error) {
+	now := time.Now()
+
+	delivery := ctdf.NotificationDelivery{
+		TargetUser:       notification.TargetUser,
+		Type:             ctdf.NotificationTypeEmail,
+		EventType:        notification.EventType,
+		Target:           target.EmailAddress,
+		Status:           ctdf.NotificationDeliveryStatusSent,
+		Attempts:         1,
+		CreationDateTime: now,
+	}
+
+	targetUpdate := bson.M{"$set": bson.M{"faileddeliveries": 0}}
+
+	if sendErr != nil {
+		delivery.Status = ctdf.NotificationDeliveryStatusFailed
+		delivery.ErrorMessage = sendErr.Error()
+
+		failureUpdate := bson.M{"lastfailuremessage": sendErr.Error()}
+
+		if code, bounced := isBounce(sendErr); bounced {
+			delivery.Status = ctdf.NotificationDeliveryStatusBounced
+
+			failureUpdate["bounced"] = true
+			failureUpdate["bounceddatetime"] = now
+
+			log.Warn().Str("target", notification.TargetUser).Int("code", code).Msg("Email address bounced")
+		}
+
+		targetUpdate = bson.M{
+			"$inc": bson.M{"faileddeliveries": 1},
+			"$set": failureUpdate,
+		}
+	}
+
+	notificationDeliveryCollection := database.GetCollection("notification_deliveries")
+	if _, err := notificationDeliveryCollection.InsertOne(context.Background(), delivery); err != nil {
+		log.Error().Err(err).Msg("Failed to record notification delivery")
+	}
+
+	userEmailNotificationTargetCollection := database.GetCollection("user_email_notification_target")
+	_, err := userEmailNotificationTargetCollection.UpdateOne(context.Background(), bson.M{
+		"userid": target.UserID,
+	}, targetUpdate)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update email notification target")
+	}
+}
+
+func (m *EmailManager) buildMessage(notification ctdf.Notification, emailAddress string) ([]byte, error) {
+	templateData := emailTemplateData{
+		Title:     notification.Title,
+		Message:   notification.Message,
+		EventType: notification.EventType,
+	}
+
+	templateName := string(notification.EventType)
+	if templateName == "" || m.HTMLTemplates.Lookup(templateName+".html") == nil || m.TextTemplates.Lookup(templateName+".txt") == nil {
+		templateName = "default"
+	}
+
+	var htmlBody bytes.Buffer
+	if err := m.HTMLTemplates.ExecuteTemplate(&htmlBody, templateName+".html", templateData); err != nil {
+		return nil, err
+	}
+
+	var textBody bytes.Buffer
+	if err := m.TextTemplates.ExecuteTemplate(&textBody, templateName+".txt", templateData); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	multipartWriter := multipart.NewWriter(&body)
+
+	for _, part := range []struct {
+		contentType string
+		content     []byte
+	}{
+		{contentType: "text/plain; charset=utf-8", content: textBody.Bytes()},
+		{contentType: "text/html; charset=utf-8", content: htmlBody.Bytes()},
+	} {
+		partWriter, err := multipartWriter.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		quotedPrintableWriter := quotedprintable.NewWriter(partWriter)
+		quotedPrintableWriter.Write(part.content)
+		quotedPrintableWriter.Close()
+	}
+	multipartWriter.Close()
+
+	var message bytes.Buffer
+	headers := []string{
+		fmt.Sprintf("From: %s", m.From),
+		fmt.Sprintf("To: %s", emailAddress),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", notification.Title)),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		"MIME-Version: 1.0",
+		fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s", multipartWriter.Boundary()),
+	}
+	message.WriteString(strings.Join(headers, "\r\n"))
+	message.WriteString("\r\n\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// startSMTPServer runs a stand-in SMTP server on a local port that accepts everything apart from the
+// commands given a reply in rejections, eg. "RCPT" => "550 5.1.1 No such user"
+func startSMTPServer(t *testing.T, rejections map[string]string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSMTP(connection, rejections)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveSMTP(connection net.Conn, rejections map[string]string) {
+	defer connection.Close()
+
+	reader := bufio.NewReader(connection)
+	reply := func(line string) {
+		fmt.Fprintf(connection, "%s\r\n", line)
+	}
+
+	reply("220 localhost ESMTP stand-in")
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.Fields(line + " ")[0])
+
+		if rejection, exists := rejections[command]; exists {
+			reply(rejection)
+			continue
+		}
+
+		switch command {
+		case "EHLO", "HELO":
+			reply("250 localhost")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+			}
+
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func setupEmailTest(t *testing.T, rejections map[string]string) *EmailManager {
+	database.ConnectMemory()
+
+	t.Setenv("TRAVIGO_SMTP_ADDRESS", startSMTPServer(t, rejections))
+
+	emailManager := &EmailManager{}
+	if err := emailManager.Setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	return emailManager
+}
+
+func sendTestEmail(t *testing.T, emailManager *EmailManager, userID string) (*ctdf.UserEmailNotificationTarget, *ctdf.NotificationDelivery, error) {
+	targetCollection := database.GetCollection("user_email_notification_target")
+	targetCollection.InsertOne(context.Background(), ctdf.UserEmailNotificationTarget{
+		UserID:       userID,
+		EmailAddress: fmt.Sprintf("%s@example.com", userID),
+	})
+
+	sendErr := emailManager.SendEmail(ctdf.Notification{
+		TargetUser: userID,
+		Type:       ctdf.NotificationTypeEmail,
+		Title:      "Test",
+		Message:    "Test message",
+	})
+
+	var target *ctdf.UserEmailNotificationTarget
+	targetCollection.FindOne(context.Background(), bson.M{"userid": userID}).Decode(&target)
+
+	var delivery *ctdf.NotificationDelivery
+	database.GetCollection("notification_deliveries").FindOne(context.Background(), bson.M{"targetuser": userID}).Decode(&delivery)
+
+	if target == nil || delivery == nil {
+		t.Fatal("expected the target & delivery to be stored")
+	}
+
+	return target, delivery, sendErr
+}
+
+func TestSendEmail(t *testing.T) {
+	emailManager := setupEmailTest(t, map[string]string{})
+
+	target, delivery, err := sendTestEmail(t, emailManager, "email-sent")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if delivery.Status != ctdf.NotificationDeliveryStatusSent {
+		t.Errorf("expected the delivery to be sent, got %s", delivery.Status)
+	}
+	if target.Bounced || target.FailedDeliveries != 0 {
+		t.Error("expected the target not to have failed")
+	}
+}
+
+func TestSendEmailRecipientRejectedBounces(t *testing.T) {
+	for _, code := range []string{"550", "551", "553"} {
+		emailManager := setupEmailTest(t, map[string]string{
+			"RCPT": fmt.Sprintf("%s 5.1.1 Mailbox unavailable", code),
+		})
+
+		target, delivery, err := sendTestEmail(t, emailManager, fmt.Sprintf("email-bounced-%s", code))
+		if err == nil {
+			t.Fatal("expected the send to fail")
+		}
+
+		if delivery.Status != ctdf.NotificationDeliveryStatusBounced {
+			t.Errorf("expected %s to be a bounce, got %s", code, delivery.Status)
+		}
+		if !target.Bounced {
+			t.Errorf("expected %s to mark the address bounced", code)
+		}
+	}
+}
+
+func TestSendEmailOtherRejectionsDontBounce(t *testing.T) {
+	for name, rejections := range map[string]map[string]string{
+		"sender":    {"MAIL": "550 5.7.1 Sender rejected"},
+		"message":   {"DATA": "554 5.6.0 Message rejected"},
+		"temporary": {"RCPT": "450 4.2.1 Mailbox busy"},
+		"policy":    {"RCPT": "554 5.7.1 Relay access denied"},
+	} {
+		emailManager := setupEmailTest(t, rejections)
+
+		target, delivery, err := sendTestEmail(t, emailManager, fmt.Sprintf("email-failed-%s", name))
+		if err == nil {
+			t.Fatalf("expected the %s rejection to fail the send", name)
+		}
+
+		if delivery.Status != ctdf.NotificationDeliveryStatusFailed {
+			t.Errorf("expected the %s rejection to be a failure, got %s", name, delivery.Status)
+		}
+		if target.Bounced {
+			t.Errorf("expected the %s rejection not to mark the address bounced", name)
+		}
+		if target.FailedDeliveries != 1 {
+			t.Errorf("expected the %s rejection to count a failed delivery, got %d", name, target.FailedDeliveries)
+		}
+	}
+}
+
+func TestSendEmailSkipsBouncedAddress(t *testing.T) {
+	emailManager := setupEmailTest(t, map[string]string{"RCPT": "550 5.1.1 No such user"})
+
+	sendTestEmail(t, emailManager, "email-skip")
+
+	err := emailManager.SendEmail(ctdf.Notification{TargetUser: "email-skip", Type: ctdf.NotificationTypeEmail})
+	if err == nil || !strings.Contains(err.Error(), "bounced") {
+		t.Errorf("expected a bounced address to be skipped, got %v", err)
+	}
+}
@@ -41,15 +41,32 @@ func (m *PushManager) Setup() error {
 	return nil
 }
 
+// FCM allows at most 500 tokens in a single multicast message
+const maxMulticastTokens = 500
+
 func (m *PushManager) SendPush(notification ctdf.Notification) error {
 	userPushNotificationTargetCollection := database.GetCollection("user_push_notification_target")
-	var userPushNotificationTarget *ctdf.UserPushNotificationTarget
 
-	userPushNotificationTargetCollection.FindOne(context.Background(), bson.M{
+	cursor, err := userPushNotificationTargetCollection.Find(context.Background(), bson.M{
 		"userid": notification.TargetUser,
-	}).Decode(&userPushNotificationTarget)
+	})
+	if err != nil {
+		return err
+	}
+
+	var userPushNotificationTargets []ctdf.UserPushNotificationTarget
+	if err := cursor.All(context.Background(), &userPushNotificationTargets); err != nil {
+		return err
+	}
 
-	if userPushNotificationTarget == nil {
+	var tokens []string
+	for _, userPushNotificationTarget := range userPushNotificationTargets {
+		if userPushNotificationTarget.PushNotificationToken != "" {
+			tokens = append(tokens, userPushNotificationTarget.PushNotificationToken)
+		}
+	}
+
+	if len(tokens) == 0 {
 		return errors.New("failed to find user token")
 	}
 
@@ -59,19 +76,57 @@ func (m *PushManager) SendPush(notification ctdf.Notification) error {
 		return err
 	}
 
-	_, err = fcmClient.Send(context.Background(), &messaging.Message{
-		Notification: &messaging.Notification{
-			Title: notification.Title,
-			Body:  notification.Message,
-		},
-		Token: userPushNotificationTarget.PushNotificationToken,
-	})
+	var successCount int
+	var unregisteredTokens []string
+
+	for start := 0; start < len(tokens); start += maxMulticastTokens {
+		end := min(start+maxMulticastTokens, len(tokens))
+		batchTokens := tokens[start:end]
+
+		batchResponse, err := fcmClient.SendEachForMulticast(context.Background(), &messaging.MulticastMessage{
+			Notification: &messaging.Notification{
+				Title: notification.Title,
+				Body:  notification.Message,
+			},
+			Tokens: batchTokens,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		successCount += batchResponse.SuccessCount
+
+		for i, response := range batchResponse.Responses {
+			if response.Success {
+				continue
+			}
+
+			if messaging.IsUnregistered(response.Error) {
+				unregisteredTokens = append(unregisteredTokens, batchTokens[i])
+			} else {
+				log.Error().Err(response.Error).Str("target", notification.TargetUser).Msg("Failed to send Push Notification to device")
+			}
+		}
+	}
 
-	if err != nil {
-		return err
+	// Devices that have uninstalled the app or logged out will never receive anything again
+	if len(unregisteredTokens) > 0 {
+		_, err := userPushNotificationTargetCollection.DeleteMany(context.Background(), bson.M{
+			"pushnotificationtoken": bson.M{"$in": unregisteredTokens},
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to remove unregistered push tokens")
+		} else {
+			log.Info().Str("target", notification.TargetUser).Int("tokens", len(unregisteredTokens)).Msg("Removed unregistered push tokens")
+		}
+	}
+
+	if successCount == 0 {
+		return errors.New("failed to send push notification to any device")
 	}
 
-	log.Info().Str("target", notification.TargetUser).Msg("Sent Push Notification")
+	log.Info().Str("target", notification.TargetUser).Int("devices", successCount).Msg("Sent Push Notification")
 
 	return nil
 }
@@ -0,0 +1,273 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const webhookSignatureHeader = "X-Travigo-Signature"
+const webhookTimestampHeader = "X-Travigo-Timestamp"
+
+type WebhookManager struct {
+	Client *http.Client
+
+	MaxAttempts    int
+	InitialBackoff time.Duration
+
+	// DisableAfterFailures is the number of consecutive failed deliveries before an endpoint is disabled
+	DisableAfterFailures int
+}
+
+func (m *WebhookManager) Setup() error {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: webhookDialControl,
+	}
+
+	m.Client = &http.Client{
+		Timeout: 10 * time.Second,
+		// Proxies are skipped so the dialer always sees the address of the webhook itself
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if request.URL.Scheme != "https" {
+				return errors.New("webhook redirected to a non https URL")
+			}
+			if len(via) >= 3 {
+				return errors.New("webhook redirected too many times")
+			}
+
+			return nil
+		},
+	}
+
+	m.MaxAttempts = 5
+	m.InitialBackoff = 1 * time.Second
+	m.DisableAfterFailures = 10
+
+	return nil
+}
+
+var errWebhookAddressNotPublic = errors.New("webhook address is not public")
+
+// webhookDialControl stops webhooks from reaching internal services. It runs after the host has been resolved so
+// checks the address actually being connected to, which a hostname resolving to a different address later can't get around
+func webhookDialControl(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !isPublicAddress(ip) {
+		return errWebhookAddressNotPublic
+	}
+
+	return nil
+}
+
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64 which could map to any of the IPv4 ranges
+}
+
+func isPublicAddress(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SignWebhookPayload generates the signature sent alongside each webhook
+// Receivers should calculate the same HMAC-SHA256 over "<timestamp>.<body>" with their secret and compare
+func SignWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return fmt.Sprintf("sha256=%s", hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (m *WebhookManager) SendWebhook(notification ctdf.Notification) error {
+	userWebhookNotificationTargetCollection := database.GetCollection("user_webhook_notification_target")
+	var userWebhookNotificationTarget *ctdf.UserWebhookNotificationTarget
+
+	userWebhookNotificationTargetCollection.FindOne(context.Background(), bson.M{
+		"userid": notification.TargetUser,
+	}).Decode(&userWebhookNotificationTarget)
+
+	if userWebhookNotificationTarget == nil || userWebhookNotificationTarget.URL == "" {
+		return errors.New("failed to find user webhook")
+	}
+
+	if userWebhookNotificationTarget.Disabled {
+		return errors.New("user webhook has been disabled after repeated failures")
+	}
+
+	if !strings.HasPrefix(userWebhookNotificationTarget.URL, "https://") {
+		return errors.New("user webhook is not https")
+	}
+
+	var payload []byte
+	var err error
+	if notification.Event != nil {
+		payload, err = json.Marshal(notification.Event)
+	} else {
+		payload, err = json.Marshal(notification)
+	}
+	if err != nil {
+		return err
+	}
+
+	backoff := m.InitialBackoff
+	var attempts int
+	var statusCode int
+
+	for attempts = 1; attempts <= m.MaxAttempts; attempts++ {
+		var retryable bool
+		statusCode, retryable, err = m.post(userWebhookNotificationTarget, payload)
+
+		if err == nil || !retryable || attempts == m.MaxAttempts {
+			break
+		}
+
+		log.Debug().Err(err).Str("target", notification.TargetUser).Int("attempt", attempts).Msg("Retrying webhook")
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	m.recordDelivery(notification, userWebhookNotificationTarget, attempts, statusCode, err)
+
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("target", notification.TargetUser).Msg("Sent Webhook Notification")
+
+	return nil
+}
+
+// post makes a single delivery attempt, returning whether a failure is worth retrying
+func (m *WebhookManager) post(target *ctdf.UserWebhookNotificationTarget, payload []byte) (int, bool, error) {
+	request, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, false, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "travigo-webhook")
+	request.Header.Set(webhookTimestampHeader, timestamp)
+	request.Header.Set(webhookSignatureHeader, SignWebhookPayload(target.Secret, timestamp, payload))
+
+	response, err := m.Client.Do(request)
+	if err != nil {
+		return 0, !errors.Is(err, errWebhookAddressNotPublic), err
+	}
+	response.Body.Close()
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response.StatusCode, false, nil
+	}
+
+	retryable := response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+
+	return response.StatusCode, retryable, errors.New(fmt.Sprintf("webhook returned status %d", response.StatusCode))
+}
+
+func (m *WebhookManager) recordDelivery(notification ctdf.Notification, target *ctdf.UserWebhookNotificationTarget, attempts int, statusCode int, sendErr error) {
+	now := time.Now()
+
+	delivery := ctdf.NotificationDelivery{
+		TargetUser:         notification.TargetUser,
+		Type:               ctdf.NotificationTypeWebhook,
+		EventType:          notification.EventType,
+		Target:             target.URL,
+		Status:             ctdf.NotificationDeliveryStatusSent,
+		Attempts:           attempts,
+		ResponseStatusCode: statusCode,
+		CreationDateTime:   now,
+	}
+
+	// Several notifications for the same target can be sent at once so the failures are counted in the database
+	targetUpdate := bson.M{"$set": bson.M{"consecutivefailures": 0}}
+
+	if sendErr != nil {
+		delivery.Status = ctdf.NotificationDeliveryStatusFailed
+		delivery.ErrorMessage = sendErr.Error()
+
+		targetUpdate = bson.M{
+			"$inc": bson.M{"consecutivefailures": 1},
+			"$set": bson.M{"lastfailuremessage": sendErr.Error()},
+		}
+	}
+
+	notificationDeliveryCollection := database.GetCollection("notification_deliveries")
+	if _, err := notificationDeliveryCollection.InsertOne(context.Background(), delivery); err != nil {
+		log.Error().Err(err).Msg("Failed to record notification delivery")
+	}
+
+	userWebhookNotificationTargetCollection := database.GetCollection("user_webhook_notification_target")
+	_, err := userWebhookNotificationTargetCollection.UpdateOne(context.Background(), bson.M{
+		"userid": target.UserID,
+	}, targetUpdate)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update webhook notification target")
+	}
+
+	if sendErr == nil {
+		return
+	}
+
+	result, err := userWebhookNotificationTargetCollection.UpdateOne(context.Background(), bson.M{
+		"userid":              target.UserID,
+		"consecutivefailures": bson.M{"$gte": m.DisableAfterFailures},
+		"disabled":            bson.M{"$ne": true},
+	}, bson.M{"$set": bson.M{
+		"disabled":         true,
+		"disableddatetime": now,
+	}})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to disable webhook notification target")
+	} else if result.ModifiedCount > 0 {
+		log.Warn().Str("target", notification.TargetUser).Msg("Disabling failing webhook")
+	}
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	for address, public := range map[string]bool{
+		"1.1.1.1":            true,
+		"2606:4700::1111":    true,
+		"127.0.0.1":          false,
+		"10.0.0.5":           false,
+		"172.16.0.1":         false,
+		"192.168.1.1":        false,
+		"169.254.169.254":    false,
+		"100.64.0.1":         false,
+		"0.0.0.0":            false,
+		"::1":                false,
+		"fe80::1":            false,
+		"fd00::1":            false,
+		"::ffff:127.0.0.1":   false,
+		"::ffff:10.0.0.1":    false,
+		"64:ff9b::a00:1":     false,
+		"224.0.0.1":          false,
+		"255.255.255.255":    false,
+		"::ffff:8.8.8.8":     true,
+		"2001:4860:4860::88": true,
+	} {
+		if isPublicAddress(netip.MustParseAddr(address)) != public {
+			t.Errorf("expected %s public to be %t", address, public)
+		}
+	}
+}
+
+func TestWebhookClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the loopback server")
+	}))
+	defer server.Close()
+
+	webhookManager := &WebhookManager{}
+	webhookManager.Setup()
+
+	_, retryable, err := webhookManager.post(&ctdf.UserWebhookNotificationTarget{URL: server.URL}, []byte("{}"))
+	if err == nil {
+		t.Fatal("expected the request to a loopback address to fail")
+	}
+	if retryable {
+		t.Error("expected a refused address not to be retried")
+	}
+}
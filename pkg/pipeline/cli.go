@@ -0,0 +1,67 @@
+package pipeline
+
+import (
+	"os"
+
+	dataaggregator "github.com/travigo/travigo/pkg/dataaggregator/global"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/urfave/cli/v2"
+
+	"github.com/rs/zerolog/log"
+
+	_ "time/tzdata"
+)
+
+func RegisterCLI() *cli.Command {
+	return &cli.Command{
+		Name:  "pipeline",
+		Usage: "Run the import, link, index & stats stages that get new data live",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "run",
+				Usage: "Run a pipeline defined in data/pipelines",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Value: "default",
+						Usage: "Name of the pipeline",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					pipeline, err := LoadPipeline(c.String("name"))
+					if err != nil {
+						return err
+					}
+
+					if err := database.Connect(); err != nil {
+						return err
+					}
+					if err := redis_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to Redis")
+					}
+					if err := queue_client.Connect(); err != nil {
+						log.Fatal().Err(err).Msg("Failed to connect to queue")
+					}
+
+					if pipeline.HasStageType(StageTypeIndex) || pipeline.HasStageType(StageTypeStats) {
+						if err := elastic_client.Connect(pipeline.HasStageType(StageTypeIndex)); err != nil {
+							return err
+						}
+					}
+					if pipeline.HasStageType(StageTypeIndex) {
+						dataaggregator.Setup()
+					}
+
+					results, err := pipeline.Run()
+
+					WriteSummary(os.Stdout, results)
+
+					return err
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const pipelinesDirectory = "data/pipelines/"
+
+type StageType string
+
+const (
+	StageTypeImport StageType = "import"
+	StageTypeLink             = "link"
+	StageTypeIndex            = "index"
+	StageTypeStats            = "stats"
+)
+
+type Pipeline struct {
+	Identifier  string
+	Description string
+
+	Stages []*Stage
+}
+
+type Stage struct {
+	Identifier string
+	Type       StageType
+	DependsOn  []string
+
+	Retries    int
+	RetryDelay time.Duration
+
+	// Let dependent stages run even if this one fails, eg. a failed import leaves the previous version live
+	AllowFailure bool
+
+	// Import stages, with no datasets listed every static dataset (optionally of the given size) is imported
+	Datasets    []string
+	DatasetSize string
+	Force       bool
+
+	// Link & index stages
+	Object string
+
+	// Stats stages
+	Objects []string
+}
+
+// LoadPipeline reads the pipeline definition from the data directory
+func LoadPipeline(identifier string) (*Pipeline, error) {
+	pipelineYaml, err := os.ReadFile(filepath.Join(pipelinesDirectory, fmt.Sprintf("%s.yaml", identifier)))
+	if err != nil {
+		return nil, err
+	}
+
+	var pipeline Pipeline
+	if err := yaml.Unmarshal(pipelineYaml, &pipeline); err != nil {
+		return nil, err
+	}
+
+	if pipeline.Identifier == "" {
+		pipeline.Identifier = identifier
+	}
+
+	if err := pipeline.validate(); err != nil {
+		return nil, err
+	}
+
+	return &pipeline, nil
+}
+
+func (p *Pipeline) validate() error {
+	stages := map[string]*Stage{}
+
+	for _, stage := range p.Stages {
+		if stage.Identifier == "" {
+			return errors.New("Every stage must have an identifier")
+		}
+		if stages[stage.Identifier] != nil {
+			return errors.New(fmt.Sprintf("Stage %s is defined more than once", stage.Identifier))
+		}
+
+		switch stage.Type {
+		case StageTypeImport:
+		case StageTypeStats:
+			if len(stage.Objects) == 0 {
+				return errors.New(fmt.Sprintf("Stage %s must have objects", stage.Identifier))
+			}
+		case StageTypeLink, StageTypeIndex:
+			if stage.Object == "" {
+				return errors.New(fmt.Sprintf("Stage %s must have an object", stage.Identifier))
+			}
+		default:
+			return errors.New(fmt.Sprintf("Stage %s has unknown type %s", stage.Identifier, stage.Type))
+		}
+
+		stages[stage.Identifier] = stage
+	}
+
+	for _, stage := range p.Stages {
+		for _, dependency := range stage.DependsOn {
+			if stages[dependency] == nil {
+				return errors.New(fmt.Sprintf("Stage %s depends on unknown stage %s", stage.Identifier, dependency))
+			}
+		}
+	}
+
+	_, err := p.orderedStages()
+
+	return err
+}
+
+// orderedStages sorts the stages so every stage comes after the ones it depends on,
+// stages keep the order they are defined in where possible
+func (p *Pipeline) orderedStages() ([]*Stage, error) {
+	var ordered []*Stage
+	added := map[string]bool{}
+
+	for len(ordered) < len(p.Stages) {
+		progressed := false
+
+		for _, stage := range p.Stages {
+			if added[stage.Identifier] {
+				continue
+			}
+
+			ready := true
+			for _, dependency := range stage.DependsOn {
+				if !added[dependency] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				ordered = append(ordered, stage)
+				added[stage.Identifier] = true
+				progressed = true
+			}
+		}
+
+		if !progressed {
+			return nil, errors.New("Pipeline stages have a circular dependency")
+		}
+	}
+
+	return ordered, nil
+}
+
+func (p *Pipeline) HasStageType(stageType StageType) bool {
+	for _, stage := range p.Stages {
+		if stage.Type == stageType {
+			return true
+		}
+	}
+
+	return false
+}
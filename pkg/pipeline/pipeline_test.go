@@ -0,0 +1,157 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		stages []*Stage
+		valid  bool
+	}{
+		{
+			"valid",
+			[]*Stage{
+				{Identifier: "import", Type: StageTypeImport},
+				{Identifier: "link", Type: StageTypeLink, Object: "stops", DependsOn: []string{"import"}},
+				{Identifier: "stats", Type: StageTypeStats, Objects: []string{"stops"}, DependsOn: []string{"link"}},
+			},
+			true,
+		},
+		{"missing identifier", []*Stage{{Type: StageTypeImport}}, false},
+		{"duplicate identifier", []*Stage{{Identifier: "import", Type: StageTypeImport}, {Identifier: "import", Type: StageTypeImport}}, false},
+		{"unknown type", []*Stage{{Identifier: "import", Type: "unknown"}}, false},
+		{"link without an object", []*Stage{{Identifier: "link", Type: StageTypeLink}}, false},
+		{"index without an object", []*Stage{{Identifier: "index", Type: StageTypeIndex}}, false},
+		{"stats without objects", []*Stage{{Identifier: "stats", Type: StageTypeStats}}, false},
+		{"unknown dependency", []*Stage{{Identifier: "import", Type: StageTypeImport, DependsOn: []string{"missing"}}}, false},
+		{
+			"circular dependency",
+			[]*Stage{
+				{Identifier: "a", Type: StageTypeImport, DependsOn: []string{"b"}},
+				{Identifier: "b", Type: StageTypeImport, DependsOn: []string{"a"}},
+			},
+			false,
+		},
+	} {
+		pipeline := &Pipeline{Identifier: "test", Stages: test.stages}
+
+		err := pipeline.validate()
+		if test.valid && err != nil {
+			t.Errorf("%s: expected to be valid, got %s", test.name, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("%s: expected to be invalid", test.name)
+		}
+	}
+}
+
+func TestPipelineOrderedStages(t *testing.T) {
+	pipeline := &Pipeline{
+		Stages: []*Stage{
+			{Identifier: "stats", DependsOn: []string{"link-services", "link-stops"}},
+			{Identifier: "link-services", DependsOn: []string{"link-operators"}},
+			{Identifier: "import"},
+			{Identifier: "link-stops", DependsOn: []string{"import"}},
+			{Identifier: "link-operators", DependsOn: []string{"import"}},
+		},
+	}
+
+	orderedStages, err := pipeline.orderedStages()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var identifiers []string
+	for _, stage := range orderedStages {
+		identifiers = append(identifiers, stage.Identifier)
+	}
+
+	expected := "import,link-stops,link-operators,link-services,stats"
+	if strings.Join(identifiers, ",") != expected {
+		t.Errorf("expected stages in order %s, got %s", expected, strings.Join(identifiers, ","))
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	// Datasets are loaded relative to the working directory so run from an empty data directory
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, "data", "datasources"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	workingDirectory, _ := os.Getwd()
+	if err := os.Chdir(directory); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDirectory) })
+
+	// Importing a dataset size that doesn't exist succeeds without doing anything and an unknown index always fails
+	pipeline := &Pipeline{
+		Identifier: "test",
+		Stages: []*Stage{
+			{Identifier: "succeeds", Type: StageTypeImport, DatasetSize: "none"},
+			{Identifier: "fails", Type: StageTypeIndex, Object: "unknown", Retries: 2, RetryDelay: time.Millisecond},
+			{Identifier: "fails-allowed", Type: StageTypeIndex, Object: "unknown", AllowFailure: true},
+			{Identifier: "after-succeeds", Type: StageTypeImport, DatasetSize: "none", DependsOn: []string{"succeeds"}},
+			{Identifier: "after-fails", Type: StageTypeImport, DatasetSize: "none", DependsOn: []string{"succeeds", "fails"}},
+			{Identifier: "after-fails-allowed", Type: StageTypeImport, DatasetSize: "none", DependsOn: []string{"fails-allowed"}},
+			{Identifier: "after-skipped", Type: StageTypeImport, DatasetSize: "none", DependsOn: []string{"after-fails"}},
+		},
+	}
+
+	results, err := pipeline.Run()
+	if err == nil {
+		t.Error("expected the pipeline to fail")
+	}
+
+	for _, test := range []struct {
+		stage    string
+		status   StageStatus
+		attempts int
+	}{
+		{"succeeds", StageStatusSuccess, 1},
+		{"fails", StageStatusFailed, 3},
+		{"fails-allowed", StageStatusFailed, 1},
+		{"after-succeeds", StageStatusSuccess, 1},
+		{"after-fails", StageStatusSkipped, 0},
+		{"after-fails-allowed", StageStatusSuccess, 1},
+		{"after-skipped", StageStatusSkipped, 0},
+	} {
+		var result *StageResult
+		for _, stageResult := range results {
+			if stageResult.Stage.Identifier == test.stage {
+				result = stageResult
+			}
+		}
+
+		if result == nil {
+			t.Errorf("expected a result for %s", test.stage)
+			continue
+		}
+		if result.Status != test.status || result.Attempts != test.attempts {
+			t.Errorf("expected %s to be %s after %d attempts, got %s after %d", test.stage, test.status, test.attempts, result.Status, result.Attempts)
+		}
+	}
+}
+
+func TestDefaultPipelineIsValid(t *testing.T) {
+	pipelineYaml, err := os.ReadFile("../../data/pipelines/default.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pipeline Pipeline
+	if err := yaml.Unmarshal(pipelineYaml, &pipeline); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pipeline.validate(); err != nil {
+		t.Error(err)
+	}
+}
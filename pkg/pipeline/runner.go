@@ -0,0 +1,154 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultRetryDelay = 30 * time.Second
+
+type StageStatus string
+
+const (
+	StageStatusPending StageStatus = "pending"
+	StageStatusSuccess             = "success"
+	StageStatusFailed              = "failed"
+	StageStatusSkipped             = "skipped"
+)
+
+type StageResult struct {
+	Stage *Stage
+
+	Status   StageStatus
+	Attempts int
+	Error    error
+
+	StartDateTime time.Time
+	EndDateTime   time.Time
+}
+
+// Run executes the stages in dependency order, a stage only runs once every stage it depends on
+// has succeeded so a failure further up never leaves the later stages working from partial data
+func (p *Pipeline) Run() ([]*StageResult, error) {
+	orderedStages, err := p.orderedStages()
+	if err != nil {
+		return nil, err
+	}
+
+	var results []*StageResult
+	resultsByStage := map[string]*StageResult{}
+
+	for _, stage := range orderedStages {
+		result := &StageResult{
+			Stage:  stage,
+			Status: StageStatusPending,
+		}
+		results = append(results, result)
+		resultsByStage[stage.Identifier] = result
+
+		var failedDependencies []string
+		for _, dependency := range stage.DependsOn {
+			dependencyResult := resultsByStage[dependency]
+
+			if dependencyResult.Status != StageStatusSuccess && !(dependencyResult.Status == StageStatusFailed && dependencyResult.Stage.AllowFailure) {
+				failedDependencies = append(failedDependencies, dependency)
+			}
+		}
+
+		if len(failedDependencies) > 0 {
+			result.Status = StageStatusSkipped
+			result.Error = errors.New(fmt.Sprintf("Dependency %s did not succeed", strings.Join(failedDependencies, ", ")))
+
+			log.Warn().Str("pipeline", p.Identifier).Str("stage", stage.Identifier).Err(result.Error).Msg("Skipping stage")
+			continue
+		}
+
+		p.runStage(result)
+	}
+
+	var failedStages []string
+	for _, result := range results {
+		if result.Status != StageStatusSuccess {
+			failedStages = append(failedStages, result.Stage.Identifier)
+		}
+	}
+
+	if len(failedStages) > 0 {
+		return results, errors.New(fmt.Sprintf("Pipeline %s stages did not succeed: %s", p.Identifier, strings.Join(failedStages, ", ")))
+	}
+
+	return results, nil
+}
+
+func (p *Pipeline) runStage(result *StageResult) {
+	stage := result.Stage
+	result.StartDateTime = time.Now()
+	defer func() { result.EndDateTime = time.Now() }()
+
+	execution, err := newStageExecution(stage)
+	if err != nil {
+		result.Status = StageStatusFailed
+		result.Error = err
+		return
+	}
+
+	retryDelay := stage.RetryDelay
+	if retryDelay == 0 {
+		retryDelay = defaultRetryDelay
+	}
+
+	for result.Attempts <= stage.Retries {
+		if result.Attempts > 0 {
+			log.Info().Str("pipeline", p.Identifier).Str("stage", stage.Identifier).Str("delay", retryDelay.String()).Msg("Retrying stage")
+			time.Sleep(retryDelay)
+		}
+		result.Attempts++
+
+		log.Info().
+			Str("pipeline", p.Identifier).
+			Str("stage", stage.Identifier).
+			Str("type", string(stage.Type)).
+			Int("attempt", result.Attempts).
+			Msg("Running stage")
+
+		result.Error = execution.run()
+		if result.Error == nil {
+			result.Status = StageStatusSuccess
+
+			log.Info().Str("pipeline", p.Identifier).Str("stage", stage.Identifier).Str("duration", time.Since(result.StartDateTime).String()).Msg("Stage succeeded")
+			return
+		}
+
+		log.Error().Err(result.Error).Str("pipeline", p.Identifier).Str("stage", stage.Identifier).Int("attempt", result.Attempts).Msg("Stage failed")
+	}
+
+	result.Status = StageStatusFailed
+}
+
+// WriteSummary prints a table of how each stage went
+func WriteSummary(writer io.Writer, results []*StageResult) {
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tableWriter, "STAGE\tTYPE\tSTATUS\tATTEMPTS\tDURATION\tERROR")
+	for _, result := range results {
+		var duration time.Duration
+		if !result.StartDateTime.IsZero() {
+			duration = result.EndDateTime.Sub(result.StartDateTime).Round(time.Second)
+		}
+
+		var errorMessage string
+		if result.Error != nil {
+			errorMessage = result.Error.Error()
+		}
+
+		fmt.Fprintf(tableWriter, "%s\t%s\t%s\t%d\t%s\t%s\n", result.Stage.Identifier, result.Stage.Type, result.Status, result.Attempts, duration, errorMessage)
+	}
+
+	tableWriter.Flush()
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/insertrecords"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/datalinker"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/indexer"
+	"github.com/travigo/travigo/pkg/stats/calculator"
+)
+
+// stageExecution keeps the state of a stage between attempts so retries only redo what failed
+type stageExecution struct {
+	stage *Stage
+
+	remainingDatasets []string
+	remainingObjects  []string
+}
+
+func newStageExecution(stage *Stage) (*stageExecution, error) {
+	execution := &stageExecution{
+		stage:            stage,
+		remainingObjects: stage.Objects,
+	}
+
+	if stage.Type == StageTypeImport {
+		datasetIdentifiers, err := stage.datasetIdentifiers()
+		if err != nil {
+			return nil, err
+		}
+
+		execution.remainingDatasets = datasetIdentifiers
+	}
+
+	return execution, nil
+}
+
+func (s *Stage) datasetIdentifiers() ([]string, error) {
+	if len(s.Datasets) > 0 {
+		for _, identifier := range s.Datasets {
+			if _, err := manager.GetDataset(identifier); err != nil {
+				return nil, errors.New(fmt.Sprintf("Dataset %s: %s", identifier, err))
+			}
+		}
+
+		return s.Datasets, nil
+	}
+
+	var identifiers []string
+	for _, dataset := range manager.GetRegisteredDataSets() {
+		if dataset.ImportDestination == datasets.ImportDestinationRealtimeQueue {
+			continue
+		}
+
+		datasetSize := dataset.DatasetSize
+		if datasetSize == "" {
+			datasetSize = "small"
+		}
+		if s.DatasetSize != "" && s.DatasetSize != datasetSize {
+			continue
+		}
+
+		identifiers = append(identifiers, dataset.Identifier)
+	}
+
+	return identifiers, nil
+}
+
+func (e *stageExecution) run() (err error) {
+	// A panic in one stage is treated like any other failure so the rest of the pipeline can be skipped cleanly
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.New(fmt.Sprintf("Stage panicked: %v", recovered))
+		}
+	}()
+
+	switch e.stage.Type {
+	case StageTypeImport:
+		return e.runImport()
+	case StageTypeLink:
+		return e.runLink()
+	case StageTypeIndex:
+		return e.runIndex()
+	case StageTypeStats:
+		return e.runStats()
+	default:
+		return errors.New(fmt.Sprintf("Unknown stage type %s", e.stage.Type))
+	}
+}
+
+func (e *stageExecution) runImport() error {
+	var failedDatasets []string
+
+	for _, identifier := range e.remainingDatasets {
+		dataset, err := manager.GetDataset(identifier)
+		if err == nil {
+			_, err = manager.ImportDatasetWithTrigger(&dataset, e.stage.Force, "pipeline")
+		}
+
+		if err != nil {
+			log.Error().Err(err).Str("stage", e.stage.Identifier).Str("dataset", identifier).Msg("Failed to import dataset")
+			failedDatasets = append(failedDatasets, identifier)
+		}
+	}
+
+	e.remainingDatasets = failedDatasets
+
+	if len(failedDatasets) > 0 {
+		return errors.New(fmt.Sprintf("Failed to import %s", strings.Join(failedDatasets, ", ")))
+	}
+
+	return nil
+}
+
+func (e *stageExecution) runLink() error {
+	linker, err := datalinker.NewLinker(e.stage.Object)
+	if err != nil {
+		return err
+	}
+
+	insertrecords.Insert()
+
+	return linker.Run()
+}
+
+func (e *stageExecution) runIndex() error {
+	switch e.stage.Object {
+	case "stops":
+		indexer.IndexStops()
+	default:
+		return errors.New(fmt.Sprintf("Unknown index object %s", e.stage.Object))
+	}
+
+	elastic_client.WaitUntilQueueEmpty()
+
+	return nil
+}
+
+func (e *stageExecution) runStats() error {
+	var failedObjects []string
+
+	for _, objectName := range e.remainingObjects {
+		if err := calculator.RecordStats(objectName); err != nil {
+			log.Error().Err(err).Str("stage", e.stage.Identifier).Str("type", objectName).Msg("Failed to update stats")
+			failedObjects = append(failedObjects, objectName)
+		}
+	}
+
+	e.remainingObjects = failedObjects
+
+	elastic_client.WaitUntilQueueEmpty()
+
+	if len(failedObjects) > 0 {
+		return errors.New(fmt.Sprintf("Failed to calculate stats for %s", strings.Join(failedObjects, ", ")))
+	}
+
+	return nil
+}
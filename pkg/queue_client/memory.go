@@ -0,0 +1,196 @@
+package queue_client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+)
+
+// Publishing blocks once a queue holds this many unconsumed messages
+const memoryQueueCapacity = 100000
+
+// memoryConnection is an in-process queue backend for running everything in a single binary and for tests.
+// Messages are lost when the process exits.
+type memoryConnection struct {
+	mutex  sync.Mutex
+	queues map[string]*memoryQueue
+
+	stopOnce  sync.Once
+	stopping  chan struct{}
+	consumers sync.WaitGroup
+}
+
+func newMemoryConnection() *memoryConnection {
+	return &memoryConnection{
+		queues:   map[string]*memoryQueue{},
+		stopping: make(chan struct{}),
+	}
+}
+
+func (c *memoryConnection) OpenQueue(name string) (Queue, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if queue, exists := c.queues[name]; exists {
+		return queue, nil
+	}
+
+	queue := &memoryQueue{
+		name:       name,
+		ready:      make(chan string, memoryQueueCapacity),
+		connection: c,
+	}
+	c.queues[name] = queue
+
+	return queue, nil
+}
+
+func (c *memoryConnection) StopAllConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+	})
+
+	go func() {
+		c.consumers.Wait()
+		close(finished)
+	}()
+
+	return finished
+}
+
+func (c *memoryConnection) Stats() ([]QueueStats, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var queueStats []QueueStats
+	for name, queue := range c.queues {
+		queueStats = append(queueStats, QueueStats{
+			Name:          name,
+			ReadyCount:    int64(len(queue.ready)),
+			RejectedCount: queue.rejectedCount.Load(),
+			Consumers:     queue.consumerCount.Load(),
+		})
+	}
+
+	return queueStats, nil
+}
+
+// Clean has nothing to do as consumers only stop when the whole process does
+func (c *memoryConnection) Clean() (int64, error) {
+	return 0, nil
+}
+
+type memoryQueue struct {
+	name  string
+	ready chan string
+
+	rejectedCount atomic.Int64
+	consumerCount atomic.Int64
+
+	connection *memoryConnection
+}
+
+func (q *memoryQueue) PublishBytes(payload ...[]byte) error {
+	for _, message := range payload {
+		q.ready <- string(message)
+	}
+
+	return nil
+}
+
+func (q *memoryQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	return nil
+}
+
+func (q *memoryQueue) AddBatchConsumer(tag string, batchSize int64, timeout time.Duration, consumer rmq.BatchConsumer) (string, error) {
+	q.connection.consumers.Add(1)
+	q.consumerCount.Add(1)
+
+	go func() {
+		defer q.connection.consumers.Done()
+		defer q.consumerCount.Add(-1)
+
+		for {
+			batch, stopped := q.nextBatch(batchSize, timeout)
+
+			if len(batch) > 0 {
+				consumer.Consume(batch)
+			}
+
+			if stopped {
+				return
+			}
+		}
+	}()
+
+	return tag, nil
+}
+
+// nextBatch blocks until a message is ready and then waits up to the timeout to fill the rest of the batch
+func (q *memoryQueue) nextBatch(batchSize int64, timeout time.Duration) (rmq.Deliveries, bool) {
+	var batch rmq.Deliveries
+
+	select {
+	case payload := <-q.ready:
+		batch = append(batch, &memoryDelivery{payload: payload, queue: q})
+	case <-q.connection.stopping:
+		return nil, true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for int64(len(batch)) < batchSize {
+		select {
+		case payload := <-q.ready:
+			batch = append(batch, &memoryDelivery{payload: payload, queue: q})
+		case <-timer.C:
+			return batch, false
+		case <-q.connection.stopping:
+			return batch, true
+		}
+	}
+
+	return batch, false
+}
+
+func (q *memoryQueue) ReadyCount() (int64, error) {
+	return int64(len(q.ready)), nil
+}
+
+type memoryDelivery struct {
+	payload string
+	queue   *memoryQueue
+}
+
+func (d *memoryDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *memoryDelivery) Ack() error {
+	return nil
+}
+
+// Reject puts the message back on the ready list to be consumed again rather than dropping it
+func (d *memoryDelivery) Reject() error {
+	d.queue.rejectedCount.Add(1)
+
+	select {
+	case d.queue.ready <- d.payload:
+	default:
+		// Don't block the consumer while the queue is full
+		go func() {
+			d.queue.ready <- d.payload
+		}()
+	}
+
+	return nil
+}
+
+func (d *memoryDelivery) Push() error {
+	return d.Reject()
+}
@@ -0,0 +1,107 @@
+package queue_client
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+)
+
+type recordingConsumer struct {
+	mutex    sync.Mutex
+	payloads []string
+
+	// Rejects every message the first time it's seen
+	rejectFirst bool
+	seen        map[string]bool
+
+	consumed chan struct{}
+}
+
+func (c *recordingConsumer) Consume(batch rmq.Deliveries) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, delivery := range batch {
+		payload := delivery.Payload()
+
+		if c.rejectFirst && !c.seen[payload] {
+			c.seen[payload] = true
+			delivery.Reject()
+			continue
+		}
+
+		c.payloads = append(c.payloads, payload)
+		delivery.Ack()
+		c.consumed <- struct{}{}
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		rejectFirst bool
+		rejected    int64
+	}{
+		{"acked", false, 0},
+		{"rejected messages are consumed again", true, 3},
+	} {
+		connection := newMemoryConnection()
+
+		queue, err := connection.OpenQueue("test-queue")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reopened, _ := connection.OpenQueue("test-queue"); reopened != queue {
+			t.Errorf("%s: expected opening the queue again to share it", test.name)
+		}
+
+		consumer := &recordingConsumer{rejectFirst: test.rejectFirst, seen: map[string]bool{}, consumed: make(chan struct{}, 10)}
+		if _, err := queue.AddBatchConsumer("test", 10, 10*time.Millisecond, consumer); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := queue.PublishBytes([]byte("a"), []byte("b"), []byte("c")); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 3; i++ {
+			select {
+			case <-consumer.consumed:
+			case <-time.After(time.Second):
+				t.Fatalf("%s: expected 3 messages to be consumed, got %v", test.name, consumer.payloads)
+			}
+		}
+
+		<-connection.StopAllConsuming()
+
+		stats, _ := connection.Stats()
+		if len(stats) != 1 || stats[0].ReadyCount != 0 || stats[0].RejectedCount != test.rejected || stats[0].Consumers != 0 {
+			t.Errorf("%s: unexpected stats %+v", test.name, stats)
+		}
+	}
+}
+
+func TestConnectMemoryBackend(t *testing.T) {
+	t.Setenv("TRAVIGO_QUEUE_BACKEND", string(BackendMemory))
+	t.Cleanup(func() { QueueConnection = nil })
+
+	if err := Connect(); err != nil {
+		t.Fatal(err)
+	}
+	connection := QueueConnection
+
+	// Everything in the binary has to share the in-process backend
+	if err := Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if QueueConnection != connection {
+		t.Error("expected connecting again to keep the same memory backend")
+	}
+
+	t.Setenv("TRAVIGO_QUEUE_BACKEND", "unknown")
+	if err := Connect(); err == nil {
+		t.Error("expected an unknown backend to fail")
+	}
+}
@@ -0,0 +1,222 @@
+package queue_client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+)
+
+// natsConnection backs every queue with a JetStream work queue stream. All replicas share a single durable
+// consumer per queue so each message is handed to only one of them.
+type natsConnection struct {
+	conn      *nats.Conn
+	jetStream jetstream.JetStream
+
+	stopOnce  sync.Once
+	stopping  chan struct{}
+	consumers sync.WaitGroup
+}
+
+func connectNATS(address string) (*natsConnection, error) {
+	if address == "" {
+		address = nats.DefaultURL
+	}
+
+	conn, err := nats.Connect(address, nats.Name("travigo"))
+	if err != nil {
+		return nil, err
+	}
+
+	jetStream, err := jetstream.New(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return &natsConnection{
+		conn:      conn,
+		jetStream: jetStream,
+		stopping:  make(chan struct{}),
+	}, nil
+}
+
+func (c *natsConnection) OpenQueue(name string) (Queue, error) {
+	stream, err := c.jetStream.CreateOrUpdateStream(context.Background(), jetstream.StreamConfig{
+		Name:      name,
+		Subjects:  []string{natsSubject(name)},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &natsQueue{name: name, stream: stream, connection: c}, nil
+}
+
+func (c *natsConnection) StopAllConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	c.stopOnce.Do(func() {
+		close(c.stopping)
+	})
+
+	go func() {
+		c.consumers.Wait()
+		c.conn.Drain()
+		close(finished)
+	}()
+
+	return finished
+}
+
+func (c *natsConnection) Stats() ([]QueueStats, error) {
+	var queueStats []QueueStats
+
+	streams := c.jetStream.ListStreams(context.Background(), jetstream.WithStreamListSubject(natsSubject("*")))
+	for info := range streams.Info() {
+		stats := QueueStats{
+			Name:       info.Config.Name,
+			ReadyCount: int64(info.State.Msgs),
+		}
+
+		// Messages stay in a work queue stream until they are acknowledged so take off those still being processed
+		consumer, err := c.jetStream.Consumer(context.Background(), info.Config.Name, info.Config.Name)
+		if err == nil {
+			consumerInfo, err := consumer.Info(context.Background())
+			if err != nil {
+				return nil, err
+			}
+
+			stats.UnackedCount = int64(consumerInfo.NumAckPending)
+			stats.ReadyCount -= stats.UnackedCount
+			stats.Consumers = int64(consumerInfo.NumWaiting)
+		} else if !errors.Is(err, jetstream.ErrConsumerNotFound) {
+			return nil, err
+		}
+
+		queueStats = append(queueStats, stats)
+	}
+	if err := streams.Err(); err != nil {
+		return nil, err
+	}
+
+	return queueStats, nil
+}
+
+// Clean has nothing to do as JetStream redelivers messages that aren't acknowledged in time by itself
+func (c *natsConnection) Clean() (int64, error) {
+	return 0, nil
+}
+
+func natsSubject(queueName string) string {
+	return fmt.Sprintf("travigo.%s", queueName)
+}
+
+type natsQueue struct {
+	name     string
+	stream   jetstream.Stream
+	consumer jetstream.Consumer
+
+	connection *natsConnection
+}
+
+func (q *natsQueue) PublishBytes(payload ...[]byte) error {
+	for _, message := range payload {
+		if _, err := q.connection.jetStream.Publish(context.Background(), natsSubject(q.name), message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *natsQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	consumer, err := q.stream.CreateOrUpdateConsumer(context.Background(), jetstream.ConsumerConfig{
+		Durable:       q.name,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		MaxAckPending: int(prefetchLimit),
+	})
+	if err != nil {
+		return err
+	}
+
+	q.consumer = consumer
+
+	return nil
+}
+
+func (q *natsQueue) AddBatchConsumer(tag string, batchSize int64, timeout time.Duration, consumer rmq.BatchConsumer) (string, error) {
+	if q.consumer == nil {
+		return "", errors.New("StartConsuming must be called before adding consumers")
+	}
+
+	q.connection.consumers.Add(1)
+
+	go func() {
+		defer q.connection.consumers.Done()
+
+		for {
+			select {
+			case <-q.connection.stopping:
+				return
+			default:
+			}
+
+			messages, err := q.consumer.Fetch(int(batchSize), jetstream.FetchMaxWait(timeout))
+			if err != nil {
+				log.Error().Err(err).Str("queue", q.name).Str("consumer", tag).Msg("Failed to fetch messages")
+				time.Sleep(timeout)
+				continue
+			}
+
+			var batch rmq.Deliveries
+			for message := range messages.Messages() {
+				batch = append(batch, &natsDelivery{message: message})
+			}
+
+			if len(batch) > 0 {
+				consumer.Consume(batch)
+			}
+		}
+	}()
+
+	return tag, nil
+}
+
+// ReadyCount includes messages that have been delivered but not yet acknowledged
+func (q *natsQueue) ReadyCount() (int64, error) {
+	info, err := q.stream.Info(context.Background())
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(info.State.Msgs), nil
+}
+
+type natsDelivery struct {
+	message jetstream.Msg
+}
+
+func (d *natsDelivery) Payload() string {
+	return string(d.message.Data())
+}
+
+func (d *natsDelivery) Ack() error {
+	return d.message.Ack()
+}
+
+// Reject matches rmq where rejected deliveries are not retried
+func (d *natsDelivery) Reject() error {
+	return d.message.Term()
+}
+
+func (d *natsDelivery) Push() error {
+	return d.message.Nak()
+}
@@ -0,0 +1,86 @@
+package queue_client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/util"
+)
+
+// Queue is the subset of the rmq queue that the rest of travigo relies on so that it can be backed by something
+// other than Redis. Consumers keep implementing rmq.BatchConsumer and receive rmq.Deliveries from every backend.
+type Queue interface {
+	PublishBytes(payload ...[]byte) error
+	StartConsuming(prefetchLimit int64, pollDuration time.Duration) error
+	AddBatchConsumer(tag string, batchSize int64, timeout time.Duration, consumer rmq.BatchConsumer) (string, error)
+	ReadyCount() (int64, error)
+}
+
+type Connection interface {
+	OpenQueue(name string) (Queue, error)
+	StopAllConsuming() <-chan struct{}
+
+	// Stats reports on every queue known to the backend
+	Stats() ([]QueueStats, error)
+	// Clean returns deliveries held by consumers that have died back to their queues
+	Clean() (int64, error)
+}
+
+type QueueStats struct {
+	Name string
+
+	ReadyCount    int64
+	RejectedCount int64
+	UnackedCount  int64
+
+	Consumers int64
+}
+
+type Backend string
+
+const (
+	BackendRedis  Backend = "redis"
+	BackendNATS   Backend = "nats"
+	BackendMemory Backend = "memory"
+)
+
+var QueueConnection Connection
+
+// Connect sets up the queue backend selected by TRAVIGO_QUEUE_BACKEND, defaulting to Redis
+func Connect() error {
+	env := util.GetEnvironmentVariables()
+
+	backend := Backend(env["TRAVIGO_QUEUE_BACKEND"])
+	if backend == "" {
+		backend = BackendRedis
+	}
+
+	// The in-process backend has to be shared by everything in the binary so never replace it
+	if _, isMemory := QueueConnection.(*memoryConnection); isMemory && backend == BackendMemory {
+		return nil
+	}
+
+	var err error
+
+	switch backend {
+	case BackendRedis:
+		QueueConnection, err = connectRedis()
+	case BackendNATS:
+		QueueConnection, err = connectNATS(env["TRAVIGO_NATS_ADDRESS"])
+	case BackendMemory:
+		QueueConnection = newMemoryConnection()
+	default:
+		return errors.New(fmt.Sprintf("Unknown queue backend %s", backend))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Str("backend", string(backend)).Msg("Connected to queue backend")
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package queue_client
+
+import (
+	"errors"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+	"github.com/travigo/travigo/pkg/redis_client"
+)
+
+type redisConnection struct {
+	connection rmq.Connection
+}
+
+func connectRedis() (*redisConnection, error) {
+	if redis_client.QueueConnection == nil {
+		if err := redis_client.Connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &redisConnection{connection: redis_client.QueueConnection}, nil
+}
+
+func (c *redisConnection) OpenQueue(name string) (Queue, error) {
+	queue, err := c.connection.OpenQueue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &redisQueue{name: name, queue: queue, connection: c.connection}, nil
+}
+
+func (c *redisConnection) StopAllConsuming() <-chan struct{} {
+	return c.connection.StopAllConsuming()
+}
+
+func (c *redisConnection) Stats() ([]QueueStats, error) {
+	queues, err := c.connection.GetOpenQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := c.connection.CollectStats(queues)
+	if err != nil {
+		return nil, err
+	}
+
+	var queueStats []QueueStats
+	for name, stat := range stats.QueueStats {
+		queueStats = append(queueStats, QueueStats{
+			Name:          name,
+			ReadyCount:    stat.ReadyCount,
+			RejectedCount: stat.RejectedCount,
+			UnackedCount:  stat.UnackedCount(),
+			Consumers:     stat.ConsumerCount(),
+		})
+	}
+
+	return queueStats, nil
+}
+
+func (c *redisConnection) Clean() (int64, error) {
+	return rmq.NewCleaner(c.connection).Clean()
+}
+
+type redisQueue struct {
+	name       string
+	queue      rmq.Queue
+	connection rmq.Connection
+}
+
+func (q *redisQueue) PublishBytes(payload ...[]byte) error {
+	return q.queue.PublishBytes(payload...)
+}
+
+func (q *redisQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	return q.queue.StartConsuming(prefetchLimit, pollDuration)
+}
+
+func (q *redisQueue) AddBatchConsumer(tag string, batchSize int64, timeout time.Duration, consumer rmq.BatchConsumer) (string, error) {
+	return q.queue.AddBatchConsumer(tag, batchSize, timeout, consumer)
+}
+
+func (q *redisQueue) ReadyCount() (int64, error) {
+	stats, err := q.connection.CollectStats([]string{q.name})
+	if err != nil {
+		return 0, err
+	}
+
+	queueStats, exists := stats.QueueStats[q.name]
+	if !exists {
+		return 0, errors.New("Queue missing from stats")
+	}
+
+	return queueStats.ReadyCount, nil
+}
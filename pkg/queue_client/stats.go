@@ -0,0 +1,30 @@
+package queue_client
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// WriteStatsHTML renders the queue stats as a table, the page reloads itself every refresh seconds when set
+func WriteStatsHTML(writer io.Writer, stats []QueueStats, refresh string) {
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	fmt.Fprint(writer, "<html><head><title>travigo queues</title>")
+	if seconds, err := strconv.Atoi(refresh); err == nil && seconds > 0 {
+		fmt.Fprintf(writer, `<meta http-equiv="refresh" content="%d">`, seconds)
+	}
+	fmt.Fprint(writer, `</head><body><table style="font-family:monospace;text-align:right">`)
+	fmt.Fprint(writer, `<tr><th style="text-align:left">queue</th><th>ready</th><th>rejected</th><th>unacked</th><th>consumers</th></tr>`)
+
+	for _, queue := range stats {
+		fmt.Fprintf(writer, `<tr><td style="text-align:left">%s</td><td>%d</td><td>%d</td><td>%d</td><td>%d</td></tr>`,
+			html.EscapeString(queue.Name), queue.ReadyCount, queue.RejectedCount, queue.UnackedCount, queue.Consumers)
+	}
+
+	fmt.Fprint(writer, "</table></body></html>")
+}
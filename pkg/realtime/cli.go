@@ -2,6 +2,7 @@ package realtime
 
 import (
 	"github.com/travigo/travigo/pkg/realtime/nationalrail"
+	"github.com/travigo/travigo/pkg/realtime/recorder"
 	"github.com/travigo/travigo/pkg/realtime/tflarrivals"
 	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
 	"github.com/urfave/cli/v2"
@@ -15,6 +16,8 @@ func RegisterCLI() *cli.Command {
 			vehicletracker.RegisterCLI(),
 			tflarrivals.RegisterCLI(),
 			nationalrail.RegisterCLI(),
+			recorder.RegisterRecordCLI(),
+			recorder.RegisterReplayCLI(),
 		},
 	}
 }
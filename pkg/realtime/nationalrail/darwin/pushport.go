@@ -12,6 +12,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/realtime/nationalrail/railutils"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -26,7 +27,7 @@ type PushPortData struct {
 }
 
 func (p *PushPortData) UpdateRealtimeJourneys(queue *railutils.BatchProcessingQueue) {
-	now := time.Now()
+	now := util.Now()
 	datasource := &ctdf.DataSourceReference{
 		OriginalFormat: "DarwinPushPort",
 		ProviderName:   "National Rail",
@@ -440,7 +441,7 @@ func (p *PushPortData) UpdateRealtimeJourneys(queue *railutils.BatchProcessingQu
 		collection := database.GetCollection("datadump")
 		collection.InsertOne(context.Background(), bson.M{
 			"type":             "trainalert",
-			"creationdatetime": time.Now(),
+			"creationdatetime": util.Now(),
 			"document":         trainAlert,
 		})
 	}
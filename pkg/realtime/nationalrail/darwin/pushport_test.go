@@ -0,0 +1,89 @@
+package darwin
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/realtime/nationalrail/railutils"
+	"github.com/travigo/travigo/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func gzipMessage(t *testing.T, message string) []byte {
+	var buffer bytes.Buffer
+
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buffer.Bytes()
+}
+
+func TestReplayedTrainStatusUsesRecordedTime(t *testing.T) {
+	database.ConnectMemory()
+
+	database.GetCollection("journeys").InsertOne(context.Background(), ctdf.Journey{
+		PrimaryIdentifier: "test-journey",
+		OtherIdentifiers:  map[string]string{"TrainUID": "C12345"},
+		Availability: &ctdf.Availability{
+			Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: "2024-03-05"}},
+		},
+	})
+
+	recordedTime := time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC)
+	util.SetSimulatedTime(recordedTime, 0)
+	defer util.ClearSimulatedTime()
+
+	client := &StompClient{
+		queue: &railutils.BatchProcessingQueue{Items: make(chan mongo.WriteModel, 10)},
+	}
+
+	err := client.ParseMessage(gzipMessage(t, `<?xml version="1.0" encoding="UTF-8"?>
+<Pport xmlns="http://www.thalesgroup.com/rtti/PushPort/v16"><uR><TS rid="202403058012345" uid="C12345" ssd="2024-03-05"></TS></uR></Pport>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(client.queue.Items) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(client.queue.Items))
+	}
+
+	var update struct {
+		Set bson.M `bson:"$set"`
+	}
+	if err := bson.Unmarshal((<-client.queue.Items).(*mongo.UpdateOneModel).Update.([]byte), &update); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"modificationdatetime", "creationdatetime"} {
+		value, _ := update.Set[field].(primitive.DateTime)
+		if !value.Time().Equal(recordedTime) {
+			t.Errorf("expected %s to be the recorded time %s, got %s", field, recordedTime, value.Time())
+		}
+	}
+}
+
+func TestParseMessageReturnsErrors(t *testing.T) {
+	client := &StompClient{
+		queue: &railutils.BatchProcessingQueue{Items: make(chan mongo.WriteModel, 10)},
+	}
+
+	if err := client.ParseMessage([]byte("not gzip")); err == nil {
+		t.Error("expected a message that isn't gzipped to fail")
+	}
+
+	if err := client.ParseMessage(gzipMessage(t, `<Pport><uR><TS rid="1" uid="C1" ssd="2024-03-05"><Location tpl="X"></TS></uR></Pport>`)); err == nil {
+		t.Error("expected invalid xml to fail")
+	}
+}
@@ -3,6 +3,8 @@ package darwin
 import (
 	"bytes"
 	"compress/gzip"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/go-stomp/stomp/v3"
@@ -16,24 +18,30 @@ type StompClient struct {
 	Username  string
 	Password  string
 	QueueName string
+
+	queue *railutils.BatchProcessingQueue
 }
 
 var stopCache railutils.StopCache
 
-func (s *StompClient) Run() {
+func (s *StompClient) Setup() {
 	railutils.LoadLateAndCancelledReasons()
 
 	stopCache = railutils.StopCache{}
 	stopCache.Setup()
 
 	// Setup batch queue processor first
-	queue := &railutils.BatchProcessingQueue{
+	s.queue = &railutils.BatchProcessingQueue{
 		Timeout: time.Second * 5,
 		Items:   make(chan mongo.WriteModel, 500),
 	}
-	queue.Process()
+	s.queue.Process()
+}
 
-	go RetryRecords(queue)
+func (s *StompClient) Run() {
+	s.Setup()
+
+	go RetryRecords(s.queue)
 
 	// Start stomp client
 	var stompOptions []func(*stomp.Conn) error = []func(*stomp.Conn) error{
@@ -61,20 +69,41 @@ func (s *StompClient) Run() {
 				log.Fatal().Err(err).Msg("STOMP error")
 			}
 
-			b := bytes.NewReader(msg.Body)
-			gzipDecoder, err := gzip.NewReader(b)
+			pushPortData, err := decodeMessage(msg.Body)
 			if err != nil {
-				log.Fatal().Err(err).Msg("cannot decode gzip stream")
+				log.Error().Err(err).Msg("Failed to decode push port message")
 				continue
 			}
 
-			pushPortData, err := ParseXMLFile(gzipDecoder)
-			gzipDecoder.Close()
-			if err != nil {
-				log.Fatal().Err(err).Msg("Failed to parse push port data xml")
-			}
-
-			go pushPortData.UpdateRealtimeJourneys(queue)
+			go pushPortData.UpdateRealtimeJourneys(s.queue)
 		}
 	}
 }
+
+// ParseMessage decodes a push port message and applies it before returning, used when replaying recordings
+// so each message is processed at its recorded time
+func (s *StompClient) ParseMessage(body []byte) error {
+	pushPortData, err := decodeMessage(body)
+	if err != nil {
+		return err
+	}
+
+	pushPortData.UpdateRealtimeJourneys(s.queue)
+
+	return nil
+}
+
+func decodeMessage(body []byte) (PushPortData, error) {
+	gzipDecoder, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return PushPortData{}, errors.New(fmt.Sprintf("Failed to decode gzip stream: %s", err))
+	}
+	defer gzipDecoder.Close()
+
+	pushPortData, err := ParseXMLFile(gzipDecoder)
+	if err != nil {
+		return PushPortData{}, errors.New(fmt.Sprintf("Failed to parse push port data xml: %s", err))
+	}
+
+	return pushPortData, nil
+}
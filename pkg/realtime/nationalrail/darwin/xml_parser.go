@@ -2,9 +2,10 @@ package darwin
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 
-	"github.com/rs/zerolog/log"
 	"golang.org/x/net/html/charset"
 )
 
@@ -19,8 +20,7 @@ func ParseXMLFile(reader io.Reader) (PushPortData, error) {
 			// EOF means we're done.
 			break
 		} else if err != nil {
-			log.Fatal().Msgf("Error decoding token: %s", err)
-			return pushPortData, err
+			return pushPortData, errors.New(fmt.Sprintf("Error decoding token: %s", err))
 		}
 
 		switch ty := tok.(type) {
@@ -29,50 +29,44 @@ func ParseXMLFile(reader io.Reader) (PushPortData, error) {
 				var trainStatus TrainStatus
 
 				if err = d.DecodeElement(&trainStatus, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.TrainStatuses = append(pushPortData.TrainStatuses, trainStatus)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.TrainStatuses = append(pushPortData.TrainStatuses, trainStatus)
 			} else if ty.Name.Local == "schedule" {
 				var schedule Schedule
 
 				if err = d.DecodeElement(&schedule, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.Schedules = append(pushPortData.Schedules, schedule)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.Schedules = append(pushPortData.Schedules, schedule)
 			} else if ty.Name.Local == "formationLoading" {
 				var formationLoading FormationLoading
 
 				if err = d.DecodeElement(&formationLoading, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.FormationLoadings = append(pushPortData.FormationLoadings, formationLoading)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.FormationLoadings = append(pushPortData.FormationLoadings, formationLoading)
 			} else if ty.Name.Local == "OW" {
 				var stationMessage StationMessage
 
 				if err = d.DecodeElement(&stationMessage, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.StationMessages = append(pushPortData.StationMessages, stationMessage)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.StationMessages = append(pushPortData.StationMessages, stationMessage)
 			} else if ty.Name.Local == "trainAlert" {
 				var trainAlert TrainAlert
 
 				if err = d.DecodeElement(&trainAlert, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.TrainAlerts = append(pushPortData.TrainAlerts, trainAlert)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.TrainAlerts = append(pushPortData.TrainAlerts, trainAlert)
 			} else if ty.Name.Local == "scheduleFormations" {
 				var scheduleFormation ScheduleFormations
 
 				if err = d.DecodeElement(&scheduleFormation, &ty); err != nil {
-					log.Fatal().Msgf("Error decoding item: %s", err)
-				} else {
-					pushPortData.ScheduleFormations = append(pushPortData.ScheduleFormations, scheduleFormation)
+					return pushPortData, errors.New(fmt.Sprintf("Error decoding item: %s", err))
 				}
+				pushPortData.ScheduleFormations = append(pushPortData.ScheduleFormations, scheduleFormation)
 			}
 		}
 	}
@@ -8,6 +8,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -36,7 +37,7 @@ type TrustActivation struct {
 }
 
 func (a *TrustActivation) Process(stompClient *StompClient) {
-	now := time.Now()
+	now := util.Now()
 	datasource := &ctdf.DataSourceReference{
 		OriginalFormat: "TrainActivationJSON",
 		ProviderName:   "Network Rail",
@@ -3,7 +3,6 @@ package nrod
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
@@ -47,7 +46,7 @@ type TrustMovement struct {
 }
 
 func (m *TrustMovement) Process(stompClient *StompClient) {
-	now := time.Now()
+	now := util.Now()
 
 	realtimeJourneysCollection := database.GetCollection("realtime_journeys")
 
@@ -0,0 +1,76 @@
+package nrod
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/realtime/nationalrail/railutils"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestReplayedMovementUsesRecordedTime(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	t.Setenv("TRAVIGO_REDIS_ADDRESS", redisServer.Addr())
+	if err := redis_client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	database.ConnectMemory()
+
+	database.GetCollection("stops").InsertOne(context.Background(), ctdf.Stop{
+		PrimaryIdentifier: "test-stop-a",
+		PrimaryName:       "Stop A",
+		OtherIdentifiers:  []string{"gb-stanox-1000"},
+	})
+	database.GetCollection("realtime_journeys").InsertOne(context.Background(), ctdf.RealtimeJourney{
+		PrimaryIdentifier: "test-realtime-journey",
+		OtherIdentifiers:  map[string]string{"TrainID": "123A45MX05"},
+		Journey: &ctdf.Journey{
+			PrimaryIdentifier: "test-journey",
+			Path: []*ctdf.JourneyPathItem{
+				{OriginStopRef: "test-stop-a", DestinationStopRef: "test-stop-b"},
+			},
+		},
+	})
+
+	recordedTime := time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC)
+	util.SetSimulatedTime(recordedTime, 0)
+	defer util.ClearSimulatedTime()
+
+	client := &StompClient{
+		Queue: &railutils.BatchProcessingQueue{Items: make(chan mongo.WriteModel, 10)},
+	}
+	client.StopCache.Setup()
+
+	client.ParseTrainMovementMessages([]byte(`[{"header": {"msg_type": "0003"}, "body": {"event_type": "DEPARTURE", "train_id": "123A45MX05", "loc_stanox": "1000"}}]`))
+
+	if len(client.Queue.Items) != 1 {
+		t.Fatalf("expected 1 update, got %d", len(client.Queue.Items))
+	}
+
+	var update struct {
+		Set bson.M `bson:"$set"`
+	}
+	if err := bson.Unmarshal((<-client.Queue.Items).(*mongo.UpdateOneModel).Update.([]byte), &update); err != nil {
+		t.Fatal(err)
+	}
+
+	if update.Set["departedstopref"] != "test-stop-a" {
+		t.Errorf("expected the train to have departed test-stop-a, got %v", update.Set["departedstopref"])
+	}
+
+	for _, field := range []string{"modificationdatetime", "stops.test-stop-a.departuretime"} {
+		value, _ := update.Set[field].(primitive.DateTime)
+		if !value.Time().Equal(recordedTime) {
+			t.Errorf("expected %s to be the recorded time %s, got %s", field, recordedTime, value.Time())
+		}
+	}
+}
@@ -3,11 +3,11 @@ package nrod
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -19,7 +19,7 @@ type TrustReinstatement struct {
 }
 
 func (r *TrustReinstatement) Process(stompClient *StompClient) {
-	now := time.Now()
+	now := util.Now()
 
 	realtimeJourneysCollection := database.GetCollection("realtime_journeys")
 
@@ -11,6 +11,7 @@ import (
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/dataimporter/formats/cif"
 	"github.com/travigo/travigo/pkg/realtime/nationalrail/railutils"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -50,7 +51,7 @@ func (v *VSTPMessage) Process(stompClient *StompClient) {
 }
 
 func (v *VSTPMessage) processCreate() {
-	now := time.Now()
+	now := util.Now()
 	var updateOperations []mongo.WriteModel
 
 	for _, scheduleSegment := range v.VSTP.Schedule.ScheduleSegment {
@@ -197,7 +198,7 @@ func (v *VSTPMessage) processCreate() {
 }
 
 func (v *VSTPMessage) processDelete() {
-	now := time.Now()
+	now := util.Now()
 
 	var journey *ctdf.Journey
 
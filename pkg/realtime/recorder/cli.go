@@ -0,0 +1,198 @@
+package recorder
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
+	"github.com/urfave/cli/v2"
+)
+
+func RegisterRecordCLI() *cli.Command {
+	return &cli.Command{
+		Name:  "record",
+		Usage: "Record raw realtime feed payloads to disk for later replay",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "output",
+				Usage:    "Directory to write the recording to",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "dataset",
+				Usage: "ID of a realtime dataset to record (can be repeated)",
+			},
+			&cli.StringFlag{
+				Name:  "interval",
+				Usage: "Override the dataset refresh interval",
+			},
+			&cli.BoolFlag{
+				Name:  "darwin",
+				Usage: "Record the National Rail Darwin Push Port feed",
+			},
+			&cli.BoolFlag{
+				Name:  "trust",
+				Usage: "Record the Network Rail TRUST train movements feed",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			recording, err := NewRecording(c.String("output"))
+			if err != nil {
+				return err
+			}
+			defer recording.Close()
+
+			var intervalOverride time.Duration
+			if c.String("interval") != "" {
+				intervalOverride, err = time.ParseDuration(c.String("interval"))
+				if err != nil {
+					return err
+				}
+			}
+
+			for _, datasetID := range c.StringSlice("dataset") {
+				dataset, err := manager.GetDataset(datasetID)
+				if err != nil {
+					return err
+				}
+
+				interval := 30 * time.Second
+				if intervalOverride.Seconds() > 0 {
+					interval = intervalOverride
+				} else if dataset.RefreshInterval.Seconds() > 0 {
+					interval = dataset.RefreshInterval
+				}
+
+				go RecordDataset(recording, dataset, interval)
+			}
+
+			env := util.GetEnvironmentVariables()
+
+			if c.Bool("darwin") {
+				if env["TRAVIGO_NATIONALRAIL_DARWIN_STOMP_USERNAME"] == "" {
+					log.Fatal().Msg("TRAVIGO_NATIONALRAIL_DARWIN_STOMP_USERNAME must be set")
+				}
+				if env["TRAVIGO_NATIONALRAIL_DARWIN_STOMP_PASSWORD"] == "" {
+					log.Fatal().Msg("TRAVIGO_NATIONALRAIL_DARWIN_STOMP_PASSWORD must be set")
+				}
+
+				go RecordSTOMP(
+					recording,
+					RecordingSourceTypeDarwin,
+					"darwin-dist-44ae45.nationalrail.co.uk:61613",
+					env["TRAVIGO_NATIONALRAIL_DARWIN_STOMP_USERNAME"],
+					env["TRAVIGO_NATIONALRAIL_DARWIN_STOMP_PASSWORD"],
+					"/topic/darwin.pushport-v16",
+				)
+			}
+
+			if c.Bool("trust") {
+				if env["TRAVIGO_NETWORKRAIL_USERNAME"] == "" {
+					log.Fatal().Msg("TRAVIGO_NETWORKRAIL_USERNAME must be set")
+				}
+				if env["TRAVIGO_NETWORKRAIL_PASSWORD"] == "" {
+					log.Fatal().Msg("TRAVIGO_NETWORKRAIL_PASSWORD must be set")
+				}
+
+				go RecordSTOMP(
+					recording,
+					RecordingSourceTypeTrust,
+					"publicdatafeeds.networkrail.co.uk:61618",
+					env["TRAVIGO_NETWORKRAIL_USERNAME"],
+					env["TRAVIGO_NETWORKRAIL_PASSWORD"],
+					"/topic/TRAIN_MVT_ALL_TOC",
+				)
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, syscall.SIGINT)
+			defer signal.Stop(signals)
+
+			<-signals // wait for signal
+			go func() {
+				<-signals // hard exit on second signal (in case shutdown gets stuck)
+				os.Exit(1)
+			}()
+
+			return nil
+		},
+	}
+}
+
+func RegisterReplayCLI() *cli.Command {
+	return &cli.Command{
+		Name:  "replay",
+		Usage: "Replay a recording through the realtime parsers with a simulated clock",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "input",
+				Usage:    "Directory containing the recording",
+				Required: true,
+			},
+			&cli.Float64Flag{
+				Name:  "speed",
+				Value: 1,
+				Usage: "Replay speed multiplier, 0 replays as fast as possible",
+			},
+			&cli.BoolFlag{
+				Name:  "vehicle-tracker",
+				Usage: "Run the vehicle tracker consumers in the same process",
+			},
+		},
+		Action: func(c *cli.Context) error {
+			if err := database.Connect(); err != nil {
+				return err
+			}
+			if err := redis_client.Connect(); err != nil {
+				return err
+			}
+			if err := queue_client.Connect(); err != nil {
+				return err
+			}
+
+			if c.Bool("vehicle-tracker") {
+				if err := elastic_client.Connect(false); err != nil {
+					return err
+				}
+
+				vehicletracker.StartConsumers()
+			}
+
+			replayer := Replayer{
+				Directory: c.String("input"),
+				Speed:     c.Float64("speed"),
+			}
+
+			if err := replayer.Run(); err != nil {
+				return err
+			}
+
+			if c.Bool("vehicle-tracker") {
+				log.Info().Msg("Replay complete, vehicle tracker will keep consuming until interrupted")
+
+				signals := make(chan os.Signal, 1)
+				signal.Notify(signals, syscall.SIGINT)
+				defer signal.Stop(signals)
+
+				<-signals // wait for signal
+				go func() {
+					<-signals // hard exit on second signal (in case shutdown gets stuck)
+					os.Exit(1)
+				}()
+
+				<-queue_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+			}
+
+			return nil
+		},
+	}
+}
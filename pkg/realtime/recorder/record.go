@@ -0,0 +1,82 @@
+package recorder
+
+import (
+	"os"
+	"time"
+
+	"github.com/go-stomp/stomp/v3"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+)
+
+func RecordDataset(recording *Recording, dataset datasets.DataSet, interval time.Duration) {
+	log.Info().Str("id", dataset.Identifier).Str("interval", interval.String()).Msg("Recording dataset")
+
+	for {
+		startTime := time.Now()
+
+		if err := recordDatasetOnce(recording, &dataset); err != nil {
+			log.Error().Err(err).Str("id", dataset.Identifier).Msg("Failed to record dataset")
+		}
+
+		waitTime := interval - time.Since(startTime)
+
+		if waitTime.Seconds() > 0 {
+			time.Sleep(waitTime)
+		}
+	}
+}
+
+func recordDatasetOnce(recording *Recording, dataset *datasets.DataSet) error {
+	tempFile, err := manager.DownloadDataset(dataset)
+	if err != nil {
+		return err
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	payload, err := os.ReadFile(tempFile.Name())
+	if err != nil {
+		return err
+	}
+
+	log.Debug().Str("id", dataset.Identifier).Int("size", len(payload)).Msg("Recorded dataset payload")
+
+	return recording.Write(RecordingSourceTypeDataset, dataset.Identifier, payload)
+}
+
+func RecordSTOMP(recording *Recording, sourceType RecordingSourceType, address string, username string, password string, queueName string) {
+	var stompOptions []func(*stomp.Conn) error = []func(*stomp.Conn) error{
+		stomp.ConnOpt.Login(username, password),
+		stomp.ConnOpt.HeartBeat(5*time.Second, 5*time.Second),
+	}
+	conn, err := stomp.Dial("tcp", address, stompOptions...)
+	if err != nil {
+		log.Fatal().Err(err).Msg("cannot connect to server")
+	}
+
+	sub, err := conn.Subscribe(queueName, stomp.AckAuto)
+	if err != nil {
+		log.Fatal().Str("queue", queueName).Err(err).Msg("cannot subscribe to queue")
+	}
+
+	log.Info().Str("queue", queueName).Str("source", string(sourceType)).Msg("Recording STOMP subscription")
+
+	for {
+		if !sub.Active() {
+			log.Fatal().Str("queue", queueName).Msg("STOMP channel no longer active")
+		}
+		msg := <-sub.C
+
+		if msg != nil {
+			if msg.Err != nil {
+				log.Fatal().Str("queue", queueName).Err(msg.Err).Msg("STOMP error")
+			}
+
+			if err := recording.Write(sourceType, "", msg.Body); err != nil {
+				log.Error().Err(err).Msg("Failed to write recorded message")
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const indexFilename = "index.jsonl"
+const payloadsDirectory = "payloads"
+
+type RecordingSourceType string
+
+const (
+	RecordingSourceTypeDataset RecordingSourceType = "dataset"
+	RecordingSourceTypeDarwin                      = "darwin"
+	RecordingSourceTypeTrust                       = "trust"
+)
+
+type RecordingEntry struct {
+	Timestamp time.Time
+
+	SourceType RecordingSourceType
+	DatasetID  string `json:",omitempty"`
+
+	Filename string
+}
+
+type Recording struct {
+	Directory string
+
+	index    *os.File
+	sequence int
+	mutex    sync.Mutex
+}
+
+func NewRecording(directory string) (*Recording, error) {
+	if err := os.MkdirAll(filepath.Join(directory, payloadsDirectory), 0755); err != nil {
+		return nil, err
+	}
+
+	index, err := os.OpenFile(filepath.Join(directory, indexFilename), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Recording{
+		Directory: directory,
+		index:     index,
+	}, nil
+}
+
+func (r *Recording) Write(sourceType RecordingSourceType, datasetID string, payload []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	r.sequence += 1
+
+	filename := filepath.Join(payloadsDirectory, fmt.Sprintf("%d-%06d-%s.bin", now.UnixNano(), r.sequence, sourceType))
+	if err := os.WriteFile(filepath.Join(r.Directory, filename), payload, 0644); err != nil {
+		return err
+	}
+
+	entryBytes, _ := json.Marshal(RecordingEntry{
+		Timestamp:  now,
+		SourceType: sourceType,
+		DatasetID:  datasetID,
+		Filename:   filename,
+	})
+
+	_, err := r.index.Write(append(entryBytes, '\n'))
+
+	return err
+}
+
+func (r *Recording) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.index.Close()
+}
+
+func LoadRecordingEntries(directory string) ([]RecordingEntry, error) {
+	index, err := os.Open(filepath.Join(directory, indexFilename))
+	if err != nil {
+		return nil, err
+	}
+	defer index.Close()
+
+	var entries []RecordingEntry
+
+	scanner := bufio.NewScanner(index)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry RecordingEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	return entries, nil
+}
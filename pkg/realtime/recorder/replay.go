@@ -0,0 +1,134 @@
+package recorder
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/dataimporter/datasets"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+	"github.com/travigo/travigo/pkg/realtime/nationalrail/darwin"
+	"github.com/travigo/travigo/pkg/realtime/nationalrail/nrod"
+	"github.com/travigo/travigo/pkg/util"
+)
+
+type Replayer struct {
+	Directory string
+
+	// Speed multiplier against the original recording, 0 replays as fast as possible
+	Speed float64
+
+	darwinClient *darwin.StompClient
+	nrodClient   *nrod.StompClient
+	datasets     map[string]*datasets.DataSet
+}
+
+func (r *Replayer) Run() error {
+	entries, err := LoadRecordingEntries(r.Directory)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		return errors.New("Recording has no entries")
+	}
+
+	r.datasets = map[string]*datasets.DataSet{}
+
+	log.Info().
+		Int("entries", len(entries)).
+		Time("start", entries[0].Timestamp).
+		Time("end", entries[len(entries)-1].Timestamp).
+		Float64("speed", r.Speed).
+		Msg("Starting replay")
+
+	defer util.ClearSimulatedTime()
+
+	replayStartTime := time.Now()
+	recordingStartTime := entries[0].Timestamp
+
+	for _, entry := range entries {
+		if r.Speed > 0 {
+			recordingOffset := entry.Timestamp.Sub(recordingStartTime)
+			waitTime := time.Duration(float64(recordingOffset)/r.Speed) - time.Since(replayStartTime)
+
+			if waitTime > 0 {
+				time.Sleep(waitTime)
+			}
+		}
+
+		util.SetSimulatedTime(entry.Timestamp, r.Speed)
+
+		if err := r.replayEntry(entry); err != nil {
+			log.Error().Err(err).Str("file", entry.Filename).Msg("Failed to replay entry")
+		}
+	}
+
+	log.Info().Str("duration", time.Since(replayStartTime).String()).Msg("Replay finished")
+
+	return nil
+}
+
+func (r *Replayer) replayEntry(entry RecordingEntry) error {
+	payloadPath := filepath.Join(r.Directory, entry.Filename)
+
+	log.Debug().Str("source", string(entry.SourceType)).Str("file", entry.Filename).Msg("Replaying entry")
+
+	switch entry.SourceType {
+	case RecordingSourceTypeDataset:
+		dataset, err := r.getDataset(entry.DatasetID)
+		if err != nil {
+			return err
+		}
+
+		dataset.Source = payloadPath
+
+		return manager.ImportDataset(dataset, true)
+	case RecordingSourceTypeDarwin:
+		payload, err := os.ReadFile(payloadPath)
+		if err != nil {
+			return err
+		}
+
+		if r.darwinClient == nil {
+			r.darwinClient = &darwin.StompClient{}
+			r.darwinClient.Setup()
+		}
+
+		return r.darwinClient.ParseMessage(payload)
+	case RecordingSourceTypeTrust:
+		payload, err := os.ReadFile(payloadPath)
+		if err != nil {
+			return err
+		}
+
+		if r.nrodClient == nil {
+			r.nrodClient = &nrod.StompClient{}
+			r.nrodClient.Setup()
+		}
+
+		r.nrodClient.ParseTrainMovementMessages(payload)
+	default:
+		return errors.New(fmt.Sprintf("Unknown source type %s", entry.SourceType))
+	}
+
+	return nil
+}
+
+func (r *Replayer) getDataset(identifier string) (*datasets.DataSet, error) {
+	if dataset, exists := r.datasets[identifier]; exists {
+		return dataset, nil
+	}
+
+	dataset, err := manager.GetDataset(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	r.datasets[identifier] = &dataset
+
+	return &dataset, nil
+}
@@ -0,0 +1,157 @@
+package recorder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// writeRecording creates a recording with the given payloads at fixed times, out of order to check they are sorted
+func writeRecording(t *testing.T, entries map[time.Time]string) string {
+	directory := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(directory, payloadsDirectory), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := os.Create(filepath.Join(directory, indexFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+
+	for timestamp, payload := range entries {
+		filename := filepath.Join(payloadsDirectory, fmt.Sprintf("%d-trust.bin", timestamp.UnixNano()))
+		if err := os.WriteFile(filepath.Join(directory, filename), []byte(payload), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		entryBytes, _ := json.Marshal(RecordingEntry{
+			Timestamp:  timestamp,
+			SourceType: RecordingSourceTypeTrust,
+			Filename:   filename,
+		})
+		index.Write(append(entryBytes, '\n'))
+	}
+
+	return directory
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	directory := t.TempDir()
+
+	recording, err := NewRecording(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recording.Write(RecordingSourceTypeDataset, "test-dataset", []byte("first"))
+	recording.Write(RecordingSourceTypeDarwin, "", []byte("second"))
+	recording.Close()
+
+	entries, err := LoadRecordingEntries(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].SourceType != RecordingSourceTypeDataset || entries[0].DatasetID != "test-dataset" {
+		t.Errorf("expected the dataset entry first, got %+v", entries[0])
+	}
+
+	for i, expected := range []string{"first", "second"} {
+		payload, err := os.ReadFile(filepath.Join(directory, entries[i].Filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != expected {
+			t.Errorf("expected payload %s, got %s", expected, payload)
+		}
+	}
+}
+
+func TestReplayUsesRecordedTimes(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	t.Setenv("TRAVIGO_REDIS_ADDRESS", redisServer.Addr())
+	if err := redis_client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	database.ConnectMemory()
+
+	database.GetCollection("stops").InsertOne(context.Background(), ctdf.Stop{
+		PrimaryIdentifier: "test-stop-a",
+		OtherIdentifiers:  []string{"gb-stanox-1000"},
+	})
+	database.GetCollection("stops").InsertOne(context.Background(), ctdf.Stop{
+		PrimaryIdentifier: "test-stop-b",
+		OtherIdentifiers:  []string{"gb-stanox-2000"},
+	})
+	database.GetCollection("realtime_journeys").InsertOne(context.Background(), ctdf.RealtimeJourney{
+		PrimaryIdentifier: "test-realtime-journey",
+		OtherIdentifiers:  map[string]string{"TrainID": "123A45MX05"},
+		Journey: &ctdf.Journey{
+			PrimaryIdentifier: "test-journey",
+			Path: []*ctdf.JourneyPathItem{
+				{OriginStopRef: "test-stop-a", DestinationStopRef: "test-stop-b"},
+			},
+		},
+	})
+
+	departureTime := time.Date(2024, 3, 5, 8, 15, 0, 0, time.UTC)
+	arrivalTime := time.Date(2024, 3, 5, 8, 42, 0, 0, time.UTC)
+
+	directory := writeRecording(t, map[time.Time]string{
+		arrivalTime:   `[{"header": {"msg_type": "0003"}, "body": {"event_type": "ARRIVAL", "train_id": "123A45MX05", "loc_stanox": "2000"}}]`,
+		departureTime: `[{"header": {"msg_type": "0003"}, "body": {"event_type": "DEPARTURE", "train_id": "123A45MX05", "loc_stanox": "1000"}}]`,
+	})
+
+	replayer := &Replayer{Directory: directory}
+	if err := replayer.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !util.Now().After(arrivalTime.Add(24 * time.Hour)) {
+		t.Error("expected the simulated clock to be cleared after the replay")
+	}
+
+	if len(replayer.nrodClient.Queue.Items) != 2 {
+		t.Fatalf("expected 2 updates, got %d", len(replayer.nrodClient.Queue.Items))
+	}
+
+	for _, expected := range []struct {
+		field string
+		time  time.Time
+	}{
+		{"stops.test-stop-a.departuretime", departureTime},
+		{"stops.test-stop-b.arrivaltime", arrivalTime},
+	} {
+		var update struct {
+			Set bson.M `bson:"$set"`
+		}
+		if err := bson.Unmarshal((<-replayer.nrodClient.Queue.Items).(*mongo.UpdateOneModel).Update.([]byte), &update); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, field := range []string{"modificationdatetime", expected.field} {
+			value, _ := update.Set[field].(primitive.DateTime)
+			if !value.Time().Equal(expected.time) {
+				t.Errorf("expected %s to be the recorded time %s, got %s", field, expected.time, value.Time())
+			}
+		}
+	}
+}
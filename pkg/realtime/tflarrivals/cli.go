@@ -11,6 +11,7 @@ import (
 	"github.com/travigo/travigo/pkg/ctdf"
 	dataaggregator "github.com/travigo/travigo/pkg/dataaggregator/global"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 	"go.mongodb.org/mongo-driver/bson"
@@ -128,6 +129,9 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
 
 					dataaggregator.Setup()
 
@@ -152,7 +156,7 @@ func RegisterCLI() *cli.Command {
 					}
 					trackerManager.Run(false)
 
-					redisConsumer := consumer.RedisConsumer{
+					queueConsumer := consumer.QueueConsumer{
 						QueueName:       "tfl-bus-queue",
 						NumberConsumers: 5,
 						BatchSize:       20,
@@ -160,7 +164,7 @@ func RegisterCLI() *cli.Command {
 						Consumer:        NewBusBatchConsumer(),
 					}
 
-					redisConsumer.Setup()
+					queueConsumer.Setup()
 
 					signals := make(chan os.Signal, 1)
 					signal.Notify(signals, syscall.SIGINT)
@@ -172,7 +176,7 @@ func RegisterCLI() *cli.Command {
 						os.Exit(1)
 					}()
 
-					<-redis_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+					<-queue_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
 
 					return nil
 				},
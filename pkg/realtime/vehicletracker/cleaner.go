@@ -3,18 +3,15 @@ package vehicletracker
 import (
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/rs/zerolog/log"
-	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 )
 
 func StartCleaner() {
-	cleaner := rmq.NewCleaner(redis_client.QueueConnection)
-
 	log.Info().Msg("Starting realtime_queue cleaner process")
 
 	for range time.Tick(5 * time.Minute) {
-		returned, err := cleaner.Clean()
+		returned, err := queue_client.QueueConnection.Clean()
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to clean")
 			continue
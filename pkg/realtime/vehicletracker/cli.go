@@ -7,6 +7,8 @@ import (
 
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"github.com/travigo/travigo/pkg/realtime/vehicletracker/identifiers"
 	"github.com/travigo/travigo/pkg/redis_client"
 	"github.com/urfave/cli/v2"
 )
@@ -19,6 +21,12 @@ func RegisterCLI() *cli.Command {
 			{
 				Name:  "run",
 				Usage: "run an instance of the realtime engine",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "journey-index",
+						Usage: "Keep an in-memory index of the days journeys for vehicle identification",
+					},
+				},
 				Action: func(c *cli.Context) error {
 					if err := database.Connect(); err != nil {
 						return err
@@ -29,6 +37,13 @@ func RegisterCLI() *cli.Command {
 					if err := redis_client.Connect(); err != nil {
 						return err
 					}
+					if err := queue_client.Connect(); err != nil {
+						return err
+					}
+
+					if c.Bool("journey-index") {
+						identifiers.StartJourneyIndex()
+					}
 
 					StartConsumers()
 
@@ -44,7 +59,7 @@ func RegisterCLI() *cli.Command {
 						os.Exit(1)
 					}()
 
-					<-redis_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+					StopConsumers() // wait for all Consume() calls to finish
 
 					return nil
 				},
@@ -53,7 +68,7 @@ func RegisterCLI() *cli.Command {
 				Name:  "cleaner",
 				Usage: "run an the queue cleaner for the realtime queue",
 				Action: func(c *cli.Context) error {
-					if err := redis_client.Connect(); err != nil {
+					if err := queue_client.Connect(); err != nil {
 						return err
 					}
 
@@ -69,7 +84,7 @@ func RegisterCLI() *cli.Command {
 						os.Exit(1)
 					}()
 
-					<-redis_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
+					<-queue_client.QueueConnection.StopAllConsuming() // wait for all Consume() calls to finish
 
 					return nil
 				},
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/adjust/rmq/v5"
@@ -12,10 +13,13 @@ import (
 	"github.com/eko/gocache/lib/v4/store"
 	redisstore "github.com/eko/gocache/store/redis/v4"
 	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
 	"github.com/travigo/travigo/pkg/elastic_client"
+	"github.com/travigo/travigo/pkg/queue_client"
 	"github.com/travigo/travigo/pkg/realtime/vehicletracker/identifiers"
 	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -44,43 +48,103 @@ func StartConsumers() {
 	CreateIdentificationCache()
 
 	// Run the background consumers
-	log.Info().Msg("Starting realtime consumers")
+	partitions := GetRealtimeQueuePartitionCount()
 
-	queue, err := redis_client.QueueConnection.OpenQueue("realtime-queue")
+	if partitions == 1 {
+		log.Info().Msg("Starting realtime consumers")
+
+		queue, err := queue_client.QueueConnection.OpenQueue(realtimeQueueName)
+		if err != nil {
+			panic(err)
+		}
+		if err := queue.StartConsuming(numConsumers*batchSize, 1*time.Second); err != nil {
+			panic(err)
+		}
+
+		for i := 0; i < numConsumers; i++ {
+			go startRealtimeConsumer(queue, fmt.Sprintf("%s-%d", realtimeQueueName, i), NewBatchConsumer(i))
+		}
+
+		return
+	}
+
+	// A single consumer per partition so updates for the same journey are always processed in order
+	ownedPartitions := getOwnedPartitions(partitions)
+	log.Info().Ints("partitions", ownedPartitions).Int("total", partitions).Msg("Starting partitioned realtime consumers")
+
+	for _, partition := range ownedPartitions {
+		go startPartitionConsumer(partition)
+	}
+}
+
+// StopConsumers waits for all Consume() calls to finish and hands the partitions back to the other replicas
+func StopConsumers() {
+	<-queue_client.QueueConnection.StopAllConsuming()
+
+	releasePartitionLeases()
+}
+
+// startPartitionConsumer only starts consuming the partition once this replica holds its lease
+func startPartitionConsumer(partition int) {
+	lease := acquirePartitionLease(partition)
+	go lease.keepRenewing(func(lease *partitionLease) {
+		log.Error().Int("partition", lease.partition).Msg("Lost the realtime partition lease, restarting to reassign partitions")
+
+		StopConsumers()
+		os.Exit(1)
+	})
+
+	queueName := RealtimeQueuePartitionName(partition)
+
+	queue, err := queue_client.QueueConnection.OpenQueue(queueName)
 	if err != nil {
 		panic(err)
 	}
-	if err := queue.StartConsuming(numConsumers*batchSize, 1*time.Second); err != nil {
+	if err := queue.StartConsuming(batchSize, 1*time.Second); err != nil {
 		panic(err)
 	}
 
-	for i := 0; i < numConsumers; i++ {
-		go startRealtimeConsumer(queue, i)
-	}
+	consumer := NewBatchConsumer(partition)
+	consumer.lease = lease
+
+	startRealtimeConsumer(queue, queueName, consumer)
 }
-func startRealtimeConsumer(queue rmq.Queue, id int) {
-	log.Info().Msgf("Starting realtime consumer %d", id)
 
-	if _, err := queue.AddBatchConsumer(fmt.Sprintf("realtime-queue-%d", id), batchSize, 2*time.Second, NewBatchConsumer(id)); err != nil {
+func startRealtimeConsumer(queue queue_client.Queue, tag string, consumer *BatchConsumer) {
+	log.Info().Msgf("Starting realtime consumer %s", tag)
+
+	if _, err := queue.AddBatchConsumer(tag, batchSize, 2*time.Second, consumer); err != nil {
 		panic(err)
 	}
 }
 
 type BatchConsumer struct {
 	id          int
-	TfLBusQueue rmq.Queue
+	TfLBusQueue queue_client.Queue
+
+	DelayThresholds []int
+
+	// lease is only set when consuming a partition of the realtime queue
+	lease *partitionLease
 }
 
 func NewBatchConsumer(id int) *BatchConsumer {
-	tfLBusQueue, err := redis_client.QueueConnection.OpenQueue("tfl-bus-queue")
+	tfLBusQueue, err := queue_client.QueueConnection.OpenQueue("tfl-bus-queue")
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to start notify queue")
 	}
 
-	return &BatchConsumer{id: id, TfLBusQueue: tfLBusQueue}
+	return &BatchConsumer{id: id, TfLBusQueue: tfLBusQueue, DelayThresholds: ctdf.GetRealtimeJourneyDelayThresholds()}
 }
 
 func (consumer *BatchConsumer) Consume(batch rmq.Deliveries) {
+	// Another replica may already be consuming the partition, the batch is left unacked so it goes back to the
+	// queue for the new owner
+	if consumer.lease != nil && !consumer.lease.Held() {
+		log.Warn().Int("partition", consumer.lease.partition).Msg("Realtime partition lease no longer held, skipping batch")
+		return
+	}
+
 	payloads := batch.Payloads()
 
 	var realtimeJourneyOperations []mongo.WriteModel
@@ -223,7 +287,7 @@ func (consumer *BatchConsumer) identifyService(sourceType string, identifyingInf
 }
 
 func (consumer *BatchConsumer) identifyVehicle(vehicleUpdateEvent *VehicleUpdateEvent, sourceType string, identifyingInformation map[string]string) string {
-	currentTime := time.Now()
+	currentTime := util.Now()
 	yearNumber, weekNumber := currentTime.ISOWeek()
 	identifyEventsIndexName := fmt.Sprintf("realtime-identify-events-%d-%d", yearNumber, weekNumber)
 
@@ -311,7 +375,7 @@ func (consumer *BatchConsumer) identifyVehicle(vehicleUpdateEvent *VehicleUpdate
 
 			// Record the failed identification event
 			elasticEvent, _ := json.Marshal(RealtimeIdentifyFailureElasticEvent{
-				Timestamp: time.Now(),
+				Timestamp: util.Now(),
 
 				Success:    false,
 				FailReason: errorCode,
@@ -7,6 +7,7 @@ import (
 
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -62,10 +63,14 @@ func (r *GTFSRT) IdentifyService() (string, error) {
 		return "", errors.New("Missing field linkedDataset")
 	}
 
-	var potentialServices []ctdf.Stop
-
 	formatedServiceID := fmt.Sprintf("%s-service-%s", linkedDataset, routeID)
 
+	if indexedServices := getJourneyIndex().GetServicesByIdentifier(linkedDataset, formatedServiceID); len(indexedServices) == 1 {
+		return indexedServices[0], nil
+	}
+
+	var potentialServices []ctdf.Service
+
 	cursor, _ := servicesCollection.Find(context.Background(), bson.M{
 		"$or": bson.A{
 			bson.M{"primaryidentifier": formatedServiceID},
@@ -78,7 +83,7 @@ func (r *GTFSRT) IdentifyService() (string, error) {
 	if len(potentialServices) == 0 {
 		return "", errors.New("Could not find referenced service")
 	} else if len(potentialServices) == 1 {
-		return potentialServices[0].PrimaryIdentifier, nil
+		return serviceIdentifier(&potentialServices[0]), nil
 	} else {
 		return "", errors.New("Could not find referenced service")
 	}
@@ -97,6 +102,10 @@ func (r *GTFSRT) IdentifyJourney() (string, error) {
 		return "", errors.New("Missing field linkedDataset")
 	}
 
+	if indexedJourneys := getJourneyIndex().GetJourneysByTripID(util.Now(), linkedDataset, tripID); len(indexedJourneys) == 1 {
+		return indexedJourneys[0], nil
+	}
+
 	var potentialJourneys []ctdf.Journey
 
 	cursor, _ := journeysCollection.Find(context.Background(), bson.M{
@@ -108,7 +117,7 @@ func (r *GTFSRT) IdentifyJourney() (string, error) {
 	if len(potentialJourneys) == 0 {
 		return "", errors.New("Could not find referenced trip")
 	} else if len(potentialJourneys) == 1 {
-		return potentialJourneys[0].PrimaryIdentifier, nil
+		return journeyIdentifier(&potentialJourneys[0]), nil
 	} else {
 		return "", errors.New("Could not find referenced trip")
 	}
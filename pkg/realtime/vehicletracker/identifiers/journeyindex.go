@@ -0,0 +1,323 @@
+package identifiers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const journeyIndexRefreshInterval = 5 * time.Minute
+
+// JourneyIndex is an in-memory copy of the records needed to identify vehicles on a single day
+type JourneyIndex struct {
+	Date           time.Time
+	DatasetVersion time.Time
+	LoadedAt       time.Time
+
+	operators map[string]*ctdf.Operator
+
+	servicesByNameOperator map[string][]string
+	servicesByIdentifier   map[string][]string
+
+	journeysByService map[string][]*ctdf.Journey
+	journeysByTripID  map[string][]string
+
+	duplicateServices map[string]string
+}
+
+var journeyIndex *JourneyIndex
+var journeyIndexMutex sync.RWMutex
+
+func StartJourneyIndex() {
+	refreshJourneyIndex()
+
+	go func() {
+		for range time.Tick(journeyIndexRefreshInterval) {
+			refreshJourneyIndex()
+		}
+	}()
+}
+
+func getJourneyIndex() *JourneyIndex {
+	journeyIndexMutex.RLock()
+	defer journeyIndexMutex.RUnlock()
+
+	return journeyIndex
+}
+
+func refreshJourneyIndex() {
+	now := util.Now()
+	date := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	datasetVersion := getLatestDatasetVersion()
+
+	currentIndex := getJourneyIndex()
+	if currentIndex != nil && currentIndex.Date.Equal(date) && !datasetVersion.After(currentIndex.DatasetVersion) {
+		return
+	}
+
+	log.Info().Time("date", date).Time("datasetversion", datasetVersion).Msg("Building journey index")
+
+	startTime := time.Now()
+	newIndex, err := buildJourneyIndex(date)
+	if err != nil {
+		// Keep using the previous index, it's tried again on the next refresh
+		log.Error().Err(err).Time("date", date).Msg("Failed to build journey index")
+		return
+	}
+	newIndex.DatasetVersion = datasetVersion
+
+	journeyIndexMutex.Lock()
+	journeyIndex = newIndex
+	journeyIndexMutex.Unlock()
+
+	log.Info().
+		Int("operators", len(newIndex.operators)).
+		Int("services", len(newIndex.servicesByNameOperator)).
+		Int("journeyservices", len(newIndex.journeysByService)).
+		Str("time", time.Since(startTime).String()).
+		Msg("Built journey index")
+}
+
+func getLatestDatasetVersion() time.Time {
+	datasetVersionCollection := database.GetCollection("dataset_versions")
+
+	var latestDatasetVersion *ctdf.DatasetVersion
+	opts := options.FindOne().SetSort(bson.D{{Key: "lastmodified", Value: -1}})
+	datasetVersionCollection.FindOne(context.Background(), bson.M{}, opts).Decode(&latestDatasetVersion)
+
+	if latestDatasetVersion == nil {
+		return time.Time{}
+	}
+
+	return latestDatasetVersion.LastModified
+}
+
+// journeyAvailabilityQuery narrows the journeys down to the ones that could run on the date, MatchDate still has to
+// be checked on each of them as date ranges & the secondary, condition & exclude rules are left to it
+func journeyAvailabilityQuery(date time.Time) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{"availability.match": bson.M{"$elemMatch": bson.M{"type": ctdf.AvailabilityDayOfWeek, "value": date.Weekday().String()}}},
+			bson.M{"availability.match": bson.M{"$elemMatch": bson.M{"type": ctdf.AvailabilityDate, "value": date.Format(ctdf.YearMonthDayFormat)}}},
+			bson.M{"availability.match.type": bson.M{"$in": bson.A{ctdf.AvailabilityDateRange, ctdf.AvailabilityMatchAll}}},
+		},
+	}
+}
+
+func buildJourneyIndex(date time.Time) (*JourneyIndex, error) {
+	index := &JourneyIndex{
+		Date:     date,
+		LoadedAt: time.Now(),
+
+		operators: map[string]*ctdf.Operator{},
+
+		servicesByNameOperator: map[string][]string{},
+		servicesByIdentifier:   map[string][]string{},
+
+		journeysByService: map[string][]*ctdf.Journey{},
+		journeysByTripID:  map[string][]string{},
+
+		duplicateServices: map[string]string{},
+	}
+
+	// Operators
+	operatorsCollection := database.GetCollection("operators")
+	cursor, err := operatorsCollection.Find(context.Background(), bson.M{}, options.Find().SetProjection(bson.D{
+		bson.E{Key: "primaryidentifier", Value: 1},
+		bson.E{Key: "otheridentifiers", Value: 1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	for cursor.Next(context.Background()) {
+		var operator *ctdf.Operator
+		if err := cursor.Decode(&operator); err != nil {
+			log.Error().Err(err).Msg("Failed to decode operator")
+			continue
+		}
+
+		index.operators[operator.PrimaryIdentifier] = operator
+		for _, otherIdentifier := range operator.OtherIdentifiers {
+			index.operators[otherIdentifier] = operator
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// Services
+	servicesCollection := database.GetCollection("services")
+	cursor, err = servicesCollection.Find(context.Background(), bson.M{}, options.Find().SetProjection(bson.D{
+		bson.E{Key: "primaryidentifier", Value: 1},
+		bson.E{Key: "otheridentifiers", Value: 1},
+		bson.E{Key: "servicename", Value: 1},
+		bson.E{Key: "operatorref", Value: 1},
+		bson.E{Key: "datasource.datasetid", Value: 1},
+		bson.E{Key: "duplicateof", Value: 1},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	for cursor.Next(context.Background()) {
+		var service *ctdf.Service
+		if err := cursor.Decode(&service); err != nil {
+			log.Error().Err(err).Msg("Failed to decode service")
+			continue
+		}
+
+		// Duplicate services are still found by their own identifiers but resolve to the preferred service
+		serviceRef := serviceIdentifier(service)
+		if service.DuplicateOf != "" {
+			index.duplicateServices[service.PrimaryIdentifier] = service.DuplicateOf
+		}
+
+		nameOperatorKey := serviceNameOperatorKey(service.ServiceName, service.OperatorRef)
+		if !slices.Contains(index.servicesByNameOperator[nameOperatorKey], serviceRef) {
+			index.servicesByNameOperator[nameOperatorKey] = append(index.servicesByNameOperator[nameOperatorKey], serviceRef)
+		}
+
+		if service.DataSource != nil {
+			for _, identifier := range append([]string{service.PrimaryIdentifier}, service.OtherIdentifiers...) {
+				identifierKey := datasetIdentifierKey(service.DataSource.DatasetID, identifier)
+				index.servicesByIdentifier[identifierKey] = append(index.servicesByIdentifier[identifierKey], serviceRef)
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	// Journeys available on the index date
+	journeysCollection := database.GetCollection("journeys")
+	cursor, err = journeysCollection.Find(context.Background(), journeyAvailabilityQuery(date), options.Find().SetProjection(bson.D{
+		bson.E{Key: "_id", Value: 0},
+		bson.E{Key: "creationdatetime", Value: 0},
+		bson.E{Key: "modificationdatetime", Value: 0},
+		bson.E{Key: "destinationdisplay", Value: 0},
+		bson.E{Key: "track", Value: 0},
+		bson.E{Key: "path.track", Value: 0},
+		bson.E{Key: "path.originactivity", Value: 0},
+		bson.E{Key: "path.destinationactivity", Value: 0},
+		bson.E{Key: "detailedrailinformation", Value: 0},
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	for cursor.Next(context.Background()) {
+		var journey *ctdf.Journey
+		if err := cursor.Decode(&journey); err != nil {
+			log.Error().Err(err).Msg("Failed to decode journey")
+			continue
+		}
+
+		if journey.Availability == nil || !journey.Availability.MatchDate(date) {
+			continue
+		}
+
+		// Clip the rule slices so GenerateFunctionalHash can't append into a backing array shared between consumers
+		journey.Availability.Match = slices.Clip(journey.Availability.Match)
+		journey.Availability.MatchSecondary = slices.Clip(journey.Availability.MatchSecondary)
+		journey.Availability.Exclude = slices.Clip(journey.Availability.Exclude)
+		journey.Availability.Condition = slices.Clip(journey.Availability.Condition)
+
+		// Journeys of duplicate services are kept with the preferred service, including duplicate journeys
+		// as they may have identifiers the preferred journey doesn't
+		serviceRef := journey.ServiceRef
+		if duplicateOf, exists := index.duplicateServices[serviceRef]; exists {
+			serviceRef = duplicateOf
+		}
+		index.journeysByService[serviceRef] = append(index.journeysByService[serviceRef], journey)
+
+		if tripID := journey.OtherIdentifiers["GTFS-TripID"]; tripID != "" && journey.DataSource != nil {
+			tripKey := datasetIdentifierKey(journey.DataSource.DatasetID, tripID)
+			index.journeysByTripID[tripKey] = append(index.journeysByTripID[tripKey], journeyIdentifier(journey))
+		}
+
+		journey.DataSource = nil
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+func serviceNameOperatorKey(serviceName string, operatorRef string) string {
+	return fmt.Sprintf("%s/%s", operatorRef, serviceName)
+}
+
+func datasetIdentifierKey(datasetID string, identifier string) string {
+	return fmt.Sprintf("%s/%s", datasetID, identifier)
+}
+
+func (index *JourneyIndex) coversDate(date time.Time) bool {
+	return index != nil && index.Date.Year() == date.Year() && index.Date.YearDay() == date.YearDay()
+}
+
+func (index *JourneyIndex) GetOperator(identifier string) *ctdf.Operator {
+	if index == nil {
+		return nil
+	}
+
+	return index.operators[identifier]
+}
+
+func (index *JourneyIndex) GetServicesByName(serviceName string, operatorRefs []string) []string {
+	if index == nil {
+		return nil
+	}
+
+	var services []string
+	for _, operatorRef := range operatorRefs {
+		services = append(services, index.servicesByNameOperator[serviceNameOperatorKey(serviceName, operatorRef)]...)
+	}
+
+	return services
+}
+
+func (index *JourneyIndex) GetServicesByIdentifier(datasetID string, identifier string) []string {
+	if index == nil {
+		return nil
+	}
+
+	return index.servicesByIdentifier[datasetIdentifierKey(datasetID, identifier)]
+}
+
+func (index *JourneyIndex) GetJourneysByTripID(date time.Time, datasetID string, tripID string) []string {
+	if !index.coversDate(date) {
+		return nil
+	}
+
+	return index.journeysByTripID[datasetIdentifierKey(datasetID, tripID)]
+}
+
+func (index *JourneyIndex) GetJourneys(date time.Time, services []string, filter func(*ctdf.Journey) bool) []*ctdf.Journey {
+	if !index.coversDate(date) {
+		return nil
+	}
+
+	var journeys []*ctdf.Journey
+	for _, service := range services {
+		for _, journey := range index.journeysByService[service] {
+			if filter(journey) {
+				journeys = append(journeys, journey)
+			}
+		}
+	}
+
+	return journeys
+}
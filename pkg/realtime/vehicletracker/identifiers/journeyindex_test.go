@@ -0,0 +1,78 @@
+package identifiers
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+)
+
+func TestBuildJourneyIndex(t *testing.T) {
+	database.ConnectMemory()
+
+	// A Tuesday
+	date := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	database.GetCollection("operators").InsertOne(context.Background(), ctdf.Operator{
+		PrimaryIdentifier: "gb-noc-TEST",
+		OtherIdentifiers:  []string{"gb-noc-TEST", "gb-nocid-1"},
+	})
+	database.GetCollection("services").InsertOne(context.Background(), ctdf.Service{
+		PrimaryIdentifier: "test-service",
+		ServiceName:       "X1",
+		OperatorRef:       "gb-noc-TEST",
+		DataSource:        &ctdf.DataSourceReference{DatasetID: "test-dataset"},
+	})
+
+	for identifier, availability := range map[string]*ctdf.Availability{
+		"tuesday":  {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDayOfWeek, Value: "Tuesday"}}},
+		"date":     {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: "2024-03-05"}}},
+		"range":    {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDateRange, Value: "2024-03-01:2024-03-31"}}},
+		"all":      {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityMatchAll}}},
+		"saturday": {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDayOfWeek, Value: "Saturday"}}},
+		"tomorrow": {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: "2024-03-06"}}},
+		"february": {Match: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDateRange, Value: "2024-02-01:2024-02-29"}}},
+		"excluded": {
+			Match:   []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDayOfWeek, Value: "Tuesday"}},
+			Exclude: []ctdf.AvailabilityRule{{Type: ctdf.AvailabilityDate, Value: "2024-03-05"}},
+		},
+		"none": nil,
+	} {
+		database.GetCollection("journeys").InsertOne(context.Background(), ctdf.Journey{
+			PrimaryIdentifier: identifier,
+			ServiceRef:        "test-service",
+			Availability:      availability,
+		})
+	}
+
+	index, err := buildJourneyIndex(date)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if operator := index.GetOperator("gb-nocid-1"); operator == nil || operator.PrimaryIdentifier != "gb-noc-TEST" {
+		t.Errorf("expected the operator to be found by its other identifiers, got %v", operator)
+	}
+	if services := index.GetServicesByName("X1", []string{"gb-noc-TEST"}); len(services) != 1 || services[0] != "test-service" {
+		t.Errorf("expected the service to be found by name, got %v", services)
+	}
+
+	var journeys []string
+	for _, journey := range index.GetJourneys(date, []string{"test-service"}, func(*ctdf.Journey) bool { return true }) {
+		journeys = append(journeys, journey.PrimaryIdentifier)
+	}
+	sort.Strings(journeys)
+
+	expected := []string{"all", "date", "range", "tuesday"}
+	if len(journeys) != len(expected) {
+		t.Fatalf("expected journeys %v, got %v", expected, journeys)
+	}
+	for i := range expected {
+		if journeys[i] != expected[i] {
+			t.Fatalf("expected journeys %v, got %v", expected, journeys)
+		}
+	}
+}
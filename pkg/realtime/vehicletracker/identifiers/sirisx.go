@@ -67,8 +67,9 @@ func (r *SiriSX) IdentifyService() (string, error) {
 		return "", errors.New("Missing field linkedDataset")
 	}
 
-	var potentialServices []ctdf.Stop
+	var potentialServices []ctdf.Service
 
+	// Services duplicated from other datasets are kept so can still be found here & resolved to the preferred one
 	cursor, _ := servicesCollection.Find(context.Background(), bson.M{
 		"servicename":          lineRef,
 		"operatorref":          fmt.Sprintf("gb-noc-%s", operatorRef),
@@ -79,7 +80,7 @@ func (r *SiriSX) IdentifyService() (string, error) {
 	if len(potentialServices) == 0 {
 		return "", errors.New("Could not find referenced service")
 	} else if len(potentialServices) == 1 {
-		return potentialServices[0].PrimaryIdentifier, nil
+		return serviceIdentifier(&potentialServices[0]), nil
 	} else {
 		return "", errors.New("Could not find referenced service")
 	}
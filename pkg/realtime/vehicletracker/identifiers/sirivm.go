@@ -4,11 +4,13 @@ import (
 	"context"
 	"errors"
 	"regexp"
+	"slices"
 	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
@@ -20,8 +22,13 @@ type SiriVM struct {
 }
 
 func (i *SiriVM) getOperator() *ctdf.Operator {
-	var operator *ctdf.Operator
 	operatorRef := i.IdentifyingInformation["OperatorRef"]
+
+	if operator := getJourneyIndex().GetOperator(operatorRef); operator != nil {
+		return operator
+	}
+
+	var operator *ctdf.Operator
 	operatorsCollection := database.GetCollection("operators")
 	query := bson.M{"$or": bson.A{bson.M{"primaryidentifier": operatorRef}, bson.M{"otheridentifiers": operatorRef}}}
 	operatorsCollection.FindOne(context.Background(), query).Decode(&operator)
@@ -37,6 +44,26 @@ func (i *SiriVM) getServices() []string {
 		serviceName = i.IdentifyingInformation["ServiceNameRef"]
 	}
 
+	services = i.findServicesByName(serviceName)
+
+	serviceNameRegex, _ := regexp.Compile("^\\D+(\\d+)$")
+	if len(services) == 0 {
+		serviceNameMatch := serviceNameRegex.FindStringSubmatch(serviceName)
+
+		if len(serviceNameMatch) == 2 {
+			services = i.findServicesByName(serviceNameMatch[1])
+		}
+	}
+
+	return services
+}
+
+func (i *SiriVM) findServicesByName(serviceName string) []string {
+	services := getJourneyIndex().GetServicesByName(serviceName, i.Operator.OtherIdentifiers)
+	if len(services) > 0 {
+		return services
+	}
+
 	servicesCollection := database.GetCollection("services")
 
 	cursor, err := servicesCollection.Find(context.Background(), bson.M{
@@ -56,29 +83,8 @@ func (i *SiriVM) getServices() []string {
 			log.Error().Err(err).Str("serviceName", serviceName).Msg("Failed to decode service")
 		}
 
-		services = append(services, service.PrimaryIdentifier)
-	}
-
-	serviceNameRegex, _ := regexp.Compile("^\\D+(\\d+)$")
-	if len(services) == 0 {
-		serviceNameMatch := serviceNameRegex.FindStringSubmatch(serviceName)
-
-		if len(serviceNameMatch) == 2 {
-			cursor, _ := servicesCollection.Find(context.Background(), bson.M{
-				"$and": bson.A{bson.M{"servicename": serviceNameMatch[1]},
-					bson.M{"operatorref": bson.M{"$in": i.Operator.OtherIdentifiers}},
-				},
-			})
-
-			for cursor.Next(context.Background()) {
-				var service *ctdf.Service
-				err := cursor.Decode(&service)
-				if err != nil {
-					log.Error().Err(err).Str("serviceName", serviceName).Msg("Failed to decode service")
-				}
-
-				services = append(services, service.PrimaryIdentifier)
-			}
+		if serviceRef := serviceIdentifier(service); !slices.Contains(services, serviceRef) {
+			services = append(services, serviceRef)
 		}
 	}
 
@@ -86,7 +92,7 @@ func (i *SiriVM) getServices() []string {
 }
 
 func (i *SiriVM) IdentifyJourney() (string, error) {
-	i.CurrentTime = time.Now()
+	i.CurrentTime = util.Now()
 
 	// Get the directly referenced Operator
 	i.Operator = i.getOperator()
@@ -105,13 +111,13 @@ func (i *SiriVM) IdentifyJourney() (string, error) {
 	// Get the relevant Journeys
 	var framedVehicleJourneyDate time.Time
 	if i.IdentifyingInformation["FramedVehicleJourneyDate"] == "" {
-		framedVehicleJourneyDate = time.Now()
+		framedVehicleJourneyDate = util.Now()
 	} else {
 		framedVehicleJourneyDate, _ = time.Parse(ctdf.YearMonthDayFormat, i.IdentifyingInformation["FramedVehicleJourneyDate"])
 
 		// Fallback for dodgy formatted frames
 		if framedVehicleJourneyDate.Year() < 2024 {
-			framedVehicleJourneyDate = time.Now()
+			framedVehicleJourneyDate = util.Now()
 		}
 	}
 
@@ -120,60 +126,83 @@ func (i *SiriVM) IdentifyJourney() (string, error) {
 	vehicleJourneyRef := i.IdentifyingInformation["VehicleJourneyRef"]
 	blockRef := i.IdentifyingInformation["BlockRef"]
 	journeysCollection := database.GetCollection("journeys")
+	index := getJourneyIndex()
 
 	// First try getting Journeys by the TicketMachineJourneyCode
 	if vehicleJourneyRef != "" {
-		journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{
-			"$and": bson.A{
-				bson.M{"serviceref": bson.M{"$in": i.PotentialServices}},
-				bson.M{"otheridentifiers.TicketMachineJourneyCode": vehicleJourneyRef},
-			},
+		journeys = index.GetJourneys(framedVehicleJourneyDate, i.PotentialServices, func(journey *ctdf.Journey) bool {
+			return journey.OtherIdentifiers["TicketMachineJourneyCode"] == vehicleJourneyRef
 		})
+		if len(journeys) == 0 {
+			journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{
+				"$and": bson.A{
+					bson.M{"serviceref": bson.M{"$in": i.PotentialServices}},
+					bson.M{"otheridentifiers.TicketMachineJourneyCode": vehicleJourneyRef},
+				},
+			})
+		}
 		identifiedJourney, err := i.narrowJourneys(journeys, true)
 		if err == nil {
-			return identifiedJourney.PrimaryIdentifier, nil
+			return journeyIdentifier(identifiedJourney), nil
 		}
 	}
 
 	// Fallback to Block Ref (incorrect usage of block ref but it kinda works)
 	if blockRef != "" {
-		journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{
-			"$and": bson.A{
-				bson.M{"serviceref": bson.M{"$in": i.PotentialServices}},
-				bson.M{"otheridentifiers.BlockNumber": blockRef},
-			},
+		journeys = index.GetJourneys(framedVehicleJourneyDate, i.PotentialServices, func(journey *ctdf.Journey) bool {
+			return journey.OtherIdentifiers["BlockNumber"] == blockRef
 		})
+		if len(journeys) == 0 {
+			journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{
+				"$and": bson.A{
+					bson.M{"serviceref": bson.M{"$in": i.PotentialServices}},
+					bson.M{"otheridentifiers.BlockNumber": blockRef},
+				},
+			})
+		}
 		identifiedJourney, err := i.narrowJourneys(journeys, true)
 		if err == nil {
-			return identifiedJourney.PrimaryIdentifier, nil
+			return journeyIdentifier(identifiedJourney), nil
 		}
 	}
 
 	// If we fail with the ID codes then try with the origin & destination stops
-	var journeyQuery []bson.M
-	for _, service := range i.PotentialServices {
-		journeyQuery = append(journeyQuery, bson.M{"$or": bson.A{
-			bson.M{
-				"$and": bson.A{
-					bson.M{"serviceref": service},
-					bson.M{"path.originstopref": i.IdentifyingInformation["OriginRef"]},
+	journeys = index.GetJourneys(framedVehicleJourneyDate, i.PotentialServices, func(journey *ctdf.Journey) bool {
+		for _, pathItem := range journey.Path {
+			if pathItem.OriginStopRef == i.IdentifyingInformation["OriginRef"] || pathItem.DestinationStopRef == i.IdentifyingInformation["DestinationRef"] {
+				return true
+			}
+		}
+
+		return false
+	})
+
+	if len(journeys) == 0 {
+		var journeyQuery []bson.M
+		for _, service := range i.PotentialServices {
+			journeyQuery = append(journeyQuery, bson.M{"$or": bson.A{
+				bson.M{
+					"$and": bson.A{
+						bson.M{"serviceref": service},
+						bson.M{"path.originstopref": i.IdentifyingInformation["OriginRef"]},
+					},
 				},
-			},
-			bson.M{
-				"$and": bson.A{
-					bson.M{"serviceref": service},
-					bson.M{"path.destinationstopref": i.IdentifyingInformation["DestinationRef"]},
+				bson.M{
+					"$and": bson.A{
+						bson.M{"serviceref": service},
+						bson.M{"path.destinationstopref": i.IdentifyingInformation["DestinationRef"]},
+					},
 				},
-			},
-		}})
-	}
+			}})
+		}
 
-	journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{"$or": journeyQuery})
+		journeys = getAvailableJourneys(journeysCollection, framedVehicleJourneyDate, bson.M{"$or": journeyQuery})
+	}
 
 	identifiedJourney, err := i.narrowJourneys(journeys, true)
 
 	if err == nil {
-		return identifiedJourney.PrimaryIdentifier, nil
+		return journeyIdentifier(identifiedJourney), nil
 	} else {
 		// log.Debug().Err(err).Int("length", len(journeys)).Msgf("wtf")
 
@@ -188,6 +217,7 @@ func (i *SiriVM) IdentifyJourney() (string, error) {
 }
 
 func (i *SiriVM) narrowJourneys(journeys []*ctdf.Journey, includeAvailabilityCondition bool) (*ctdf.Journey, error) {
+	journeys = removeDuplicatedJourneys(journeys)
 	journeys = ctdf.FilterIdenticalJourneys(journeys, includeAvailabilityCondition)
 
 	if len(journeys) == 0 {
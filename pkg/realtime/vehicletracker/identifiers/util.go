@@ -6,12 +6,12 @@ import (
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func getAvailableJourneys(journeysCollection *mongo.Collection, framedVehicleJourneyDate time.Time, query bson.M) []*ctdf.Journey {
+func getAvailableJourneys(journeysCollection database.Collection, framedVehicleJourneyDate time.Time, query bson.M) []*ctdf.Journey {
 	var journeys []*ctdf.Journey
 
 	opts := options.Find().SetProjection(bson.D{
@@ -42,3 +42,40 @@ func getAvailableJourneys(journeysCollection *mongo.Collection, framedVehicleJou
 
 	return journeys
 }
+
+// serviceIdentifier is the identifier realtime data should use for the service, duplicates of a service from
+// a higher priority dataset resolve to that service
+func serviceIdentifier(service *ctdf.Service) string {
+	if service.DuplicateOf != "" {
+		return service.DuplicateOf
+	}
+
+	return service.PrimaryIdentifier
+}
+
+// journeyIdentifier is the identifier realtime data should use for the journey, duplicates of a journey from
+// a higher priority dataset resolve to that journey
+func journeyIdentifier(journey *ctdf.Journey) string {
+	if journey.DuplicateOf != "" {
+		return journey.DuplicateOf
+	}
+
+	return journey.PrimaryIdentifier
+}
+
+// removeDuplicatedJourneys drops the journeys that duplicate another one of the journeys
+func removeDuplicatedJourneys(journeys []*ctdf.Journey) []*ctdf.Journey {
+	identifiers := map[string]bool{}
+	for _, journey := range journeys {
+		identifiers[journey.PrimaryIdentifier] = true
+	}
+
+	var filteredJourneys []*ctdf.Journey
+	for _, journey := range journeys {
+		if journey.DuplicateOf == "" || !identifiers[journey.DuplicateOf] {
+			filteredJourneys = append(filteredJourneys, journey)
+		}
+	}
+
+	return filteredJourneys
+}
@@ -0,0 +1,211 @@
+package vehicletracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/queue_client"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"github.com/travigo/travigo/pkg/util"
+)
+
+const realtimeQueueName = "realtime-queue"
+
+const replicaHeartbeatInterval = 10 * time.Second
+const replicaHeartbeatExpiry = 30 * time.Second
+
+// GetRealtimeQueuePartitionCount returns the number of sub-queues the realtime-queue is split into.
+// A single partition keeps the legacy unpartitioned realtime-queue.
+func GetRealtimeQueuePartitionCount() int {
+	env := util.GetEnvironmentVariables()
+
+	if partitions, err := strconv.Atoi(env["TRAVIGO_REALTIME_QUEUE_PARTITIONS"]); err == nil && partitions > 1 {
+		return partitions
+	}
+
+	return 1
+}
+
+func RealtimeQueuePartitionName(partition int) string {
+	if GetRealtimeQueuePartitionCount() == 1 {
+		return realtimeQueueName
+	}
+
+	return fmt.Sprintf("%s-partition-%d", realtimeQueueName, partition)
+}
+
+func PartitionForKey(key string, partitions int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(partitions))
+}
+
+// PartitionKey keeps all the updates for a single vehicle journey on the same partition so they are processed in order
+func (e *VehicleUpdateEvent) PartitionKey() string {
+	return e.LocalID
+}
+
+type PartitionedRealtimeQueue struct {
+	partitions []queue_client.Queue
+}
+
+func OpenPartitionedRealtimeQueue() (*PartitionedRealtimeQueue, error) {
+	partitionCount := GetRealtimeQueuePartitionCount()
+
+	partitionedQueue := &PartitionedRealtimeQueue{}
+
+	for i := 0; i < partitionCount; i++ {
+		queue, err := queue_client.QueueConnection.OpenQueue(RealtimeQueuePartitionName(i))
+		if err != nil {
+			return nil, err
+		}
+
+		partitionedQueue.partitions = append(partitionedQueue.partitions, queue)
+	}
+
+	return partitionedQueue, nil
+}
+
+func (q *PartitionedRealtimeQueue) Publish(event *VehicleUpdateEvent) error {
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	partition := PartitionForKey(event.PartitionKey(), len(q.partitions))
+
+	return q.partitions[partition].PublishBytes(eventBytes)
+}
+
+func (q *PartitionedRealtimeQueue) ReadyCount() int64 {
+	var readyCount int64
+
+	for _, partition := range q.partitions {
+		partitionReadyCount, err := partition.ReadyCount()
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get realtime queue size")
+			continue
+		}
+
+		readyCount += partitionReadyCount
+	}
+
+	return readyCount
+}
+
+// getOwnedPartitions assigns partitions to this replica based on its ordinal so that
+// each partition is only ever consumed by a single replica.
+// When TRAVIGO_REALTIME_REPLICAS isn't set the number of replicas can change (eg. when autoscaled) so it's worked out
+// from the replicas heartbeats instead, and the process restarts to pick up its new partitions when it changes
+func getOwnedPartitions(partitions int) []int {
+	env := util.GetEnvironmentVariables()
+
+	replicaIndex := getReplicaIndex()
+
+	replicas, err := strconv.Atoi(env["TRAVIGO_REALTIME_REPLICAS"])
+	if err != nil || replicas < 1 {
+		startReplicaHeartbeat(replicaIndex)
+		replicas = countLiveReplicas(replicaIndex)
+
+		go watchLiveReplicas(replicaIndex, replicas)
+	} else if replicaIndex >= replicas {
+		log.Fatal().Int("index", replicaIndex).Int("replicas", replicas).Msg("Replica index is outside of TRAVIGO_REALTIME_REPLICAS")
+	}
+
+	log.Info().Int("index", replicaIndex).Int("replicas", replicas).Msg("Assigning realtime queue partitions")
+
+	return partitionsForReplica(partitions, replicas, replicaIndex)
+}
+
+func partitionsForReplica(partitions int, replicas int, replicaIndex int) []int {
+	var owned []int
+	for partition := 0; partition < partitions; partition++ {
+		if partition%replicas == replicaIndex%replicas {
+			owned = append(owned, partition)
+		}
+	}
+
+	return owned
+}
+
+func getReplicaIndex() int {
+	env := util.GetEnvironmentVariables()
+
+	if replicaIndex, err := strconv.Atoi(env["TRAVIGO_REALTIME_REPLICA_INDEX"]); err == nil {
+		return replicaIndex
+	}
+
+	// Fallback to the StatefulSet pod ordinal in the hostname
+	hostname, _ := os.Hostname()
+	ordinalMatch := regexp.MustCompile("-(\\d+)$").FindStringSubmatch(hostname)
+
+	if len(ordinalMatch) != 2 {
+		log.Warn().Str("hostname", hostname).Msg("No replica index in TRAVIGO_REALTIME_REPLICA_INDEX or the hostname, assuming a single replica")
+		return 0
+	}
+
+	replicaIndex, _ := strconv.Atoi(ordinalMatch[1])
+
+	return replicaIndex
+}
+
+func replicaHeartbeatKey(replicaIndex int) string {
+	return fmt.Sprintf("%s-replica/%d", realtimeQueueName, replicaIndex)
+}
+
+func startReplicaHeartbeat(replicaIndex int) {
+	heartbeat := func() {
+		if err := redis_client.Client.Set(context.Background(), replicaHeartbeatKey(replicaIndex), 1, replicaHeartbeatExpiry).Err(); err != nil {
+			log.Error().Err(err).Msg("Failed to send realtime replica heartbeat")
+		}
+	}
+	heartbeat()
+
+	go func() {
+		for range time.Tick(replicaHeartbeatInterval) {
+			heartbeat()
+		}
+	}()
+
+	// Give replicas starting at the same time a chance to be seen
+	time.Sleep(replicaHeartbeatInterval)
+}
+
+// countLiveReplicas counts the replicas with a recent heartbeat. StatefulSet ordinals are contiguous so
+// it stops at the first missing one, this replica always counts
+func countLiveReplicas(replicaIndex int) int {
+	replicas := 0
+
+	for {
+		exists, err := redis_client.Client.Exists(context.Background(), replicaHeartbeatKey(replicas)).Result()
+		if err != nil || exists == 0 {
+			break
+		}
+
+		replicas++
+	}
+
+	return max(replicas, replicaIndex+1)
+}
+
+func watchLiveReplicas(replicaIndex int, replicas int) {
+	for range time.Tick(replicaHeartbeatInterval) {
+		liveReplicas := countLiveReplicas(replicaIndex)
+		if liveReplicas == replicas {
+			continue
+		}
+
+		log.Info().Int("replicas", replicas).Int("live", liveReplicas).Msg("Number of realtime replicas changed, restarting to reassign partitions")
+
+		StopConsumers()
+		os.Exit(0)
+	}
+}
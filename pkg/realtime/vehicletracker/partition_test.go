@@ -0,0 +1,102 @@
+package vehicletracker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/travigo/travigo/pkg/redis_client"
+)
+
+func TestPartitionForKey(t *testing.T) {
+	for _, partitions := range []int{1, 4, 7} {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("vehicle-journey-%d", i)
+
+			partition := PartitionForKey(key, partitions)
+			if partition < 0 || partition >= partitions {
+				t.Fatalf("expected %s to be in one of %d partitions, got %d", key, partitions, partition)
+			}
+			if PartitionForKey(key, partitions) != partition {
+				t.Fatalf("expected %s to always be in the same partition", key)
+			}
+		}
+	}
+}
+
+func TestPartitionsForReplica(t *testing.T) {
+	for _, test := range []struct {
+		partitions int
+		replicas   int
+		expected   [][]int
+	}{
+		{4, 1, [][]int{{0, 1, 2, 3}}},
+		{4, 2, [][]int{{0, 2}, {1, 3}}},
+		{5, 3, [][]int{{0, 3}, {1, 4}, {2}}},
+		{2, 3, [][]int{{0}, {1}, nil}},
+	} {
+		owners := map[int]int{}
+
+		for replicaIndex := 0; replicaIndex < test.replicas; replicaIndex++ {
+			owned := partitionsForReplica(test.partitions, test.replicas, replicaIndex)
+
+			if fmt.Sprint(owned) != fmt.Sprint(test.expected[replicaIndex]) {
+				t.Errorf("expected replica %d of %d to own %v of %d partitions, got %v", replicaIndex, test.replicas, test.expected[replicaIndex], test.partitions, owned)
+			}
+
+			for _, partition := range owned {
+				owners[partition]++
+			}
+		}
+
+		for partition := 0; partition < test.partitions; partition++ {
+			if owners[partition] != 1 {
+				t.Errorf("expected partition %d of %d to be owned by one of %d replicas, got %d", partition, test.partitions, test.replicas, owners[partition])
+			}
+		}
+	}
+}
+
+func TestPartitionLease(t *testing.T) {
+	redisServer := miniredis.RunT(t)
+	t.Setenv("TRAVIGO_REDIS_ADDRESS", redisServer.Addr())
+	if err := redis_client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(releasePartitionLeases)
+
+	lease, err := tryAcquirePartitionLease(3)
+	if err != nil || lease == nil {
+		t.Fatalf("expected to acquire the free partition, got %v", err)
+	}
+
+	if other, _ := tryAcquirePartitionLease(3); other != nil {
+		t.Fatal("expected the partition to be held by the first lease")
+	}
+	if !lease.renew() || !lease.Held() {
+		t.Fatal("expected the lease to be renewed")
+	}
+
+	// The lease expires without being renewed and another replica takes the partition over
+	redisServer.FastForward(partitionLeaseTTL + time.Second)
+
+	other, _ := tryAcquirePartitionLease(3)
+	if other == nil {
+		t.Fatal("expected the expired partition to be acquired")
+	}
+	if lease.renew() || lease.Held() {
+		t.Error("expected the first lease to be lost")
+	}
+
+	// Releasing the lost lease must not release the new owners
+	lease.Release()
+	if !other.renew() {
+		t.Error("expected the new owner to keep the partition")
+	}
+
+	other.Release()
+	if next, _ := tryAcquirePartitionLease(3); next == nil {
+		t.Error("expected the released partition to be acquired")
+	}
+}
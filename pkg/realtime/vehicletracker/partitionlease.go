@@ -0,0 +1,164 @@
+package vehicletracker
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/redis_client"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const partitionLeaseTTL = 30 * time.Second
+const partitionLeaseRetryInterval = 2 * time.Second
+
+// Only renew or release the lease if we still own it
+var renewPartitionLeaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0
+`)
+var releasePartitionLeaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0
+`)
+
+// partitionLease makes sure a partition is only consumed by one replica at a time, even while replicas are
+// restarting to pick up a new assignment and briefly disagree over who owns what
+type partitionLease struct {
+	partition int
+	key       string
+	token     string
+
+	mutex   sync.Mutex
+	expires time.Time
+	lost    bool
+
+	stop chan struct{}
+}
+
+var heldPartitionLeases []*partitionLease
+var heldPartitionLeasesMutex sync.Mutex
+
+func partitionLeaseKey(partition int) string {
+	return fmt.Sprintf("%s-partition-lease/%d", realtimeQueueName, partition)
+}
+
+func tryAcquirePartitionLease(partition int) (*partitionLease, error) {
+	lease := &partitionLease{
+		partition: partition,
+		key:       partitionLeaseKey(partition),
+		token:     primitive.NewObjectID().Hex(),
+		stop:      make(chan struct{}),
+	}
+
+	acquiredAt := time.Now()
+	acquired, err := redis_client.Client.SetNX(context.Background(), lease.key, lease.token, partitionLeaseTTL).Result()
+	if err != nil || !acquired {
+		return nil, err
+	}
+	lease.expires = acquiredAt.Add(partitionLeaseTTL)
+
+	heldPartitionLeasesMutex.Lock()
+	heldPartitionLeases = append(heldPartitionLeases, lease)
+	heldPartitionLeasesMutex.Unlock()
+
+	return lease, nil
+}
+
+// acquirePartitionLease waits until the partition is free, the previous owner releases it when it shuts down
+// or it expires if the previous owner died
+func acquirePartitionLease(partition int) *partitionLease {
+	for {
+		lease, err := tryAcquirePartitionLease(partition)
+		if err != nil {
+			log.Error().Err(err).Int("partition", partition).Msg("Failed to acquire realtime partition lease")
+		} else if lease != nil {
+			return lease
+		} else {
+			log.Info().Int("partition", partition).Msg("Realtime partition is still leased to another replica, waiting")
+		}
+
+		time.Sleep(partitionLeaseRetryInterval)
+	}
+}
+
+// keepRenewing renews the lease until it's released, calling onLost if another replica takes it over or it
+// couldn't be renewed before it expired
+func (l *partitionLease) keepRenewing(onLost func(*partitionLease)) {
+	ticker := time.NewTicker(partitionLeaseTTL / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if !l.renew() && !l.Held() {
+				onLost(l)
+				return
+			}
+		}
+	}
+}
+
+// renew extends the lease, returning false if the renewal failed
+func (l *partitionLease) renew() bool {
+	renewedAt := time.Now()
+	renewed, err := renewPartitionLeaseScript.Run(context.Background(), redis_client.Client, []string{l.key}, l.token, partitionLeaseTTL.Milliseconds()).Int()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err != nil {
+		log.Error().Err(err).Int("partition", l.partition).Msg("Failed to renew realtime partition lease")
+		return false
+	}
+	if renewed == 0 {
+		l.lost = true
+		return false
+	}
+
+	l.expires = renewedAt.Add(partitionLeaseTTL)
+
+	return true
+}
+
+// Held reports whether this replica can still consume the partition
+func (l *partitionLease) Held() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return !l.lost && time.Now().Before(l.expires)
+}
+
+func (l *partitionLease) Release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	select {
+	case <-l.stop:
+		return
+	default:
+		close(l.stop)
+	}
+
+	releasePartitionLeaseScript.Run(context.Background(), redis_client.Client, []string{l.key}, l.token)
+	l.lost = true
+}
+
+func releasePartitionLeases() {
+	heldPartitionLeasesMutex.Lock()
+	defer heldPartitionLeasesMutex.Unlock()
+
+	for _, lease := range heldPartitionLeases {
+		lease.Release()
+	}
+	heldPartitionLeases = nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/ctdf"
 	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -28,6 +29,7 @@ func (consumer *BatchConsumer) updateRealtimeJourney(journeyID string, vehicleUp
 		{Key: "journey.departuretimezone", Value: 1},
 		{Key: "nextstopref", Value: 1},
 		{Key: "offset", Value: 1},
+		{Key: "delaythreshold", Value: 1},
 	})
 
 	realtimeJourneysCollection := database.GetCollection("realtime_journeys")
@@ -261,7 +263,7 @@ func (consumer *BatchConsumer) updateRealtimeJourney(journeyID string, vehicleUp
 		}
 
 		closestPathTime := 9999999 * time.Minute
-		now := time.Now()
+		now := util.Now()
 		realtimeTimeframe, err := time.Parse("2006-01-02", vehicleUpdateEvent.VehicleLocationUpdate.Timeframe)
 
 		journeyTimezone, _ := time.LoadLocation(realtimeJourney.Journey.DepartureTimezone)
@@ -335,6 +337,12 @@ func (consumer *BatchConsumer) updateRealtimeJourney(journeyID string, vehicleUp
 		updateMap["offset"] = offset
 	}
 
+	// Only written when a threshold is crossed so dbwatch isn't woken up by every position update
+	delayThreshold := ctdf.GetDelayThreshold(offset, consumer.DelayThresholds)
+	if delayThreshold != realtimeJourney.DelayThreshold || newRealtimeJourney {
+		updateMap["delaythreshold"] = delayThreshold
+	}
+
 	if realtimeJourney.NextStopRef != closestDistanceJourneyPath.DestinationStopRef {
 		journeyStopUpdates[realtimeJourney.NextStopRef] = &ctdf.RealtimeJourneyStops{
 			StopRef:  realtimeJourney.NextStopRef,
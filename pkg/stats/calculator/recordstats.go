@@ -1,9 +1,63 @@
 package calculator
 
-import "time"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/travigo/travigo/pkg/elastic_client"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
 
 type RecordStatsData struct {
 	Type      string `json:"-"`
 	Stats     interface{}
 	Timestamp time.Time
 }
+
+// RecordStats calculates the stats for the object type and stores them in Mongo & Elasticsearch
+func RecordStats(objectName string) error {
+	var statsData interface{}
+
+	switch objectName {
+	case "services":
+		statsData = GetServices()
+	case "operators":
+		statsData = GetOperators()
+	case "stops":
+		statsData = GetStops()
+	case "servicealerts":
+		statsData = GetServiceAlerts()
+	case "realtimejourneys":
+		statsData = GetRealtimeJourneys()
+	default:
+		return errors.New(fmt.Sprintf("Unknown type %s", objectName))
+	}
+
+	log.Info().Str("type", objectName).Interface("stats", statsData).Msg("Calculated")
+
+	recordStatsData := RecordStatsData{
+		Type:      objectName,
+		Stats:     statsData,
+		Timestamp: time.Now(),
+	}
+
+	// Add to Mongo
+	statsCollection := database.GetCollection("stats")
+	_, err := statsCollection.UpdateOne(context.Background(), bson.M{"type": objectName}, bson.M{"$set": recordStatsData}, options.Update().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+
+	// Publish stats to Elasticsearch
+	elasticEvent, _ := json.Marshal(recordStatsData)
+	elastic_client.IndexRequest("overall-stats-1", bytes.NewReader(elasticEvent))
+
+	return nil
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"strings"
 
+	"github.com/travigo/travigo/pkg/database"
+
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func CountAggregate(collection *mongo.Collection, aggregateKey string) map[string]int {
+func CountAggregate(collection database.Collection, aggregateKey string) map[string]int {
 	countMap := map[string]int{}
 
 	aggregation := mongo.Pipeline{
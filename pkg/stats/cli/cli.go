@@ -1,11 +1,7 @@
 package cli
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"strings"
-	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/travigo/travigo/pkg/database"
@@ -13,8 +9,6 @@ import (
 	"github.com/travigo/travigo/pkg/stats/calculator"
 	"github.com/travigo/travigo/pkg/stats/web_api"
 	"github.com/urfave/cli/v2"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func RegisterCLI() *cli.Command {
@@ -68,39 +62,9 @@ func RegisterCLI() *cli.Command {
 					for _, objectName := range objectNames {
 						log.Info().Str("type", objectName).Msg("Updating stats")
 
-						var statsData interface{}
-
-						switch objectName {
-						case "services":
-							statsData = calculator.GetServices()
-						case "operators":
-							statsData = calculator.GetOperators()
-						case "stops":
-							statsData = calculator.GetStops()
-						case "servicealerts":
-							statsData = calculator.GetServiceAlerts()
-						case "realtimejourneys":
-							statsData = calculator.GetRealtimeJourneys()
-						default:
-							log.Error().Str("type", objectName).Msg("Unknown type")
-							continue
-						}
-
-						log.Info().Str("type", objectName).Interface("stats", statsData).Msg("Calculated")
-
-						recordStatsData := calculator.RecordStatsData{
-							Type:      objectName,
-							Stats:     statsData,
-							Timestamp: time.Now(),
+						if err := calculator.RecordStats(objectName); err != nil {
+							log.Error().Err(err).Str("type", objectName).Msg("Failed to update stats")
 						}
-
-						// Add to Mongo
-						statsCollection := database.GetCollection("stats")
-						statsCollection.UpdateOne(context.Background(), bson.M{"type": objectName}, bson.M{"$set": recordStatsData}, options.Update().SetUpsert(true))
-
-						// Publish stats to Elasticsearch
-						elasticEvent, _ := json.Marshal(recordStatsData)
-						elastic_client.IndexRequest("overall-stats-1", bytes.NewReader(elasticEvent))
 					}
 
 					return nil
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/travigo/travigo/pkg/dataimporter/importruns"
+	"github.com/travigo/travigo/pkg/dataimporter/manager"
+)
+
+// MetricsRoute serves the dataset import metrics for Prometheus
+func MetricsRoute() fiber.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(importruns.NewCollector(manager.GetRegisteredDataSets()))
+
+	return adaptor.HTTPHandler(promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+}
@@ -17,5 +17,7 @@ func SetupServer(listen string) {
 
 	group.Get("calculated", routes.CalculatedRoute)
 
+	webApp.Get("/metrics", routes.MetricsRoute())
+
 	webApp.Listen(listen)
 }
@@ -0,0 +1,128 @@
+package transforms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const backfillBatchSize = 1000
+
+// Backfill applies the current import stage definitions to the records of a type already in the database,
+// so changes to the definitions don't need a re-import to take effect. Each record is transformed with the
+// group of the dataset it came from, the same as the importers do, & only records that changed are written back.
+// Returns the number of records updated.
+func Backfill(typeName string, datasetID string, dryRun bool) (int, error) {
+	recordType, exists := recordTypes[typeName]
+	if !exists || recordType.Collection == "" {
+		return 0, errors.New(fmt.Sprintf("%s records can't be backfilled", typeName))
+	}
+
+	collection := database.GetCollection(recordType.Collection)
+
+	query := bson.M{}
+	if datasetID != "" {
+		query["datasource.datasetid"] = datasetID
+	}
+
+	cursor, err := collection.Find(context.Background(), query)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.Background())
+
+	var updated int
+	var checked int
+	var operations []mongo.WriteModel
+
+	writeOperations := func() error {
+		if len(operations) == 0 || dryRun {
+			operations = nil
+			return nil
+		}
+
+		_, err := collection.BulkWrite(context.Background(), operations, options.BulkWrite().SetOrdered(false))
+		operations = nil
+
+		return err
+	}
+
+	for cursor.Next(context.Background()) {
+		checked++
+
+		var reference struct {
+			PrimaryIdentifier string
+			Identifier        string
+			DataSource        *ctdf.DataSourceReference
+		}
+		if err := cursor.Decode(&reference); err != nil {
+			return updated, err
+		}
+
+		record := recordType.New()
+		if err := cursor.Decode(record); err != nil {
+			return updated, err
+		}
+
+		before, err := bson.Marshal(record)
+		if err != nil {
+			return updated, err
+		}
+
+		var group string
+		if reference.DataSource != nil {
+			group = reference.DataSource.DatasetID
+		}
+
+		if TransformImport(record, recordType.Depth, group) == 0 {
+			continue
+		}
+
+		after, err := bson.Marshal(record)
+		if err != nil {
+			return updated, err
+		}
+		if bytes.Equal(before, after) {
+			continue
+		}
+
+		filter := bson.M{"primaryidentifier": reference.PrimaryIdentifier}
+		if reference.PrimaryIdentifier == "" {
+			filter = bson.M{"identifier": reference.Identifier}
+		}
+
+		bsonRep, _ := bson.Marshal(bson.M{"$set": record})
+		updateModel := mongo.NewUpdateOneModel()
+		updateModel.SetFilter(filter)
+		updateModel.SetUpdate(bsonRep)
+		operations = append(operations, updateModel)
+		updated++
+
+		if len(operations) >= backfillBatchSize {
+			if err := writeOperations(); err != nil {
+				return updated, err
+			}
+
+			log.Info().Str("type", typeName).Int("checked", checked).Int("updated", updated).Msg("Backfilling transforms")
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+
+	if err := writeOperations(); err != nil {
+		return updated, err
+	}
+
+	log.Info().Str("type", typeName).Int("checked", checked).Int("updated", updated).Bool("dryrun", dryRun).Msg("Backfilled transforms")
+
+	return updated, nil
+}
@@ -0,0 +1,63 @@
+package transforms
+
+import (
+	"context"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestBackfill(t *testing.T) {
+	database.ConnectMemory()
+
+	setTestTransforms(t, []TransformDefinition{
+		{Type: "ctdf.Service", Stage: TransformStageImport, Group: "backfill-dataset", Match: map[string]string{"OperatorRef": "gb-noc-ABLO"}, Data: map[string]interface{}{"OperatorRef": "gb-noc-TFLO"}},
+		{Type: "ctdf.Service", Stage: TransformStageImport, Match: map[string]string{"ServiceName": "N1"}, Data: map[string]interface{}{"BrandColour": "#000000"}},
+	})
+
+	for _, service := range []ctdf.Service{
+		{PrimaryIdentifier: "remapped", OperatorRef: "gb-noc-ABLO", DataSource: &ctdf.DataSourceReference{DatasetID: "backfill-dataset"}},
+		{PrimaryIdentifier: "other-group", OperatorRef: "gb-noc-ABLO", DataSource: &ctdf.DataSourceReference{DatasetID: "other-dataset"}},
+		{PrimaryIdentifier: "branded", ServiceName: "N1", OperatorRef: "gb-noc-TEST", DataSource: &ctdf.DataSourceReference{DatasetID: "backfill-dataset"}},
+		// Matches but the transform doesn't change anything so isn't written back
+		{PrimaryIdentifier: "unchanged", ServiceName: "N1", OperatorRef: "gb-noc-TEST", BrandColour: "#000000", DataSource: &ctdf.DataSourceReference{DatasetID: "other-dataset"}},
+	} {
+		database.GetCollection("services").InsertOne(context.Background(), service)
+	}
+
+	for _, test := range []struct {
+		name      string
+		datasetID string
+		dryRun    bool
+		updated   int
+		services  map[string]string
+	}{
+		{"dry run", "", true, 2, map[string]string{"remapped": "gb-noc-ABLO/", "other-group": "gb-noc-ABLO/", "branded": "gb-noc-TEST/", "unchanged": "gb-noc-TEST/#000000"}},
+		{"single dataset", "other-dataset", false, 0, map[string]string{"remapped": "gb-noc-ABLO/", "other-group": "gb-noc-ABLO/", "branded": "gb-noc-TEST/", "unchanged": "gb-noc-TEST/#000000"}},
+		{"every dataset", "", false, 2, map[string]string{"remapped": "gb-noc-TFLO/", "other-group": "gb-noc-ABLO/", "branded": "gb-noc-TEST/#000000", "unchanged": "gb-noc-TEST/#000000"}},
+		{"already backfilled", "", false, 0, map[string]string{"remapped": "gb-noc-TFLO/", "other-group": "gb-noc-ABLO/", "branded": "gb-noc-TEST/#000000", "unchanged": "gb-noc-TEST/#000000"}},
+	} {
+		updated, err := Backfill("ctdf.Service", test.datasetID, test.dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated != test.updated {
+			t.Errorf("%s: expected %d updated, got %d", test.name, test.updated, updated)
+		}
+
+		for identifier, expected := range test.services {
+			var service ctdf.Service
+			database.GetCollection("services").FindOne(context.Background(), bson.M{"primaryidentifier": identifier}).Decode(&service)
+
+			if actual := service.OperatorRef + "/" + service.BrandColour; actual != expected {
+				t.Errorf("%s: expected %s to be %s, got %s", test.name, identifier, expected, actual)
+			}
+		}
+	}
+
+	if _, err := Backfill("ctdf.JourneyDetailedRail", "", false); err == nil {
+		t.Error("expected types without a collection to fail")
+	}
+}
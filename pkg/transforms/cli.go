@@ -0,0 +1,217 @@
+package transforms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+	"github.com/travigo/travigo/pkg/database"
+	"github.com/urfave/cli/v2"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Record types that can be tested or backfilled, the collection they're stored in & the depth the importers transform them to
+var recordTypes = map[string]struct {
+	New        func() interface{}
+	Collection string
+	Depth      int
+}{
+	"ctdf.Operator":            {func() interface{} { return &ctdf.Operator{} }, "operators", 1},
+	"ctdf.OperatorGroup":       {func() interface{} { return &ctdf.OperatorGroup{} }, "operator_groups", 1},
+	"ctdf.Stop":                {func() interface{} { return &ctdf.Stop{} }, "stops", 3},
+	"ctdf.StopGroup":           {func() interface{} { return &ctdf.StopGroup{} }, "stop_groups", 3},
+	"ctdf.Service":             {func() interface{} { return &ctdf.Service{} }, "services", 1},
+	"ctdf.Journey":             {func() interface{} { return &ctdf.Journey{} }, "journeys", 1},
+	"ctdf.JourneyDetailedRail": {func() interface{} { return &ctdf.JourneyDetailedRail{} }, "", 0},
+}
+
+func RegisterCLI() *cli.Command {
+	return &cli.Command{
+		Name:  "transforms",
+		Usage: "Check & backfill the transform definitions in data/transforms",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "test",
+				Usage: "Show which transform definitions match a record & the record once they're applied",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "type",
+						Usage:    "Type of the record eg. ctdf.Service",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "record",
+						Usage: "Record as JSON",
+					},
+					&cli.StringFlag{
+						Name:  "identifier",
+						Usage: "Primary identifier of a record to load from the database instead",
+					},
+					&cli.StringSliceFlag{
+						Name:  "group",
+						Usage: "Groups to apply as well as the ungrouped definitions, importers use their dataset identifier",
+					},
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "List the definitions for the type that didn't match as well",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					recordType, exists := recordTypes[c.String("type")]
+					if !exists {
+						return errors.New(fmt.Sprintf("Unknown type %s", c.String("type")))
+					}
+
+					record := recordType.New()
+
+					if c.String("record") != "" {
+						if err := json.Unmarshal([]byte(c.String("record")), record); err != nil {
+							return err
+						}
+					} else if c.String("identifier") != "" {
+						if recordType.Collection == "" {
+							return errors.New(fmt.Sprintf("%s records can't be loaded by identifier", c.String("type")))
+						}
+
+						if err := database.Connect(); err != nil {
+							return err
+						}
+
+						query := bson.M{"$or": bson.A{
+							bson.M{"primaryidentifier": c.String("identifier")},
+							bson.M{"identifier": c.String("identifier")},
+						}}
+						if err := database.GetCollection(recordType.Collection).FindOne(context.Background(), query).Decode(record); err != nil {
+							return err
+						}
+					} else {
+						return errors.New("One of --record or --identifier is required")
+					}
+
+					TestRecord(os.Stdout, c.String("type"), record, c.StringSlice("group"), c.Bool("all"))
+
+					output, err := json.MarshalIndent(record, "", "  ")
+					if err != nil {
+						return err
+					}
+					fmt.Println(string(output))
+
+					return nil
+				},
+			},
+			{
+				Name:  "backfill",
+				Usage: "Apply the import transform definitions to records already in the database without re-importing them",
+				Flags: []cli.Flag{
+					&cli.StringSliceFlag{
+						Name:  "type",
+						Usage: "Types of record to backfill, defaults to every type stored in the database",
+					},
+					&cli.StringFlag{
+						Name:  "dataset",
+						Usage: "Only backfill the records from this dataset",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Report how many records would change without writing anything",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if err := database.Connect(); err != nil {
+						return err
+					}
+
+					typeNames := c.StringSlice("type")
+					if len(typeNames) == 0 {
+						// Services before journeys as journeys are imported with their service's transformed operator
+						typeNames = []string{"ctdf.Operator", "ctdf.OperatorGroup", "ctdf.Stop", "ctdf.StopGroup", "ctdf.Service", "ctdf.Journey"}
+					}
+
+					for _, typeName := range typeNames {
+						updated, err := Backfill(typeName, c.String("dataset"), c.Bool("dry-run"))
+						if err != nil {
+							return err
+						}
+
+						fmt.Printf("%s: %d records updated\n", typeName, updated)
+					}
+
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// TestRecord applies the import & presentation definitions for the type to the record in the order they would run,
+// writing out the definitions that matched & whether they were applied
+func TestRecord(writer io.Writer, typeName string, record interface{}, groups []string, showAll bool) {
+	recordValue := reflect.ValueOf(record).Elem()
+
+	importDefinitions := getDefinitions(TransformStageImport, append([]string{""}, groups...))[typeName]
+	presentationDefinitions := getDefinitions(TransformStagePresentation, []string{""})[typeName]
+
+	tableWriter := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tableWriter, "STAGE\tGROUP\tPRIORITY\tMATCHED\tAPPLIED\tSOURCE\tMATCH")
+
+	writeRow := func(transformDef *TransformDefinition, matched bool, applied bool) {
+		if !matched && !showAll {
+			return
+		}
+
+		fmt.Fprintf(tableWriter, "%s\t%s\t%d\t%t\t%t\t%s\t%s\n",
+			transformDef.GetStage(), transformDef.Group, transformDef.Priority, matched, applied, transformDef.Source, transformDef.matchSummary())
+	}
+
+	for _, stageDefinitions := range [][]*TransformDefinition{importDefinitions, presentationDefinitions} {
+		for _, transformDef := range stageDefinitions {
+			matched := transformDef.matches(recordValue)
+			if matched {
+				handleSubDocument(recordValue, transformDef.Data)
+			}
+
+			writeRow(transformDef, matched, matched)
+		}
+	}
+
+	// Definitions for other groups are checked against the final record but never applied
+	for i := range transforms {
+		transformDef := &transforms[i]
+
+		if transformDef.Type != typeName || slices.Contains(importDefinitions, transformDef) || slices.Contains(presentationDefinitions, transformDef) {
+			continue
+		}
+
+		writeRow(transformDef, transformDef.matches(recordValue), false)
+	}
+
+	tableWriter.Flush()
+}
+
+// matchSummary describes the predicates so a definition can be found in its source file
+func (t *TransformDefinition) matchSummary() string {
+	var predicates []string
+
+	for key, value := range t.Match {
+		predicates = append(predicates, fmt.Sprintf("%s=%s", key, value))
+	}
+	for key, value := range t.MatchRegex {
+		predicates = append(predicates, fmt.Sprintf("%s~%s", key, value))
+	}
+	sort.Strings(predicates)
+
+	if t.MatchExpression != "" {
+		predicates = append(predicates, t.MatchExpression)
+	}
+
+	return strings.Join(predicates, " ")
+}
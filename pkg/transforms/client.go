@@ -2,8 +2,12 @@ package transforms
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/rs/zerolog/log"
 	"gopkg.in/yaml.v3"
@@ -11,6 +15,9 @@ import (
 
 var transforms []TransformDefinition
 
+// Definitions for each stage & group combination, see getDefinitions
+var definitionsCache sync.Map
+
 func SetupClient() {
 	err := filepath.Walk("data/transforms/",
 		func(path string, fileInfo os.FileInfo, err error) error {
@@ -35,9 +42,26 @@ func SetupClient() {
 				decoder := yaml.NewDecoder(bytes.NewReader(transformYaml))
 
 				for {
-					var transformDefinition TransformDefinition
-					if decoder.Decode(&transformDefinition) != nil {
+					var document yaml.Node
+					if err := decoder.Decode(&document); err == io.EOF {
 						break
+					} else if err != nil {
+						return errors.New(fmt.Sprintf("%s: %s", path, err))
+					}
+
+					// Empty documents eg. from a trailing ---
+					if len(document.Content) == 0 || document.Content[0].Tag == "!!null" {
+						continue
+					}
+
+					var transformDefinition TransformDefinition
+					if err := document.Decode(&transformDefinition); err != nil {
+						return errors.New(fmt.Sprintf("%s: %s", path, err))
+					}
+
+					transformDefinition.Source = path
+					if err := transformDefinition.compile(); err != nil {
+						return errors.New(fmt.Sprintf("%s: %s", path, err))
 					}
 
 					transforms = append(transforms, transformDefinition)
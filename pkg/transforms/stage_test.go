@@ -0,0 +1,113 @@
+package transforms
+
+import (
+	"os"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func setTestTransforms(t *testing.T, definitions []TransformDefinition) {
+	for i := range definitions {
+		if err := definitions[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	transforms = definitions
+	definitionsCache.Clear()
+
+	t.Cleanup(func() {
+		transforms = nil
+		definitionsCache.Clear()
+	})
+}
+
+func TestTransformImport(t *testing.T) {
+	setTestTransforms(t, []TransformDefinition{
+		// Defined out of order so the priority has to put the remap first
+		{Type: "ctdf.Service", Stage: TransformStageImport, Priority: 20, Match: map[string]string{"OperatorRef": "gb-noc-TFLO"}, Data: map[string]interface{}{"BrandColour": "#dc241f"}},
+		{Type: "ctdf.Service", Stage: TransformStageImport, Group: "test-dataset", Priority: 10, Match: map[string]string{"OperatorRef": "gb-noc-ABLO"}, Data: map[string]interface{}{"OperatorRef": "gb-noc-TFLO"}},
+		{Type: "ctdf.Service", Stage: TransformStageImport, Group: "other-dataset", Match: map[string]string{"OperatorRef": "gb-noc-ABLO"}, Data: map[string]interface{}{"BrandIcon": "other"}},
+		{Type: "ctdf.Service", Match: map[string]string{"OperatorRef": "gb-noc-ABLO"}, Data: map[string]interface{}{"BrandIcon": "presentation"}},
+		// The same priority keeps the order they were loaded in
+		{Type: "ctdf.Service", Stage: TransformStageImport, Match: map[string]string{"ServiceName": "1"}, Data: map[string]interface{}{"BrandDisplayMode": "first"}},
+		{Type: "ctdf.Service", Stage: TransformStageImport, Match: map[string]string{"ServiceName": "1"}, Data: map[string]interface{}{"BrandDisplayMode": "second"}},
+	})
+
+	for _, test := range []struct {
+		name    string
+		groups  []string
+		service ctdf.Service
+		applied int
+		result  ctdf.Service
+	}{
+		{
+			"remapped then branded", []string{"test-dataset"},
+			ctdf.Service{OperatorRef: "gb-noc-ABLO"},
+			2, ctdf.Service{OperatorRef: "gb-noc-TFLO", BrandColour: "#dc241f"},
+		},
+		{
+			"other group isn't remapped", []string{"another-dataset"},
+			ctdf.Service{OperatorRef: "gb-noc-ABLO"},
+			0, ctdf.Service{OperatorRef: "gb-noc-ABLO"},
+		},
+		{
+			"ungrouped apply to every dataset", nil,
+			ctdf.Service{OperatorRef: "gb-noc-TFLO"},
+			1, ctdf.Service{OperatorRef: "gb-noc-TFLO", BrandColour: "#dc241f"},
+		},
+		{
+			"same priority in load order", nil,
+			ctdf.Service{ServiceName: "1"},
+			2, ctdf.Service{ServiceName: "1", BrandDisplayMode: "second"},
+		},
+	} {
+		service := test.service
+
+		if applied := TransformImport(&service, 1, test.groups...); applied != test.applied {
+			t.Errorf("%s: expected %d transforms applied, got %d", test.name, test.applied, applied)
+		}
+		if service.OperatorRef != test.result.OperatorRef || service.BrandColour != test.result.BrandColour ||
+			service.BrandIcon != test.result.BrandIcon || service.BrandDisplayMode != test.result.BrandDisplayMode {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.result, service)
+		}
+	}
+
+	// Presentation transforms are only applied when returned from the API
+	service := ctdf.Service{OperatorRef: "gb-noc-ABLO"}
+	Transform(&service, 1)
+	if service.BrandIcon != "presentation" || service.OperatorRef != "gb-noc-ABLO" {
+		t.Errorf("expected only the presentation transform to apply, got %+v", service)
+	}
+}
+
+func TestTransformImportDefinitions(t *testing.T) {
+	// The definitions are loaded relative to the root of the repository
+	workingDirectory, _ := os.Getwd()
+	if err := os.Chdir("../.."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(workingDirectory) })
+
+	setTestTransforms(t, nil)
+	SetupClient()
+
+	for _, test := range []struct {
+		name        string
+		group       string
+		operatorRef string
+		serviceName string
+		brandColour string
+	}{
+		{"TfL service", "", "gb-noc-TFLO", "Bakerloo", "#994f14"},
+		{"BODS operator remapped to TfL", "gb-dft-bods-gtfs-schedule", "gb-noc-ABLO", "Bakerloo", "#994f14"},
+	} {
+		service := ctdf.Service{OperatorRef: test.operatorRef, ServiceName: test.serviceName}
+		TransformImport(&service, 1, test.group)
+
+		if service.OperatorRef != "gb-noc-TFLO" || service.BrandColour != test.brandColour {
+			t.Errorf("%s: expected to be branded %s, got %+v", test.name, test.brandColour, service)
+		}
+	}
+}
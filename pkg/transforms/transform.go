@@ -1,68 +1,149 @@
 package transforms
 
 import (
+	"errors"
+	"fmt"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// TransformStage is when a transform definition is applied to records
+type TransformStage string
+
+const (
+	// Applied when records are imported or linked so the transformed values are stored in the database
+	TransformStageImport TransformStage = "import"
+	// Applied to records as they're returned from the API, the default
+	TransformStagePresentation TransformStage = "presentation"
 )
 
 type TransformDefinition struct {
-	Type  string                 `yaml:"Type"`
-	Group string                 `yaml:"Group"`
-	Match map[string]string      `yaml:"Match"`
-	Data  map[string]interface{} `yaml:"Data"`
+	Type  string         `yaml:"Type"`
+	Group string         `yaml:"Group"`
+	Stage TransformStage `yaml:"Stage"`
+	// Definitions are applied in ascending priority so higher priority ones override lower ones,
+	// those with the same priority are applied in the order they were loaded
+	Priority int `yaml:"Priority"`
+
+	// Field values that must be equal, nested fields are separated by dots eg. Service.OperatorRef
+	Match map[string]string `yaml:"Match"`
+	// Field values that must match the regular expressions, with the same field names as Match
+	MatchRegex map[string]string `yaml:"MatchRegex"`
+	// expr-lang expression evaluated against the record eg. `ServiceName startsWith "N" && len(Routes) > 1`
+	MatchExpression string `yaml:"MatchExpression"`
+
+	Data map[string]interface{} `yaml:"Data"`
+
+	// File the definition was loaded from
+	Source string `yaml:"-"`
+
+	matchRegex   map[string]*regexp.Regexp
+	matchProgram *vm.Program
+}
+
+func (t *TransformDefinition) GetStage() TransformStage {
+	if t.Stage == "" {
+		return TransformStagePresentation
+	}
+
+	return t.Stage
 }
 
-func (t *TransformDefinition) Transform(inputTypeOf reflect.Type, inputValue reflect.Value, depth int) {
-	isMatch := true
+// compile parses the regex & expression predicates so they're only checked once when the definitions are loaded,
+// expressions are type checked against the record type so unknown fields & mismatched types fail here
+func (t *TransformDefinition) compile() error {
+	recordType, exists := recordTypes[t.Type]
+	if !exists {
+		return errors.New(fmt.Sprintf("Unknown Type %s", t.Type))
+	}
+
+	t.matchRegex = map[string]*regexp.Regexp{}
+	for key, value := range t.MatchRegex {
+		regex, err := regexp.Compile(value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid MatchRegex for %s: %s", key, err))
+		}
 
-	if !inputValue.IsValid() {
-		return
+		t.matchRegex[key] = regex
 	}
 
-	if depth < 0 {
-		return
+	if t.MatchExpression != "" {
+		program, err := expr.Compile(t.MatchExpression, expr.Env(recordType.New()), expr.AsBool())
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid MatchExpression: %s", err))
+		}
+
+		t.matchProgram = program
 	}
 
-	// Only check values and try and replace them if the types match the transform def
-	inputTypeName := strings.Replace(inputTypeOf.String(), "*", "", 1)
+	return nil
+}
 
-	if inputTypeName == t.Type {
-		for key, value := range t.Match {
-			field := inputValue.FieldByName(key)
-			if field.IsValid() {
-				if value != field.String() {
-					isMatch = false
-				}
-			} else {
-				isMatch = false
-			}
+func (t *TransformDefinition) matches(inputValue reflect.Value) bool {
+	for key, value := range t.Match {
+		field, exists := fieldByPath(inputValue, key)
+		if !exists || value != fieldString(field) {
+			return false
 		}
+	}
 
-		// If we match then go over and update the values
-		if isMatch {
-			// pretty.Println(inputValue, t.Data)
-			handleSubDocument(inputValue, t.Data)
+	for key, regex := range t.matchRegex {
+		field, exists := fieldByPath(inputValue, key)
+		if !exists || !regex.MatchString(fieldString(field)) {
+			return false
 		}
 	}
 
-	// Go through all the fields and try and run transform against anymore structs/slices
-	for i := 0; i < inputValue.NumField(); i++ {
-		valueField := inputValue.Field(i)
-		typeField := inputValue.Type().Field(i)
+	if t.matchProgram != nil {
+		// An expression that can't be evaluated (eg. on a nil field) isn't a match
+		output, err := expr.Run(t.matchProgram, inputValue.Addr().Interface())
+		if err != nil || output != true {
+			return false
+		}
+	}
 
-		valueTypeKind := typeField.Type.Kind()
-		if valueTypeKind == reflect.Pointer {
-			valueType := reflect.Indirect(valueField)
-			if !valueType.IsValid() {
-				continue
+	return true
+}
+
+// fieldByPath finds a dot separated field through structs, pointers & string keyed maps
+func fieldByPath(value reflect.Value, path string) (reflect.Value, bool) {
+	for _, name := range strings.Split(path, ".") {
+		value = reflect.Indirect(value)
+
+		switch value.Kind() {
+		case reflect.Struct:
+			value = value.FieldByName(name)
+		case reflect.Map:
+			if value.Type().Key().Kind() != reflect.String {
+				return reflect.Value{}, false
 			}
-			valueTypeKind = valueType.Type().Kind()
+			value = value.MapIndex(reflect.ValueOf(name).Convert(value.Type().Key()))
+		default:
+			return reflect.Value{}, false
 		}
 
-		if valueTypeKind == reflect.Slice || valueTypeKind == reflect.Struct {
-			Transform(valueField.Interface(), depth-1)
+		if !value.IsValid() || !value.CanInterface() {
+			return reflect.Value{}, false
 		}
 	}
+
+	value = reflect.Indirect(value)
+
+	return value, value.IsValid()
+}
+
+func fieldString(value reflect.Value) string {
+	if value.Kind() == reflect.String {
+		return value.String()
+	}
+
+	return fmt.Sprint(value.Interface())
 }
 
 func handleSubDocument(inputValue reflect.Value, data map[string]interface{}) {
@@ -112,35 +193,119 @@ func handleSubDocument2(field reflect.Value, valueOf reflect.Value, data map[str
 	}
 }
 
+// Transform applies the presentation transforms in the groups (or the ungrouped ones when there are none)
+// to the input as it's returned from the API
 func Transform(input interface{}, depth int, groups ...string) {
-	inputTypeOf := reflect.TypeOf(input)
-	inputValueOf := reflect.ValueOf(input)
+	if len(groups) == 0 {
+		groups = []string{""}
+	}
 
-	// TODO just supporting 1 group atm
-	group := ""
-	if len(groups) == 1 {
-		group = groups[0]
+	transformInput(getDefinitions(TransformStagePresentation, groups), input, depth)
+}
+
+// TransformImport applies the ungrouped import transforms & the ones in the groups to a record before
+// it's stored, returns the number of transforms applied. Importers use their dataset identifier as the group
+func TransformImport(input interface{}, depth int, groups ...string) int {
+	return transformInput(getDefinitions(TransformStageImport, append([]string{""}, groups...)), input, depth)
+}
+
+// getDefinitions returns the definitions for the stage & groups by type name, in the order they're applied
+func getDefinitions(stage TransformStage, groups []string) map[string][]*TransformDefinition {
+	cacheKey := fmt.Sprintf("%s/%s", stage, strings.Join(groups, ","))
+	if definitions, exists := definitionsCache.Load(cacheKey); exists {
+		return definitions.(map[string][]*TransformDefinition)
+	}
+
+	definitions := map[string][]*TransformDefinition{}
+	for i := range transforms {
+		transformDef := &transforms[i]
+
+		if transformDef.GetStage() == stage && slices.Contains(groups, transformDef.Group) {
+			definitions[transformDef.Type] = append(definitions[transformDef.Type], transformDef)
+		}
 	}
 
+	for _, typeDefinitions := range definitions {
+		sort.SliceStable(typeDefinitions, func(i, j int) bool {
+			return typeDefinitions[i].Priority < typeDefinitions[j].Priority
+		})
+	}
+
+	definitionsCache.Store(cacheKey, definitions)
+
+	return definitions
+}
+
+func transformInput(definitions map[string][]*TransformDefinition, input interface{}, depth int) int {
+	if len(definitions) == 0 || input == nil {
+		return 0
+	}
+
+	inputTypeOf := reflect.TypeOf(input)
+	inputValueOf := reflect.ValueOf(input)
+
 	if inputTypeOf.Kind() == reflect.Slice {
+		var applied int
 		for i := 0; i < inputValueOf.Len(); i++ {
-			indexInput := inputValueOf.Index(i).Interface()
-			transformValue(reflect.TypeOf(indexInput), reflect.ValueOf(indexInput), depth, group)
+			applied += transformValue(definitions, inputValueOf.Index(i).Interface(), depth)
 		}
-	} else {
-		transformValue(inputTypeOf, inputValueOf, depth, group)
+
+		return applied
 	}
+
+	return transformValue(definitions, input, depth)
 }
 
-func transformValue(inputTypeOf reflect.Type, inputValueOf reflect.Value, depth int, group string) {
-	var inputValue reflect.Value
-	if inputTypeOf.Kind() == reflect.Pointer {
-		inputValue = inputValueOf.Elem()
+func transformValue(definitions map[string][]*TransformDefinition, input interface{}, depth int) int {
+	inputTypeOf := reflect.TypeOf(input)
+	if depth < 0 || inputTypeOf == nil || inputTypeOf.Kind() != reflect.Pointer {
+		return 0
+	}
+
+	inputValue := reflect.ValueOf(input).Elem()
+	if !inputValue.IsValid() || inputValue.Kind() != reflect.Struct {
+		return 0
+	}
+
+	var applied int
+
+	// Only check values and try and replace them if the types match the transform def
+	inputTypeName := strings.Replace(inputTypeOf.String(), "*", "", 1)
+
+	for _, transformDef := range definitions[inputTypeName] {
+		// If we match then go over and update the values
+		if transformDef.matches(inputValue) {
+			handleSubDocument(inputValue, transformDef.Data)
+			applied++
+		}
+	}
+
+	if depth == 0 {
+		return applied
 	}
 
-	for _, transformDef := range transforms {
-		if transformDef.Group == group {
-			transformDef.Transform(inputTypeOf, inputValue, depth)
+	// Go through all the fields and try and run transform against anymore structs/slices
+	for i := 0; i < inputValue.NumField(); i++ {
+		valueField := inputValue.Field(i)
+		typeField := inputValue.Type().Field(i)
+
+		if !typeField.IsExported() {
+			continue
+		}
+
+		valueTypeKind := typeField.Type.Kind()
+		if valueTypeKind == reflect.Pointer {
+			valueType := reflect.Indirect(valueField)
+			if !valueType.IsValid() {
+				continue
+			}
+			valueTypeKind = valueType.Type().Kind()
+		}
+
+		if valueTypeKind == reflect.Slice || valueTypeKind == reflect.Struct {
+			applied += transformInput(definitions, valueField.Interface(), depth-1)
 		}
 	}
+
+	return applied
 }
@@ -0,0 +1,46 @@
+package transforms
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/travigo/travigo/pkg/ctdf"
+)
+
+func TestCompileChecksExpressionsAgainstType(t *testing.T) {
+	for _, test := range []struct {
+		definition TransformDefinition
+		valid      bool
+	}{
+		{TransformDefinition{Type: "ctdf.Service", MatchExpression: `ServiceName startsWith "N" && len(Routes) > 1`}, true},
+		{TransformDefinition{Type: "ctdf.Journey", MatchExpression: `Service.ServiceName startsWith "N"`}, true},
+		{TransformDefinition{Type: "ctdf.Service", MatchExpression: `NotAField == "Rail"`}, false},
+		{TransformDefinition{Type: "ctdf.Service", MatchExpression: `ServiceName`}, false},
+		{TransformDefinition{Type: "ctdf.Service", MatchExpression: `ServiceName > 1`}, false},
+		{TransformDefinition{Type: "ctdf.Unknown", Data: map[string]interface{}{"ServiceName": "A"}}, false},
+	} {
+		err := test.definition.compile()
+		if test.valid && err != nil {
+			t.Errorf("expected %s on %s to compile, got %s", test.definition.MatchExpression, test.definition.Type, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("expected %s on %s to fail to compile", test.definition.MatchExpression, test.definition.Type)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	definition := TransformDefinition{Type: "ctdf.Service", MatchExpression: `ServiceName startsWith "N" && len(Routes) > 1`}
+	if err := definition.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	service := &ctdf.Service{ServiceName: "N29", Routes: []ctdf.Route{{}, {}}}
+	if !definition.matches(reflect.ValueOf(service).Elem()) {
+		t.Error("expected a night service with 2 routes to match")
+	}
+
+	service.Routes = service.Routes[:1]
+	if definition.matches(reflect.ValueOf(service).Elem()) {
+		t.Error("expected a night service with 1 route not to match")
+	}
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+type simulatedClock struct {
+	sync.RWMutex
+
+	enabled bool
+	current time.Time
+	setAt   time.Time
+	speed   float64
+}
+
+var clock = &simulatedClock{}
+
+// Now returns the current time, or the simulated time when replaying recorded data
+func Now() time.Time {
+	clock.RLock()
+	defer clock.RUnlock()
+
+	if !clock.enabled {
+		return time.Now()
+	}
+
+	elapsed := time.Since(clock.setAt)
+
+	return clock.current.Add(time.Duration(float64(elapsed) * clock.speed))
+}
+
+// SetSimulatedTime moves the simulated clock to the given time, after which it advances at speed times real time
+func SetSimulatedTime(current time.Time, speed float64) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.enabled = true
+	clock.current = current
+	clock.setAt = time.Now()
+	clock.speed = speed
+}
+
+func ClearSimulatedTime() {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.enabled = false
+}